@@ -12,12 +12,13 @@ var Commands CommandsConfig
 
 // Struct for commands.yaml
 type CommandsConfig map[string]struct {
-	Clickhouse string `yaml:"clickhouse"`
-	Firebird   string `yaml:"firebird"`
-	Mssql      string `yaml:"mssql"`
-	Mysql      string `yaml:"mysql"`
-	Postgresql string `yaml:"postgresql"`
-	Sqlite3    string `yaml:"sqlite3"`
+	Clickhouse string  `yaml:"clickhouse"`
+	Firebird   string  `yaml:"firebird"`
+	Mssql      string  `yaml:"mssql"`
+	Mysql      string  `yaml:"mysql"`
+	Mariadb    *string `yaml:"mariadb"` // the mysql command when not set
+	Postgresql string  `yaml:"postgresql"`
+	Sqlite3    string  `yaml:"sqlite3"`
 }
 
 // Build SQL command string and args
@@ -30,8 +31,13 @@ func (c CommandsConfig) Command(name string, dbVendor string, identifiers []stri
 	switch dbVendor {
 	case types.DBVendorClickHouse:
 		qry = cmd.Clickhouse
-	case types.DBVendorMySQL, types.DBVendorMariaDB:
+	case types.DBVendorMySQL:
 		qry = cmd.Mysql
+	case types.DBVendorMariaDB:
+		qry = cmd.Mysql
+		if cmd.Mariadb != nil {
+			qry = *cmd.Mariadb
+		}
 	case types.DBVendorMSSQL:
 		qry = cmd.Mssql
 	case types.DBVendorPostgres:
@@ -14,6 +14,7 @@ type Config[T any] struct {
 	Filename string
 	ModTime  time.Time
 	Data     T
+	Optional bool // a missing file is not an error, Data is reset
 }
 
 func New[T any](filename string) Config[T] {
@@ -41,11 +42,16 @@ func LoadYAMLConfig[T any](filename string, target T) (T, error) {
 	return target, nil
 }
 
-// Load config file. The file is only read once unless it is modified.
+// Load config file. The file is only read once unless it is modified. On error, Data is unchanged.
 func (c *Config[T]) Load() (err error) {
 
 	var info os.FileInfo
 	if info, err = os.Stat(c.Filename); err != nil {
+		if c.Optional && os.IsNotExist(err) {
+			c.Data = *new(T)
+			c.ModTime = time.Time{}
+			return nil
+		}
 		return err
 	}
 
@@ -53,10 +59,13 @@ func (c *Config[T]) Load() (err error) {
 		return
 	}
 
-	if c.Data, err = LoadYAMLConfig(c.Filename, c.Data); err != nil {
+	// decode into a new value, so that the entries removed from the file are removed from Data
+	data, err := LoadYAMLConfig(c.Filename, *new(T))
+	if err != nil {
 		return err
 	}
 
+	c.Data = data
 	c.ModTime = info.ModTime()
 	fmt.Printf("config file %v loaded\n", c.Filename)
 	return
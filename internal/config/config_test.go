@@ -0,0 +1,58 @@
+package config
+
+import (
+	"db-portal/internal/types"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLoadRemovedEntries(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "types.yaml")
+	write := func(content string, modTime time.Time) {
+		if err := os.WriteFile(filename, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filename, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := New[TypesConfig](filename)
+	write("aliases:\n  postgresql:\n    citext: text\n    ltree: text\n", time.Unix(1, 0))
+	if err := c.Load(); err != nil || len(c.Data.Aliases["postgresql"]) != 2 {
+		t.Fatalf("Load() = %v, aliases %v", err, c.Data.Aliases)
+	}
+	write("aliases:\n  postgresql:\n    citext: text\n", time.Unix(2, 0))
+	if err := c.Load(); err != nil || len(c.Data.Aliases["postgresql"]) != 1 {
+		t.Fatalf("Load() after removing an alias = %v, aliases %v", err, c.Data.Aliases)
+	}
+	write("aliases: [", time.Unix(3, 0))
+	if err := c.Load(); err == nil || len(c.Data.Aliases["postgresql"]) != 1 {
+		t.Fatalf("Load() of an invalid file = %v, aliases %v", err, c.Data.Aliases)
+	}
+}
+
+func TestCommandMariaDB(t *testing.T) {
+	var c CommandsConfig
+	err := yaml.Unmarshal([]byte("explain:\n  mysql: EXPLAIN\nexplain-actual:\n  mysql: EXPLAIN ANALYZE\n  mariadb: ANALYZE FORMAT=JSON\n"), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, vendor, want string
+	}{
+		{"explain", types.DBVendorMySQL, "EXPLAIN"},
+		{"explain", types.DBVendorMariaDB, "EXPLAIN"},
+		{"explain-actual", types.DBVendorMySQL, "EXPLAIN ANALYZE"},
+		{"explain-actual", types.DBVendorMariaDB, "ANALYZE FORMAT=JSON"},
+	}
+	for _, tt := range tests {
+		if qry, _, err := c.Command(tt.name, tt.vendor, nil); err != nil || qry != tt.want {
+			t.Errorf("Command(%s, %s) = %q, %v, want %q", tt.name, tt.vendor, qry, err, tt.want)
+		}
+	}
+}
@@ -3,8 +3,16 @@ package config
 // Struct for server.yaml
 type Server struct {
 	Addr               string `yaml:"addr"`
-	Timeout            int    `yaml:"timeout"`
+	Timeout            int    `yaml:"timeout"` // deprecated, default query-timeout
+	QueryTimeout       int    `yaml:"query-timeout"`
+	CopyTimeout        int    `yaml:"copy-timeout"`
 	MaxResultsetLength int    `yaml:"max-resultset-length"`
+	MaxCopyRows        int    `yaml:"max-copy-rows"`
+	QueryHistoryDays   int    `yaml:"query-history-days"`
+	CursorIdleTimeout  int    `yaml:"cursor-idle-timeout"`
+	MaxCursorsPerUser  int    `yaml:"max-cursors-per-user"`
+	SessionIdleTimeout int    `yaml:"session-idle-timeout"`
+	MaxSessionsPerUser int    `yaml:"max-sessions-per-user"`
 	CertFile           string `yaml:"cert-file"`
 	KeyFile            string `yaml:"key-file"`
 }
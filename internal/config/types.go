@@ -0,0 +1,9 @@
+package config
+
+// Struct for types.yaml
+type TypesConfig struct {
+	// vendor -> vendor type -> canonical type
+	Aliases map[string]map[string]string `yaml:"aliases"`
+	// canonical type -> vendor -> vendor type
+	VendorTypes map[string]map[string]string `yaml:"vendor-types"`
+}
@@ -8,6 +8,8 @@ type ctxKey string
 
 const (
 	usernameKey ctxKey = "username"
+	tokenKey    ctxKey = "token"
+	clientIPKey ctxKey = "clientIP"
 )
 
 func SetUsername(ctx context.Context, username string) context.Context {
@@ -18,3 +20,21 @@ func UsernameFromContext(ctx context.Context) string {
 	username, _ := ctx.Value(usernameKey).(string)
 	return username
 }
+
+func SetToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenKey, token)
+}
+
+func TokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(tokenKey).(string)
+	return token
+}
+
+func SetClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey, ip)
+}
+
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey).(string)
+	return ip
+}
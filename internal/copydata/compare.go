@@ -0,0 +1,499 @@
+package copydata
+
+import (
+	"context"
+	"database/sql"
+	"db-portal/internal/dbutil"
+	"db-portal/internal/types"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CompareRequest asks to compare the rows of two endpoints, matched by key columns.
+type CompareRequest struct {
+	Left   EndPoint `json:"left"`
+	Right  EndPoint `json:"right"`
+	Keys   []string `json:"keys"`
+	Format string   `json:"format,omitempty"` // diff file format, no diff file when empty
+}
+
+// CompareResult counts the rows by comparison status.
+type CompareResult struct {
+	Matching         int      `json:"matching"`
+	MissingLeft      int      `json:"missingLeft"`  // rows of right not found in left
+	MissingRight     int      `json:"missingRight"` // rows of left not found in right
+	Differing        int      `json:"differing"`
+	LeftOnlyColumns  []string `json:"leftOnlyColumns,omitempty"` // not compared
+	RightOnlyColumns []string `json:"rightOnlyColumns,omitempty"`
+}
+
+// DiffFields are the fields of a diff file.
+// One row per missing row, and one row per differing column of a differing row.
+func DiffFields(keys []string) []string {
+	return append(append([]string{"diff"}, keys...), "column", "left", "right")
+}
+
+// NewSortedRowReader returns a reader of the endpoint rows ordered by key columns.
+// DB endpoints are ordered by the DB, text keys in binary order whatever the collation of the DB,
+// files are read and sorted in memory. Compare sorts them again by the key types of both endpoints.
+func NewSortedRowReader(ep EndPoint, ctx context.Context, conn *sql.Conn, file io.Reader, keys []string) (RowReader, error) {
+	var from string
+	switch ep.Type {
+	case "table":
+		from = ep.Table
+	case "query":
+		from = "(" + ep.Query + ") q"
+	}
+	if from != "" {
+		fields, types, err := dbColumns(ctx, conn, ep.DBVendor, from)
+		if err != nil {
+			return nil, err
+		}
+		index, err := keyIndex(fields, keys)
+		if err != nil {
+			return nil, err
+		}
+		order := make([]string, len(keys))
+		for i, key := range keys {
+			order[i] = orderKey(ep.DBVendor, dbutil.QuoteIdentifier(ep.DBVendor, key), typeAt(types, index[i]).Canonical)
+		}
+		return NewDBRowReader(ctx, conn, ep.DBVendor, "select * from "+from+" order by "+joinColumns(order))
+	}
+
+	r, err := NewRowReader(ep, ctx, conn, file)
+	if err != nil {
+		return nil, err
+	}
+	index, err := keyIndex(r.Fields(), keys)
+	if err != nil {
+		return nil, err
+	}
+	var rows []Row
+	for {
+		row, err := r.ReadRow()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	m := &memRowReader{fields: r.Fields(), types: r.Types(), rows: rows}
+	m.sort(index, keyKinds(m.types, index, nil, nil))
+	return m, nil
+}
+
+// dbColumns returns the columns of from, a table or an aliased subquery, from an empty result set.
+func dbColumns(ctx context.Context, conn *sql.Conn, dbVendor, from string) ([]string, []dbutil.ColumnType, error) {
+	rows, err := conn.QueryContext(ctx, "select * from "+from+" where 1 = 0")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, err
+	}
+	fields := make([]string, len(columnTypes))
+	types := make([]dbutil.ColumnType, len(columnTypes))
+	for i, c := range columnTypes {
+		fields[i], types[i] = c.Name(), dbutil.NewColumnType(dbVendor, c)
+	}
+	return fields, types, rows.Err()
+}
+
+// orderKey returns the ORDER BY expression of a key column. Text keys are ordered by code point, as compareKeys does,
+// instead of by the collation of the column (case insensitive, linguistic...). Nulls come first.
+func orderKey(dbVendor, quoted, canonical string) string {
+	expr := quoted
+	if keyKindOf(canonical) == keyText {
+		switch dbVendor {
+		case types.DBVendorPostgres:
+			expr = "CAST(" + quoted + " AS text) COLLATE \"C\""
+		case types.DBVendorMySQL, types.DBVendorMariaDB:
+			expr = "CONVERT(" + quoted + " USING utf8mb4) COLLATE utf8mb4_bin"
+		case types.DBVendorMSSQL:
+			expr = "CAST(" + quoted + " AS nvarchar(max)) COLLATE Latin1_General_BIN2"
+		case types.DBVendorClickHouse:
+			expr = "toString(" + quoted + ")"
+		case types.DBVendorSQLite:
+			expr = "CAST(" + quoted + " AS TEXT) COLLATE BINARY"
+		}
+	}
+	if dbVendor == types.DBVendorPostgres || dbVendor == types.DBVendorClickHouse {
+		expr += " NULLS FIRST"
+	}
+	return expr
+}
+
+// memRowReader reads rows from memory.
+type memRowReader struct {
+	fields []string
+	types  []dbutil.ColumnType
+	rows   []Row
+}
+
+func (r *memRowReader) ReadRow() (Row, error) {
+	if len(r.rows) == 0 {
+		return nil, io.EOF
+	}
+	row := r.rows[0]
+	r.rows = r.rows[1:]
+	return row, nil
+}
+
+func (r *memRowReader) Fields() []string           { return r.fields }
+func (r *memRowReader) Types() []dbutil.ColumnType { return r.types }
+
+// sort sorts the rows by key columns.
+func (r *memRowReader) sort(index []int, kinds []keyKind) {
+	sort.SliceStable(r.rows, func(i, j int) bool { return compareKeys(r.rows[i], r.rows[j], index, index, kinds) < 0 })
+}
+
+// Compare merges two readers ordered by key columns and counts matching, missing and differing rows.
+// Columns are matched by name, case insensitive. Values are compared after normalization,
+// so that the same data read from different vendors or files is equal (ex: 1 and "1.0", true and 1, null and "").
+// When diff is not nil, the differences are written to it, see DiffFields.
+func Compare(left, right RowReader, keys []string, diff RowWriter) (result CompareResult, err error) {
+	leftKeys, err := keyIndex(left.Fields(), keys)
+	if err != nil {
+		return result, fmt.Errorf("left: %w", err)
+	}
+	rightKeys, err := keyIndex(right.Fields(), keys)
+	if err != nil {
+		return result, fmt.Errorf("right: %w", err)
+	}
+	kinds := keyKinds(left.Types(), leftKeys, right.Types(), rightKeys)
+	if m, ok := left.(*memRowReader); ok {
+		m.sort(leftKeys, kinds)
+	}
+	if m, ok := right.(*memRowReader); ok {
+		m.sort(rightKeys, kinds)
+	}
+
+	// compared columns, keys excluded
+	type pair struct {
+		name        string
+		left, right int
+	}
+	var columns []pair
+	isKey := func(name string) bool {
+		for _, key := range keys {
+			if strings.EqualFold(key, name) {
+				return true
+			}
+		}
+		return false
+	}
+	for i, name := range left.Fields() {
+		if isKey(name) {
+			continue
+		}
+		if j := columnIndex(right.Fields(), name); j != -1 {
+			columns = append(columns, pair{name, i, j})
+		} else {
+			result.LeftOnlyColumns = append(result.LeftOnlyColumns, name)
+		}
+	}
+	for _, name := range right.Fields() {
+		if !isKey(name) && columnIndex(left.Fields(), name) == -1 {
+			result.RightOnlyColumns = append(result.RightOnlyColumns, name)
+		}
+	}
+
+	if diff != nil {
+		fields := DiffFields(keys)
+		types := make([]dbutil.ColumnType, len(fields))
+		for i := range types {
+			types[i].Canonical = "text"
+		}
+		if err = diff.WriteFields(fields, types); err != nil {
+			return
+		}
+	}
+	writeDiff := func(status string, row Row, index []int, column string, l, r any) error {
+		if diff == nil {
+			return nil
+		}
+		out := Row{status}
+		for _, i := range index {
+			out = append(out, row[i])
+		}
+		_, err := diff.WriteRow(append(out, column, diffValue(l), diffValue(r)))
+		return err
+	}
+
+	// read the next row of a reader, checking it is ordered by key
+	next := func(r RowReader, index []int, prev Row, side string) (Row, error) {
+		row, err := r.ReadRow()
+		if err != nil {
+			return nil, err
+		}
+		if prev != nil && compareKeys(prev, row, index, index, kinds) > 0 {
+			return nil, fmt.Errorf("%s rows are not ordered by key as expected, the key types may differ: %v after %v", side, keyValues(row, index), keyValues(prev, index))
+		}
+		return row, nil
+	}
+
+	l, lerr := next(left, leftKeys, nil, "left")
+	r, rerr := next(right, rightKeys, nil, "right")
+	for {
+		if lerr != nil && lerr != io.EOF {
+			return result, lerr
+		}
+		if rerr != nil && rerr != io.EOF {
+			return result, rerr
+		}
+		if lerr == io.EOF && rerr == io.EOF {
+			break
+		}
+
+		var c int
+		switch {
+		case lerr == io.EOF:
+			c = 1
+		case rerr == io.EOF:
+			c = -1
+		default:
+			c = compareKeys(l, r, leftKeys, rightKeys, kinds)
+		}
+
+		switch {
+		case c < 0:
+			result.MissingRight++
+			if err = writeDiff("missing-right", l, leftKeys, "", nil, nil); err != nil {
+				return
+			}
+			l, lerr = next(left, leftKeys, l, "left")
+		case c > 0:
+			result.MissingLeft++
+			if err = writeDiff("missing-left", r, rightKeys, "", nil, nil); err != nil {
+				return
+			}
+			r, rerr = next(right, rightKeys, r, "right")
+		default:
+			differing := false
+			for _, col := range columns {
+				if normalize(l[col.left]) != normalize(r[col.right]) {
+					differing = true
+					if err = writeDiff("differing", l, leftKeys, col.name, l[col.left], r[col.right]); err != nil {
+						return
+					}
+				}
+			}
+			if differing {
+				result.Differing++
+			} else {
+				result.Matching++
+			}
+			l, lerr = next(left, leftKeys, l, "left")
+			r, rerr = next(right, rightKeys, r, "right")
+		}
+	}
+
+	if diff != nil {
+		_, err = diff.Flush()
+	}
+	return
+}
+
+// keyIndex returns the index of each key column in fields.
+func keyIndex(fields []string, keys []string) ([]int, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("key columns are required")
+	}
+	index := make([]int, len(keys))
+	for i, key := range keys {
+		if index[i] = columnIndex(fields, key); index[i] == -1 {
+			return nil, fmt.Errorf("key column %s not found", key)
+		}
+	}
+	return index, nil
+}
+
+func keyValues(row Row, index []int) []any {
+	values := make([]any, len(index))
+	for i, j := range index {
+		values[i] = row[j]
+	}
+	return values
+}
+
+// keyKind is how key values are compared.
+type keyKind int
+
+const (
+	keyAny    keyKind = iota // untyped file values: numbers as numbers, other values as normalized strings
+	keyText                  // strings, by code point
+	keyTime                  // dates and times
+	keyNumber                // numbers and booleans
+)
+
+// keyKindOf returns the kind of a key of a canonical type, keyAny for an untyped file column.
+func keyKindOf(canonical string) keyKind {
+	switch canonical {
+	case "":
+		return keyAny
+	case "int", "bigint", "smallint", "decimal", "float", "boolean":
+		return keyNumber
+	case "date", "datetime", "timestamptz":
+		return keyTime
+	}
+	return keyText
+}
+
+// keyKinds returns the kind of each key column, from the types of both endpoints:
+// a key is compared as typed on either side, a number or time rather than a string.
+func keyKinds(aTypes []dbutil.ColumnType, aIndex []int, bTypes []dbutil.ColumnType, bIndex []int) []keyKind {
+	kinds := make([]keyKind, len(aIndex))
+	for i := range aIndex {
+		kinds[i] = keyKindOf(typeAt(aTypes, aIndex[i]).Canonical)
+		if bIndex != nil {
+			kinds[i] = max(kinds[i], keyKindOf(typeAt(bTypes, bIndex[i]).Canonical))
+		}
+	}
+	return kinds
+}
+
+// compareKeys compares the key values of two rows by key kind. Nulls come first,
+// but equal empty strings as files cannot tell null from an empty string.
+func compareKeys(a, b Row, aIndex, bIndex []int, kinds []keyKind) int {
+	for i := range aIndex {
+		va, vb := a[aIndex[i]], b[bIndex[i]]
+		switch {
+		case (va == nil || vb == nil) && normalize(va) == normalize(vb):
+			continue
+		case va == nil:
+			return -1
+		case vb == nil:
+			return 1
+		}
+		if c := compareKey(va, vb, kinds[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareKey compares two non null key values.
+func compareKey(a, b any, kind keyKind) int {
+	if kind == keyText {
+		return strings.Compare(textValue(a), textValue(b))
+	}
+	x, y := normalize(a), normalize(b)
+	if x == y {
+		return 0
+	}
+	switch kind {
+	case keyTime:
+		tx, errx := time.Parse(time.RFC3339Nano, x)
+		ty, erry := time.Parse(time.RFC3339Nano, y)
+		if errx == nil && erry == nil {
+			return tx.Compare(ty)
+		}
+	case keyNumber, keyAny:
+		// big.Rat is exact, whatever the number of digits of a decimal
+		fx, okx := new(big.Rat).SetString(x)
+		fy, oky := new(big.Rat).SetString(y)
+		if okx && oky && !strings.Contains(x+y, "/") {
+			return fx.Cmp(fy)
+		}
+	}
+	return strings.Compare(x, y)
+}
+
+// normalize returns a comparable text of a value, whatever the vendor or file it was read from.
+func normalize(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "" // files (ex: csv) cannot tell null from an empty string
+	case bool:
+		if t {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return t.UTC().Format(time.RFC3339Nano)
+	case float32:
+		return normalizeDecimal(strconv.FormatFloat(float64(t), 'g', -1, 32))
+	case float64:
+		return normalizeDecimal(strconv.FormatFloat(t, 'g', -1, 64))
+	case json.RawMessage:
+		var x any
+		if json.Unmarshal(t, &x) == nil {
+			if b, err := json.Marshal(x); err == nil { // keys sorted, spaces removed
+				return string(b)
+			}
+		}
+	}
+	s := textValue(v)
+	if len(s) >= 19 && s[4] == '-' && s[7] == '-' {
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t.UTC().Format(time.RFC3339Nano)
+			}
+		}
+	}
+	if strings.ContainsAny(s, ".eE") {
+		return normalizeDecimal(s) // ex: "1.50" and 1.5
+	}
+	return s
+}
+
+// maxDecimalExponent is the largest exponent of a number normalized as plain decimal text, beyond it is kept in e notation.
+const maxDecimalExponent = 400
+
+// normalizeDecimal returns the decimal text of a number, without exponent, leading and trailing zeros:
+// "1.50", "15e-1" and "1.5E0" are "1.5". All the digits are kept, unlike with a float. Other text is returned as it is.
+func normalizeDecimal(s string) string {
+	mantissa, exponent, hasExponent := strings.Cut(strings.ToLower(s), "e")
+	exp := 0
+	if hasExponent {
+		var err error
+		if exp, err = strconv.Atoi(exponent); err != nil || exp > maxDecimalExponent || exp < -maxDecimalExponent {
+			return s
+		}
+	}
+	sign := ""
+	if mantissa != "" && (mantissa[0] == '-' || mantissa[0] == '+') {
+		sign, mantissa = strings.TrimPrefix(mantissa[:1], "+"), mantissa[1:]
+	}
+	intPart, fracPart, _ := strings.Cut(mantissa, ".")
+	digits := intPart + fracPart
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return s
+	}
+
+	// point is the position of the decimal point in digits
+	point := len(intPart) + exp
+	trimmed := strings.TrimLeft(digits, "0")
+	point -= len(digits) - len(trimmed)
+	digits = strings.TrimRight(trimmed, "0")
+	switch {
+	case digits == "":
+		return "0"
+	case point <= 0:
+		return sign + "0." + strings.Repeat("0", -point) + digits
+	case point >= len(digits):
+		return sign + digits + strings.Repeat("0", point-len(digits))
+	}
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// timeLayouts are the text timestamps normalized as time, ex: SQLite datetime.
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999-07:00"}
+
+// diffValue returns a value of a diff file row.
+func diffValue(v any) any {
+	if v == nil {
+		return nil
+	}
+	return textValue(v)
+}
@@ -0,0 +1,56 @@
+package copydata
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompareKeys(t *testing.T) {
+	tests := []struct {
+		kind keyKind
+		a, b any
+		want int
+	}{
+		{keyText, "10", "9", -1},
+		{keyText, "B", "a", -1},
+		{keyText, "1.50", "1.5", 1},
+		{keyNumber, "10", int64(9), 1},
+		{keyNumber, "1.50", 1.5, 0},
+		{keyNumber, "12345678901234567890.1234567891", "12345678901234567890.1234567892", -1},
+		{keyAny, "99999999999999999999.5", "99999999999999999999.50", 0},
+		{keyAny, "10", "9", 1},
+		{keyTime, "2024-01-01 00:00:00.5", time.Date(2024, 1, 1, 0, 0, 1, 0, time.UTC), -1},
+		{keyText, nil, "a", -1},
+		{keyText, nil, "", 0},
+	}
+	for _, tt := range tests {
+		if got := compareKeys(Row{tt.a}, Row{tt.b}, []int{0}, []int{0}, []keyKind{tt.kind}); got != tt.want {
+			t.Errorf("compareKeys(%v, %v, kind %d) = %d, want %d", tt.a, tt.b, tt.kind, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeDecimal(t *testing.T) {
+	tests := []struct {
+		value any
+		want  string
+	}{
+		{"12345678901234567890.1234567891", "12345678901234567890.1234567891"},
+		{"012345678901234567890.12345678920", "12345678901234567890.1234567892"},
+		{"1.50", "1.5"},
+		{1.5, "1.5"},
+		{"15e-1", "1.5"},
+		{"-0.000", "0"},
+		{"+1.2E3", "1200"},
+		{1e21, "1000000000000000000000"},
+		{"-.5", "-0.5"},
+		{"1e999", "1e999"},
+		{"e.", "e."},
+		{"1.2.3", "1.2.3"},
+	}
+	for _, tt := range tests {
+		if got := normalize(tt.value); got != tt.want {
+			t.Errorf("normalize(%v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
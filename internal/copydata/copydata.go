@@ -49,3 +49,26 @@ func CopyData(r RowReader, w RowWriter) (reads int, writes int, err error) {
 
 	return
 }
+
+// limitRowReader fails when its RowReader has more rows than the limit.
+type limitRowReader struct {
+	RowReader
+	limit int64
+	reads int64
+}
+
+// WithRowLimit returns a RowReader failing when r has more than limit rows, so that the copy is rolled back.
+func WithRowLimit(r RowReader, limit int64) RowReader {
+	return &limitRowReader{RowReader: r, limit: limit}
+}
+
+func (r *limitRowReader) ReadRow() (Row, error) {
+	row, err := r.RowReader.ReadRow()
+	if err != nil {
+		return row, err
+	}
+	if r.reads++; r.reads > r.limit {
+		return nil, fmt.Errorf("copy row limit of %d rows exceeded", r.limit)
+	}
+	return row, nil
+}
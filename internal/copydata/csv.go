@@ -1,6 +1,7 @@
 package copydata
 
 import (
+	"db-portal/internal/dbutil"
 	"encoding/csv"
 	"errors"
 	"fmt"
@@ -12,7 +13,7 @@ import (
 type csvRowReader struct {
 	r      *csv.Reader
 	fields []string
-	types  []string
+	types  []dbutil.ColumnType
 }
 
 func NewCSVRowReader(file io.Reader) (RowReader, error) {
@@ -45,12 +46,13 @@ func (c *csvRowReader) ReadRow() (Row, error) {
 	return row, nil
 }
 
-func (c *csvRowReader) Fields() []string { return c.fields }
-func (c *csvRowReader) Types() []string  { return c.types }
+func (c *csvRowReader) Fields() []string           { return c.fields }
+func (c *csvRowReader) Types() []dbutil.ColumnType { return c.types }
 
 // csvRowWriter implements RowWriter for CSV files.
 type csvRowWriter struct {
 	w           *csv.Writer
+	types       []dbutil.ColumnType
 	wroteHeader bool
 }
 
@@ -65,10 +67,24 @@ func NewCSVRowWriter(file io.Writer) (RowWriter, error) {
 	}, nil
 }
 
-func (c *csvRowWriter) WriteFields(fields []string, types []string) error {
+// NewTSVRowWriter returns a CSV writer with tab separated values.
+func NewTSVRowWriter(file io.Writer) (RowWriter, error) {
+	if file == nil {
+		return nil, errors.New("file writer is nil")
+	}
+	w := csv.NewWriter(file)
+	w.Comma = '\t'
+
+	return &csvRowWriter{
+		w: w,
+	}, nil
+}
+
+func (c *csvRowWriter) WriteFields(fields []string, types []dbutil.ColumnType) error {
 	if c.wroteHeader {
 		return nil
 	}
+	c.types = types
 	if err := c.w.Write(fields); err != nil {
 		return err
 	}
@@ -82,7 +98,7 @@ func (c *csvRowWriter) WriteRow(row Row) (rowsWritten int, err error) {
 		if v == nil {
 			rec[i] = ""
 		} else {
-			rec[i] = toString(v)
+			rec[i] = textValue(fileValue(v, typeAt(c.types, i)))
 		}
 	}
 	if err = c.w.Write(rec); err != nil {
@@ -115,7 +131,7 @@ func toString(v any) string {
 		complex64, complex128:
 		return fmt.Sprint(t)
 	case time.Time:
-		return t.Format(time.RFC3339)
+		return t.Format(time.RFC3339Nano)
 	case time.Duration:
 		return t.String()
 	case time.Month:
@@ -4,17 +4,21 @@ import (
 	"context"
 	"database/sql"
 	"db-portal/internal/dbutil"
+	"db-portal/internal/types"
 	"errors"
+	"fmt"
 	"io"
+	"strings"
 )
 
 // dbRowReader implements RowReader for database sources.
 type dbRowReader struct {
-	ctx     context.Context
-	conn    *sql.Conn
-	rows    *sql.Rows
-	columns []string
-	types   []string
+	ctx      context.Context
+	conn     *sql.Conn
+	rows     *sql.Rows
+	columns  []string
+	types    []dbutil.ColumnType
+	dbVendor string
 }
 
 func NewDBRowReader(ctx context.Context, conn *sql.Conn, dbVendor string, query string, args ...any) (RowReader, error) {
@@ -32,24 +36,24 @@ func NewDBRowReader(ctx context.Context, conn *sql.Conn, dbVendor string, query
 		return nil, err
 	}
 
-	// Attempt to get each column's DatabaseTypeName.
-	// If successful, infer the canonical type for each column.
+	// Attempt to get each column's type.
+	// If successful, infer the canonical type for each column, with length, precision, scale and nullability when the driver supports it.
 	// Some drivers may return an empty string for DatabaseTypeName;
 	// in such cases, the canonical type will default to "text" as a fallback for unknown types.
-	types := make([]string, len(cols))
+	types := make([]dbutil.ColumnType, len(cols))
 	if columnTypes, err := rows.ColumnTypes(); err == nil {
 		for i, c := range columnTypes {
-			databaseTypeName := c.DatabaseTypeName()
-			types[i] = dbutil.CanonicalType(dbVendor, databaseTypeName)
+			types[i] = dbutil.NewColumnType(dbVendor, c)
 		}
 	}
 
 	return &dbRowReader{
-		ctx:     ctx,
-		conn:    conn,
-		rows:    rows,
-		columns: cols,
-		types:   types,
+		ctx:      ctx,
+		conn:     conn,
+		rows:     rows,
+		columns:  cols,
+		types:    types,
+		dbVendor: dbVendor,
 	}, nil
 }
 
@@ -69,11 +73,14 @@ func (r *dbRowReader) ReadRow() (Row, error) {
 	if err := r.rows.Scan(colPtrs...); err != nil {
 		return nil, err
 	}
+	for i := range cols {
+		cols[i] = readValue(cols[i], typeAt(r.types, i), r.dbVendor)
+	}
 	return cols, nil
 }
 
-func (r *dbRowReader) Fields() []string { return r.columns }
-func (r *dbRowReader) Types() []string  { return r.types }
+func (r *dbRowReader) Fields() []string           { return r.columns }
+func (r *dbRowReader) Types() []dbutil.ColumnType { return r.types }
 
 // dbRowWriter
 type dbRowWriter struct {
@@ -82,9 +89,11 @@ type dbRowWriter struct {
 	table       string
 	createTable bool
 	columns     []string
+	types       []dbutil.ColumnType
 	batch       [][]any
 	batchSize   int
 	dbVendor    string
+	upsertKeys  []string // when set, rows are inserted or updated by key
 }
 
 func NewDBRowWriter(ctx context.Context, tx *sql.Tx, dbVendor string, table string, createTable bool, columns []string) (RowWriter, error) {
@@ -103,7 +112,8 @@ func NewDBRowWriter(ctx context.Context, tx *sql.Tx, dbVendor string, table stri
 	}, nil
 }
 
-func (w *dbRowWriter) WriteFields(columns []string, types []string) error {
+func (w *dbRowWriter) WriteFields(columns []string, types []dbutil.ColumnType) error {
+	w.types = types // used to convert values
 	if !w.createTable {
 		return nil
 	}
@@ -112,10 +122,22 @@ func (w *dbRowWriter) WriteFields(columns []string, types []string) error {
 	}
 
 	// Build CREATE TABLE statement
-	var colsDef []string
+	var colsDef, primaryKey []string
 	for i, col := range columns {
-		sqlType := dbutil.VendorType(w.dbVendor, types[i])
-		colsDef = append(colsDef, dbutil.QuoteIdentifier(w.dbVendor, col)+" "+sqlType)
+		colDef := dbutil.QuoteIdentifier(w.dbVendor, col) + " " + types[i].VendorType(w.dbVendor)
+		if types[i].NotNull || types[i].PrimaryKey {
+			colDef += " NOT NULL"
+		}
+		if isJSONText(types[i], w.dbVendor) {
+			colDef += " CHECK (ISJSON(" + dbutil.QuoteIdentifier(w.dbVendor, col) + ") = 1)"
+		}
+		colsDef = append(colsDef, colDef)
+		if types[i].PrimaryKey {
+			primaryKey = append(primaryKey, dbutil.QuoteIdentifier(w.dbVendor, col))
+		}
+	}
+	if len(primaryKey) > 0 {
+		colsDef = append(colsDef, "PRIMARY KEY ("+joinColumns(primaryKey)+")")
 	}
 	query := "CREATE TABLE " + dbutil.QuoteIdentifier(w.dbVendor, w.table) + " (" + joinColumns(colsDef) + ")"
 
@@ -143,6 +165,11 @@ func (w *dbRowWriter) Flush() (rowsWritten int, err error) {
 	if err != nil {
 		return 0, err
 	}
+	for i := range placeholders {
+		if typeAt(w.types, i%numCols).Canonical == "geometry" {
+			placeholders[i] = geometryPlaceholder(w.dbVendor, placeholders[i])
+		}
+	}
 
 	// Build VALUES clause
 	valuesClause := ""
@@ -164,10 +191,15 @@ func (w *dbRowWriter) Flush() (rowsWritten int, err error) {
 	query := "INSERT INTO " + dbutil.QuoteIdentifier(w.dbVendor, w.table)
 	query += " (" + joinColumns(quoted)
 	query += ") VALUES " + valuesClause
+	if len(w.upsertKeys) > 0 {
+		query = upsertQuery(w.dbVendor, w.table, w.columns, w.upsertKeys, valuesClause)
+	}
 
 	args := []any{}
 	for _, row := range w.batch {
-		args = append(args, row...)
+		for i, v := range row {
+			args = append(args, dbValue(v, typeAt(w.types, i), w.dbVendor))
+		}
 	}
 
 	_, err = w.tx.ExecContext(w.ctx, query, args...)
@@ -175,6 +207,101 @@ func (w *dbRowWriter) Flush() (rowsWritten int, err error) {
 	return numRows, err
 }
 
+// WithUpsert makes a table writer insert new rows and update the existing ones, matched by key columns.
+// ClickHouse has no upsert, rows are inserted and deduplicated by the table engine (ex: ReplacingMergeTree).
+func WithUpsert(w RowWriter, keys []string) (RowWriter, error) {
+	dw, ok := w.(*dbRowWriter)
+	if !ok {
+		return nil, errors.New("upsert is only supported for a table destination")
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("upsert needs key columns")
+	}
+	for _, key := range keys {
+		found := false
+		for _, col := range dw.columns {
+			found = found || col == key
+		}
+		if !found {
+			return nil, fmt.Errorf("upsert key column %s not found in origin", key)
+		}
+	}
+	dw.upsertKeys = keys
+	return dw, nil
+}
+
+// upsertQuery returns the statement inserting or updating a batch of rows.
+func upsertQuery(dbVendor, table string, columns, keys []string, valuesClause string) string {
+	quote := func(s string) string { return dbutil.QuoteIdentifier(dbVendor, s) }
+	isKey := func(col string) bool {
+		for _, key := range keys {
+			if key == col {
+				return true
+			}
+		}
+		return false
+	}
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = quote(col)
+	}
+	insert := "INSERT INTO " + quote(table) + " (" + joinColumns(quoted) + ") VALUES " + valuesClause
+
+	var sets []string
+	switch dbVendor {
+	case types.DBVendorPostgres, types.DBVendorSQLite:
+		quotedKeys := make([]string, len(keys))
+		for i, key := range keys {
+			quotedKeys[i] = quote(key)
+		}
+		for _, col := range columns {
+			if !isKey(col) {
+				sets = append(sets, quote(col)+" = excluded."+quote(col))
+			}
+		}
+		if len(sets) == 0 {
+			return insert + " ON CONFLICT (" + joinColumns(quotedKeys) + ") DO NOTHING"
+		}
+		return insert + " ON CONFLICT (" + joinColumns(quotedKeys) + ") DO UPDATE SET " + joinColumns(sets)
+	case types.DBVendorMySQL, types.DBVendorMariaDB:
+		for _, col := range columns {
+			if !isKey(col) {
+				sets = append(sets, quote(col)+" = VALUES("+quote(col)+")")
+			}
+		}
+		if len(sets) == 0 {
+			sets = append(sets, quote(keys[0])+" = "+quote(keys[0]))
+		}
+		return insert + " ON DUPLICATE KEY UPDATE " + joinColumns(sets)
+	case types.DBVendorMSSQL:
+		var on, values []string
+		for _, key := range keys {
+			on = append(on, "d."+quote(key)+" = s."+quote(key))
+		}
+		for _, col := range columns {
+			values = append(values, "s."+quote(col))
+			if !isKey(col) {
+				sets = append(sets, "d."+quote(col)+" = s."+quote(col))
+			}
+		}
+		query := "MERGE INTO " + quote(table) + " AS d USING (VALUES " + valuesClause + ") AS s (" + joinColumns(quoted) + ")"
+		query += " ON " + strings.Join(on, " AND ")
+		if len(sets) > 0 {
+			query += " WHEN MATCHED THEN UPDATE SET " + joinColumns(sets)
+		}
+		return query + " WHEN NOT MATCHED THEN INSERT (" + joinColumns(quoted) + ") VALUES (" + joinColumns(values) + ");"
+	}
+	return insert
+}
+
+// typeAt returns the column type at index i, an empty type if unknown.
+func typeAt(types []dbutil.ColumnType, i int) dbutil.ColumnType {
+	if i < len(types) {
+		return types[i]
+	}
+	return dbutil.ColumnType{}
+}
+
 // Helper to join columns for SQL
 func joinColumns(cols []string) string {
 	if len(cols) == 0 {
@@ -2,17 +2,25 @@ package copydata
 
 // an data EndPoint represents a data origin or destination
 type EndPoint struct {
-	Type       string `json:"type"`               // "table", "query", or "file"
-	DSName     string `json:"dsName,omitempty"`   // Data source name (for "table" and "query")
-	DBVendor   string `json:"dbVendor,omitempty"` // Database vendor (for "table" and "query")
-	Schema     string `json:"schema,omitempty"`   // Schema name (for "table" and "query")
-	Table      string `json:"table,omitempty"`    // Table name (for "table")
-	IsNewTable string `json:"newTable,omitempty"` // Whether to create the table (for "table")
-	Query      string `json:"query,omitempty"`    // SQL query (for "query")
-	Format     string `json:"format,omitempty"`   // File format: "csv", "xlsx", "json", "jsontabular" (for "file")
+	Type       string `json:"type"`                // "table", "query", or "file"
+	DSName     string `json:"dsName,omitempty"`    // Data source name (for "table" and "query")
+	DBVendor   string `json:"dbVendor,omitempty"`  // Database vendor (for "table" and "query")
+	Schema     string `json:"schema,omitempty"`    // Schema name (for "table" and "query")
+	Table      string `json:"table,omitempty"`     // Table name (for "table")
+	IsNewTable string `json:"newTable,omitempty"`  // Whether to create the table (for "table")
+	Evolve     string `json:"evolve,omitempty"`    // Whether to add missing columns to an existing table (for "table")
+	Widen      string `json:"widen,omitempty"`     // Whether to widen varchar/decimal columns of an existing table (for "table")
+	Upsert     string `json:"upsert,omitempty"`    // Whether to update existing rows matched by key columns (for "table")
+	Keys       string `json:"keys,omitempty"`      // Comma separated upsert key columns, the primary key by default (for "table")
+	Query      string `json:"query,omitempty"`     // SQL query (for "query")
+	Watermark  string `json:"watermark,omitempty"` // Column to read rows beyond the last copy high-water mark (for "table" and "query")
+	Format     string `json:"format,omitempty"`    // File format: "csv", "xlsx", "json", "jsontabular" (for "file")
+
+	TypeOverrides map[string]string `json:"typeOverrides,omitempty"` // Vendor type by field name or canonical type (for "table")
 }
 
 type CopyRequest struct {
-	OriginEP EndPoint `json:"origin"`      // Source endpoint
-	DestEP   EndPoint `json:"destination"` // Destination endpoint
+	Name     string   `json:"name,omitempty"` // Copy name, used to store the high-water mark of an incremental copy
+	OriginEP EndPoint `json:"origin"`         // Source endpoint
+	DestEP   EndPoint `json:"destination"`    // Destination endpoint
 }
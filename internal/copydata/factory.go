@@ -39,12 +39,17 @@ func NewRowWriter(ep EndPoint, ctx context.Context, tx *sql.Tx, file io.Writer,
 		switch ep.Format {
 		case "csv":
 			return NewCSVRowWriter(file)
-		case "json":
+		case "tsv":
+			return NewTSVRowWriter(file)
+		case "json", "ndjson":
+			// one json object per line
 			return NewJSONRowWriter(file)
 		case "jsonTabular":
 			return NewJSONTabularRowWriter(file)
 		case "xlsx":
 			return NewXLSXRowWriter(file)
+		case "parquet":
+			return NewParquetRowWriter(file)
 		}
 	}
 	return nil, fmt.Errorf("unsupported writer. type: %s, format: %s", ep.Type, ep.Format)
@@ -1,16 +1,18 @@
 package copydata
 
+import "db-portal/internal/dbutil"
+
 // Row represents a single row of data, with each column as an any type.
 type Row []any
 
 type RowReader interface {
 	ReadRow() (Row, error)
 	Fields() []string
-	Types() []string
+	Types() []dbutil.ColumnType // nil when the origin has no type information
 }
 
 type RowWriter interface {
-	WriteFields(fields []string, types []string) error
+	WriteFields(fields []string, types []dbutil.ColumnType) error
 	WriteRow(row Row) (rowsWritten int, err error)
 	Flush() (rowsWritten int, err error)
 }
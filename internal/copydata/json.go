@@ -3,6 +3,7 @@ package copydata
 import (
 	"bufio"
 	"bytes"
+	"db-portal/internal/dbutil"
 	"encoding/json"
 	"errors"
 	"io"
@@ -12,7 +13,7 @@ import (
 type jsonRowReader struct {
 	scanner   *bufio.Scanner
 	fields    []string
-	types     []string
+	types     []dbutil.ColumnType
 	firstRow  map[string]any // buffer for the first row
 	firstRead bool           // has the first row been read?
 }
@@ -105,13 +106,14 @@ func (j *jsonRowReader) ReadRow() (Row, error) {
 	return nil, io.EOF
 }
 
-func (j *jsonRowReader) Fields() []string { return j.fields }
-func (j *jsonRowReader) Types() []string  { return j.types }
+func (j *jsonRowReader) Fields() []string           { return j.fields }
+func (j *jsonRowReader) Types() []dbutil.ColumnType { return j.types }
 
 // jsonRowWriter
 type jsonRowWriter struct {
 	enc     *json.Encoder
 	fields  []string
+	types   []dbutil.ColumnType
 	written bool
 }
 
@@ -124,8 +126,9 @@ func NewJSONRowWriter(w io.Writer) (RowWriter, error) {
 	}, nil
 }
 
-func (j *jsonRowWriter) WriteFields(fields []string, types []string) error {
+func (j *jsonRowWriter) WriteFields(fields []string, types []dbutil.ColumnType) error {
 	j.fields = append([]string{}, fields...)
+	j.types = types
 	j.written = true
 	return nil
 }
@@ -142,7 +145,7 @@ func (j *jsonRowWriter) WriteRow(row Row) (rowsWritten int, err error) {
 		buf.WriteByte(':')
 		val := []byte("null")
 		if i < len(row) {
-			val, _ = json.Marshal(row[i])
+			val, _ = json.Marshal(fileValue(row[i], typeAt(j.types, i)))
 		}
 		buf.Write(val)
 	}
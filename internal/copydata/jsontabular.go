@@ -13,6 +13,7 @@ Example of supported json format:
 */
 
 import (
+	"db-portal/internal/dbutil"
 	"encoding/json"
 	"errors"
 	"io"
@@ -57,14 +58,26 @@ func (j *jsontabularRowReader) ReadRow() (Row, error) {
 }
 
 func (j *jsontabularRowReader) Fields() []string { return j.data.Fields }
-func (j *jsontabularRowReader) Types() []string  { return j.data.Types }
+
+// Types returns the canonical types of the file header.
+func (j *jsontabularRowReader) Types() []dbutil.ColumnType {
+	if j.data.Types == nil {
+		return nil
+	}
+	types := make([]dbutil.ColumnType, len(j.data.Types))
+	for i, t := range j.data.Types {
+		types[i] = dbutil.ColumnType{Canonical: t}
+	}
+	return types
+}
 
 // jasontabularRowWriter
 type jasontabularRowWriter struct {
-	enc    *json.Encoder
-	fields []string
-	types  []string
-	rows   [][]any
+	enc         *json.Encoder
+	fields      []string
+	types       []string
+	columnTypes []dbutil.ColumnType
+	rows        [][]any
 }
 
 func NewJSONTabularRowWriter(w io.Writer) (RowWriter, error) {
@@ -77,15 +90,20 @@ func NewJSONTabularRowWriter(w io.Writer) (RowWriter, error) {
 	}, nil
 }
 
-func (j *jasontabularRowWriter) WriteFields(fields []string, types []string) error {
+func (j *jasontabularRowWriter) WriteFields(fields []string, types []dbutil.ColumnType) error {
 	j.fields = append([]string{}, fields...)
-	j.types = append([]string{}, types...)
+	j.types = dbutil.CanonicalTypes(types)
+	j.columnTypes = types
 	j.rows = [][]any{}
 	return nil
 }
 
 func (j *jasontabularRowWriter) WriteRow(row Row) (rowsWritten int, err error) {
-	j.rows = append(j.rows, append([]any{}, row...))
+	encoded := make([]any, len(row))
+	for i, v := range row {
+		encoded[i] = fileValue(v, typeAt(j.columnTypes, i))
+	}
+	j.rows = append(j.rows, encoded)
 	return
 }
 
@@ -0,0 +1,178 @@
+package copydata
+
+import (
+	"db-portal/internal/dbutil"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetRowWriter implements RowWriter for Parquet files.
+// Columns are typed from the origin canonical types: integers, floats, booleans and timestamps.
+// Other types (decimal, date, json, ...) are written as strings. All columns are optional.
+// Rows are written by row groups, so that memory does not grow with the number of rows.
+type parquetRowWriter struct {
+	file    io.Writer
+	w       *parquet.Writer
+	kinds   []string // per field: "int", "float", "bool", "timestamp" or "string"
+	columns []int    // leaf column index of each field, parquet orders columns by name
+	types   []dbutil.ColumnType
+}
+
+const parquetRowGroupSize = 100_000
+
+func NewParquetRowWriter(file io.Writer) (RowWriter, error) {
+	if file == nil {
+		return nil, errors.New("file writer is nil")
+	}
+	return &parquetRowWriter{file: file}, nil
+}
+
+func (p *parquetRowWriter) WriteFields(fields []string, types []dbutil.ColumnType) error {
+	p.types = types
+	p.kinds = make([]string, len(fields))
+	names := make([]string, len(fields))
+	group := parquet.Group{}
+	for i, field := range fields {
+		// parquet column names must be unique and not empty
+		name := field
+		if name == "" {
+			name = fmt.Sprintf("column%d", i+1)
+		}
+		for n := 2; group[name] != nil; n++ {
+			name = fmt.Sprintf("%s_%d", field, n)
+		}
+		names[i] = name
+
+		var node parquet.Node
+		switch typeAt(types, i).Canonical {
+		case "int", "smallint", "bigint":
+			p.kinds[i], node = "int", parquet.Int(64)
+		case "float":
+			p.kinds[i], node = "float", parquet.Leaf(parquet.DoubleType)
+		case "boolean":
+			p.kinds[i], node = "bool", parquet.Leaf(parquet.BooleanType)
+		case "datetime", "timestamptz":
+			p.kinds[i], node = "timestamp", parquet.Timestamp(parquet.Microsecond)
+		default:
+			p.kinds[i], node = "string", parquet.String()
+		}
+		group[name] = parquet.Optional(node)
+	}
+
+	schema := parquet.NewSchema("row", group)
+	p.columns = make([]int, len(fields))
+	for i, name := range names {
+		leaf, _ := schema.Lookup(name)
+		p.columns[i] = leaf.ColumnIndex
+	}
+	p.w = parquet.NewWriter(p.file, schema, parquet.MaxRowsPerRowGroup(parquetRowGroupSize), parquet.Compression(&parquet.Snappy))
+	return nil
+}
+
+func (p *parquetRowWriter) WriteRow(row Row) (rowsWritten int, err error) {
+	values := make(parquet.Row, len(p.columns))
+	for i, col := range p.columns {
+		var v any
+		if i < len(row) {
+			v = row[i]
+		}
+		value, err := parquetValue(v, p.kinds[i], typeAt(p.types, i))
+		if err != nil {
+			return 0, err
+		}
+		if v == nil {
+			values[col] = value.Level(0, 0, col)
+		} else {
+			values[col] = value.Level(0, 1, col)
+		}
+	}
+	if _, err = p.w.WriteRows([]parquet.Row{values}); err != nil {
+		return
+	}
+	rowsWritten = 1
+	return
+}
+
+// Flush writes the last row group and the file footer.
+func (p *parquetRowWriter) Flush() (rowsWritten int, err error) {
+	if p.w == nil {
+		return 0, nil
+	}
+	return 0, p.w.Close()
+}
+
+// parquetValue converts a value to the parquet type of its column.
+func parquetValue(v any, kind string, t dbutil.ColumnType) (parquet.Value, error) {
+	if v == nil {
+		return parquet.NullValue(), nil
+	}
+	if b, ok := v.([]byte); ok && kind != "string" {
+		v = string(b)
+	}
+	rv := reflect.ValueOf(v)
+	s, isString := v.(string)
+	s = strings.TrimSpace(s)
+
+	switch kind {
+	case "int":
+		switch {
+		case rv.CanInt():
+			return parquet.Int64Value(rv.Int()), nil
+		case rv.CanUint():
+			return parquet.Int64Value(int64(rv.Uint())), nil
+		case rv.CanFloat() && rv.Float() == float64(int64(rv.Float())):
+			return parquet.Int64Value(int64(rv.Float())), nil
+		case isString:
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return parquet.Int64Value(n), nil
+			}
+		}
+	case "float":
+		switch {
+		case rv.CanFloat():
+			return parquet.DoubleValue(rv.Float()), nil
+		case rv.CanInt():
+			return parquet.DoubleValue(float64(rv.Int())), nil
+		case rv.CanUint():
+			return parquet.DoubleValue(float64(rv.Uint())), nil
+		case isString:
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				return parquet.DoubleValue(f), nil
+			}
+		}
+	case "bool":
+		switch {
+		case rv.Kind() == reflect.Bool:
+			return parquet.BooleanValue(rv.Bool()), nil
+		case rv.CanInt():
+			return parquet.BooleanValue(rv.Int() != 0), nil
+		case rv.CanUint():
+			return parquet.BooleanValue(rv.Uint() != 0), nil
+		case isString:
+			if b, err := strconv.ParseBool(s); err == nil {
+				return parquet.BooleanValue(b), nil
+			}
+		}
+	case "timestamp":
+		if tm, ok := v.(time.Time); ok {
+			return parquet.Int64Value(tm.UnixMicro()), nil
+		}
+		if isString {
+			for _, layout := range timeLayouts {
+				if tm, err := time.Parse(layout, s); err == nil {
+					return parquet.Int64Value(tm.UnixMicro()), nil
+				}
+			}
+		}
+	default:
+		return parquet.ByteArrayValue([]byte(textValue(fileValue(v, t)))), nil
+	}
+	return parquet.Value{}, fmt.Errorf("cannot convert %v (%T) to a parquet %s", v, v, kind)
+}
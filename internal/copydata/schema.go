@@ -0,0 +1,385 @@
+package copydata
+
+import (
+	"context"
+	"database/sql"
+	"db-portal/internal/dbutil"
+	"db-portal/internal/types"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TableColumn describes a column of an existing table.
+type TableColumn struct {
+	Name        string
+	Type        string // vendor type, as returned by the DB
+	Length      int64  // character max length, 0 if unknown, -1 for MAX
+	Precision   int64  // numeric precision, 0 if unknown
+	Scale       int64  // numeric scale, 0 if unknown
+	NotNull     bool
+	PrimaryKey  bool
+	Default     *string // default value as returned by the DB, nil if none
+	DefaultExpr bool    // Default is an expression (MySQL DEFAULT_GENERATED)
+	Comment     string
+}
+
+// Queryer is implemented by *sql.Conn and *sql.Tx.
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// Result column names of the "table-columns" command, which differ between vendors.
+var (
+	tableColumnNameKeys      = []string{"column_name", "name", "field"}
+	tableColumnTypeKeys      = []string{"data_type", "type"}
+	tableColumnLengthKeys    = []string{"max_length", "max_len", "character_maximum_length"}
+	tableColumnPrecisionKeys = []string{"numeric_precision"}
+	tableColumnScaleKeys     = []string{"numeric_scale"}
+	tableColumnNullableKeys  = []string{"is_nullable", "null"}                              // YES/NO
+	tableColumnNotNullKeys   = []string{"notnull"}                                          // sqlite: 1/0
+	tableColumnPKKeys        = []string{"is_primary_key", "is_in_primary_key", "pk", "key"} // YES/1/PRI
+	tableColumnDefaultKeys   = []string{"default", "def", "dflt_value", "column_default"}
+	tableColumnCommentKeys   = []string{"comment"}
+	tableColumnExtraKeys     = []string{"extra"} // mysql: auto_increment, DEFAULT_GENERATED...
+)
+
+// ReadTableColumns runs the "table-columns" command query and returns the table columns.
+func ReadTableColumns(ctx context.Context, db Queryer, dbVendor string, query string, args []any) ([]TableColumn, error) {
+	cols, rows, err := queryRows(ctx, db, query, args)
+	if err != nil {
+		return nil, err
+	}
+	index := func(keys []string) int { return columnIndex(cols, keys...) }
+	nameIdx, typeIdx := index(tableColumnNameKeys), index(tableColumnTypeKeys)
+	if nameIdx == -1 || typeIdx == -1 {
+		return nil, fmt.Errorf("cannot find column name and type in table-columns result %v", cols)
+	}
+	lengthIdx, precisionIdx, scaleIdx := index(tableColumnLengthKeys), index(tableColumnPrecisionKeys), index(tableColumnScaleKeys)
+	nullableIdx, notNullIdx, pkIdx := index(tableColumnNullableKeys), index(tableColumnNotNullKeys), index(tableColumnPKKeys)
+	defaultIdx, commentIdx, extraIdx := index(tableColumnDefaultKeys), index(tableColumnCommentKeys), index(tableColumnExtraKeys)
+
+	var columns []TableColumn
+	for _, values := range rows {
+		col := TableColumn{
+			Name: toString(values[nameIdx]),
+			Type: toString(values[typeIdx]),
+		}
+		if lengthIdx != -1 {
+			col.Length = toInt64(values[lengthIdx])
+		}
+		if precisionIdx != -1 {
+			col.Precision = toInt64(values[precisionIdx])
+		}
+		if scaleIdx != -1 {
+			col.Scale = toInt64(values[scaleIdx])
+		}
+		if nullableIdx != -1 {
+			col.NotNull = strings.EqualFold(toString(values[nullableIdx]), "NO")
+		}
+		if notNullIdx != -1 {
+			col.NotNull = toInt64(values[notNullIdx]) != 0
+		}
+		if pkIdx != -1 {
+			pk := strings.ToUpper(toString(values[pkIdx]))
+			col.PrimaryKey = pk == "YES" || pk == "PRI" || pk == "TRUE" || toInt64(values[pkIdx]) > 0
+		}
+		if defaultIdx != -1 && values[defaultIdx] != nil {
+			def := toString(values[defaultIdx])
+			col.Default = &def
+		}
+		if commentIdx != -1 {
+			col.Comment = toString(values[commentIdx])
+		}
+		if extraIdx != -1 {
+			col.DefaultExpr = strings.Contains(strings.ToUpper(toString(values[extraIdx])), "DEFAULT_GENERATED")
+		}
+
+		// Some vendors only return parameters within the type, ex: varchar(50), decimal(10,2)
+		params := dbutil.TypeParams(col.Type)
+		switch dbutil.CanonicalType(dbVendor, col.Type) {
+		case "char", "varchar":
+			if col.Length == 0 && len(params) > 0 {
+				col.Length = params[0]
+			}
+		case "decimal":
+			if col.Precision == 0 && len(params) > 0 {
+				col.Precision = params[0]
+			}
+			if col.Scale == 0 && len(params) > 1 {
+				col.Scale = params[1]
+			}
+		}
+
+		columns = append(columns, col)
+	}
+	return columns, nil
+}
+
+// TableIndex describes an index of an existing table.
+type TableIndex struct {
+	Name    string
+	Columns []string
+	Unique  bool
+}
+
+// ReadTableIndexes runs the "table-indexes" command query and returns the table indexes.
+func ReadTableIndexes(ctx context.Context, db Queryer, query string, args []any) ([]TableIndex, error) {
+	cols, rows, err := queryRows(ctx, db, query, args)
+	if err != nil {
+		return nil, err
+	}
+	nameIdx, columnIdx, uniqueIdx := columnIndex(cols, "index_name"), columnIndex(cols, "column_name"), columnIndex(cols, "is_unique")
+	if nameIdx == -1 || columnIdx == -1 {
+		return nil, fmt.Errorf("cannot find index name and column name in table-indexes result %v", cols)
+	}
+
+	var indexes []TableIndex
+	for _, values := range rows {
+		name := toString(values[nameIdx])
+		if len(indexes) == 0 || indexes[len(indexes)-1].Name != name {
+			index := TableIndex{Name: name}
+			if uniqueIdx != -1 {
+				unique := strings.ToUpper(toString(values[uniqueIdx]))
+				index.Unique = unique == "YES" || unique == "TRUE" || toInt64(values[uniqueIdx]) > 0
+			}
+			indexes = append(indexes, index)
+		}
+		indexes[len(indexes)-1].Columns = append(indexes[len(indexes)-1].Columns, toString(values[columnIdx]))
+	}
+	return indexes, nil
+}
+
+// ReadFirstColumn runs a query and returns the values of its first column as strings.
+// Used with the "tables" and "table-foreign-keys" command queries.
+func ReadFirstColumn(ctx context.Context, db Queryer, query string, args []any) ([]string, error) {
+	_, rows, err := queryRows(ctx, db, query, args)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if len(row) > 0 && row[0] != nil {
+			values = append(values, toString(row[0]))
+		}
+	}
+	return values, nil
+}
+
+// queryRows runs a query and returns its column names and all its rows.
+// Only meant for small results, like table definitions.
+func queryRows(ctx context.Context, db Queryer, query string, args []any) (cols []string, rows [][]any, err error) {
+	if db == nil {
+		return nil, nil, errors.New("db connection is nil")
+	}
+	result, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer result.Close()
+
+	if cols, err = result.Columns(); err != nil {
+		return nil, nil, err
+	}
+	for result.Next() {
+		values := make([]any, len(cols))
+		valuePtrs := make([]any, len(cols))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+		if err = result.Scan(valuePtrs...); err != nil {
+			return nil, nil, err
+		}
+		rows = append(rows, values)
+	}
+	err = result.Err()
+	return
+}
+
+// columnIndex returns the index of the first column matching one of the names, case insensitive.
+func columnIndex(cols []string, names ...string) int {
+	for i, c := range cols {
+		for _, name := range names {
+			if strings.EqualFold(c, name) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// EvolveTable alters an existing table so that all origin fields can be written to it.
+// Missing columns are added. With widen = true, varchar and decimal columns narrower
+// than the origin type are widened. Returns the DDL statements applied.
+func EvolveTable(ctx context.Context, tx *sql.Tx, dbVendor, table string, existing []TableColumn, fields []string, types []dbutil.ColumnType, widen bool) (ddl []string, err error) {
+	if tx == nil {
+		return nil, errors.New("transaction is nil")
+	}
+	if len(existing) == 0 {
+		return nil, fmt.Errorf("table %s not found or has no columns", table)
+	}
+
+	for i, field := range fields {
+		originType := dbutil.ColumnType{Canonical: "text"} // fallback when the origin has no types (ex: csv)
+		if i < len(types) && types[i].Canonical != "" {
+			originType = types[i]
+		}
+
+		var query string
+		if col, ok := findTableColumn(existing, field); !ok {
+			query = dbutil.AddColumnDDL(dbVendor, table, field, originType.VendorType(dbVendor))
+		} else if widen {
+			sqlType, ok := widerType(dbVendor, col, originType)
+			if !ok {
+				continue
+			}
+			if query, err = dbutil.AlterColumnTypeDDL(dbVendor, table, col.Name, sqlType, dbutil.ColumnAttributes{
+				NotNull:     col.NotNull,
+				Default:     col.Default,
+				DefaultExpr: col.DefaultExpr,
+				Comment:     col.Comment,
+			}); err != nil {
+				return
+			}
+		}
+		if query == "" {
+			continue
+		}
+
+		if _, err = tx.ExecContext(ctx, query); err != nil {
+			err = fmt.Errorf("error applying %q: %w", query, err)
+			return
+		}
+		ddl = append(ddl, query)
+	}
+	return
+}
+
+// findTableColumn looks for a column by name, case insensitive.
+func findTableColumn(columns []TableColumn, name string) (TableColumn, bool) {
+	for _, col := range columns {
+		if strings.EqualFold(col.Name, name) {
+			return col, true
+		}
+	}
+	return TableColumn{}, false
+}
+
+// widerType returns the vendor type to use when col is narrower than the origin type.
+// When the origin length or precision is unknown, the default vendor type is used for comparison.
+// SQLite columns are never widened, types are not enforced.
+func widerType(dbVendor string, col TableColumn, origin dbutil.ColumnType) (sqlType string, ok bool) {
+	if dbVendor == types.DBVendorSQLite {
+		return
+	}
+
+	switch dbutil.CanonicalType(dbVendor, col.Type) {
+	case "char", "varchar":
+		if col.Length <= 0 {
+			return // unknown or MAX
+		}
+		switch origin.Canonical {
+		case "text":
+			return dbutil.ColumnType{Canonical: "varchar", Length: -1}.VendorType(dbVendor), true
+		case "char", "varchar":
+			length := origin.Length
+			if length == 0 {
+				if params := dbutil.TypeParams(dbutil.VendorType(dbVendor, "varchar")); len(params) > 0 {
+					length = params[0]
+				}
+			}
+			if length > 0 && length <= col.Length {
+				return
+			}
+			return dbutil.ColumnType{Canonical: "varchar", Length: length}.VendorType(dbVendor), true
+		}
+	case "decimal":
+		if col.Precision <= 0 || origin.Canonical != "decimal" {
+			return
+		}
+		precision, scale := origin.Precision, origin.Scale
+		if precision == 0 {
+			if params := dbutil.TypeParams(dbutil.VendorType(dbVendor, "decimal")); len(params) > 1 {
+				precision, scale = params[0], params[1]
+			}
+		}
+		if precision <= col.Precision && scale <= col.Scale {
+			return
+		}
+		// keep the integer part of both types
+		scale = max(scale, col.Scale)
+		precision = max(precision-origin.Scale, col.Precision-col.Scale) + scale
+		return dbutil.ColumnType{Canonical: "decimal", Precision: precision, Scale: scale}.VendorType(dbVendor), true
+	}
+	return
+}
+
+// typedRowReader is a RowReader whose types are completed or overridden.
+type typedRowReader struct {
+	RowReader
+	types []dbutil.ColumnType
+}
+
+func (t *typedRowReader) Types() []dbutil.ColumnType { return t.types }
+
+// WithTableColumns returns a RowReader whose types are completed with the nullability and
+// primary key of the origin table columns, so that an identical table can be created.
+func WithTableColumns(r RowReader, columns []TableColumn) RowReader {
+	types := append([]dbutil.ColumnType{}, r.Types()...)
+	for i, field := range r.Fields() {
+		col, ok := findTableColumn(columns, field)
+		if !ok || i >= len(types) {
+			continue
+		}
+		types[i].NotNull = types[i].NotNull || col.NotNull
+		types[i].PrimaryKey = col.PrimaryKey
+		// fill parameters the driver did not report
+		if types[i].Length == 0 && col.Length != 0 {
+			types[i].Length = col.Length
+		}
+		if types[i].Precision == 0 && col.Precision > 0 {
+			types[i].Precision, types[i].Scale = col.Precision, col.Scale
+		}
+	}
+	return &typedRowReader{RowReader: r, types: types}
+}
+
+// WithTypeOverrides returns a RowReader whose types are forced to a destination vendor type.
+// An override key is a field name, or else a canonical type.
+// Ex: {"payload": "JSONB", "text": "NVARCHAR(MAX)"}
+func WithTypeOverrides(r RowReader, overrides map[string]string) RowReader {
+	types := make([]dbutil.ColumnType, len(r.Fields()))
+	copy(types, r.Types())
+	for i, field := range r.Fields() {
+		if types[i].Canonical == "" {
+			types[i].Canonical = "text" // origin has no types (ex: csv)
+		}
+		if sqlType, ok := overrides[field]; ok {
+			types[i].Override = sqlType
+		} else if sqlType, ok := overrides[types[i].Canonical]; ok {
+			types[i].Override = sqlType
+		}
+	}
+	return &typedRowReader{RowReader: r, types: types}
+}
+
+// toInt64 converts a scanned DB value to int64, 0 if not a number.
+func toInt64(v any) int64 {
+	switch t := v.(type) {
+	case int64:
+		return t
+	case int32:
+		return int64(t)
+	case int:
+		return int64(t)
+	case uint64:
+		return int64(t)
+	case float64:
+		return int64(t)
+	case []byte, string:
+		n, _ := strconv.ParseInt(strings.TrimSpace(toString(t)), 10, 64)
+		return n
+	}
+	return 0
+}
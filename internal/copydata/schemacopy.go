@@ -0,0 +1,218 @@
+package copydata
+
+import (
+	"context"
+	"database/sql"
+	"db-portal/internal/dbutil"
+	"db-portal/internal/types"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// CommandFunc returns the query of a vendor command, see config.CommandsConfig.Command.
+type CommandFunc func(name string, dbVendor string, identifiers []string) (string, []any, error)
+
+// SchemaCopyRequest asks to copy tables from an origin schema to a destination schema.
+// Tables are names or globs (ex: "*", "user_*"), all origin tables when empty.
+type SchemaCopyRequest struct {
+	OriginEP EndPoint `json:"origin"`      // DSName and Schema are used
+	DestEP   EndPoint `json:"destination"` // DSName and Schema are used
+	Tables   []string `json:"tables"`
+}
+
+// TableCopyResult reports the copy of one table.
+type TableCopyResult struct {
+	Table  string   `json:"table"`
+	Reads  int      `json:"reads"`
+	Writes int      `json:"writes"`
+	DDL    []string `json:"ddl,omitempty"`   // indexes created
+	Skip   []string `json:"skip,omitempty"`  // indexes that could not be translated
+	Error  string   `json:"error,omitempty"` // the copy stops at the first table in error
+}
+
+// CopySchema creates each origin table matching the tables patterns in the destination,
+// with columns, primary key and indexes when translatable, then copies its rows.
+// Tables are copied in foreign keys dependency order, each table in its own transaction.
+// The copy stops at the first error, results of the tables already copied are returned.
+// With maxRows > 0, the copy of a table with more rows fails, see WithRowLimit.
+func CopySchema(ctx context.Context, cmd CommandFunc, origin *sql.Conn, originVendor string, dest *sql.Conn, destVendor string, tables []string, maxRows int64) ([]TableCopyResult, error) {
+	names, err := matchTables(ctx, cmd, origin, originVendor, tables)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no origin table matches %v", tables)
+	}
+	if names, err = sortTablesByDependency(ctx, cmd, origin, originVendor, names); err != nil {
+		return nil, err
+	}
+
+	results := make([]TableCopyResult, 0, len(names))
+	for _, table := range names {
+		result := copyTable(ctx, cmd, origin, originVendor, dest, destVendor, table, maxRows)
+		results = append(results, result)
+		if result.Error != "" {
+			return results, fmt.Errorf("table %s: %s", table, result.Error)
+		}
+	}
+	return results, nil
+}
+
+// matchTables returns the origin tables matching one of the patterns, in origin order.
+func matchTables(ctx context.Context, cmd CommandFunc, conn *sql.Conn, dbVendor string, patterns []string) ([]string, error) {
+	query, args, err := cmd("tables", dbVendor, nil)
+	if err != nil {
+		return nil, err
+	}
+	all, err := ReadFirstColumn(ctx, conn, query, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read origin tables: %w", err)
+	}
+	if len(patterns) == 0 {
+		patterns = []string{"*"}
+	}
+
+	var names []string
+	for _, name := range all {
+		if dbVendor == types.DBVendorSQLite && strings.HasPrefix(name, "sqlite_") {
+			continue // internal tables
+		}
+		for _, pattern := range patterns {
+			if ok, err := path.Match(pattern, name); err != nil {
+				return nil, fmt.Errorf("invalid table pattern %q: %w", pattern, err)
+			} else if ok {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	return names, nil
+}
+
+// sortTablesByDependency orders tables so that referenced tables come first.
+// Tables in a reference cycle keep their original order, after the others.
+func sortTablesByDependency(ctx context.Context, cmd CommandFunc, conn *sql.Conn, dbVendor string, names []string) ([]string, error) {
+	query, _, err := cmd("table-foreign-keys", dbVendor, []string{names[0]})
+	if err != nil || query == "" {
+		return names, nil // no foreign keys for this vendor
+	}
+
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		selected[name] = true
+	}
+	references := make(map[string][]string, len(names))
+	for _, name := range names {
+		query, args, err := cmd("table-foreign-keys", dbVendor, []string{name})
+		if err != nil {
+			return nil, err
+		}
+		referenced, err := ReadFirstColumn(ctx, conn, query, args)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read foreign keys of %s: %w", name, err)
+		}
+		for _, ref := range referenced {
+			if selected[ref] && ref != name {
+				references[name] = append(references[name], ref)
+			}
+		}
+	}
+
+	sorted := make([]string, 0, len(names))
+	done := make(map[string]bool, len(names))
+	for len(sorted) < len(names) {
+		progress := false
+		for _, name := range names {
+			if done[name] {
+				continue
+			}
+			ready := true
+			for _, ref := range references[name] {
+				if !done[ref] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				sorted = append(sorted, name)
+				done[name] = true
+				progress = true
+			}
+		}
+		if !progress { // cycle
+			for _, name := range names {
+				if !done[name] {
+					sorted = append(sorted, name)
+					done[name] = true
+				}
+			}
+		}
+	}
+	return sorted, nil
+}
+
+// copyTable creates one table in the destination and copies its rows.
+func copyTable(ctx context.Context, cmd CommandFunc, origin *sql.Conn, originVendor string, dest *sql.Conn, destVendor string, table string, maxRows int64) (result TableCopyResult) {
+	result.Table = table
+	fail := func(format string, a ...any) TableCopyResult {
+		result.Error = fmt.Sprintf(format, a...)
+		return result
+	}
+
+	// origin table definition, read before the row reader holds the connection
+	var columns []TableColumn
+	if query, args, err := cmd("table-columns", originVendor, []string{table}); err == nil && query != "" {
+		if columns, err = ReadTableColumns(ctx, origin, originVendor, query, args); err != nil {
+			return fail("failed to read table columns: %v", err)
+		}
+	}
+	var indexes []TableIndex
+	if query, args, err := cmd("table-indexes", originVendor, []string{table}); err == nil && query != "" {
+		if indexes, err = ReadTableIndexes(ctx, origin, query, args); err != nil {
+			return fail("failed to read table indexes: %v", err)
+		}
+	}
+
+	src, err := NewDBRowReader(ctx, origin, originVendor, "select * from "+dbutil.QuoteIdentifier(originVendor, table))
+	if err != nil {
+		return fail("%v", err)
+	}
+	if columns != nil {
+		src = WithTableColumns(src, columns)
+	}
+	if maxRows > 0 {
+		src = WithRowLimit(src, maxRows)
+	}
+
+	tx, err := dest.BeginTx(ctx, nil)
+	if err != nil {
+		return fail("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // Safe to call even if already committed
+
+	dst, err := NewDBRowWriter(ctx, tx, destVendor, table, true, src.Fields())
+	if err != nil {
+		return fail("%v", err)
+	}
+	if result.Reads, result.Writes, err = CopyData(src, dst); err != nil {
+		return fail("%v", err)
+	}
+
+	for _, index := range indexes {
+		query, err := dbutil.CreateIndexDDL(destVendor, table, index.Name, index.Columns, index.Unique)
+		if err != nil {
+			result.Skip = append(result.Skip, index.Name)
+			continue
+		}
+		if _, err = tx.ExecContext(ctx, query); err != nil {
+			return fail("failed to create index %s: %v", index.Name, err)
+		}
+		result.DDL = append(result.DDL, query)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fail("failed to commit transaction: %v", err)
+	}
+	return result
+}
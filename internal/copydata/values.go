@@ -0,0 +1,333 @@
+package copydata
+
+import (
+	"db-portal/internal/dbutil"
+	"db-portal/internal/types"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/wkb"
+)
+
+// Values read from a DB are normalized according to their canonical type,
+// so that writers get the same representation whatever the origin vendor:
+// - json: json.RawMessage
+// - array: []any, or a driver slice (ex: ClickHouse []string)
+// - geometry: WKB []byte
+// - interval: string
+// - timestamptz, datetime: time.Time
+
+// readValue normalizes a value scanned from a DB.
+func readValue(v any, t dbutil.ColumnType, dbVendor string) any {
+	if v == nil {
+		return nil
+	}
+	switch t.Canonical {
+	case "json":
+		return jsonValue(v)
+	case "array":
+		switch s := v.(type) {
+		case []byte:
+			return parsePGArray(string(s), t.Element)
+		case string:
+			return parsePGArray(s, t.Element)
+		}
+	case "geometry":
+		return geometryValue(v, dbVendor)
+	case "interval":
+		if d, ok := v.(time.Duration); ok {
+			return d.String()
+		}
+	}
+	return v
+}
+
+// jsonValue returns v as json.RawMessage. Strings and bytes are expected to hold JSON,
+// other values (ex: ClickHouse Map or Tuple) are marshaled.
+func jsonValue(v any) any {
+	var b []byte
+	switch s := v.(type) {
+	case json.RawMessage:
+		return s
+	case []byte:
+		b = s
+	case string:
+		b = []byte(s)
+	default:
+		var err error
+		if b, err = json.Marshal(v); err != nil {
+			return fmt.Sprint(v)
+		}
+	}
+	if !json.Valid(b) {
+		return string(b)
+	}
+	return json.RawMessage(b)
+}
+
+// geometryValue returns v as WKB.
+// Supported: MySQL (SRID + WKB), PostGIS (hex EWKB), ClickHouse (orb geometries).
+// Other formats (ex: MSSQL native serialization) are returned unchanged,
+// use a query origin with geometry.STAsBinary() to convert them.
+func geometryValue(v any, dbVendor string) any {
+	switch g := v.(type) {
+	case orb.Geometry:
+		if b, err := wkb.Marshal(g); err == nil {
+			return b
+		}
+	case string:
+		if b, err := hex.DecodeString(g); err == nil && dbVendor == types.DBVendorPostgres {
+			return ewkbToWKB(b)
+		}
+	case []byte:
+		switch dbVendor {
+		case types.DBVendorMySQL, types.DBVendorMariaDB:
+			if len(g) > 4 {
+				return g[4:] // internal format: 4 bytes SRID followed by WKB
+			}
+		case types.DBVendorPostgres:
+			return ewkbToWKB(g)
+		}
+	}
+	return v
+}
+
+// ewkbToWKB removes the PostGIS SRID from an EWKB geometry.
+func ewkbToWKB(b []byte) []byte {
+	const sridFlag = 0x20000000
+	if len(b) < 9 || b[0] > 1 {
+		return b
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if b[0] == 1 {
+		order = binary.LittleEndian
+	}
+	geomType := order.Uint32(b[1:5])
+	if geomType&sridFlag == 0 {
+		return b
+	}
+	out := make([]byte, 5, len(b)-4)
+	out[0] = b[0]
+	order.PutUint32(out[1:5], geomType&^sridFlag)
+	return append(out, b[9:]...)
+}
+
+// parsePGArray parses a PostgreSQL array literal, ex: {1,2,NULL}, {"a b","c"} or {{1,2},{3,4}}.
+// Elements are converted according to the element canonical type, nested arrays are []any.
+// A value that is not an array literal is returned unchanged.
+func parsePGArray(s string, element string) any {
+	if len(s) < 2 || s[0] != '{' || s[len(s)-1] != '}' {
+		return s
+	}
+	elements, end := parsePGArrayElements(s, 1, element)
+	if end != len(s) {
+		return s
+	}
+	return elements
+}
+
+// parsePGArrayElements parses the elements of an array literal from i, after its opening brace,
+// and returns them with the index after its closing brace, -1 when the array is not closed.
+func parsePGArrayElements(s string, i int, element string) ([]any, int) {
+	elements := []any{}
+	if i < len(s) && s[i] == '}' {
+		return elements, i + 1
+	}
+	for i < len(s) {
+		switch s[i] {
+		case '{':
+			var nested []any
+			if nested, i = parsePGArrayElements(s, i+1, element); i == -1 {
+				return nil, -1
+			}
+			elements = append(elements, nested)
+		case '"':
+			var item strings.Builder
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				item.WriteByte(s[i])
+			}
+			i++ // closing quote
+			elements = append(elements, arrayElement(item.String(), element))
+		default:
+			start := i
+			for i < len(s) && s[i] != ',' && s[i] != '}' {
+				i++
+			}
+			if item := s[start:i]; strings.EqualFold(item, "NULL") {
+				elements = append(elements, nil)
+			} else {
+				elements = append(elements, arrayElement(item, element))
+			}
+		}
+		if i < len(s) && s[i] == '}' {
+			return elements, i + 1
+		}
+		i++ // comma
+	}
+	return nil, -1
+}
+
+// arrayElement converts an array element literal to a Go value.
+func arrayElement(s string, element string) any {
+	switch element {
+	case "int", "bigint", "smallint":
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	case "float":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	}
+	return s
+}
+
+// formatPGArray returns a PostgreSQL array literal, nested slices are nested arrays.
+func formatPGArray(elements []any) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, e := range elements {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if e == nil {
+			b.WriteString("NULL")
+			continue
+		}
+		if nested, ok := sliceElements(e); ok {
+			b.WriteString(formatPGArray(nested))
+			continue
+		}
+		s := toString(e)
+		s = strings.ReplaceAll(s, `\`, `\\`)
+		s = strings.ReplaceAll(s, `"`, `\"`)
+		b.WriteString(`"` + s + `"`)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// sliceElements returns the elements of any slice but []byte.
+func sliceElements(v any) ([]any, bool) {
+	if elements, ok := v.([]any); ok {
+		return elements, true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+	elements := make([]any, rv.Len())
+	for i := range elements {
+		elements[i] = rv.Index(i).Interface()
+	}
+	return elements, true
+}
+
+// fileValue encodes a value for a file writer. All file formats share the same encoding:
+// - json and arrays: JSON (json.RawMessage, []any)
+// - geometry: hex encoded WKB
+// - time.Time: RFC 3339 with nanoseconds, time zone offset is kept
+func fileValue(v any, t dbutil.ColumnType) any {
+	switch s := v.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		return s.Format(time.RFC3339Nano)
+	case []byte:
+		if t.Canonical == "geometry" {
+			return strings.ToUpper(hex.EncodeToString(s))
+		}
+	}
+	return v
+}
+
+// textValue returns the text of an encoded file value, JSON for json, arrays and maps.
+func textValue(v any) string {
+	switch s := v.(type) {
+	case json.RawMessage:
+		return string(s)
+	case string, []byte:
+		return toString(s)
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice || rv.Kind() == reflect.Map {
+		if b, err := json.Marshal(v); err == nil {
+			return string(b)
+		}
+	}
+	return toString(v)
+}
+
+// dbValue converts a value for a DB writer, according to the destination vendor and column type.
+func dbValue(v any, t dbutil.ColumnType, dbVendor string) any {
+	if v == nil {
+		return nil
+	}
+	if raw, ok := v.(json.RawMessage); ok {
+		return string(raw)
+	}
+
+	switch t.Canonical {
+	case "array":
+		elements, ok := sliceElements(v)
+		if !ok {
+			return v
+		}
+		switch dbVendor {
+		case types.DBVendorPostgres:
+			return formatPGArray(elements)
+		case types.DBVendorClickHouse:
+			return elements
+		default:
+			return textValue(elements) // json array
+		}
+	case "json":
+		if _, ok := v.(string); !ok {
+			return textValue(v)
+		}
+	case "timestamptz":
+		if tt, ok := v.(time.Time); ok {
+			switch dbVendor {
+			case types.DBVendorMySQL, types.DBVendorMariaDB:
+				return tt.UTC()
+			case types.DBVendorSQLite:
+				return tt.Format(time.RFC3339Nano)
+			}
+		}
+	case "geometry":
+		if b, ok := v.([]byte); ok && dbVendor == types.DBVendorClickHouse {
+			return strings.ToUpper(hex.EncodeToString(b))
+		}
+	}
+	return v
+}
+
+// geometryPlaceholder wraps a placeholder with the vendor function converting WKB to geometry.
+func geometryPlaceholder(dbVendor, placeholder string) string {
+	switch dbVendor {
+	case types.DBVendorPostgres, types.DBVendorMySQL, types.DBVendorMariaDB:
+		return "ST_GeomFromWKB(" + placeholder + ")"
+	case types.DBVendorMSSQL:
+		return "geometry::STGeomFromWKB(" + placeholder + ", 0)"
+	}
+	return placeholder
+}
+
+// isJSONText reports whether a column stores JSON text and needs a JSON check constraint.
+func isJSONText(t dbutil.ColumnType, dbVendor string) bool {
+	return dbVendor == types.DBVendorMSSQL && t.Override == "" && (t.Canonical == "json" || t.Canonical == "array") &&
+		strings.HasPrefix(strings.ToUpper(t.VendorType(dbVendor)), "NVARCHAR")
+}
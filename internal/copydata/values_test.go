@@ -0,0 +1,105 @@
+package copydata
+
+import (
+	"bytes"
+	"db-portal/internal/dbutil"
+	"db-portal/internal/types"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePGArray(t *testing.T) {
+	tests := []struct {
+		s       string
+		element string
+		want    any
+	}{
+		{"{}", "int", []any{}},
+		{"{1,2,NULL}", "int", []any{int64(1), int64(2), nil}},
+		{"{1.5,-2}", "float", []any{1.5, -2.0}},
+		{"{t,f}", "boolean", []any{true, false}},
+		{`{"a b",c,"NULL",null}`, "varchar", []any{"a b", "c", "NULL", nil}},
+		{`{"a,b","say \"hi\"","back\\slash","{x}"}`, "varchar", []any{"a,b", `say "hi"`, `back\slash`, "{x}"}},
+		{"{{1,2},{3,NULL}}", "int", []any{[]any{int64(1), int64(2)}, []any{int64(3), nil}}},
+		{`{{"a}",b},{}}`, "varchar", []any{[]any{"a}", "b"}, []any{}}},
+		{"{1,x}", "int", []any{int64(1), "x"}}, // not a number: kept as text
+		{"not an array", "int", "not an array"},
+		{"{{1,2}", "int", "{{1,2}"},
+		{"{1}}", "int", "{1}}"},
+	}
+	for _, tt := range tests {
+		if got := parsePGArray(tt.s, tt.element); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePGArray(%q, %s) = %#v, want %#v", tt.s, tt.element, got, tt.want)
+		}
+	}
+}
+
+func TestFormatPGArray(t *testing.T) {
+	tests := []struct {
+		elements []any
+		want     string
+	}{
+		{[]any{}, "{}"},
+		{[]any{int64(1), nil, 2.5}, `{"1",NULL,"2.5"}`},
+		{[]any{"a,b", `say "hi"`, `back\slash`, "NULL"}, `{"a,b","say \"hi\"","back\\slash","NULL"}`},
+		{[]any{[]any{int64(1), int64(2)}, []int64{3, 4}}, `{{"1","2"},{"3","4"}}`},
+	}
+	for _, tt := range tests {
+		if got := formatPGArray(tt.elements); got != tt.want {
+			t.Errorf("formatPGArray(%#v) = %s, want %s", tt.elements, got, tt.want)
+		}
+	}
+}
+
+func TestEWKBToWKB(t *testing.T) {
+	tests := []struct {
+		name       string
+		ewkb, want string // hex
+	}{
+		{"little endian with SRID", "0101000020E6100000000000000000F03F0000000000000040", "0101000000000000000000F03F0000000000000040"},
+		{"big endian with SRID", "0020000001000010E63FF00000000000004000000000000000", "00000000013FF00000000000004000000000000000"},
+		{"without SRID", "0101000000000000000000F03F0000000000000040", "0101000000000000000000F03F0000000000000040"},
+		{"too short", "0101000020", "0101000020"},
+		{"invalid byte order", "0201000020E6100000000000000000F03F", "0201000020E6100000000000000000F03F"},
+	}
+	for _, tt := range tests {
+		b, _ := hex.DecodeString(tt.ewkb)
+		want, _ := hex.DecodeString(tt.want)
+		if got := ewkbToWKB(b); !bytes.Equal(got, want) {
+			t.Errorf("ewkbToWKB %s = %X, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDBValue(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.FixedZone("", 3600))
+	array := dbutil.ColumnType{Canonical: "array"}
+	tests := []struct {
+		value  any
+		typ    dbutil.ColumnType
+		vendor string
+		want   any
+	}{
+		{nil, array, types.DBVendorPostgres, nil},
+		{json.RawMessage(`{"a":1}`), dbutil.ColumnType{Canonical: "json"}, types.DBVendorMySQL, `{"a":1}`},
+		{map[string]any{"a": 1}, dbutil.ColumnType{Canonical: "json"}, types.DBVendorPostgres, `{"a":1}`},
+		{`{"a":1}`, dbutil.ColumnType{Canonical: "json"}, types.DBVendorPostgres, `{"a":1}`},
+		{[]any{"a", nil}, array, types.DBVendorPostgres, `{"a",NULL}`},
+		{[]string{"a", "b"}, array, types.DBVendorClickHouse, []any{"a", "b"}},
+		{[]any{int64(1), "b"}, array, types.DBVendorMySQL, `[1,"b"]`},
+		{"{1,2}", array, types.DBVendorPostgres, "{1,2}"}, // not a slice: unchanged
+		{ts, dbutil.ColumnType{Canonical: "timestamptz"}, types.DBVendorMySQL, ts.UTC()},
+		{ts, dbutil.ColumnType{Canonical: "timestamptz"}, types.DBVendorSQLite, "2024-01-02T03:04:05.6+01:00"},
+		{ts, dbutil.ColumnType{Canonical: "timestamptz"}, types.DBVendorPostgres, ts},
+		{[]byte{0x01, 0xab}, dbutil.ColumnType{Canonical: "geometry"}, types.DBVendorClickHouse, "01AB"},
+		{[]byte{0x01, 0xab}, dbutil.ColumnType{Canonical: "geometry"}, types.DBVendorPostgres, []byte{0x01, 0xab}},
+	}
+	for _, tt := range tests {
+		if got := dbValue(tt.value, tt.typ, tt.vendor); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("dbValue(%#v, %s, %s) = %#v, want %#v", tt.value, tt.typ.Canonical, tt.vendor, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package copydata
+
+import (
+	"context"
+	"database/sql"
+	"db-portal/internal/dbutil"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// WatermarkRowReader reads the rows of a table or query origin beyond the last high-water mark,
+// ordered by the watermark column, and keeps track of the new high-water mark.
+type WatermarkRowReader struct {
+	RowReader
+	index int    // watermark column index
+	last  string // high-water mark of the rows read so far
+}
+
+// NewWatermarkRowReader returns a reader of the origin rows whose watermark column is greater than last.
+// All rows are read when last is empty.
+// The watermark column must be a timestamp or a monotonically increasing number.
+func NewWatermarkRowReader(ep EndPoint, ctx context.Context, conn *sql.Conn, last string) (*WatermarkRowReader, error) {
+	var from string
+	switch ep.Type {
+	case "table":
+		from = ep.Table
+	case "query":
+		from = "(" + ep.Query + ") q"
+	default:
+		return nil, fmt.Errorf("watermark is not supported for %s origin", ep.Type)
+	}
+	column := dbutil.QuoteIdentifier(ep.DBVendor, ep.Watermark)
+
+	query := "select * from " + from
+	var args []any
+	if last != "" {
+		placeholders, err := dbutil.SetPlaceholders(ep.DBVendor, 1)
+		if err != nil {
+			return nil, err
+		}
+		query += " where " + column + " > " + placeholders[0]
+		args = append(args, parseWatermark(last))
+	}
+	query += " order by " + column
+
+	r, err := NewDBRowReader(ctx, conn, ep.DBVendor, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	index := -1
+	for i, field := range r.Fields() {
+		if field == ep.Watermark {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return nil, fmt.Errorf("watermark column %s not found in origin", ep.Watermark)
+	}
+	return &WatermarkRowReader{RowReader: r, index: index, last: last}, nil
+}
+
+func (r *WatermarkRowReader) ReadRow() (Row, error) {
+	row, err := r.RowReader.ReadRow()
+	if err == nil && row[r.index] != nil {
+		r.last = formatWatermark(row[r.index]) // rows are ordered by watermark
+	}
+	return row, err
+}
+
+// Last returns the high-water mark of the rows read, the initial one if no row was read.
+func (r *WatermarkRowReader) Last() string { return r.last }
+
+// formatWatermark returns the text of a watermark value, as stored in the internal DB.
+func formatWatermark(v any) string {
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	return toString(v)
+}
+
+// parseWatermark returns a stored watermark as a query argument: a number, a time or a string.
+func parseWatermark(s string) any {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t
+	}
+	return s
+}
@@ -1,8 +1,8 @@
 package copydata
 
 import (
+	"db-portal/internal/dbutil"
 	"errors"
-	"fmt"
 	"io"
 
 	"github.com/tealeg/xlsx"
@@ -13,7 +13,7 @@ type xlsxRowReader struct {
 	file     *xlsx.File
 	sheet    *xlsx.Sheet
 	fields   []string
-	types    []string
+	types    []dbutil.ColumnType
 	rowIndex int
 }
 
@@ -102,14 +102,15 @@ func (x *xlsxRowReader) ReadRow() (Row, error) {
 	return row, nil
 }
 
-func (x *xlsxRowReader) Fields() []string { return x.fields }
-func (x *xlsxRowReader) Types() []string  { return x.types }
+func (x *xlsxRowReader) Fields() []string           { return x.fields }
+func (x *xlsxRowReader) Types() []dbutil.ColumnType { return x.types }
 
 // xlsxRowWriter
 type xlsxRowWriter struct {
 	file    *xlsx.File
 	sheet   *xlsx.Sheet
 	fields  []string
+	types   []dbutil.ColumnType
 	writer  io.Writer
 	written bool
 }
@@ -132,8 +133,9 @@ func NewXLSXRowWriter(w io.Writer) (RowWriter, error) {
 	}, nil
 }
 
-func (x *xlsxRowWriter) WriteFields(fields []string, types []string) error {
+func (x *xlsxRowWriter) WriteFields(fields []string, types []dbutil.ColumnType) error {
 	x.fields = append([]string{}, fields...)
+	x.types = types
 
 	// Write header row
 	if len(x.fields) > 0 {
@@ -153,7 +155,7 @@ func (x *xlsxRowWriter) WriteRow(row Row) (rowsWritten int, err error) {
 	for i := range x.fields {
 		cell := xlsxRow.AddCell()
 		if i < len(row) && row[i] != nil {
-			switch v := row[i].(type) {
+			switch v := fileValue(row[i], typeAt(x.types, i)).(type) {
 			case string:
 				cell.Value = v
 			case int:
@@ -173,7 +175,7 @@ func (x *xlsxRowWriter) WriteRow(row Row) (rowsWritten int, err error) {
 			case bool:
 				cell.SetBool(v)
 			default:
-				cell.Value = fmt.Sprintf("%v", v)
+				cell.Value = textValue(v)
 			}
 		}
 	}
@@ -0,0 +1,271 @@
+// Package cursor keeps query results open between requests, so that the SQL editor fetches the next pages
+// without running the query again. A cursor holds a dedicated connection until it is fully read,
+// closed explicitly or idle for too long.
+package cursor
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"db-portal/internal/dbutil"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned for an unknown, closed or expired cursor, or a cursor of another user.
+var ErrNotFound = errors.New("cursor not found or expired")
+
+// Cursor is an open query result.
+type Cursor struct {
+	ID     string
+	DSName string // data source, schema and query, to count the rows on another connection
+	Schema string
+	Query  string
+	Args   []any
+
+	username string
+	conn     *sql.Conn
+	rows     *sql.Rows
+	cancel   context.CancelFunc
+	cols     []string
+	dbTypes  []string
+	next     []any // row read ahead, to know whether there are more rows
+	fetched  int64
+	done     bool
+	lastUsed time.Time
+	mu       sync.Mutex
+}
+
+// Manager holds the open cursors of all users.
+type Manager struct {
+	idleTimeout time.Duration
+	maxPerUser  int
+	mu          sync.Mutex
+	cursors     map[string]*Cursor
+}
+
+// NewManager returns a cursor manager. Defaults are 5 minutes and 5 cursors per user.
+func NewManager(idleTimeout time.Duration, maxPerUser int) *Manager {
+	if idleTimeout <= 0 {
+		idleTimeout = 5 * time.Minute
+	}
+	if maxPerUser <= 0 {
+		maxPerUser = 5
+	}
+	return &Manager{
+		idleTimeout: idleTimeout,
+		maxPerUser:  maxPerUser,
+		cursors:     map[string]*Cursor{},
+	}
+}
+
+// Start closes the idle cursors every 30 seconds, until ctx is done.
+func (m *Manager) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.closeIdle(time.Now().Add(-m.idleTimeout))
+			}
+		}
+	}()
+}
+
+func (m *Manager) closeIdle(before time.Time) {
+	var idle []*Cursor
+	m.mu.Lock()
+	for id, c := range m.cursors {
+		if c.lastUsed.Before(before) {
+			idle = append(idle, c)
+			delete(m.cursors, id)
+		}
+	}
+	m.mu.Unlock()
+	for _, c := range idle {
+		c.close()
+	}
+}
+
+// Open runs a query on conn and returns a cursor on its rows. The cursor owns conn, which is closed with the cursor.
+// When the user has too many cursors, the least recently used one is closed.
+// The query runs with its own context: it is not canceled at the end of the request.
+func (m *Manager) Open(username string, conn *sql.Conn, dsName, schema, query string, args []any) (c *Cursor, dResult dbutil.DBResult, err error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	startTime := time.Now()
+	rows, err := conn.QueryContext(ctx, query, args...)
+	dResult.Duration = time.Since(startTime)
+	if err != nil {
+		cancel()
+		dResult.DBerror = err.Error()
+		return nil, dResult, err
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		cancel()
+		return nil, dResult, err
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	c = &Cursor{
+		ID:       hex.EncodeToString(id),
+		DSName:   dsName,
+		Schema:   schema,
+		Query:    query,
+		Args:     args,
+		username: username,
+		conn:     conn,
+		rows:     rows,
+		cancel:   cancel,
+		cols:     cols,
+		dbTypes:  dbutil.DatabaseTypes(rows, len(cols)),
+		lastUsed: time.Now(),
+	}
+
+	var evicted *Cursor
+	m.mu.Lock()
+	count := 0
+	for _, other := range m.cursors {
+		if other.username != username {
+			continue
+		}
+		count++
+		if evicted == nil || other.lastUsed.Before(evicted.lastUsed) {
+			evicted = other
+		}
+	}
+	if count < m.maxPerUser {
+		evicted = nil
+	} else {
+		delete(m.cursors, evicted.ID)
+	}
+	m.cursors[c.ID] = c
+	m.mu.Unlock()
+
+	if evicted != nil {
+		evicted.close()
+	}
+	return c, dResult, nil
+}
+
+// Get returns a cursor of the user.
+func (m *Manager) Get(username, id string) (*Cursor, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.cursors[id]
+	if !ok || c.username != username {
+		return nil, ErrNotFound
+	}
+	c.lastUsed = time.Now()
+	return c, nil
+}
+
+// Close closes a cursor of the user.
+func (m *Manager) Close(username, id string) error {
+	m.mu.Lock()
+	c, ok := m.cursors[id]
+	if !ok || c.username != username {
+		m.mu.Unlock()
+		return ErrNotFound
+	}
+	delete(m.cursors, id)
+	m.mu.Unlock()
+
+	c.close()
+	return nil
+}
+
+// Fetch reads the next rows of a cursor, at most size. The result CursorID is set while rows remain,
+// otherwise the cursor is closed.
+func (m *Manager) Fetch(c *Cursor, size int64) (dResult dbutil.DBResult, err error) {
+	c.mu.Lock()
+	startTime := time.Now()
+	dResult, err = c.fetch(size)
+	dResult.Duration = time.Since(startTime)
+	done := c.done
+	c.mu.Unlock()
+
+	if done {
+		m.Close(c.username, c.ID)
+	}
+	return
+}
+
+func (c *Cursor) fetch(size int64) (dResult dbutil.DBResult, err error) {
+	dResult.Cols = c.cols
+	dResult.DatabaseTypes = c.dbTypes
+	dResult.StmtType = "query"
+	if c.rows == nil {
+		return dResult, ErrNotFound
+	}
+
+	for int64(len(dResult.Rows)) < size {
+		row, err := c.read()
+		if err != nil {
+			dResult.DBerror = err.Error()
+			c.done = true
+			return dResult, err
+		}
+		if row == nil {
+			break
+		}
+		dResult.Rows = append(dResult.Rows, row)
+	}
+	dResult.RowsReturned = int64(len(dResult.Rows))
+	c.fetched += dResult.RowsReturned
+
+	// read ahead
+	if !c.done {
+		if c.next, err = c.read(); err != nil {
+			dResult.DBerror = err.Error()
+			c.done = true
+			return dResult, err
+		}
+		c.done = c.next == nil
+	}
+	if !c.done {
+		dResult.Truncated = true
+		dResult.CursorID = c.ID
+	}
+	return dResult, nil
+}
+
+// read returns the next row, nil at the end of the rows.
+func (c *Cursor) read() ([]any, error) {
+	if row := c.next; row != nil {
+		c.next = nil
+		return row, nil
+	}
+	if c.done || !c.rows.Next() {
+		c.done = true
+		return nil, c.rows.Err()
+	}
+	return dbutil.ScanRow(c.rows, len(c.cols))
+}
+
+// Fetched returns the number of rows already fetched.
+func (c *Cursor) Fetched() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fetched
+}
+
+// close releases the rows and the connection. It waits for a running fetch.
+func (c *Cursor) close() {
+	c.cancel()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rows != nil {
+		c.rows.Close()
+		c.conn.Close()
+		c.rows = nil
+		c.done = true
+	}
+}
@@ -3,8 +3,11 @@ package dbutil
 import (
 	"context"
 	"database/sql"
+	"db-portal/internal/types"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 )
 
 // Cache for *sql.DB (DB is a database handle representing a pool of zero or more underlying connections.)
@@ -57,3 +60,73 @@ func GetConn(ctx context.Context, vendor string, location string, useCache bool)
 
 	return
 }
+
+// readOnlyCommands make the transactions of a connection read-only, by vendor.
+// SQLite databases are opened read-only instead, see ReadOnlyLocation. MSSQL and ClickHouse have no such session
+// setting, their read-only access relies on statement classification.
+var readOnlyCommands = map[string]string{
+	types.DBVendorPostgres: "SET SESSION CHARACTERISTICS AS TRANSACTION READ ONLY",
+	types.DBVendorMySQL:    "SET SESSION TRANSACTION READ ONLY",
+	types.DBVendorMariaDB:  "SET SESSION TRANSACTION READ ONLY",
+}
+
+// ReadOnlyLocation returns the location of a read-only connection: the SQLite database file is opened with
+// the mode=ro URI parameter, which no statement of the connection can undo. Other locations are unchanged.
+func ReadOnlyLocation(vendor string, location string) string {
+	if vendor != types.DBVendorSQLite {
+		return location
+	}
+	if !strings.HasPrefix(location, "file:") {
+		location = "file:" + strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(location)
+	}
+	location, fragment, _ := strings.Cut(location, "#")
+	path, query, _ := strings.Cut(location, "?")
+	params := []string{}
+	for _, param := range strings.Split(query, "&") {
+		if param != "" && !strings.HasPrefix(param, "mode=") {
+			params = append(params, param)
+		}
+	}
+	location = path + "?" + strings.Join(append(params, "mode=ro"), "&")
+	if fragment != "" {
+		location += "#" + fragment
+	}
+	return location
+}
+
+// SetReadOnly makes a connection read-only when the vendor supports it, and reports whether it does.
+func SetReadOnly(ctx context.Context, conn *sql.Conn, vendor string) (bool, error) {
+	command, ok := readOnlyCommands[vendor]
+	if !ok {
+		return false, nil
+	}
+	if _, err := conn.ExecContext(ctx, command); err != nil {
+		return false, fmt.Errorf("cannot set read-only connection. %v", err)
+	}
+	return true, nil
+}
+
+// SetStatementTimeout limits the duration of the next statements of a connection when the vendor supports it,
+// and reports whether it does. A 0 timeout does nothing.
+// MySQL max_execution_time applies to SELECT statements only. ClickHouse gets its max_execution_time from the
+// context deadline of each statement, set by its driver. MSSQL and SQLite statements are stopped by the context deadline.
+func SetStatementTimeout(ctx context.Context, conn *sql.Conn, vendor string, timeout time.Duration) (bool, error) {
+	if timeout <= 0 {
+		return false, nil
+	}
+	var command string
+	switch vendor {
+	case types.DBVendorPostgres:
+		command = fmt.Sprintf("SET statement_timeout = %d", timeout.Milliseconds())
+	case types.DBVendorMySQL:
+		command = fmt.Sprintf("SET SESSION max_execution_time = %d", timeout.Milliseconds())
+	case types.DBVendorMariaDB:
+		command = fmt.Sprintf("SET SESSION max_statement_time = %g", timeout.Seconds())
+	default:
+		return false, nil
+	}
+	if _, err := conn.ExecContext(ctx, command); err != nil {
+		return false, fmt.Errorf("cannot set statement timeout. %v", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,25 @@
+package dbutil
+
+import (
+	"db-portal/internal/types"
+	"testing"
+)
+
+func TestReadOnlyLocation(t *testing.T) {
+	tests := []struct {
+		vendor   string
+		location string
+		want     string
+	}{
+		{types.DBVendorSQLite, "data/my db.sqlite", "file:data/my db.sqlite?mode=ro"},
+		{types.DBVendorSQLite, "data/a?b#c%d.db", "file:data/a%3fb%23c%25d.db?mode=ro"},
+		{types.DBVendorSQLite, "file:test.db?cache=shared&mode=rw", "file:test.db?cache=shared&mode=ro"},
+		{types.DBVendorSQLite, "file:test.db?mode=rwc#x", "file:test.db?mode=ro#x"},
+		{types.DBVendorPostgres, "postgres://u@h/db?sslmode=disable", "postgres://u@h/db?sslmode=disable"},
+	}
+	for _, tt := range tests {
+		if got := ReadOnlyLocation(tt.vendor, tt.location); got != tt.want {
+			t.Errorf("ReadOnlyLocation(%s, %q) = %q, want %q", tt.vendor, tt.location, got, tt.want)
+		}
+	}
+}
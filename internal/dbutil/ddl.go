@@ -0,0 +1,86 @@
+package dbutil
+
+import (
+	"db-portal/internal/types"
+	"fmt"
+	"strings"
+)
+
+// AddColumnDDL returns the ALTER TABLE statement adding a column to an existing table.
+func AddColumnDDL(dbVendor, table, column, sqlType string) string {
+	query := "ALTER TABLE " + QuoteIdentifier(dbVendor, table)
+	if dbVendor == types.DBVendorMSSQL {
+		query += " ADD "
+	} else {
+		query += " ADD COLUMN "
+	}
+	return query + QuoteIdentifier(dbVendor, column) + " " + sqlType
+}
+
+// ColumnAttributes are the attributes of an existing column that AlterColumnTypeDDL re-emits,
+// so that changing the column type keeps its constraints.
+type ColumnAttributes struct {
+	NotNull     bool
+	Default     *string // default value, nil if none
+	DefaultExpr bool    // Default is an expression, not a literal
+	Comment     string
+}
+
+// AlterColumnTypeDDL returns the ALTER TABLE statement changing the type of an existing column.
+// MySQL and MariaDB redefine the whole column, and MSSQL the nullability, so the attributes
+// of the existing column are repeated. SQLite has no way to alter a column type, an error is returned.
+func AlterColumnTypeDDL(dbVendor, table, column, sqlType string, attrs ColumnAttributes) (query string, err error) {
+	table = QuoteIdentifier(dbVendor, table)
+	column = QuoteIdentifier(dbVendor, column)
+	null := " NULL"
+	if attrs.NotNull {
+		null = " NOT NULL"
+	}
+	switch dbVendor {
+	case types.DBVendorPostgres:
+		query = "ALTER TABLE " + table + " ALTER COLUMN " + column + " TYPE " + sqlType
+	case types.DBVendorMSSQL:
+		query = "ALTER TABLE " + table + " ALTER COLUMN " + column + " " + sqlType + null
+	case types.DBVendorMySQL, types.DBVendorMariaDB:
+		query = "ALTER TABLE " + table + " MODIFY COLUMN " + column + " " + sqlType + null
+		if attrs.Default != nil {
+			if attrs.DefaultExpr {
+				query += " DEFAULT (" + *attrs.Default + ")"
+			} else {
+				query += " DEFAULT " + mysqlLiteral(*attrs.Default)
+			}
+		}
+		if attrs.Comment != "" {
+			query += " COMMENT " + mysqlLiteral(attrs.Comment)
+		}
+	case types.DBVendorClickHouse:
+		query = "ALTER TABLE " + table + " MODIFY COLUMN " + column + " " + sqlType
+	default:
+		err = fmt.Errorf("altering a column type is not supported for %s", dbVendor)
+	}
+	return
+}
+
+// mysqlLiteral returns s as a MySQL string literal.
+func mysqlLiteral(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", "''").Replace(s) + "'"
+}
+
+// CreateIndexDDL returns the CREATE INDEX statement of a table index.
+// ClickHouse has no secondary indexes of this kind, an error is returned.
+func CreateIndexDDL(dbVendor, table, index string, columns []string, unique bool) (query string, err error) {
+	if dbVendor == types.DBVendorClickHouse {
+		err = fmt.Errorf("creating an index is not supported for %s", dbVendor)
+		return
+	}
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = QuoteIdentifier(dbVendor, col)
+	}
+	query = "CREATE INDEX "
+	if unique {
+		query = "CREATE UNIQUE INDEX "
+	}
+	query += QuoteIdentifier(dbVendor, index) + " ON " + QuoteIdentifier(dbVendor, table) + " (" + strings.Join(quoted, ",") + ")"
+	return
+}
@@ -0,0 +1,31 @@
+package dbutil
+
+import (
+	"db-portal/internal/types"
+	"testing"
+)
+
+func TestAlterColumnTypeDDL(t *testing.T) {
+	def, expr := "it's", "uuid()"
+	tests := []struct {
+		vendor string
+		attrs  ColumnAttributes
+		want   string
+	}{
+		{types.DBVendorPostgres, ColumnAttributes{NotNull: true, Default: &def}, `ALTER TABLE "t" ALTER COLUMN "c" TYPE varchar(100)`},
+		{types.DBVendorMSSQL, ColumnAttributes{NotNull: true}, `ALTER TABLE [t] ALTER COLUMN [c] varchar(100) NOT NULL`},
+		{types.DBVendorMSSQL, ColumnAttributes{}, `ALTER TABLE [t] ALTER COLUMN [c] varchar(100) NULL`},
+		{types.DBVendorMySQL, ColumnAttributes{}, "ALTER TABLE `t` MODIFY COLUMN `c` varchar(100) NULL"},
+		{types.DBVendorMySQL, ColumnAttributes{NotNull: true, Default: &def, Comment: `a\b`}, "ALTER TABLE `t` MODIFY COLUMN `c` varchar(100) NOT NULL DEFAULT 'it''s' COMMENT 'a\\\\b'"},
+		{types.DBVendorMariaDB, ColumnAttributes{Default: &expr, DefaultExpr: true}, "ALTER TABLE `t` MODIFY COLUMN `c` varchar(100) NULL DEFAULT (uuid())"},
+	}
+	for _, tt := range tests {
+		got, err := AlterColumnTypeDDL(tt.vendor, "t", "c", "varchar(100)", tt.attrs)
+		if err != nil || got != tt.want {
+			t.Errorf("AlterColumnTypeDDL(%s, %+v) = %q, %v, want %q", tt.vendor, tt.attrs, got, err, tt.want)
+		}
+	}
+	if _, err := AlterColumnTypeDDL(types.DBVendorSQLite, "t", "c", "text", ColumnAttributes{}); err == nil {
+		t.Error("AlterColumnTypeDDL(sqlite) should fail")
+	}
+}
@@ -0,0 +1,83 @@
+package dbutil
+
+import (
+	"context"
+	"database/sql"
+	"db-portal/internal/types"
+	"fmt"
+	"strconv"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// backendIDQueries return the server id of the connection, by vendor.
+var backendIDQueries = map[string]string{
+	types.DBVendorPostgres: "select pg_backend_pid()",
+	types.DBVendorMySQL:    "select connection_id()",
+	types.DBVendorMariaDB:  "select connection_id()",
+	types.DBVendorMSSQL:    "select @@spid",
+}
+
+// WithQueryID tags the statements run with ctx with a query id, for the vendors killing a statement by query id (ClickHouse).
+func WithQueryID(ctx context.Context, dbVendor, queryID string) context.Context {
+	if dbVendor == types.DBVendorClickHouse {
+		return clickhouse.Context(ctx, clickhouse.WithQueryID(queryID))
+	}
+	return ctx
+}
+
+// BackendID returns the server id of the statements run on q, to kill them from another connection with KillStatement:
+// the connection id, or queryID for ClickHouse (see WithQueryID). It is empty when the vendor cannot kill a statement (SQLite).
+func BackendID(ctx context.Context, q Querier, dbVendor, queryID string) (string, error) {
+	if dbVendor == types.DBVendorClickHouse {
+		return queryID, nil
+	}
+	query, ok := backendIDQueries[dbVendor]
+	if !ok {
+		return "", nil
+	}
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var id int64
+	if rows.Next() {
+		err = rows.Scan(&id)
+	} else if err = rows.Err(); err == nil {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(id, 10), nil
+}
+
+// KillStatement stops the statement running for backendID, a BackendID result, from conn, another connection.
+// PostgreSQL and MySQL cancel the statement and keep the connection. MSSQL has no statement kill: its connection is killed.
+func KillStatement(ctx context.Context, conn *sql.Conn, dbVendor, backendID string) error {
+	var err error
+	switch dbVendor {
+	case types.DBVendorClickHouse:
+		_, err = conn.ExecContext(ctx, "KILL QUERY WHERE query_id = ?", backendID)
+		return err
+	case types.DBVendorPostgres, types.DBVendorMySQL, types.DBVendorMariaDB, types.DBVendorMSSQL:
+	default:
+		return fmt.Errorf("cannot kill a statement on a %s database", dbVendor)
+	}
+
+	// KILL takes no parameter, the id is checked to be a number
+	id, err := strconv.ParseInt(backendID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid backend id %q", backendID)
+	}
+	switch dbVendor {
+	case types.DBVendorPostgres:
+		_, err = conn.ExecContext(ctx, "select pg_cancel_backend($1)", id)
+	case types.DBVendorMSSQL:
+		_, err = conn.ExecContext(ctx, fmt.Sprintf("KILL %d", id))
+	default:
+		_, err = conn.ExecContext(ctx, fmt.Sprintf("KILL QUERY %d", id))
+	}
+	return err
+}
@@ -0,0 +1,190 @@
+package dbutil
+
+import (
+	"db-portal/internal/types"
+	"strings"
+)
+
+type tokenType int
+
+const (
+	tokenWord     tokenType = iota // keyword or unquoted identifier
+	tokenIdent                     // quoted identifier, text is unquoted
+	tokenString                    // string literal or dollar quoted body
+	tokenNumber                    // numeric literal
+	tokenVariable                  // @name, @@name, :name, $1 or ? placeholder
+	tokenPunct                     // any other character: ( ) , . ; = ...
+)
+
+type token struct {
+	typ  tokenType
+	text string
+	pos  int // byte offset of the token in the statement
+}
+
+// is reports whether t is one of the keywords, case insensitive.
+func (t token) is(keywords ...string) bool {
+	if t.typ != tokenWord {
+		return false
+	}
+	for _, keyword := range keywords {
+		if strings.EqualFold(t.text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// isName reports whether t can be an object name.
+func (t token) isName() bool {
+	return t.typ == tokenWord || t.typ == tokenIdent
+}
+
+// tokenize splits a SQL statement into tokens, skipping spaces and comments. The lexer follows the vendor syntax:
+// "..." is a string for MySQL and an identifier otherwise, # starts a MySQL comment and a MSSQL temporary table name,
+// block comments are nested for PostgreSQL and MSSQL, $tag$ dollar quotes and E'...' strings are PostgreSQL.
+func tokenize(sql string, dbVendor string) []token {
+	mysql := dbVendor == types.DBVendorMySQL || dbVendor == types.DBVendorMariaDB
+	nestedComments := dbVendor == types.DBVendorPostgres || dbVendor == types.DBVendorMSSQL
+
+	var tokens []token
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case c == '-' && strings.HasPrefix(sql[i:], "--"), c == '#' && mysql:
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			i = skipBlockComment(sql, i, nestedComments)
+		case c == '\'':
+			end := quoteEnd(sql, i, '\'', mysql)
+			tokens = append(tokens, token{tokenString, sql[i:end], i})
+			i = end
+		case c == '"' && mysql:
+			end := quoteEnd(sql, i, '"', true)
+			tokens = append(tokens, token{tokenString, sql[i:end], i})
+			i = end
+		case c == '"' || c == '`' || c == '[' && (dbVendor == types.DBVendorMSSQL || dbVendor == types.DBVendorSQLite || dbVendor == ""):
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			end := quoteEnd(sql, i, closing, false)
+			text := strings.TrimSuffix(sql[i+1:end], string(closing))
+			tokens = append(tokens, token{tokenIdent, strings.ReplaceAll(text, string([]byte{closing, closing}), string(closing)), i})
+			i = end
+		case c == '$' && dbVendor != types.DBVendorMSSQL && dollarTag(sql[i:]) != "":
+			tag := dollarTag(sql[i:])
+			end := len(sql)
+			if closing := strings.Index(sql[i+len(tag):], tag); closing != -1 {
+				end = i + len(tag) + closing + len(tag)
+			}
+			tokens = append(tokens, token{tokenString, sql[i:end], i})
+			i = end
+		case isWordByte(c) && !isDigit(c) || c == '#' && dbVendor == types.DBVendorMSSQL:
+			end := i + 1
+			for end < len(sql) && (isWordByte(sql[end]) || sql[end] == '$' || sql[end] == '#') {
+				end++
+			}
+			// E'...' PostgreSQL strings with backslash escapes, N'...' and X'...' strings
+			if end-i == 1 && end < len(sql) && sql[end] == '\'' && strings.ContainsRune("eEnNxXbB", rune(c)) {
+				stop := quoteEnd(sql, end, '\'', mysql || c == 'e' || c == 'E')
+				tokens = append(tokens, token{tokenString, sql[i:stop], i})
+				i = stop
+				continue
+			}
+			tokens = append(tokens, token{tokenWord, sql[i:end], i})
+			i = end
+		case isDigit(c) || c == '.' && i+1 < len(sql) && isDigit(sql[i+1]):
+			end := i + 1
+			for end < len(sql) && (isWordByte(sql[end]) || sql[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, token{tokenNumber, sql[i:end], i})
+			i = end
+		case c == '@' || c == ':' && i+1 < len(sql) && isWordByte(sql[i+1]) && (i == 0 || sql[i-1] != ':') || c == '$' || c == '?':
+			end := i + 1
+			for end < len(sql) && (isWordByte(sql[end]) || sql[end] == '@' && c == '@') {
+				end++
+			}
+			tokens = append(tokens, token{tokenVariable, sql[i:end], i})
+			i = end
+		default:
+			tokens = append(tokens, token{tokenPunct, sql[i : i+1], i})
+			i++
+		}
+	}
+	return tokens
+}
+
+// tokenEnd returns the byte offset after a token of sql.
+func tokenEnd(sql string, t token) int {
+	if t.typ != tokenIdent {
+		return t.pos + len(t.text)
+	}
+	closing := sql[t.pos]
+	if closing == '[' {
+		closing = ']'
+	}
+	return quoteEnd(sql, t.pos, closing, false)
+}
+
+// skipBlockComment returns the index after the block comment starting at i.
+func skipBlockComment(sql string, i int, nested bool) int {
+	depth := 0
+	for i < len(sql) {
+		switch {
+		case strings.HasPrefix(sql[i:], "/*") && (nested || depth == 0):
+			depth++
+			i += 2
+		case strings.HasPrefix(sql[i:], "*/"):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return i
+}
+
+// quoteEnd returns the index after the quoted text starting at i. A doubled closing character is escaped,
+// and a backslash escapes the next character when backslash is true.
+func quoteEnd(sql string, i int, closing byte, backslash bool) int {
+	for i++; i < len(sql); i++ {
+		switch {
+		case sql[i] == '\\' && backslash:
+			i++
+		case sql[i] == closing:
+			if i+1 < len(sql) && sql[i+1] == closing {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+// dollarTag returns the $$ or $tag$ dollar quote starting s, empty for a $1 placeholder.
+func dollarTag(s string) string {
+	end := strings.IndexByte(s[1:], '$')
+	if end == -1 || end > 0 && !isParamName(s[1:1+end]) {
+		return ""
+	}
+	return s[:end+2]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isWordByte reports whether c can be part of an unquoted identifier. Bytes of non-ASCII UTF-8 characters are.
+func isWordByte(c byte) bool {
+	return c == '_' || isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,153 @@
+package dbutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Param is a typed bind variable value.
+// Type is optional: "string", "int", "float", "decimal", "bool", "date", "timestamp" or "null".
+// Without type, json numbers are bound as int or float, other json values as they are decoded.
+type Param struct {
+	Value any    `json:"value"`
+	Type  string `json:"type,omitempty"`
+}
+
+// paramTypes are the types of Param.
+var paramTypes = map[string]bool{"string": true, "int": true, "float": true, "decimal": true, "bool": true, "date": true, "timestamp": true, "null": true}
+
+// ValidParamType reports whether t is a Param type, an empty type is valid.
+func ValidParamType(t string) bool {
+	return t == "" || paramTypes[t]
+}
+
+// ParseParams decodes a json object of parameters by name. A value is either a Param
+// (an object with a value key) or a plain json value.
+func ParseParams(data string) (map[string]Param, error) {
+	params := map[string]Param{}
+	if strings.TrimSpace(data) == "" {
+		return params, nil
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(data), &raw); err != nil {
+		return nil, fmt.Errorf("invalid params. %v", err)
+	}
+	for name, msg := range raw {
+		var value any
+		dec := json.NewDecoder(strings.NewReader(string(msg)))
+		dec.UseNumber()
+		if err := dec.Decode(&value); err != nil {
+			return nil, fmt.Errorf("invalid param %s. %v", name, err)
+		}
+		p := Param{Value: value}
+		if obj, ok := value.(map[string]any); ok {
+			if v, ok := obj["value"]; ok {
+				p.Value = v
+				p.Type, _ = obj["type"].(string)
+			}
+		}
+		params[name] = p
+	}
+	return params, nil
+}
+
+// BindValue converts a parameter to the value passed to the driver.
+func (p Param) BindValue() (any, error) {
+	if p.Value == nil || p.Type == "null" {
+		return nil, nil
+	}
+	text := fmt.Sprint(p.Value)
+	switch p.Type {
+	case "":
+		if n, ok := p.Value.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				return i, nil
+			}
+			return n.Float64()
+		}
+		if _, ok := p.Value.(map[string]any); ok {
+			return nil, fmt.Errorf("object values need a type")
+		}
+		if _, ok := p.Value.([]any); ok {
+			return nil, fmt.Errorf("array values are not supported")
+		}
+		return p.Value, nil
+	case "string", "decimal":
+		return text, nil
+	case "int":
+		return strconv.ParseInt(text, 10, 64)
+	case "float":
+		return strconv.ParseFloat(text, 64)
+	case "bool":
+		return strconv.ParseBool(text)
+	case "date":
+		return time.Parse(time.DateOnly, text)
+	case "timestamp":
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999", time.DateOnly} {
+			if t, err := time.Parse(layout, text); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("cannot parse %q as a timestamp", text)
+	}
+	return nil, fmt.Errorf("unknown param type %q", p.Type)
+}
+
+// BindNamedParams rewrites the :name and @name parameters of a query into the placeholders of the vendor
+// (see PlaceholderStyle) and returns the query with its args. Parameters are read by the vendor lexer, quotes and comments are left unchanged.
+// Queries are unchanged without params. A :name without value is an error. A @name without value is left unchanged, it can be a variable
+// (ex: MSSQL declared variables, MySQL user variables). PostgreSQL :: casts are not parameters.
+func BindNamedParams(query, dbVendor string, params map[string]Param) (string, []any, error) {
+	if len(params) == 0 {
+		return query, nil, nil
+	}
+	style, err := PlaceholderStyle(dbVendor)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var b strings.Builder
+	var args []any
+	index := map[string]int{} // placeholder number by name, for numbered styles
+	start := 0
+	for _, t := range tokenize(query, dbVendor) {
+		if t.typ != tokenVariable || len(t.text) < 2 || t.text[0] != ':' && t.text[0] != '@' || t.text[1] == '@' {
+			continue // ? and $1 placeholders, @@variables
+		}
+		c, name := t.text[0], t.text[1:]
+		if !isParamName(name) {
+			continue
+		}
+		p, ok := params[name]
+		if !ok {
+			if c == ':' {
+				return "", nil, fmt.Errorf("missing value for parameter :%s", name)
+			}
+			continue
+		}
+
+		var placeholder string
+		if n, ok := index[name]; ok && style != "?" {
+			placeholder = fmt.Sprintf(style, n)
+		} else {
+			value, err := p.BindValue()
+			if err != nil {
+				return "", nil, fmt.Errorf("parameter %s: %v", name, err)
+			}
+			args = append(args, value)
+			index[name] = len(args)
+			placeholder = style
+			if style != "?" {
+				placeholder = fmt.Sprintf(style, len(args))
+			}
+		}
+		b.WriteString(query[start:t.pos])
+		b.WriteString(placeholder)
+		start = t.pos + len(t.text)
+	}
+	b.WriteString(query[start:])
+	return b.String(), args, nil
+}
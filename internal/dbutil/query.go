@@ -3,6 +3,7 @@ package dbutil
 import (
 	"context"
 	"database/sql"
+	"db-portal/internal/explain"
 	"encoding/json"
 	"time"
 
@@ -25,6 +26,9 @@ type DBResult struct {
 	StmtCmd       string        `json:"stmtCmd"`      // Top level SQL keyword : update|insert|delete|select|create|drop|alter|show...
 	StmtType      string        `json:"stmtType"`     // Identified type of statement : "query"|"not-query"
 	Truncated     bool          `json:"truncated"`
+	CursorID      string        `json:"cursorId,omitempty"`  // Open cursor to fetch the next rows, see package cursor
+	Statement     string        `json:"statement,omitempty"` // Statement of the result, when a script has several
+	Plan          *explain.Node `json:"plan,omitempty"`      // Plan tree of an explain query, see package explain
 }
 
 func (q *DBResult) MarshalJSON() ([]byte, error) {
@@ -39,6 +43,9 @@ func (q *DBResult) MarshalJSON() ([]byte, error) {
 		StmtCmd       string        `json:"stmtCmd"`
 		StmtType      string        `json:"stmtType"`
 		Truncated     bool          `json:"truncated"`
+		CursorID      string        `json:"cursorId,omitempty"`
+		Statement     string        `json:"statement,omitempty"`
+		Plan          *explain.Node `json:"plan,omitempty"`
 	}{
 		Cols: func() []string {
 			if q.Cols == nil {
@@ -65,10 +72,19 @@ func (q *DBResult) MarshalJSON() ([]byte, error) {
 		StmtCmd:      q.StmtCmd,
 		StmtType:     q.StmtType,
 		Truncated:    q.Truncated,
+		CursorID:     q.CursorID,
+		Statement:    q.Statement,
+		Plan:         q.Plan,
 	})
 }
 
-func ExecWithResult(ctx context.Context, conn *sql.Conn, query string, args []any) (dResult DBResult, err error) {
+// Querier runs statements on a connection (*sql.Conn) or in a transaction (*sql.Tx).
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func ExecWithResult(ctx context.Context, conn Querier, query string, args []any) (dResult DBResult, err error) {
 
 	startTime := time.Now()
 	var result sql.Result
@@ -82,7 +98,7 @@ func ExecWithResult(ctx context.Context, conn *sql.Conn, query string, args []an
 	return
 }
 
-func QueryWithResult(ctx context.Context, conn *sql.Conn, query string, args []any, limit int64) (dResult DBResult, err error) {
+func QueryWithResult(ctx context.Context, conn Querier, query string, args []any, limit int64) (dResult DBResult, err error) {
 
 	var rows *sql.Rows
 	startTime := time.Now()
@@ -98,6 +114,50 @@ func QueryWithResult(ctx context.Context, conn *sql.Conn, query string, args []a
 		return
 	}
 
+	err = readResultSet(rows, limit, &dResult)
+	return
+}
+
+// QueryWithResults returns all the result sets of a query, ex: a MSSQL batch or procedure.
+// The duration of the first result includes the query execution.
+func QueryWithResults(ctx context.Context, conn Querier, query string, args []any, limit int64) (dResults []DBResult, err error) {
+
+	var rows *sql.Rows
+	startTime := time.Now()
+	rows, err = conn.QueryContext(ctx, query, args...)
+
+	if rows != nil {
+		defer rows.Close()
+	}
+
+	if err != nil {
+		dResults = append(dResults, DBResult{DBerror: err.Error(), Duration: time.Since(startTime)})
+		return
+	}
+
+	for {
+		var dResult DBResult
+		err = readResultSet(rows, limit, &dResult)
+		dResult.Duration = time.Since(startTime)
+		if err != nil && dResult.DBerror == "" {
+			dResult.DBerror = err.Error()
+		}
+		dResults = append(dResults, dResult)
+		if err != nil || !rows.NextResultSet() {
+			break
+		}
+		startTime = time.Now()
+	}
+	if err == nil {
+		if err = rows.Err(); err != nil {
+			dResults[len(dResults)-1].DBerror = err.Error()
+		}
+	}
+	return
+}
+
+// readResultSet reads the current result set of rows, at most limit rows when limit > 0.
+func readResultSet(rows *sql.Rows, limit int64, dResult *DBResult) (err error) {
 	// Retrieve column names
 	if dResult.Cols, err = rows.Columns(); err != nil {
 		return
@@ -111,31 +171,40 @@ func QueryWithResult(ctx context.Context, conn *sql.Conn, query string, args []a
 			break // Limit the number of rows returned
 		}
 
-		values := make([]any, len(dResult.Cols))
-		valuePtrs := make([]any, len(dResult.Cols))
-		for i := range values {
-			valuePtrs[i] = &values[i]
-		}
-		if err = rows.Scan(valuePtrs...); err != nil {
+		var row []any
+		if row, err = ScanRow(rows, len(dResult.Cols)); err != nil {
 			break
 		}
-
-		row := make([]any, len(dResult.Cols))
-		for i := range dResult.Cols {
-			switch v := values[i].(type) {
-			case []byte:
-				// Convert byte slices to string for JSON compatibility
-				row[i] = string(v)
-			default:
-				row[i] = values[i]
-			}
-		}
 		dResult.Rows = append(dResult.Rows, row)
 
 		i++
 	}
 	dResult.RowsReturned = i
+	dResult.DatabaseTypes = DatabaseTypes(rows, len(dResult.Cols))
 
+	return
+}
+
+// ScanRow scans the current row of rows, byte slices are converted to strings for JSON compatibility.
+func ScanRow(rows *sql.Rows, colCount int) ([]any, error) {
+	values := make([]any, colCount)
+	valuePtrs := make([]any, colCount)
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+	if err := rows.Scan(valuePtrs...); err != nil {
+		return nil, err
+	}
+	for i, v := range values {
+		if b, ok := v.([]byte); ok {
+			values[i] = string(b)
+		}
+	}
+	return values, nil
+}
+
+// DatabaseTypes returns the database type names of the columns of rows, "unknown" when the driver fails to tell.
+func DatabaseTypes(rows *sql.Rows, colCount int) (databaseTypes []string) {
 	// Attempt to retrieve column types
 	var columnTypes []*sql.ColumnType
 	func() {
@@ -146,16 +215,13 @@ func QueryWithResult(ctx context.Context, conn *sql.Conn, query string, args []a
 		columnTypes, _ = rows.ColumnTypes()
 	}()
 
-	// Populate qResult.DatabaseType
-	for i := range dResult.Cols {
+	for i := 0; i < colCount; i++ {
 		if i < len(columnTypes) {
-			c := columnTypes[i]
-			dResult.DatabaseTypes = append(dResult.DatabaseTypes, c.DatabaseTypeName())
+			databaseTypes = append(databaseTypes, columnTypes[i].DatabaseTypeName())
 		} else {
 			// Default values if ColumnTypes() failed
-			dResult.DatabaseTypes = append(dResult.DatabaseTypes, "unknown")
+			databaseTypes = append(databaseTypes, "unknown")
 		}
 	}
-
 	return
 }
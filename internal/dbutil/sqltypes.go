@@ -3,8 +3,13 @@
 package dbutil
 
 import (
+	"database/sql"
 	"db-portal/internal/types"
+	"maps"
+	"math"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 // Cross-vendor usage example, ClickHouse UInt8 -> Postgres:
@@ -19,8 +24,9 @@ import (
 // - decimal, float
 // - char, varchar, text
 // - binary
-// - date, time, datetime
+// - date, time, datetime, timestamptz, interval
 // - uuid
+// - json, array, geometry
 var CanonicalTypeToVendorType = map[string]map[string]string{
 	"int": {
 		types.DBVendorMSSQL:      "INT",
@@ -134,9 +140,90 @@ var CanonicalTypeToVendorType = map[string]map[string]string{
 		types.DBVendorPostgres:   "UUID",
 		types.DBVendorClickHouse: "UUID",
 	},
+	"timestamptz": {
+		types.DBVendorMSSQL:      "DATETIMEOFFSET",
+		types.DBVendorMySQL:      "DATETIME(6)", // no time zone, values are converted to UTC
+		types.DBVendorMariaDB:    "DATETIME(6)", // no time zone, values are converted to UTC
+		types.DBVendorSQLite:     "TEXT",
+		types.DBVendorPostgres:   "TIMESTAMPTZ",
+		types.DBVendorClickHouse: "DateTime64(6, 'UTC')",
+	},
+	"interval": {
+		types.DBVendorMSSQL:      "VARCHAR(64)", // no interval type
+		types.DBVendorMySQL:      "VARCHAR(64)", // no interval type
+		types.DBVendorMariaDB:    "VARCHAR(64)", // no interval type
+		types.DBVendorSQLite:     "TEXT",
+		types.DBVendorPostgres:   "INTERVAL",
+		types.DBVendorClickHouse: "String", // interval types can't be stored
+	},
+	"json": {
+		types.DBVendorMSSQL:      "NVARCHAR(MAX)", // with an ISJSON check constraint
+		types.DBVendorMySQL:      "JSON",
+		types.DBVendorMariaDB:    "JSON",
+		types.DBVendorSQLite:     "TEXT",
+		types.DBVendorPostgres:   "JSONB",
+		types.DBVendorClickHouse: "String",
+	},
+	"array": {
+		types.DBVendorMSSQL:      "NVARCHAR(MAX)", // json array, with an ISJSON check constraint
+		types.DBVendorMySQL:      "JSON",
+		types.DBVendorMariaDB:    "JSON",
+		types.DBVendorSQLite:     "TEXT",
+		types.DBVendorPostgres:   "TEXT[]",        // element type is used when known
+		types.DBVendorClickHouse: "Array(String)", // element type is used when known
+	},
+	"geometry": {
+		types.DBVendorMSSQL:      "GEOMETRY",
+		types.DBVendorMySQL:      "GEOMETRY",
+		types.DBVendorMariaDB:    "GEOMETRY",
+		types.DBVendorSQLite:     "BLOB",     // WKB
+		types.DBVendorPostgres:   "GEOMETRY", // requires PostGIS
+		types.DBVendorClickHouse: "String",   // WKB
+	},
+}
+
+// User-defined type mappings (types.yaml), they take precedence over built-in mappings.
+var userTypes = struct {
+	sync.RWMutex
+	aliases     map[string]map[string]string // vendor -> vendor type (upper case) -> canonical type
+	vendorTypes map[string]map[string]string // canonical type -> vendor -> vendor type
+}{}
+
+// SetUserTypes replaces the user-defined type mappings. The maps are copied, the caller can change them.
+func SetUserTypes(aliases map[string]map[string]string, vendorTypes map[string]map[string]string) {
+	upper := make(map[string]map[string]string, len(aliases))
+	for vendor, m := range aliases {
+		upper[vendor] = make(map[string]string, len(m))
+		for vendorType, canonical := range m {
+			upper[vendor][strings.ToUpper(strings.TrimSpace(vendorType))] = canonical
+		}
+	}
+	copied := make(map[string]map[string]string, len(vendorTypes))
+	for canonical, m := range vendorTypes {
+		copied[canonical] = maps.Clone(m)
+	}
+
+	userTypes.Lock()
+	defer userTypes.Unlock()
+	userTypes.aliases = upper
+	userTypes.vendorTypes = copied
+}
+
+// userAlias returns the user-defined canonical type of an upper case vendor type.
+func userAlias(vendor, raw string) (canonical string, ok bool) {
+	userTypes.RLock()
+	defer userTypes.RUnlock()
+	canonical, ok = userTypes.aliases[vendor][raw]
+	return canonical, ok && canonical != ""
 }
 
 func VendorType(DBVendor string, canonical string) string {
+	userTypes.RLock()
+	sqlType := userTypes.vendorTypes[canonical][DBVendor]
+	userTypes.RUnlock()
+	if sqlType != "" {
+		return sqlType
+	}
 	return CanonicalTypeToVendorType[canonical][DBVendor]
 }
 
@@ -188,6 +275,8 @@ var typeAliases = map[string]string{
 	"TEXT":      "text",
 	"CLOB":      "text",
 
+	"CHARACTER VARYING": "varchar", // PostgreSQL information_schema names
+
 	// Binary
 	"BLOB":      "binary",
 	"BYTEA":     "binary",
@@ -201,6 +290,36 @@ var typeAliases = map[string]string{
 	"SMALLDATETIME": "datetime",
 	"TIMESTAMP":     "datetime",
 
+	"TIMESTAMP WITHOUT TIME ZONE": "datetime", // PostgreSQL information_schema names
+	"TIME WITHOUT TIME ZONE":      "time",
+
+	// Time zone aware timestamps
+	"TIMESTAMPTZ":              "timestamptz",
+	"TIMESTAMP WITH TIME ZONE": "timestamptz",
+	"DATETIMEOFFSET":           "timestamptz",
+
+	// Intervals
+	"INTERVAL": "interval",
+
+	// JSON
+	"JSON":  "json",
+	"JSONB": "json",
+
+	// Arrays (PostgreSQL information_schema name)
+	"ARRAY": "array",
+
+	// Geometry
+	"GEOMETRY":           "geometry",
+	"GEOGRAPHY":          "geometry",
+	"POINT":              "geometry",
+	"LINESTRING":         "geometry",
+	"POLYGON":            "geometry",
+	"MULTIPOINT":         "geometry",
+	"MULTILINESTRING":    "geometry",
+	"MULTIPOLYGON":       "geometry",
+	"GEOMETRYCOLLECTION": "geometry",
+	"RING":               "geometry", // ClickHouse
+
 	// UUID
 	"UUID":             "uuid",
 	"UNIQUEIDENTIFIER": "uuid",
@@ -223,6 +342,9 @@ var typeAliases = map[string]string{
 	"LOWCARDINALITY(STRING)":      "varchar",
 	"LOWCARDINALITY(FIXEDSTRING)": "char",
 	"NULLABLE":                    "", // unwrap
+	"MAP":                         "json",
+	"TUPLE":                       "json",
+	"OBJECT":                      "json",
 }
 
 // CanonicalType get a canonical type from a vendor type (=SQL type/domain).
@@ -231,6 +353,11 @@ var typeAliases = map[string]string{
 func CanonicalType(vendor, s string) string {
 	raw := strings.ToUpper(strings.TrimSpace(s))
 
+	// User-defined aliases match the full type first, ex: Array(String)
+	if alias, ok := userAlias(vendor, raw); ok {
+		return alias
+	}
+
 	// Special case: MySQL/MariaDB TINYINT(1) -> boolean
 	if (vendor == types.DBVendorMySQL || vendor == types.DBVendorMariaDB) && strings.HasPrefix(raw, "TINYINT(1") {
 		return "boolean"
@@ -250,11 +377,33 @@ func CanonicalType(vendor, s string) string {
 		raw = strings.TrimSuffix(strings.TrimPrefix(raw, "LOWCARDINALITY("), ")")
 	}
 
+	if alias, ok := userAlias(vendor, raw); ok {
+		return alias
+	}
+
+	// Arrays: PostgreSQL element type prefixed with _, ClickHouse Array(...)
+	if (vendor == types.DBVendorPostgres && strings.HasPrefix(raw, "_")) || strings.HasPrefix(raw, "ARRAY(") {
+		return "array"
+	}
+
+	// ClickHouse: DateTime with a time zone parameter, IntervalSecond, IntervalDay...
+	if vendor == types.DBVendorClickHouse {
+		if strings.HasPrefix(raw, "DATETIME") && strings.Contains(raw, "'") {
+			return "timestamptz"
+		}
+		if strings.HasPrefix(raw, "INTERVAL") {
+			return "interval"
+		}
+	}
+
 	// Strip parameters
 	if idx := strings.Index(raw, "("); idx != -1 {
 		raw = raw[:idx]
 	}
 
+	if alias, ok := userAlias(vendor, raw); ok {
+		return alias
+	}
 	if alias, ok := typeAliases[raw]; ok && alias != "" {
 		return alias
 	}
@@ -262,3 +411,189 @@ func CanonicalType(vendor, s string) string {
 	// Fallback to "text" for unknown types
 	return "text"
 }
+
+// ElementType returns the canonical type of the elements of an array vendor type,
+// or an empty string if s is not an array type.
+// Example: PostgreSQL _INT4 -> int, ClickHouse Array(Nullable(String)) -> varchar
+func ElementType(vendor, s string) string {
+	raw := strings.TrimSpace(s)
+	switch {
+	case vendor == types.DBVendorPostgres && strings.HasPrefix(raw, "_"):
+		return CanonicalType(vendor, raw[1:])
+	case strings.HasPrefix(strings.ToUpper(raw), "ARRAY(") && strings.HasSuffix(raw, ")"):
+		return CanonicalType(vendor, raw[len("ARRAY("):len(raw)-1])
+	}
+	return ""
+}
+
+// TypeParams returns the numeric parameters of a vendor type (length, or precision and scale).
+// Wrappers are ignored, the innermost parameters are returned.
+// Example: DECIMAL(10,2) -> [10 2], Nullable(FixedString(8)) -> [8], VARCHAR(MAX) -> [-1]
+func TypeParams(s string) (params []int64) {
+	start := strings.LastIndex(s, "(")
+	if start == -1 {
+		return
+	}
+	end := strings.Index(s[start:], ")")
+	if end == -1 {
+		return
+	}
+	for p := range strings.SplitSeq(s[start+1:start+end], ",") {
+		p = strings.ToUpper(strings.TrimSpace(p))
+		if p == "MAX" {
+			params = append(params, -1)
+			continue
+		}
+		if n, err := strconv.ParseInt(p, 10, 64); err == nil {
+			params = append(params, n)
+		}
+	}
+	return
+}
+
+// WithTypeParams replaces the parameters of a vendor type.
+// Example: WithTypeParams("DECIMAL(18,2)", 20, 4) -> DECIMAL(20,4)
+// A type without parameters is returned unchanged.
+func WithTypeParams(sqlType string, params ...int64) string {
+	start := strings.LastIndex(sqlType, "(")
+	if start == -1 || len(params) == 0 {
+		return sqlType
+	}
+	end := strings.Index(sqlType[start:], ")")
+	if end == -1 {
+		return sqlType
+	}
+	s := make([]string, len(params))
+	for i, p := range params {
+		if p < 0 {
+			s[i] = "MAX"
+		} else {
+			s[i] = strconv.FormatInt(p, 10)
+		}
+	}
+	return sqlType[:start+1] + strings.Join(s, ",") + sqlType[start+end:]
+}
+
+// Maximum parameters accepted by vendors, larger values fall back to an unbounded type.
+var maxVarcharLength = map[string]int64{
+	types.DBVendorMSSQL:    8000,
+	types.DBVendorMySQL:    16383, // 65535 bytes with utf8mb4
+	types.DBVendorMariaDB:  16383,
+	types.DBVendorPostgres: 10485760,
+}
+
+// maxMediumTextLength is the maximum length of a MySQL/MariaDB MEDIUMTEXT in utf8mb4 characters (16 MB).
+// TEXT only holds 65535 bytes, longer varchar use MEDIUMTEXT or LONGTEXT.
+const maxMediumTextLength = 4194303
+
+var maxDecimalPrecision = map[string]int64{
+	types.DBVendorMSSQL:      38,
+	types.DBVendorMySQL:      65,
+	types.DBVendorMariaDB:    65,
+	types.DBVendorPostgres:   1000,
+	types.DBVendorClickHouse: 76,
+}
+
+// ColumnType is a column type in a vendor independent way: a canonical type
+// with its length, precision, scale and constraints when known.
+type ColumnType struct {
+	Canonical  string // canonical type, see CanonicalTypeToVendorType
+	Length     int64  // character length, 0 if unknown, -1 if unbounded
+	Precision  int64  // decimal precision, 0 if unknown
+	Scale      int64  // decimal scale
+	NotNull    bool   // true when the column is known to be not nullable
+	PrimaryKey bool   // true when the column is part of the primary key
+	Override   string // vendor type forced by the user, used as is
+	Element    string // canonical type of array elements, empty if unknown
+}
+
+// NewColumnType returns the ColumnType of a result set column.
+// Drivers not supporting length, decimal size or nullability leave them unknown.
+func NewColumnType(dbVendor string, c *sql.ColumnType) (t ColumnType) {
+	t.Canonical = CanonicalType(dbVendor, c.DatabaseTypeName())
+
+	switch t.Canonical {
+	case "array":
+		t.Element = ElementType(dbVendor, c.DatabaseTypeName())
+	case "char", "varchar":
+		if length, ok := c.Length(); ok && length > 0 {
+			t.Length = length
+			if length >= math.MaxInt32 {
+				t.Length = -1 // drivers report unbounded types with a huge length
+			}
+		}
+	case "decimal":
+		if precision, scale, ok := c.DecimalSize(); ok && precision > 0 {
+			t.Precision, t.Scale = precision, scale
+		}
+	}
+
+	if nullable, ok := c.Nullable(); ok {
+		t.NotNull = !nullable
+	}
+	return
+}
+
+// VendorType returns the vendor type, with length or precision and scale when known.
+// Unknown canonical types fall back to "text". An override is returned unchanged.
+func (t ColumnType) VendorType(dbVendor string) string {
+	if t.Override != "" {
+		return t.Override
+	}
+	sqlType := VendorType(dbVendor, t.Canonical)
+	if sqlType == "" {
+		return VendorType(dbVendor, "text")
+	}
+
+	switch t.Canonical {
+	case "char", "varchar":
+		if t.Length == 0 || len(TypeParams(sqlType)) == 0 {
+			return sqlType
+		}
+		if limit, ok := maxVarcharLength[dbVendor]; ok && (t.Length < 0 || t.Length > limit) {
+			switch dbVendor {
+			case types.DBVendorMSSQL:
+				return WithTypeParams(VendorType(dbVendor, "varchar"), -1)
+			case types.DBVendorMySQL, types.DBVendorMariaDB:
+				if t.Length > 0 && t.Length <= maxMediumTextLength {
+					return "MEDIUMTEXT"
+				}
+				return "LONGTEXT"
+			}
+			return VendorType(dbVendor, "text")
+		}
+		return WithTypeParams(sqlType, t.Length)
+	case "decimal":
+		if t.Precision <= 0 || len(TypeParams(sqlType)) == 0 {
+			return sqlType
+		}
+		precision, scale := t.Precision, min(t.Scale, t.Precision)
+		if limit, ok := maxDecimalPrecision[dbVendor]; ok && precision > limit {
+			// keep the integer digits, the scale is lowered first
+			scale = max(0, scale-(precision-limit))
+			precision = limit
+		}
+		return WithTypeParams(sqlType, precision, scale)
+	case "array":
+		if t.Element == "" || t.Element == "array" || sqlType != CanonicalTypeToVendorType["array"][dbVendor] {
+			return sqlType // unknown element type or user-defined type
+		}
+		element := ColumnType{Canonical: t.Element}.VendorType(dbVendor)
+		switch dbVendor {
+		case types.DBVendorPostgres:
+			return element + "[]"
+		case types.DBVendorClickHouse:
+			return "Array(" + element + ")"
+		}
+	}
+	return sqlType
+}
+
+// CanonicalTypes returns the canonical type names of column types.
+func CanonicalTypes(columnTypes []ColumnType) []string {
+	names := make([]string, len(columnTypes))
+	for i, t := range columnTypes {
+		names[i] = t.Canonical
+	}
+	return names
+}
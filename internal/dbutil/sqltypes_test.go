@@ -0,0 +1,32 @@
+package dbutil
+
+import (
+	"db-portal/internal/types"
+	"testing"
+)
+
+func TestColumnTypeVendorType(t *testing.T) {
+	tests := []struct {
+		vendor string
+		typ    ColumnType
+		want   string
+	}{
+		{types.DBVendorMySQL, ColumnType{Canonical: "varchar", Length: 100}, "VARCHAR(100)"},
+		{types.DBVendorMySQL, ColumnType{Canonical: "varchar", Length: 16384}, "MEDIUMTEXT"},
+		{types.DBVendorMariaDB, ColumnType{Canonical: "varchar", Length: 4194303}, "MEDIUMTEXT"},
+		{types.DBVendorMySQL, ColumnType{Canonical: "varchar", Length: 4194304}, "LONGTEXT"},
+		{types.DBVendorMySQL, ColumnType{Canonical: "varchar", Length: -1}, "LONGTEXT"},
+		{types.DBVendorMSSQL, ColumnType{Canonical: "varchar", Length: 10000}, "VARCHAR(MAX)"},
+		{types.DBVendorPostgres, ColumnType{Canonical: "varchar", Length: -1}, "TEXT"},
+		{types.DBVendorMSSQL, ColumnType{Canonical: "decimal", Precision: 20, Scale: 4}, "DECIMAL(20,4)"},
+		{types.DBVendorMSSQL, ColumnType{Canonical: "decimal", Precision: 65, Scale: 30}, "DECIMAL(38,3)"},
+		{types.DBVendorMSSQL, ColumnType{Canonical: "decimal", Precision: 50, Scale: 5}, "DECIMAL(38,0)"},
+		{types.DBVendorMySQL, ColumnType{Canonical: "decimal", Precision: 70, Scale: 10}, "DECIMAL(65,5)"},
+		{types.DBVendorPostgres, ColumnType{Canonical: "decimal", Precision: 70, Scale: 10}, "NUMERIC(70,10)"},
+	}
+	for _, tt := range tests {
+		if got := tt.typ.VendorType(tt.vendor); got != tt.want {
+			t.Errorf("%+v.VendorType(%s) = %q, want %q", tt.typ, tt.vendor, got, tt.want)
+		}
+	}
+}
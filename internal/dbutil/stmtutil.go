@@ -1,103 +1,456 @@
 package dbutil
 
 import (
-	"regexp"
-	"slices"
+	"db-portal/internal/types"
+	"errors"
+	"fmt"
 	"strings"
 	"unicode"
 )
 
-func stmtClean(sql string) string {
-	inBlockComment := false
-	lines := strings.SplitSeq(sql, "\n")
-	var cleaned []string
+// Statement kinds, from reading data to administering the server.
+const (
+	StmtKindSelect      = "select"      // reads data: select, values, show, describe, explain...
+	StmtKindTransaction = "transaction" // begin, commit, rollback, savepoint...
+	StmtKindSession     = "session"     // session settings and variables: set, use, declare...
+	StmtKindDML         = "dml"         // modifies data: insert, update, delete, merge...
+	StmtKindCall        = "call"        // runs a procedure or code block: call, exec, do...
+	StmtKindDDL         = "ddl"         // modifies the schema: create, drop, alter, truncate...
+	StmtKindAdmin       = "admin"       // grants and server administration: grant, kill, vacuum...
+	StmtKindOther       = "other"       // unknown command
+)
 
-	for line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
+// stmtKinds are the statement kinds by command.
+var stmtKinds = map[string]string{
+	"select": StmtKindSelect, "values": StmtKindSelect, "table": StmtKindSelect, "show": StmtKindSelect,
+	"describe": StmtKindSelect, "desc": StmtKindSelect, "explain": StmtKindSelect, "pragma": StmtKindSelect,
+	"begin": StmtKindTransaction, "start": StmtKindTransaction, "commit": StmtKindTransaction, "rollback": StmtKindTransaction,
+	"savepoint": StmtKindTransaction, "release": StmtKindTransaction, "end": StmtKindTransaction, "abort": StmtKindTransaction,
+	"set": StmtKindSession, "use": StmtKindSession, "declare": StmtKindSession, "reset": StmtKindSession,
+	"discard": StmtKindSession, "prepare": StmtKindSession, "deallocate": StmtKindSession,
+	"listen": StmtKindSession, "unlisten": StmtKindSession, "notify": StmtKindSession,
+	"insert": StmtKindDML, "update": StmtKindDML, "delete": StmtKindDML, "merge": StmtKindDML,
+	"replace": StmtKindDML, "upsert": StmtKindDML, "copy": StmtKindDML, "load": StmtKindDML,
+	"call": StmtKindCall, "exec": StmtKindCall, "execute": StmtKindCall, "do": StmtKindCall,
+	"create": StmtKindDDL, "drop": StmtKindDDL, "alter": StmtKindDDL, "truncate": StmtKindDDL,
+	"rename": StmtKindDDL, "comment": StmtKindDDL,
+	"grant": StmtKindAdmin, "revoke": StmtKindAdmin, "kill": StmtKindAdmin, "vacuum": StmtKindAdmin,
+	"analyze": StmtKindAdmin, "reindex": StmtKindAdmin, "cluster": StmtKindAdmin, "checkpoint": StmtKindAdmin,
+	"attach": StmtKindAdmin, "detach": StmtKindAdmin, "optimize": StmtKindAdmin, "system": StmtKindAdmin,
+	"backup": StmtKindAdmin, "restore": StmtKindAdmin, "shutdown": StmtKindAdmin, "refresh": StmtKindAdmin,
+	"lock": StmtKindAdmin, "unlock": StmtKindAdmin, "flush": StmtKindAdmin, "reassign": StmtKindAdmin,
+	"deny": StmtKindAdmin, "dbcc": StmtKindAdmin, "reconfigure": StmtKindAdmin, "bulk": StmtKindAdmin,
+}
 
-		// Remove line comments
-		if strings.HasPrefix(line, "--") || strings.HasPrefix(line, "//") {
-			continue
+// schemaPragmas are the SQLite pragmas that read the schema of their table or index argument.
+var schemaPragmas = []string{"table_info", "table_xinfo", "table_list", "index_info", "index_xinfo", "index_list", "foreign_key_list"}
+
+// stmtKindRanks orders kinds: a statement has the highest kind of its commands,
+// ex: a select with a data-modifying CTE is "dml".
+var stmtKindRanks = map[string]int{
+	StmtKindSelect: 0, StmtKindTransaction: 1, StmtKindSession: 1,
+	StmtKindDML: 2, StmtKindCall: 2, StmtKindOther: 2, StmtKindDDL: 3, StmtKindAdmin: 4,
+}
+
+// mainCmds are the commands that can follow a WITH clause.
+var mainCmds = []string{"select", "insert", "update", "delete", "merge", "values", "table", "replace"}
+
+type stmtInfo struct {
+	Cmd      string   // main SQL keyword, after a WITH clause: update|insert|delete|select|create|drop|alter|show...
+	Type     string   // Identified type of statement : "query"|"non-query". A query may return rows
+	Kind     string   // StmtKindSelect, StmtKindDML...
+	ReadOnly bool     // the statement does not modify data nor schema
+	Tables   []string // referenced tables, unquoted, ex: schema.table
+	Nested   []string // kinds of the commands nested in the statement: CTEs, subqueries, MSSQL batch statements
+}
+
+// StmtInfo classifies a SQL statement with the vendor lexer.
+func StmtInfo(sql string, dbVendor string) (infos stmtInfo) {
+	tokens := tokenize(sql, dbVendor)
+	infos = stmtClassify(tokens, dbVendor)
+	infos.Tables = stmtTables(tokens)
+	return
+}
+
+func stmtClassify(tokens []token, dbVendor string) (infos stmtInfo) {
+	infos.Type = "query"
+	infos.Kind = StmtKindOther
+
+	// main command, skipping opening parentheses and a WITH clause
+	main := 0
+	for main < len(tokens) && tokens[main].text == "(" {
+		main++
+	}
+	if main == len(tokens) || tokens[main].typ != tokenWord {
+		return
+	}
+	if tokens[main].is("with") {
+		depth := 0
+		for i := main + 1; i < len(tokens); i++ {
+			depth += parenDelta(tokens[i])
+			if depth == 0 && tokens[i].is(mainCmds...) {
+				main = i
+				break
+			}
+		}
+	}
+	infos.Cmd = strings.ToLower(tokens[main].text)
+	if kind, ok := stmtKinds[infos.Cmd]; ok {
+		infos.Kind = kind
+	}
+	next := func(i int) token {
+		if i+1 < len(tokens) {
+			return tokens[i+1]
 		}
+		return token{}
+	}
 
-		for {
-			if inBlockComment {
-				end := strings.Index(line, "*/")
-				if end == -1 {
-					line = "" // discard line inside block comment
-					break
+	switch infos.Cmd {
+	case "explain", "analyze":
+		// the explained statement runs with ANALYZE (PostgreSQL), or MariaDB ANALYZE <statement>
+		i, analyze := main+1, infos.Cmd == "analyze"
+		for ; i < len(tokens); i++ {
+			if tokens[i].text == "(" {
+				end := closingParen(tokens, i)
+				for _, option := range tokens[i:end] {
+					analyze = analyze || option.is("analyze")
 				}
-				line = line[end+2:]
-				inBlockComment = false
-				line = strings.TrimSpace(line)
+				i = end
+			} else if tokens[i].is("analyze") {
+				analyze = true
+			} else if tokens[i].is("select", "insert", "update", "delete", "merge", "values", "table", "replace", "with") {
+				break
+			}
+		}
+		if i == len(tokens) && infos.Cmd == "analyze" {
+			// PostgreSQL ANALYZE table, MySQL ANALYZE TABLE
+			return
+		}
+		infos.Kind = StmtKindSelect
+		if inner := stmtClassify(tokens[i:], dbVendor); analyze && !inner.ReadOnly {
+			infos.Kind = inner.Kind
+		}
+		infos.ReadOnly = isReadOnlyKind(infos.Kind)
+		return
+	case "pragma":
+		// a pragma with an argument sets it, but for the schema pragmas whose argument is a table or index name
+		for i := main + 1; i < len(tokens); i++ {
+			if tokens[i].text == "=" || tokens[i].text == "(" && !tokens[i-1].is(schemaPragmas...) {
+				infos.Kind = StmtKindSession
+				break
 			}
+		}
+	case "begin":
+		if dbVendor == types.DBVendorMSSQL && !next(main).is("tran", "transaction", "distributed") {
+			infos.Kind = StmtKindOther // BEGIN ... END block
+		}
+	case "start":
+		if !next(main).is("transaction") {
+			infos.Kind = StmtKindAdmin // MySQL START REPLICA...
+		}
+	}
 
-			if strings.HasPrefix(line, "/*") {
-				end := strings.Index(line, "*/")
-				if end == -1 {
-					inBlockComment = true
-					line = "" // discard the rest of the line
-					break
-				}
-				line = line[end+2:]
-				line = strings.TrimSpace(line)
+	// rows are returned by a select, or a DML with RETURNING (MSSQL OUTPUT)
+	switch infos.Kind {
+	case StmtKindDML:
+		infos.Type = "non-query"
+		depth := 0
+		for _, t := range tokens[main:] {
+			depth += parenDelta(t)
+			if depth == 0 && (t.is("returning") && dbVendor != types.DBVendorMSSQL || t.is("output") && dbVendor == types.DBVendorMSSQL) {
+				infos.Type = "query"
+			}
+		}
+	case StmtKindDDL:
+		infos.Type = "non-query"
+	case StmtKindSelect:
+		// SELECT ... INTO creates a table, except MySQL where it sets variables or writes a file
+		depth := 0
+		for i, t := range tokens[main:] {
+			depth += parenDelta(t)
+			if depth != 0 || !t.is("into") || infos.Cmd != "select" {
 				continue
 			}
-
-			// Remove inline -- or // comments after code
-			if idx := strings.Index(line, "--"); idx != -1 {
-				line = line[:idx]
+			infos.Type = "non-query"
+			switch {
+			case dbVendor != types.DBVendorMySQL && dbVendor != types.DBVendorMariaDB:
+				infos.Kind = StmtKindDDL
+			case next(main+i).is("outfile", "dumpfile"):
+				infos.Kind = StmtKindAdmin
 			}
-			if idx := strings.Index(line, "//"); idx != -1 {
-				line = line[:idx]
+			break
+		}
+	}
+
+	// commands nested in CTEs, subqueries or MSSQL batches, where a statement needs no semicolon:
+	// any command raises the statement kind, unless it is used as a name or a clause of the statement
+	for i, t := range tokens {
+		if i == main || t.typ != tokenWord {
+			continue
+		}
+		kind, ok := stmtKinds[strings.ToLower(t.text)]
+		if !ok || !isNestedCommand(tokens, i, dbVendor) {
+			continue
+		}
+		infos.Nested = append(infos.Nested, kind)
+		if stmtKindRanks[kind] > stmtKindRanks[infos.Kind] {
+			infos.Kind = kind
+		}
+	}
+	// PostgreSQL set_config('default_transaction_read_only', 'off', false) is a SET in a function call
+	for i, t := range tokens {
+		if t.isName() && strings.EqualFold(t.text, "set_config") && i+1 < len(tokens) && tokens[i+1].text == "(" && dbVendor == types.DBVendorPostgres {
+			infos.Nested = append(infos.Nested, StmtKindSession)
+			if stmtKindRanks[StmtKindSession] > stmtKindRanks[infos.Kind] {
+				infos.Kind = StmtKindSession
 			}
+		}
+	}
+	infos.ReadOnly = isReadOnlyKind(infos.Kind)
+	return
+}
 
-			break
+// isNestedCommand reports whether the command keyword at i starts a nested command,
+// and not a name (column, table, function), nor a clause of the enclosing statement.
+func isNestedCommand(tokens []token, i int, dbVendor string) bool {
+	t := tokens[i]
+	var prev, next token
+	if i > 0 {
+		prev = tokens[i-1]
+	}
+	if i+1 < len(tokens) {
+		next = tokens[i+1]
+	}
+	switch {
+	case prev.text == "." || next.text == ".":
+		return false // schema.table, table.column
+	case next.text == "(" && !t.is("exec", "execute"):
+		return false // function call, MSSQL EXEC('...') runs a statement
+	case prev.typ == tokenPunct && prev.text != "(" && prev.text != ")" && prev.text != ";",
+		next.typ == tokenPunct && next.text != "(" && next.text != ";":
+		return false // a name in a list or an expression: a, start, b / start = 1
+	case prev.is("select", "distinct", "by", "as") || prev.is(tableKeywords...) || next.is("as") && !t.is("exec", "execute"):
+		return false // a column or table name, MSSQL EXECUTE AS changes the user
+	case prev.is("on", "for", "key", "do", "or", "character", "char", "with"):
+		return false // ON DELETE, FOR UPDATE, ON DUPLICATE KEY UPDATE, DO UPDATE, CREATE OR REPLACE, CHARACTER SET...
+	case t.is("end", "copy", "load", "comment", "rename", "table"):
+		return false // CASE ... END, MySQL LOAD_FILE, common column names
+	case t.is("use") && next.is("index", "key"), t.is("lock") && next.is("in"):
+		return false // MySQL USE INDEX, LOCK IN SHARE MODE
+	case t.is("begin") && dbVendor == types.DBVendorMSSQL && !next.is("tran", "transaction", "distributed"):
+		return false // MSSQL BEGIN ... END block, BEGIN TRY
+	case t.is("set") && isSetClause(tokens, i):
+		return false // UPDATE t SET, MySQL INSERT INTO t SET, ALTER ... SET
+	}
+	return true
+}
+
+// isSetClause reports whether the SET keyword at i is a clause of the previous UPDATE, INSERT or ALTER command,
+// and not a MSSQL SET statement that follows it in a batch: a SET statement is preceded by another SET.
+func isSetClause(tokens []token, i int) bool {
+	for i--; i >= 0 && tokens[i].text != ";"; i-- {
+		switch {
+		case tokens[i].is("set"):
+			return false
+		case tokens[i].is("update", "insert", "replace", "merge", "alter", "create"):
+			return true
 		}
-		if line != "" {
-			cleaned = append(cleaned, line)
+	}
+	return false
+}
+
+func isReadOnlyKind(kind string) bool {
+	return kind == StmtKindSelect || kind == StmtKindTransaction || kind == StmtKindSession
+}
+
+// parenDelta returns the nesting depth change of a token.
+func parenDelta(t token) int {
+	switch {
+	case t.typ != tokenPunct:
+		return 0
+	case t.text == "(":
+		return 1
+	case t.text == ")":
+		return -1
+	}
+	return 0
+}
+
+// closingParen returns the index of the parenthesis closing the one at i, the last index when there is none.
+func closingParen(tokens []token, i int) int {
+	depth := 0
+	for ; i < len(tokens); i++ {
+		if depth += parenDelta(tokens[i]); depth == 0 {
+			return i
 		}
 	}
-	return strings.Join(cleaned, " ")
+	return len(tokens) - 1
 }
 
-// stmtCmd returns the first word (SQL command)
-func stmtCmd(sql string) string {
-	for i, r := range sql {
-		if unicode.IsSpace(r) {
-			return sql[:i]
+// tableKeywords are followed by table names.
+var tableKeywords = []string{"from", "join", "into", "update", "table", "using", "truncate", "merge"}
+
+// clauseKeywords end a table reference, they are not aliases.
+var clauseKeywords = []string{"where", "join", "inner", "left", "right", "full", "cross", "natural", "outer", "on", "using",
+	"group", "order", "limit", "having", "union", "except", "intersect", "window", "offset", "fetch", "for", "set",
+	"values", "select", "returning", "output", "with", "tablesample", "pivot", "unpivot", "when", "default", "partition"}
+
+// stmtTables returns the tables referenced by a statement, excluding CTE names.
+// Keywords inside function calls, ex: EXTRACT(YEAR FROM d), are ignored.
+func stmtTables(tokens []token) []string {
+	ctes := map[string]bool{}
+	for i := 1; i < len(tokens); i++ {
+		if !tokens[i].isName() || !(tokens[i-1].is("with", "recursive") || tokens[i-1].text == ",") {
+			continue
+		}
+		// name [(columns)] AS [NOT] [MATERIALIZED] (
+		j := i + 1
+		if j < len(tokens) && tokens[j].text == "(" {
+			j = closingParen(tokens, j) + 1
+		}
+		if j < len(tokens) && tokens[j].is("as") {
+			for j++; j < len(tokens) && tokens[j].is("not", "materialized"); j++ {
+			}
+			if j < len(tokens) && tokens[j].text == "(" {
+				ctes[strings.ToLower(tokens[i].text)] = true
+			}
 		}
 	}
-	return sql
+
+	var tables []string
+	seen := map[string]bool{}
+	var functionCall []bool // by open parenthesis, whether it is a function call or a column list
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.text == "(" && t.typ == tokenPunct:
+			subquery := i+1 < len(tokens) && tokens[i+1].is("select", "with", "values", "insert", "update", "delete", "merge")
+			functionCall = append(functionCall, !subquery)
+			continue
+		case t.text == ")" && t.typ == tokenPunct:
+			if len(functionCall) > 0 {
+				functionCall = functionCall[:len(functionCall)-1]
+			}
+			continue
+		case !t.is(tableKeywords...) || len(functionCall) > 0 && functionCall[len(functionCall)-1]:
+			continue
+		case i > 0 && tokens[i-1].is("for", "on", "key", "do", "then"):
+			continue // FOR UPDATE, ON UPDATE, MERGE ... THEN UPDATE...
+		}
+
+		keyword := strings.ToLower(t.text)
+		for i++; i < len(tokens); i++ {
+			for i < len(tokens) && tokens[i].is("if", "not", "exists", "only", "into", "table", "lateral") {
+				i++
+			}
+			// schema.table
+			var parts []string
+			for i < len(tokens) && tokens[i].isName() {
+				parts = append(parts, tokens[i].text)
+				if i+2 < len(tokens) && tokens[i+1].text == "." {
+					i += 2
+					continue
+				}
+				break
+			}
+			if len(parts) == 0 || i+1 < len(tokens) && tokens[i+1].text == "(" && (keyword == "from" || keyword == "join" || keyword == "using") {
+				// subquery or table function
+				i--
+				break
+			}
+			name := strings.Join(parts, ".")
+			if key := strings.ToLower(name); !seen[key] && !(len(parts) == 1 && ctes[key]) && !(keyword == "into" && tokens[i].is("outfile", "dumpfile")) {
+				seen[key] = true
+				tables = append(tables, name)
+			}
+
+			// [AS] alias, then a comma for another table
+			if i+1 < len(tokens) && tokens[i+1].is("as") {
+				i++
+			}
+			if i+1 < len(tokens) && tokens[i+1].isName() && !tokens[i+1].is(clauseKeywords...) {
+				i++
+			}
+			if i+1 >= len(tokens) || tokens[i+1].text != "," || keyword == "into" || keyword == "join" {
+				break
+			}
+			i++
+		}
+	}
+	return tables
 }
 
-type stmtInfo struct {
-	Cmd  string // Top level SQL keyword : update|insert|delete|select|create|drop|alter|show...
-	Type string // Identified type of statement : "query"|"not-query"
+// SplitStatements splits a SQL script on the semicolons found by the vendor lexer, outside of quotes, comments
+// and PostgreSQL dollar quoted bodies, so that statements are split as StmtInfo reads them. Empty statements are removed.
+func SplitStatements(script string, dbVendor string) []string {
+	var stmts []string
+	start := 0
+	add := func(end int) {
+		if stmt := strings.TrimSpace(script[start:end]); stmt != "" && len(tokenize(stmt, dbVendor)) > 0 {
+			stmts = append(stmts, stmt)
+		}
+		start = end + 1
+	}
+
+	for _, t := range tokenize(script, dbVendor) {
+		if t.typ == tokenPunct && t.text == ";" {
+			add(t.pos)
+		}
+	}
+	if start < len(script) {
+		add(len(script))
+	}
+	return stmts
 }
 
-func StmtInfo(sql string, dbVendor string) (infos stmtInfo) {
-	sql = stmtClean(strings.ToLower(sql))
-	infos.Cmd = stmtCmd(sql)
-
-	if slices.Contains([]string{"insert", "update", "delete", "drop", "alter", "create"}, infos.Cmd) {
-		var r *regexp.Regexp
-		if dbVendor == "mssql" {
-			r = regexp.MustCompile(`[\s](output)[\s]`)
-		} else {
-			r = regexp.MustCompile(`[\s](returning)[\s]`)
-		}
-		if r.MatchString(sql) {
-			infos.Type = "query"
-		} else {
-			infos.Type = "non-query"
+// Subquery returns a single query without its trailing semicolons and comments, to be used as a derived table:
+// "SELECT ... FROM (" + query + "\n) t". An error is returned for several statements or none.
+// MSSQL does not allow a WITH clause in a derived table, an error is returned, and its ORDER BY is removed
+// unless the query has a TOP, OFFSET or FOR clause, the order of a derived table being undefined.
+func Subquery(query string, dbVendor string) (string, error) {
+	stmts := SplitStatements(query, dbVendor)
+	switch len(stmts) {
+	case 0:
+		return "", errors.New("query is empty")
+	case 1:
+	default:
+		return "", fmt.Errorf("query must be a single statement, found %d", len(stmts))
+	}
+	query = stmts[0]
+	tokens := tokenize(query, dbVendor)
+	query = query[:tokenEnd(query, tokens[len(tokens)-1])]
+	if dbVendor != types.DBVendorMSSQL {
+		return query, nil
+	}
+
+	if tokens[0].is("with") {
+		return "", fmt.Errorf("a query with a WITH clause cannot be used as a subquery on %s", dbVendor)
+	}
+	depth, order := 0, -1
+	for i, t := range tokens {
+		depth += parenDelta(t)
+		if depth != 0 {
+			continue
 		}
-	} else {
-		infos.Type = "query"
+		switch {
+		case t.is("top", "offset", "for"):
+			return query, nil
+		case order == -1 && t.is("order") && i+1 < len(tokens) && tokens[i+1].is("by"):
+			order = i
+		}
+	}
+	if order != -1 {
+		query = strings.TrimSpace(query[:tokens[order].pos])
 	}
+	return query, nil
+}
 
-	return
+// isParamName reports whether s is an identifier: a letter or _, followed by letters, digits or _.
+func isParamName(s string) bool {
+	for i, r := range s {
+		if !(r == '_' || unicode.IsLetter(r) || i > 0 && unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return s != ""
 }
@@ -0,0 +1,144 @@
+package dbutil
+
+import (
+	"db-portal/internal/types"
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		vendor string
+		script string
+		want   []string
+	}{
+		{types.DBVendorPostgres, "select 1; select 2;", []string{"select 1", "select 2"}},
+		{types.DBVendorPostgres, "select ';'; -- ;\nselect 2", []string{"select ';'", "-- ;\nselect 2"}},
+		{types.DBVendorPostgres, "select $$a;b$$; select $t$;$t$", []string{"select $$a;b$$", "select $t$;$t$"}},
+		{types.DBVendorPostgres, "/* a /* ; */ ; */ select 1; select 2", []string{"/* a /* ; */ ; */ select 1", "select 2"}},
+		{types.DBVendorPostgres, "select E'it\\'s;'; select 2", []string{"select E'it\\'s;'", "select 2"}},
+		{types.DBVendorMySQL, "select 'it\\'s'; select 2", []string{"select 'it\\'s'", "select 2"}},
+		{types.DBVendorMySQL, "select \"a;b\"; # ;\nselect 2", []string{"select \"a;b\"", "# ;\nselect 2"}},
+		{types.DBVendorMySQL, "select `a;b` from t; select 2", []string{"select `a;b` from t", "select 2"}},
+		{types.DBVendorMSSQL, "select [a;b] from t; select 2", []string{"select [a;b] from t", "select 2"}},
+		{types.DBVendorMSSQL, "select x$a$ from t; select 2", []string{"select x$a$ from t", "select 2"}},
+		{types.DBVendorSQLite, " ; ;select 1;; -- only a comment", []string{"select 1"}},
+	}
+	for _, tt := range tests {
+		if got := SplitStatements(tt.script, tt.vendor); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitStatements(%q, %s) = %q, want %q", tt.script, tt.vendor, got, tt.want)
+		}
+	}
+}
+
+func TestBindNamedParams(t *testing.T) {
+	params := map[string]Param{"id": {Value: 1}}
+	tests := []struct {
+		vendor string
+		query  string
+		want   string
+	}{
+		{types.DBVendorPostgres, "select :id, ':id', x::int, $1 from t where a = :id", "select $1, ':id', x::int, $1 from t where a = $1"},
+		{types.DBVendorMySQL, "select 'it\\'s :id', @id, @@version", "select 'it\\'s :id', ?, @@version"},
+		{types.DBVendorMSSQL, "select [:id], @id -- :id", "select [:id], @p1 -- :id"},
+	}
+	for _, tt := range tests {
+		got, args, err := BindNamedParams(tt.query, tt.vendor, params)
+		if err != nil || got != tt.want || len(args) != 1 {
+			t.Errorf("BindNamedParams(%q, %s) = %q, %v, %v, want %q", tt.query, tt.vendor, got, args, err, tt.want)
+		}
+	}
+}
+
+func TestStmtInfo(t *testing.T) {
+	tests := []struct {
+		vendor string
+		sql    string
+		kind   string
+	}{
+		{types.DBVendorMSSQL, "SELECT 1 EXEC sp_executesql N'DELETE FROM dbo.t'", StmtKindCall},
+		{types.DBVendorMSSQL, "SELECT 1 EXEC('DELETE FROM dbo.t')", StmtKindCall},
+		{types.DBVendorMSSQL, "SELECT 1 KILL 55", StmtKindAdmin},
+		{types.DBVendorMSSQL, "SELECT 1 EXECUTE AS LOGIN = 'sa'", StmtKindCall},
+		{types.DBVendorMSSQL, "SELECT 1 IF 1 = 0 SELECT 1 ELSE DELETE FROM t", StmtKindDML},
+		{types.DBVendorMSSQL, "SELECT * FROM t WITH (NOLOCK) UPDATE t SET a = 1", StmtKindDML},
+		{types.DBVendorMSSQL, "SELECT 1 BEGIN TRAN", StmtKindTransaction},
+		{types.DBVendorMSSQL, "BEGIN SELECT 1 END", StmtKindOther},
+		{types.DBVendorMSSQL, "SELECT [kill], t.[exec] FROM t", StmtKindSelect},
+		{types.DBVendorPostgres, "WITH d AS (DELETE FROM t RETURNING *) SELECT * FROM d", StmtKindDML},
+		{types.DBVendorPostgres, "SELECT start, id, end FROM t", StmtKindSelect},
+		{types.DBVendorPostgres, "SELECT set_config('default_transaction_read_only', 'off', false)", StmtKindSession},
+		{types.DBVendorPostgres, "SELECT pg_catalog.\"set_config\"('statement_timeout', '0', false)", StmtKindSession},
+		{types.DBVendorPostgres, "SELECT current_setting('statement_timeout')", StmtKindSelect},
+		{types.DBVendorPostgres, "SELECT * FROM t FOR NO KEY UPDATE", StmtKindSelect},
+		{types.DBVendorPostgres, "SELECT * FROM t FOR UPDATE", StmtKindSelect},
+		{types.DBVendorPostgres, "SELECT CASE WHEN a THEN 1 ELSE 2 END AS x FROM t", StmtKindSelect},
+		{types.DBVendorPostgres, "EXPLAIN ANALYZE SELECT 1", StmtKindSelect},
+		{types.DBVendorPostgres, "EXPLAIN ANALYZE DELETE FROM t", StmtKindDML},
+		{types.DBVendorMySQL, "SELECT * FROM t USE INDEX (i) LOCK IN SHARE MODE", StmtKindSelect},
+		{types.DBVendorMySQL, "EXPLAIN ANALYZE DELETE FROM t", StmtKindDML},
+		{types.DBVendorMariaDB, "ANALYZE FORMAT=JSON UPDATE t SET a = 1", StmtKindDML},
+		{types.DBVendorMariaDB, "ANALYZE FORMAT=JSON SELECT * FROM t", StmtKindSelect},
+		{types.DBVendorMySQL, "INSERT INTO t VALUES (1) ON DUPLICATE KEY UPDATE a = 1", StmtKindDML},
+		{types.DBVendorMySQL, "SELECT TRUNCATE(a, 2), REPLACE(b, 'x', 'y') FROM t", StmtKindSelect},
+		{types.DBVendorClickHouse, "SELECT * FROM system.tables", StmtKindSelect},
+		{types.DBVendorSQLite, "PRAGMA main.table_info(t)", StmtKindSelect},
+		{types.DBVendorSQLite, "PRAGMA user_version", StmtKindSelect},
+		{types.DBVendorSQLite, "PRAGMA query_only = 0", StmtKindSession},
+		{types.DBVendorSQLite, "PRAGMA query_only(0)", StmtKindSession},
+	}
+	for _, tt := range tests {
+		if got := StmtInfo(tt.sql, tt.vendor); got.Kind != tt.kind || got.ReadOnly != isReadOnlyKind(tt.kind) {
+			t.Errorf("StmtInfo(%q, %s) = %s (read-only %v), want %s", tt.sql, tt.vendor, got.Kind, got.ReadOnly, tt.kind)
+		}
+	}
+}
+
+func TestStmtInfoNested(t *testing.T) {
+	tests := []struct {
+		vendor string
+		sql    string
+		want   []string
+	}{
+		{types.DBVendorMSSQL, "DELETE FROM t COMMIT", []string{StmtKindTransaction}},
+		{types.DBVendorMSSQL, "UPDATE t SET a = 1 SET IMPLICIT_TRANSACTIONS ON", []string{StmtKindSession}},
+		{types.DBVendorMSSQL, "UPDATE t SET a = 1 WHERE b IN (SELECT b FROM u)", []string{StmtKindSelect}},
+		{types.DBVendorMySQL, "INSERT INTO t SET a = 1 ON DUPLICATE KEY UPDATE a = 2", nil},
+		{types.DBVendorPostgres, "MERGE INTO t USING u ON t.id = u.id WHEN MATCHED THEN UPDATE SET a = u.a", []string{StmtKindDML}},
+	}
+	for _, tt := range tests {
+		if got := StmtInfo(tt.sql, tt.vendor).Nested; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("StmtInfo(%q, %s).Nested = %q, want %q", tt.sql, tt.vendor, got, tt.want)
+		}
+	}
+}
+
+func TestSubquery(t *testing.T) {
+	tests := []struct {
+		vendor string
+		query  string
+		want   string // empty when an error is expected
+	}{
+		{types.DBVendorPostgres, "select 1;", "select 1"},
+		{types.DBVendorPostgres, "select 1 -- one;\n; ;", "select 1"},
+		{types.DBVendorPostgres, "select 1 /* one */", "select 1"},
+		{types.DBVendorPostgres, `select "a" from t order by "a"`, `select "a" from t order by "a"`},
+		{types.DBVendorMySQL, "select `a` # a", "select `a`"},
+		{types.DBVendorMSSQL, "select [a] -- a", "select [a]"},
+		{types.DBVendorMSSQL, "select a from t order by a -- a", "select a from t"},
+		{types.DBVendorMSSQL, "select a, row_number() over (order by a) from t", "select a, row_number() over (order by a) from t"},
+		{types.DBVendorMSSQL, "select top 10 a from t order by a", "select top 10 a from t order by a"},
+		{types.DBVendorMSSQL, "select a from t order by a offset 5 rows", "select a from t order by a offset 5 rows"},
+		{types.DBVendorMSSQL, "with c as (select 1 a) select a from c", ""},
+		{types.DBVendorPostgres, "select 1; select 2", ""},
+		{types.DBVendorPostgres, " ; -- nothing", ""},
+	}
+	for _, tt := range tests {
+		got, err := Subquery(tt.query, tt.vendor)
+		if tt.want == "" && err == nil {
+			t.Errorf("Subquery(%q, %s) = %q, want an error", tt.query, tt.vendor, got)
+		} else if tt.want != "" && (err != nil || got != tt.want) {
+			t.Errorf("Subquery(%q, %s) = %q, %v, want %q", tt.query, tt.vendor, got, err, tt.want)
+		}
+	}
+}
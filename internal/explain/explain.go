@@ -0,0 +1,221 @@
+// Package explain parses the query plans of the vendors into a common tree of plan nodes,
+// so that a plan can be rendered the same way whatever the database, with its most expensive nodes highlighted.
+package explain
+
+import (
+	"db-portal/internal/types"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Node is an operation of a query plan. Metrics the vendor does not report are nil.
+type Node struct {
+	Operator      string   `json:"operator"`
+	Relation      string   `json:"relation,omitempty"`      // table or index read by the operation
+	EstimatedRows *float64 `json:"estimatedRows,omitempty"` // rows the planner expects the operation to return
+	ActualRows    *float64 `json:"actualRows,omitempty"`    // rows returned, for all loops, with an actual plan
+	Cost          *float64 `json:"cost,omitempty"`          // estimated cost of the operation and its children, in vendor units
+	Time          *float64 `json:"time,omitempty"`          // actual time of the operation and its children in ms, for all loops
+	Detail        string   `json:"detail,omitempty"`        // conditions, index, join type...
+	Expensive     bool     `json:"expensive,omitempty"`     // among the nodes with the highest own time, or else cost
+	Children      []*Node  `json:"children,omitempty"`
+}
+
+// maxExpensive is the number of nodes marked as expensive, among the nodes with at least minExpensiveShare of the total.
+const (
+	maxExpensive      = 3
+	minExpensiveShare = 0.1
+)
+
+// Parse returns the plan tree of the rows of an explain query of the vendor, see the explain command of commands.yaml.
+// It fails on a plan format it does not know, the rows are then shown as they are.
+func Parse(vendor string, cols []string, rows [][]any) (*Node, error) {
+	if len(rows) == 0 || len(cols) == 0 {
+		return nil, fmt.Errorf("empty plan")
+	}
+	var root *Node
+	var err error
+	switch vendor {
+	case types.DBVendorPostgres:
+		root, err = parsePostgres(planText(rows))
+	case types.DBVendorClickHouse:
+		root, err = parseClickHouse(planText(rows))
+	case types.DBVendorMySQL, types.DBVendorMariaDB:
+		root, err = parseMySQL(planText(rows))
+	case types.DBVendorMSSQL:
+		root, err = parseMSSQL(planText(rows))
+	case types.DBVendorSQLite:
+		root, err = parseSQLite(cols, rows)
+	default:
+		err = fmt.Errorf("plans of %s are not supported", vendor)
+	}
+	if err != nil {
+		return nil, err
+	}
+	markExpensive(root)
+	return root, nil
+}
+
+// planText returns the text of a plan printed in the first column of its rows, one row or one line by row.
+func planText(rows [][]any) string {
+	var b strings.Builder
+	for _, row := range rows {
+		if len(row) == 0 {
+			continue
+		}
+		switch v := row[0].(type) {
+		case string:
+			b.WriteString(v)
+		case []byte:
+			b.Write(v)
+		case nil:
+		default:
+			// a json column decoded by the driver
+			j, _ := json.Marshal(v)
+			b.Write(j)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// decodeJSON decodes a json plan, numbers are kept as json.Number.
+func decodeJSON(text string) (any, error) {
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid json plan. %v", err)
+	}
+	return v, nil
+}
+
+// number returns a json number, a float or a numeric string as a float, nil otherwise.
+func number(v any) *float64 {
+	var f float64
+	var err error
+	switch n := v.(type) {
+	case json.Number:
+		f, err = n.Float64()
+	case float64:
+		f = n
+	case int64:
+		f = float64(n)
+	case int:
+		f = float64(n)
+	case string:
+		f, err = strconv.ParseFloat(strings.TrimSpace(n), 64)
+	default:
+		return nil
+	}
+	if err != nil {
+		return nil
+	}
+	return &f
+}
+
+// str returns a string value, or its json text.
+func str(v any) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case json.Number:
+		return s.String()
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// mul returns a * b, nil when a is nil. A nil b counts as 1.
+func mul(a, b *float64) *float64 {
+	if a == nil || b == nil {
+		return a
+	}
+	f := *a * *b
+	return &f
+}
+
+// details joins the non empty "name: value" pairs of a node detail.
+func details(pairs ...string) string {
+	var parts []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] != "" {
+			parts = append(parts, pairs[i]+": "+pairs[i+1])
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// markExpensive marks the nodes with the highest own time, the node time less its children time,
+// or own cost when the plan has no time.
+func markExpensive(root *Node) {
+	metric := func(n *Node) *float64 { return n.Time }
+	if !hasMetric(root, metric) {
+		metric = func(n *Node) *float64 { return n.Cost }
+	}
+	total := metric(root)
+	if total == nil || *total <= 0 {
+		return
+	}
+
+	type own struct {
+		node  *Node
+		value float64
+	}
+	var nodes []own
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if v := metric(n); v != nil {
+			value := *v
+			for _, c := range n.Children {
+				if cv := metric(c); cv != nil {
+					value -= *cv
+				}
+			}
+			if value >= *total*minExpensiveShare {
+				nodes = append(nodes, own{n, value})
+			}
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(root)
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].value > nodes[j].value })
+	for i := 0; i < len(nodes) && i < maxExpensive; i++ {
+		nodes[i].node.Expensive = true
+	}
+}
+
+func hasMetric(n *Node, metric func(*Node) *float64) bool {
+	if metric(n) != nil {
+		return true
+	}
+	for _, c := range n.Children {
+		if hasMetric(c, metric) {
+			return true
+		}
+	}
+	return false
+}
+
+// sumChildren sets the metric of the nodes without it to the sum of their children, from the leaves.
+func sumChildren(n *Node, metric func(*Node) **float64) {
+	var sum float64
+	set := false
+	for _, c := range n.Children {
+		sumChildren(c, metric)
+		if v := *metric(c); v != nil {
+			sum += *v
+			set = true
+		}
+	}
+	if *metric(n) == nil && set {
+		*metric(n) = &sum
+	}
+}
@@ -0,0 +1,147 @@
+package explain
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// xmlElement is an element of a generic xml tree.
+type xmlElement struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr   `xml:",any,attr"`
+	Children []xmlElement `xml:",any"`
+}
+
+func (e xmlElement) attr(name string) string {
+	for _, a := range e.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// parseMSSQL parses a MSSQL SHOWPLAN_XML plan, or a STATISTICS XML plan with its run time counters.
+// The statements of the batch are the children of a batch node when there are several.
+func parseMSSQL(text string) (*Node, error) {
+	var root xmlElement
+	if err := xml.Unmarshal([]byte(strings.TrimSpace(text)), &root); err != nil {
+		return nil, fmt.Errorf("invalid xml plan. %v", err)
+	}
+	if root.XMLName.Local != "ShowPlanXML" {
+		return nil, fmt.Errorf("unknown plan format")
+	}
+	var statements []*Node
+	var walk func(e xmlElement)
+	walk = func(e xmlElement) {
+		if strings.HasPrefix(e.XMLName.Local, "Stmt") && e.attr("StatementText") != "" {
+			statements = append(statements, mssqlStatementNode(e))
+			return
+		}
+		for _, c := range e.Children {
+			walk(c)
+		}
+	}
+	walk(root)
+	switch len(statements) {
+	case 0:
+		return nil, fmt.Errorf("no statement in plan")
+	case 1:
+		return statements[0], nil
+	}
+	batch := &Node{Operator: "Batch", Children: statements}
+	sumChildren(batch, func(n *Node) **float64 { return &n.Cost })
+	return batch, nil
+}
+
+func mssqlStatementNode(e xmlElement) *Node {
+	n := &Node{
+		Operator:      e.attr("StatementType"),
+		EstimatedRows: number(e.attr("StatementEstRows")),
+		Cost:          number(e.attr("StatementSubTreeCost")),
+		Detail:        details("statement", strings.TrimSpace(e.attr("StatementText"))),
+	}
+	n.Children = mssqlRelOps(e)
+	if len(n.Children) == 1 && n.Children[0].Time != nil {
+		n.Time = n.Children[0].Time
+	}
+	return n
+}
+
+// mssqlRelOps returns the nodes of the RelOp elements under e, not under another RelOp.
+func mssqlRelOps(e xmlElement) []*Node {
+	var nodes []*Node
+	for _, c := range e.Children {
+		if c.XMLName.Local == "RelOp" {
+			nodes = append(nodes, mssqlRelOpNode(c))
+		} else {
+			nodes = append(nodes, mssqlRelOps(c)...)
+		}
+	}
+	return nodes
+}
+
+func mssqlRelOpNode(e xmlElement) *Node {
+	n := &Node{
+		Operator:      e.attr("PhysicalOp"),
+		EstimatedRows: number(e.attr("EstimateRows")),
+		Cost:          number(e.attr("EstimatedTotalSubtreeCost")),
+	}
+	if logical := e.attr("LogicalOp"); logical != n.Operator {
+		n.Detail = details("logical", logical)
+	}
+	if object, ok := mssqlObject(e); ok {
+		n.Relation = strings.Trim(strings.Join(nonEmpty(object.attr("Schema"), object.attr("Table")), "."), ".")
+		n.Relation = strings.NewReplacer("[", "", "]", "").Replace(n.Relation)
+		n.Detail = joinDetail(n.Detail, details("index", strings.Trim(object.attr("Index"), "[]")))
+	}
+
+	// run time counters of a STATISTICS XML plan, by thread
+	for _, c := range e.Children {
+		if c.XMLName.Local != "RunTimeInformation" {
+			continue
+		}
+		var rows, elapsed float64
+		for _, counter := range c.Children {
+			if r := number(counter.attr("ActualRows")); r != nil {
+				rows += *r
+			}
+			if t := number(counter.attr("ActualElapsedms")); t != nil && *t > elapsed {
+				elapsed = *t
+			}
+		}
+		n.ActualRows = &rows
+		if len(c.Children) > 0 && c.Children[0].attr("ActualElapsedms") != "" {
+			n.Time = &elapsed
+		}
+	}
+	n.Children = mssqlRelOps(e)
+	return n
+}
+
+// mssqlObject returns the first Object element of a RelOp, outside of its child RelOps.
+func mssqlObject(e xmlElement) (xmlElement, bool) {
+	for _, c := range e.Children {
+		if c.XMLName.Local == "RelOp" {
+			continue
+		}
+		if c.XMLName.Local == "Object" {
+			return c, true
+		}
+		if object, ok := mssqlObject(c); ok {
+			return object, true
+		}
+	}
+	return xmlElement{}, false
+}
+
+func nonEmpty(values ...string) []string {
+	var result []string
+	for _, v := range values {
+		if v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
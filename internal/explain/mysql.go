@@ -0,0 +1,259 @@
+package explain
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// mysqlAccessTypes name the access types of the MySQL and MariaDB json plans.
+var mysqlAccessTypes = map[string]string{
+	"ALL":             "Table scan",
+	"index":           "Index scan",
+	"range":           "Index range scan",
+	"ref":             "Index lookup",
+	"eq_ref":          "Unique index lookup",
+	"ref_or_null":     "Index lookup or null",
+	"const":           "Constant row",
+	"system":          "Constant row",
+	"fulltext":        "Fulltext index lookup",
+	"index_merge":     "Index merge",
+	"unique_subquery": "Unique subquery lookup",
+	"index_subquery":  "Subquery index lookup",
+}
+
+// mysqlOperations name the operations of the MySQL and MariaDB json plans (format version 1) that wrap other operations.
+var mysqlOperations = map[string]string{
+	"ordering_operation":         "Sort",
+	"grouping_operation":         "Group",
+	"duplicates_removal":         "Remove duplicates",
+	"windowing":                  "Window",
+	"materialized_from_subquery": "Materialize",
+	"filesort":                   "Sort",
+	"temporary_table":            "Temporary table",
+	"read_sorted_file":           "Read sorted file",
+}
+
+// parseMySQL parses a MySQL or MariaDB EXPLAIN FORMAT=JSON plan, and the MariaDB ANALYZE FORMAT=JSON plan with its r_ actual values.
+// The MySQL format version 2 (explain_json_format_version = 2, and EXPLAIN ANALYZE FORMAT=JSON) and the MySQL
+// EXPLAIN ANALYZE tree are parsed too.
+func parseMySQL(text string) (*Node, error) {
+	if strings.HasPrefix(strings.TrimSpace(text), "->") {
+		return parseMySQLTree(text)
+	}
+	v, err := decodeJSON(text)
+	if err != nil {
+		return nil, err
+	}
+	plan, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unknown plan format")
+	}
+	if _, ok := plan["operation"]; ok {
+		return mysqlV2Node(plan), nil
+	}
+	nodes := mysqlNodes(plan)
+	if len(nodes) != 1 {
+		return nil, fmt.Errorf("unknown plan format")
+	}
+	root := nodes[0]
+	sumChildren(root, func(n *Node) **float64 { return &n.Cost })
+	sumChildren(root, func(n *Node) **float64 { return &n.Time })
+	return root, nil
+}
+
+// mysqlV2Node parses an operation of a MySQL format version 2 plan: {"operation", "table_name", "estimated_rows", "inputs": [...]}.
+func mysqlV2Node(p map[string]any) *Node {
+	loops := number(p["actual_loops"])
+	n := &Node{
+		Operator:      str(p["operation"]),
+		Relation:      str(p["table_name"]),
+		EstimatedRows: number(p["estimated_rows"]),
+		ActualRows:    mul(number(p["actual_rows"]), loops),
+		Cost:          number(p["estimated_total_cost"]),
+		Time:          mul(number(p["actual_last_row_ms"]), loops),
+		Detail: details(
+			"access", str(p["access_type"]),
+			"index", str(p["index_name"]),
+			"join", str(p["join_algorithm"]),
+			"condition", str(p["condition"]),
+			"loops", str(p["actual_loops"]),
+		),
+	}
+	inputs, _ := p["inputs"].([]any)
+	for _, i := range inputs {
+		if input, ok := i.(map[string]any); ok {
+			n.Children = append(n.Children, mysqlV2Node(input))
+		}
+	}
+	return n
+}
+
+// mysqlNodes returns the nodes of the operations of an object of a format version 1 plan.
+func mysqlNodes(p map[string]any) []*Node {
+	var nodes []*Node
+	for _, key := range []string{"query_block", "union_result", "nested_loop", "table",
+		"ordering_operation", "grouping_operation", "duplicates_removal", "windowing", "filesort", "temporary_table", "read_sorted_file",
+		"materialized_from_subquery", "query_specifications", "attached_subqueries", "optimized_away_subqueries", "subqueries"} {
+		value, ok := p[key]
+		if !ok {
+			continue
+		}
+		switch key {
+		case "query_block":
+			block, _ := value.(map[string]any)
+			cost, _ := block["cost_info"].(map[string]any)
+			nodes = append(nodes, &Node{
+				Operator: "Query block " + str(block["select_id"]),
+				Cost:     number(cost["query_cost"]),
+				Time:     number(block["r_total_time_ms"]),
+				Children: mysqlNodes(block),
+			})
+		case "union_result":
+			union, _ := value.(map[string]any)
+			nodes = append(nodes, &Node{Operator: "Union", Relation: str(union["table_name"]), Children: mysqlNodes(union)})
+		case "nested_loop":
+			nodes = append(nodes, &Node{Operator: "Nested loop", Children: mysqlListNodes(value)})
+		case "table":
+			if table, ok := value.(map[string]any); ok {
+				nodes = append(nodes, mysqlTableNode(table))
+			}
+		case "query_specifications", "attached_subqueries", "optimized_away_subqueries", "subqueries":
+			nodes = append(nodes, mysqlListNodes(value)...)
+		default:
+			op, _ := value.(map[string]any)
+			n := &Node{Operator: mysqlOperations[key], Time: number(op["r_total_time_ms"]), Children: mysqlNodes(op)}
+			if key == "ordering_operation" && op["using_filesort"] != true {
+				n.Operator = "Ordering"
+			}
+			n.Detail = details("using temporary table", str(op["using_temporary_table"]))
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// mysqlListNodes returns the nodes of the objects of a json array.
+func mysqlListNodes(value any) []*Node {
+	var nodes []*Node
+	list, _ := value.([]any)
+	for _, item := range list {
+		if obj, ok := item.(map[string]any); ok {
+			nodes = append(nodes, mysqlNodes(obj)...)
+		}
+	}
+	return nodes
+}
+
+// mysqlTableNode returns the node of a table access. MySQL reports its own read and eval costs,
+// MariaDB its actual rows (r_rows) and time (r_total_time_ms) with ANALYZE.
+func mysqlTableNode(t map[string]any) *Node {
+	accessType := str(t["access_type"])
+	n := &Node{
+		Operator:      mysqlAccessTypes[accessType],
+		Relation:      str(t["table_name"]),
+		EstimatedRows: number(t["rows_produced_per_join"]),
+		ActualRows:    mul(number(t["r_rows"]), number(t["r_loops"])),
+		Time:          number(t["r_total_time_ms"]),
+		Detail: details(
+			"key", str(t["key"]),
+			"condition", str(t["attached_condition"]),
+			"filtered", str(t["filtered"]),
+			"using index", str(t["using_index"]),
+			"loops", str(t["r_loops"]),
+		),
+		Children: mysqlNodes(t),
+	}
+	if n.Operator == "" {
+		n.Operator = accessType
+	}
+	if n.EstimatedRows == nil {
+		n.EstimatedRows = number(t["rows"])
+	}
+	if cost, ok := t["cost_info"].(map[string]any); ok {
+		read, eval := number(cost["read_cost"]), number(cost["eval_cost"])
+		if read != nil && eval != nil {
+			own := *read + *eval
+			n.Cost = &own
+		}
+	}
+	return n
+}
+
+// mysqlTreeMetrics matches the metrics of an operation of a MySQL tree plan:
+// (cost=1.15 rows=9), (actual time=0.073..0.081 rows=9 loops=1) or (never executed).
+var mysqlTreeMetrics = regexp.MustCompile(`\s*\((?:cost=(?:[\d.e+-]+\.\.)?([\d.e+-]+) rows=([\d.e+-]+)|actual time=[\d.e+-]+\.\.([\d.e+-]+) rows=([\d.e+-]+) loops=(\d+)|never executed)\)`)
+
+// parseMySQLTree parses a MySQL EXPLAIN ANALYZE (or FORMAT=TREE) plan, one operation by line indented under its parent:
+// "-> Table scan on t1  (cost=1.15 rows=9) (actual time=0.073..0.081 rows=9 loops=1)".
+func parseMySQLTree(text string) (*Node, error) {
+	type level struct {
+		indent int
+		node   *Node
+	}
+	var root *Node
+	var stack []level
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if !strings.HasPrefix(trimmed, "->") {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+		n := mysqlTreeNode(strings.TrimSpace(strings.TrimPrefix(trimmed, "->")))
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		switch {
+		case len(stack) > 0:
+			parent := stack[len(stack)-1].node
+			parent.Children = append(parent.Children, n)
+		case root == nil:
+			root = n
+		default:
+			return nil, fmt.Errorf("unknown plan format")
+		}
+		stack = append(stack, level{indent, n})
+	}
+	if root == nil {
+		return nil, fmt.Errorf("unknown plan format")
+	}
+	return root, nil
+}
+
+// mysqlTreeNode returns the node of an operation line of a MySQL tree plan, without its arrow.
+func mysqlTreeNode(line string) *Node {
+	n := &Node{}
+	for _, m := range mysqlTreeMetrics.FindAllStringSubmatch(line, -1) {
+		switch {
+		case m[1] != "":
+			n.Cost, n.EstimatedRows = number(m[1]), number(m[2])
+		case m[3] != "":
+			loops := number(m[5])
+			n.Time, n.ActualRows = mul(number(m[3]), loops), mul(number(m[4]), loops)
+			n.Detail = details("loops", m[5])
+		}
+	}
+	desc := strings.TrimSpace(mysqlTreeMetrics.ReplaceAllString(line, ""))
+
+	// "Filter: (t1.a > 1)", "Index lookup on t2 using idx (a=t1.a)"
+	colon, on := strings.Index(desc, ": "), strings.Index(desc, " on ")
+	switch {
+	case colon > 0 && (on < 0 || colon < on):
+		n.Operator, n.Detail = desc[:colon], joinDetails(strings.TrimSpace(desc[colon+2:]), n.Detail)
+	case on > 0:
+		n.Operator = desc[:on]
+		relation, rest, _ := strings.Cut(desc[on+4:], " ")
+		n.Relation, n.Detail = relation, joinDetails(strings.TrimSpace(rest), n.Detail)
+	default:
+		n.Operator = desc
+	}
+	return n
+}
+
+// joinDetails joins the non empty details of a node.
+func joinDetails(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	return a + ", " + b
+}
@@ -0,0 +1,31 @@
+package explain
+
+import (
+	"db-portal/internal/types"
+	"testing"
+)
+
+func TestParseMySQLTree(t *testing.T) {
+	plan := "-> Nested loop inner join  (cost=4.95 rows=9) (actual time=0.153..0.200 rows=9 loops=1)\n" +
+		"    -> Filter: (t1.a is not null)  (cost=1.15 rows=9) (actual time=0.075..0.086 rows=9 loops=1)\n" +
+		"        -> Table scan on t1  (cost=1.15 rows=9) (actual time=0.073..0.081 rows=9 loops=1)\n" +
+		"    -> Index lookup on t2 using idx (a=t1.a)  (cost=0.27 rows=1) (actual time=0.010..0.012 rows=1 loops=9)\n"
+	root, err := Parse(types.DBVendorMySQL, []string{"EXPLAIN"}, [][]any{{plan}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Operator != "Nested loop inner join" || len(root.Children) != 2 || *root.Cost != 4.95 || *root.Time != 0.2 {
+		t.Fatalf("root = %+v", root)
+	}
+	filter, lookup := root.Children[0], root.Children[1]
+	if filter.Operator != "Filter" || filter.Detail != "(t1.a is not null), loops: 1" || len(filter.Children) != 1 {
+		t.Errorf("filter = %+v", filter)
+	}
+	if scan := filter.Children[0]; scan.Operator != "Table scan" || scan.Relation != "t1" || *scan.ActualRows != 9 {
+		t.Errorf("scan = %+v", scan)
+	}
+	if lookup.Operator != "Index lookup" || lookup.Relation != "t2" || lookup.Detail != "using idx (a=t1.a), loops: 9" ||
+		*lookup.ActualRows != 9 || *lookup.Time != 0.108 {
+		t.Errorf("lookup = %+v", lookup)
+	}
+}
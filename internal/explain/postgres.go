@@ -0,0 +1,143 @@
+package explain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parsePostgres parses a PostgreSQL EXPLAIN (FORMAT JSON) plan: [{"Plan": {"Node Type", ..., "Plans": [...]}, "Execution Time"}].
+func parsePostgres(text string) (*Node, error) {
+	plan, err := jsonPlan(text)
+	if err != nil {
+		return nil, err
+	}
+	root := postgresNode(plan["Plan"].(map[string]any))
+	root.Detail = joinDetail(root.Detail, details(
+		"planning time", msText(plan["Planning Time"]),
+		"execution time", msText(plan["Execution Time"]),
+	))
+	return root, nil
+}
+
+func postgresNode(p map[string]any) *Node {
+	n := &Node{
+		Operator:      str(p["Node Type"]),
+		Relation:      str(p["Relation Name"]),
+		EstimatedRows: number(p["Plan Rows"]),
+		Cost:          number(p["Total Cost"]),
+	}
+	if schema := str(p["Schema"]); schema != "" && n.Relation != "" {
+		n.Relation = schema + "." + n.Relation
+	}
+	if n.Relation == "" {
+		n.Relation = str(p["CTE Name"]) + str(p["Function Name"])
+	}
+	if alias := str(p["Alias"]); alias != "" && alias != p["Relation Name"] {
+		n.Relation = strings.TrimSpace(n.Relation + " " + alias)
+	}
+	loops := number(p["Actual Loops"])
+	n.ActualRows = mul(number(p["Actual Rows"]), loops)
+	n.Time = mul(number(p["Actual Total Time"]), loops)
+	n.Detail = details(
+		"join", str(p["Join Type"]),
+		"strategy", str(p["Strategy"]),
+		"index", str(p["Index Name"]),
+		"index cond", str(p["Index Cond"]),
+		"hash cond", str(p["Hash Cond"]),
+		"merge cond", str(p["Merge Cond"]),
+		"join filter", str(p["Join Filter"]),
+		"filter", str(p["Filter"]),
+		"recheck cond", str(p["Recheck Cond"]),
+		"sort key", listText(p["Sort Key"]),
+		"group key", listText(p["Group Key"]),
+		"loops", str(p["Actual Loops"]),
+	)
+	children, _ := p["Plans"].([]any)
+	for _, c := range children {
+		if child, ok := c.(map[string]any); ok {
+			n.Children = append(n.Children, postgresNode(child))
+		}
+	}
+	return n
+}
+
+// parseClickHouse parses a ClickHouse EXPLAIN json = 1 plan: [{"Plan": {"Node Type", "Description", "Plans": [...]}}].
+// ClickHouse plans have no cost nor rows estimate, the selected parts and granules of the indexes are in the detail.
+func parseClickHouse(text string) (*Node, error) {
+	plan, err := jsonPlan(text)
+	if err != nil {
+		return nil, err
+	}
+	return clickHouseNode(plan["Plan"].(map[string]any)), nil
+}
+
+func clickHouseNode(p map[string]any) *Node {
+	n := &Node{Operator: str(p["Node Type"])}
+	description := str(p["Description"])
+	if strings.HasPrefix(n.Operator, "ReadFrom") {
+		n.Relation = description
+	} else {
+		n.Detail = description
+	}
+	indexes, _ := p["Indexes"].([]any)
+	for _, i := range indexes {
+		index, ok := i.(map[string]any)
+		if !ok {
+			continue
+		}
+		n.Detail = joinDetail(n.Detail, fmt.Sprintf("%s index %s: %s/%s parts, %s/%s granules", str(index["Type"]), str(index["Name"]),
+			str(index["Selected Parts"]), str(index["Initial Parts"]), str(index["Selected Granules"]), str(index["Initial Granules"])))
+	}
+	children, _ := p["Plans"].([]any)
+	for _, c := range children {
+		if child, ok := c.(map[string]any); ok {
+			n.Children = append(n.Children, clickHouseNode(child))
+		}
+	}
+	return n
+}
+
+// jsonPlan returns the first object of a json array of {"Plan": {...}} objects.
+func jsonPlan(text string) (map[string]any, error) {
+	v, err := decodeJSON(text)
+	if err != nil {
+		return nil, err
+	}
+	if list, ok := v.([]any); ok && len(list) > 0 {
+		v = list[0]
+	}
+	plan, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unknown plan format")
+	}
+	if _, ok := plan["Plan"].(map[string]any); !ok {
+		return nil, fmt.Errorf("unknown plan format")
+	}
+	return plan, nil
+}
+
+// listText returns the items of a json array, comma separated.
+func listText(v any) string {
+	list, _ := v.([]any)
+	items := make([]string, len(list))
+	for i, item := range list {
+		items[i] = str(item)
+	}
+	return strings.Join(items, ", ")
+}
+
+// msText returns a time in ms as text, "" when missing.
+func msText(v any) string {
+	if f := number(v); f != nil {
+		return fmt.Sprintf("%.3f ms", *f)
+	}
+	return ""
+}
+
+// joinDetail joins two details, one may be empty.
+func joinDetail(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	return a + ", " + b
+}
@@ -0,0 +1,32 @@
+package explain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseSQLite parses the rows of a SQLite EXPLAIN QUERY PLAN: id, parent, notused, detail.
+// SQLite plans have no cost nor rows estimate.
+func parseSQLite(cols []string, rows [][]any) (*Node, error) {
+	if len(cols) != 4 || cols[0] != "id" || cols[1] != "parent" || cols[3] != "detail" {
+		return nil, fmt.Errorf("unknown plan format")
+	}
+	root := &Node{Operator: "Query"}
+	nodes := map[string]*Node{"0": root}
+	for _, row := range rows {
+		detail := str(row[3])
+		n := &Node{Operator: detail}
+		// SCAN t, SEARCH t USING INDEX i (a=?)
+		if verb, rest, ok := strings.Cut(detail, " "); ok && (verb == "SCAN" || verb == "SEARCH") {
+			n.Operator = verb
+			n.Relation, n.Detail, _ = strings.Cut(rest, " ")
+		}
+		parent, ok := nodes[fmt.Sprint(row[1])]
+		if !ok {
+			parent = root
+		}
+		parent.Children = append(parent.Children, n)
+		nodes[fmt.Sprint(row[0])] = n
+	}
+	return root, nil
+}
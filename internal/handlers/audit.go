@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"db-portal/internal/contextkeys"
+	"db-portal/internal/internaldb"
+	"db-portal/internal/response"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// audit appends an event to the audit log. The user and the client IP of ctx are used when not set.
+// A failure is logged only, the action is not changed.
+func (s *Services) audit(ctx context.Context, e internaldb.AuditEvent) {
+	e.At = time.Now().UTC().Format(time.RFC3339)
+	if e.Username == "" {
+		e.Username = contextkeys.UsernameFromContext(ctx)
+	}
+	if e.IP == "" {
+		e.IP = contextkeys.ClientIPFromContext(ctx)
+	}
+	if err := s.Store.CreateAuditEvent(e); err != nil {
+		log.Printf("cannot record audit event %s of user %s: %v", e.Action, e.Username, err)
+	}
+}
+
+// auditDetail returns the json detail of an audit event.
+func auditDetail(detail map[string]any) string {
+	b, err := json.Marshal(detail)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// errorString returns the message of err, "" for a nil error.
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// parseAuditFilter reads the audit log filter form values: username, action, dsName, from and to.
+func parseAuditFilter(r *http.Request) (internaldb.AuditFilter, error) {
+	f := internaldb.AuditFilter{
+		Username: r.FormValue("username"),
+		Action:   r.FormValue("action"),
+		DSName:   r.FormValue("dsName"),
+	}
+	var err error
+	if f.From, err = parseHistoryTime("from", r.FormValue("from")); err == nil {
+		f.To, err = parseHistoryTime("to", r.FormValue("to"))
+	}
+	return f, err
+}
+
+// HandleListAuditLog returns audit events, most recent first. Admin only.
+// Query parameters: username, action, dsName, from and to (dates or RFC 3339 times, to excluded),
+// limit (100 by default) and offset.
+func (s *Services) HandleListAuditLog(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.Response[[]internaldb.AuditEvent]{}
+
+	if ok, _ := s.Store.CheckIsAdmin(currentUsername); !ok {
+		resp.Error = "you are not allowed to read the audit log."
+		response.WriteJSON(w, http.StatusForbidden, &resp)
+		return
+	}
+
+	f, err := parseAuditFilter(r)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	f.Limit = 100
+	if limit, err := strconv.Atoi(r.FormValue("limit")); err == nil && limit > 0 {
+		f.Limit = min(limit, maxQueryHistoryLimit)
+	}
+	if offset, err := strconv.Atoi(r.FormValue("offset")); err == nil && offset > 0 {
+		f.Offset = offset
+	}
+
+	if resp.Data, err = s.Store.GetAuditLog(currentUsername, f); err != nil {
+		resp.Error = "cannot get audit log. " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// HandleExportAuditLog streams the audit events as NDJSON, oldest first, without limit. Admin only.
+// It takes the filters of HandleListAuditLog.
+func (s *Services) HandleExportAuditLog(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.BasicResponse{}
+
+	if ok, _ := s.Store.CheckIsAdmin(currentUsername); !ok {
+		resp.Error = "you are not allowed to read the audit log."
+		response.WriteJSON(w, http.StatusForbidden, &resp)
+		return
+	}
+
+	f, err := parseAuditFilter(r)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", "attachment; filename=audit-log_"+time.Now().Format("20060102-150405")+".ndjson")
+	enc := json.NewEncoder(w)
+	err = s.Store.EachAuditEvent(currentUsername, f, false, func(e internaldb.AuditEvent) error {
+		return enc.Encode(e)
+	})
+	if err != nil {
+		// error message is appended to end of file
+		w.Write([]byte(err.Error()))
+	}
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"db-portal/internal/contextkeys"
+	"db-portal/internal/copydata"
+	"db-portal/internal/internaldb"
+	"db-portal/internal/response"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+type compareResponse = response.Response[copydata.CompareResult]
+
+// CompareHandler compares the rows of two endpoints (table, query or file) matched by key columns.
+// Form fields are the same as the copy form, prefixed by left and right, plus keys (comma separated)
+// and format. When format is set, the response is the diff file and the counts are in the
+// X-Compare-Result header, otherwise the counts are returned as json.
+func (s *Services) CompareHandler(w http.ResponseWriter, r *http.Request) {
+	resp := compareResponse{}
+
+	// reload config files if needed
+	s.CommandsConfig.Reload()
+	s.ReloadTypesConfig()
+
+	// Parse multipart form (10 MB max memory, rest to disk)
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		resp.Error = "failed to parse multipart form"
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+
+	var req copydata.CompareRequest
+	req.Left = parseFormEndpoint(r, "left")
+	req.Right = parseFormEndpoint(r, "right")
+	req.Format = r.FormValue("format")
+	for _, key := range strings.Split(r.FormValue("keys"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			req.Keys = append(req.Keys, key)
+		}
+	}
+	if len(req.Keys) == 0 {
+		resp.Error = "key columns are required"
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	defer func() { s.auditCompare(r.Context(), currentUsername, req, resp.Data, resp.Error) }()
+
+	// Create a reader sorted by key for each side, within the copy timeout
+	lim, err := s.limits(currentUsername, req.Left.DSName, req.Right.DSName)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+	ctx, cancel := withTimeout(r.Context(), lim.copyTimeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+	readers := make([]copydata.RowReader, 2)
+	for i, side := range []string{"left", "right"} {
+		ep := &req.Left
+		if side == "right" {
+			ep = &req.Right
+		}
+
+		var conn *sql.Conn
+		var file io.Reader
+		switch ep.Type {
+		case "table", "query":
+			var status int
+			var err error
+			if conn, status, err = s.endpointConn(r.Context(), currentUsername, side, ep, internaldb.PermissionReadOnly); err != nil {
+				resp.Error = err.Error()
+				response.WriteJSON(w, status, &resp)
+				return
+			}
+			defer conn.Close()
+		case "file":
+			f, _, err := r.FormFile(side + "[file]")
+			if err != nil || f == nil {
+				resp.Error = fmt.Sprintf("failed to get %s file", side)
+				response.WriteJSON(w, http.StatusBadRequest, &resp)
+				return
+			}
+			defer f.Close()
+			file = f
+		}
+
+		reader, err := copydata.NewSortedRowReader(*ep, r.Context(), conn, file, req.Keys)
+		if err != nil {
+			resp.Error = fmt.Sprintf("%s: %v", side, err)
+			response.WriteJSON(w, http.StatusBadRequest, &resp)
+			return
+		}
+		readers[i] = reader
+	}
+
+	// Without diff file
+	if req.Format == "" {
+		var err error
+		if resp.Data, err = copydata.Compare(readers[0], readers[1], req.Keys, nil); err != nil {
+			resp.Error = err.Error()
+			response.WriteJSON(w, http.StatusInternalServerError, &resp)
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, &resp)
+		return
+	}
+
+	// With diff file. It is written to a temporary file first, counts are only known at the end.
+	tmp, err := os.CreateTemp("", "db-portal-diff-*")
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	diff, err := copydata.NewRowWriter(copydata.EndPoint{Type: "file", Format: req.Format}, r.Context(), nil, tmp, nil)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	if resp.Data, err = copydata.Compare(readers[0], readers[1], req.Keys, diff); err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	result, _ := json.Marshal(resp.Data)
+	ext := req.Format
+	if len(ext) > 4 {
+		ext = req.Format[:4]
+	}
+	w.Header().Set("X-Compare-Result", string(result))
+	w.Header().Set("Content-Disposition", "attachment; filename=diff_"+time.Now().Format("20060102-150405")+"."+ext)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	io.Copy(w, tmp)
+}
+
+// auditCompare records a compare in the audit log, with the differences as rows.
+func (s *Services) auditCompare(ctx context.Context, username string, req copydata.CompareRequest, result copydata.CompareResult, errMsg string) {
+	s.audit(ctx, internaldb.AuditEvent{Username: username, Action: internaldb.AuditCompare, Error: errMsg,
+		Rows:   int64(result.MissingLeft + result.MissingRight + result.Differing),
+		Detail: auditDetail(map[string]any{"left": req.Left, "right": req.Right, "keys": req.Keys, "result": result})})
+}
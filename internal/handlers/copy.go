@@ -1,20 +1,27 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"db-portal/internal/contextkeys"
 	"db-portal/internal/copydata"
-	"db-portal/internal/dbutil"
+	"db-portal/internal/internaldb"
 	"db-portal/internal/response"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/go-chi/chi/v5"
 )
 
 type copyData struct {
-	Reads  int `json:"reads"`
-	Writes int `json:"writes"`
+	Reads     int      `json:"reads"`
+	Writes    int      `json:"writes"`
+	DDL       []string `json:"ddl,omitempty"`       // schema changes applied to the destination table
+	Watermark string   `json:"watermark,omitempty"` // high-water mark of an incremental copy
 }
 
 type copyResponse = response.Response[copyData]
@@ -22,6 +29,10 @@ type copyResponse = response.Response[copyData]
 func (s *Services) CopyHandler(w http.ResponseWriter, r *http.Request) {
 	resp := copyResponse{}
 
+	// reload config files if needed
+	s.CommandsConfig.Reload()
+	s.ReloadTypesConfig()
+
 	// Parse multipart form (10 MB max memory, rest to disk)
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
 		resp.Error = "failed to parse multipart form"
@@ -29,38 +40,23 @@ func (s *Services) CopyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Helper to extract endpoint from form
-	parseEndpoint := func(prefix string) copydata.EndPoint {
-		EPType := r.FormValue(prefix + "[type]")
-		switch EPType {
-		case "table":
-			return copydata.EndPoint{
-				Type:       EPType,
-				DSName:     r.FormValue(prefix + "[dsName]"),
-				Schema:     r.FormValue(prefix + "[schema]"),
-				Table:      r.FormValue(prefix + "[table]"),
-				IsNewTable: r.FormValue(prefix + "[isNewTable]"),
-			}
-		case "query":
-			return copydata.EndPoint{
-				Type:   EPType,
-				DSName: r.FormValue(prefix + "[dsName]"),
-				Schema: r.FormValue(prefix + "[schema]"),
-				Query:  r.FormValue(prefix + "[query]"),
-			}
-		case "file":
-			return copydata.EndPoint{
-				Type:   EPType,
-				Format: r.FormValue(prefix + "[format]"),
-			}
-		}
-		return copydata.EndPoint{}
-	}
-
 	// Retrieve request from form
 	var req copydata.CopyRequest
-	req.OriginEP = parseEndpoint("origin")
-	req.DestEP = parseEndpoint("destination")
+	req.Name = r.FormValue("name")
+	if strings.HasPrefix(req.Name, copyJobWatermarkPrefix) {
+		resp.Error = fmt.Sprintf("invalid copy name %q: the %s prefix is reserved to copy jobs", req.Name, copyJobWatermarkPrefix)
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	req.OriginEP = parseFormEndpoint(r, "origin")
+	req.DestEP = parseFormEndpoint(r, "destination")
+	if typeOverrides := r.FormValue("destination[typeOverrides]"); typeOverrides != "" {
+		if err := json.Unmarshal([]byte(typeOverrides), &req.DestEP.TypeOverrides); err != nil {
+			resp.Error = "invalid destination[typeOverrides] json. " + err.Error()
+			response.WriteJSON(w, http.StatusBadRequest, &resp)
+			return
+		}
+	}
 
 	// Retrieve file from form
 	var originFile io.Reader
@@ -77,114 +73,189 @@ func (s *Services) CopyHandler(w http.ResponseWriter, r *http.Request) {
 		defer file.Close()
 	}
 
-	// Prepare origin database connection
-	var originConn *sql.Conn
-	currentUsername := contextkeys.UsernameFromContext(r.Context())
-	if req.OriginEP.DSName != "" {
-		ds, err := s.Store.RequireUserDataSource(currentUsername, currentUsername, req.OriginEP.DSName)
-		if err != nil {
-			resp.Error = fmt.Sprintf("origin data source %v not found or not allowed", req.OriginEP.DSName)
-			response.WriteJSON(w, http.StatusNotFound, &resp)
+	// Prepare destination file for streaming.
+	// Headers are set once the copy is ready to start, earlier errors are returned as json.
+	var destWriter io.Writer
+	started := false
+	beforeWrite := func() {
+		started = true
+		if req.DestEP.Type != "file" {
 			return
 		}
-		if originConn, err = dbutil.GetConn(r.Context(), ds.Vendor, ds.Location, false); err != nil {
-			resp.Error = fmt.Sprintf("failed to connect to origin: %v", err)
-			response.WriteJSON(w, http.StatusInternalServerError, &resp)
-			return
+		ext := req.DestEP.Format
+		if len(ext) > 4 {
+			ext = req.DestEP.Format[:4]
 		}
-		req.OriginEP.DBVendor = ds.Vendor
+		w.Header().Set("Content-Disposition", "attachment; filename=export_"+time.Now().Format("20060102-150405")+"."+ext)
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	if req.DestEP.Type == "file" {
+		destWriter = w // use http.ResponseWriter as destWriter to stream file to client
+	}
 
-		// set schema
-		schema := req.OriginEP.Schema
-		if schema != "" {
-			setSchema, args, err := s.CommandsConfig.Data.Command("set-schema", req.OriginEP.DBVendor, []string{schema})
-			if err != nil {
-				resp.Error = err.Error()
-				response.WriteJSON(w, http.StatusInternalServerError, &resp)
-				return
-			}
-			if _, err = originConn.ExecContext(r.Context(), setSchema, args...); err != nil {
-				resp.Error = err.Error()
-				response.WriteJSON(w, http.StatusInternalServerError, &resp)
-				return
+	// Copy data
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	var status int
+	var err error
+	resp.Data, status, err = s.runCopy(r.Context(), currentUsername, currentUsername, req.Name, req, originFile, destWriter, beforeWrite)
+	if err != nil && !started {
+		resp.Error = err.Error()
+		response.WriteJSON(w, status, &resp)
+		return
+	}
+
+	// End file response
+	if req.DestEP.Type == "file" {
+		if err != nil {
+			if resp.Data.Writes == 0 {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			} else {
+				// error message is appended to end of file
+				w.Write([]byte(err.Error()))
 			}
 		}
+		return
 	}
 
-	// Create src row reader
-	src, err := copydata.NewRowReader(req.OriginEP, r.Context(), originConn, originFile)
+	// send response
 	if err != nil {
 		resp.Error = err.Error()
-		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		response.WriteJSON(w, status, &resp)
 		return
 	}
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
 
-	// Prepare destination database transaction
-	var destTx *sql.Tx
-	if req.DestEP.Type == "table" {
-		var destConn *sql.Conn
-		ds, err := s.Store.RequireUserDataSource(currentUsername, currentUsername, req.DestEP.DSName)
-		if err != nil {
-			resp.Error = fmt.Sprintf("destination data source %v not found or not allowed", req.DestEP.DSName)
-			response.WriteJSON(w, http.StatusNotFound, &resp)
+// copyJobWatermarkPrefix prefixes the high-water mark names of copy jobs, distinct from the names of ad-hoc copies.
+const copyJobWatermarkPrefix = "copy-job:"
+
+// runCopy copies data from origin to destination with the data sources allowed to username.
+// The high-water mark of an incremental copy is stored for watermarkUsername and watermarkName.
+// beforeWrite is called once the copy is ready to start, to prepare a file destination.
+// On error, the HTTP status to reply with is returned.
+func (s *Services) runCopy(ctx context.Context, username, watermarkUsername, watermarkName string, req copydata.CopyRequest, originFile io.Reader, destFile io.Writer, beforeWrite func()) (data copyData, status int, err error) {
+	defer func() {
+		s.audit(ctx, internaldb.AuditEvent{Username: username, Action: internaldb.AuditCopy, Target: req.Name, Rows: int64(data.Writes), Error: errorString(err),
+			Detail: auditDetail(map[string]any{"origin": req.OriginEP, "destination": req.DestEP, "reads": data.Reads})})
+	}()
+
+	// The copy timeout and row limit of the user on both data sources apply
+	lim, err := s.limits(username, req.OriginEP.DSName, req.DestEP.DSName)
+	if err != nil {
+		return data, http.StatusInternalServerError, err
+	}
+	ctx, cancel := withTimeout(ctx, lim.copyTimeout)
+	defer cancel()
+
+	// Prepare origin database connection
+	var originConn *sql.Conn
+	if req.OriginEP.DSName != "" {
+		if originConn, status, err = s.endpointConn(ctx, username, "origin", &req.OriginEP, internaldb.PermissionReadOnly); err != nil {
 			return
 		}
-		if destConn, err = dbutil.GetConn(r.Context(), ds.Vendor, ds.Location, false); err != nil {
-			resp.Error = fmt.Sprintf("failed to connect to destination: %v", err)
-			response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		defer originConn.Close()
+	}
+
+	// Prepare destination database connection, before the src row reader holds the origin connection
+	var destConn *sql.Conn
+	if req.DestEP.Type == "table" {
+		// creating or evolving the destination table needs the ddl permission
+		permission := internaldb.PermissionReadWrite
+		if req.DestEP.IsNewTable == "1" || req.DestEP.Evolve == "1" {
+			permission = internaldb.PermissionDDL
+		}
+		if destConn, status, err = s.endpointConn(ctx, username, "destination", &req.DestEP, permission); err != nil {
 			return
 		}
-		req.DestEP.DBVendor = ds.Vendor
+		defer destConn.Close()
+	}
 
-		// set schema
-		schema := req.DestEP.Schema
-		if schema != "" {
-			setSchema, args, err := s.CommandsConfig.Data.Command("set-schema", req.DestEP.DBVendor, []string{schema})
-			if err != nil {
-				resp.Error = err.Error()
-				response.WriteJSON(w, http.StatusInternalServerError, &resp)
-				return
-			}
-			if _, err = destConn.ExecContext(r.Context(), setSchema, args...); err != nil {
-				resp.Error = err.Error()
-				response.WriteJSON(w, http.StatusInternalServerError, &resp)
-				return
+	// Read origin table definition (nullability, primary key) when a new destination table is created.
+	// This must be done before the src row reader holds the connection.
+	var originColumns []copydata.TableColumn
+	if req.OriginEP.Type == "table" && req.DestEP.Type == "table" && req.DestEP.IsNewTable == "1" {
+		command, args, cmdErr := s.CommandsConfig.Data.Command("table-columns", req.OriginEP.DBVendor, []string{req.OriginEP.Table})
+		if cmdErr == nil && command != "" {
+			if originColumns, err = copydata.ReadTableColumns(ctx, originConn, req.OriginEP.DBVendor, command, args); err != nil {
+				return data, http.StatusInternalServerError, fmt.Errorf("failed to read origin table columns: %v", err)
 			}
 		}
+	}
 
-		// Start transaction
-		destTx, err = destConn.BeginTx(r.Context(), nil)
+	// Create src row reader, reading only rows beyond the last high-water mark for an incremental copy
+	var src copydata.RowReader
+	var watermark *copydata.WatermarkRowReader
+	if req.OriginEP.Watermark != "" {
+		if watermarkName == "" {
+			return data, http.StatusBadRequest, fmt.Errorf("an incremental copy needs a name to store its high-water mark")
+		}
+		last, err := s.Store.GetCopyWatermark(watermarkUsername, watermarkName)
 		if err != nil {
-			resp.Error = fmt.Sprintf("failed to begin transaction: %v", err)
-			response.WriteJSON(w, http.StatusInternalServerError, &resp)
-			return
+			return data, http.StatusInternalServerError, fmt.Errorf("failed to read copy high-water mark: %v", err)
+		}
+		if watermark, err = copydata.NewWatermarkRowReader(req.OriginEP, ctx, originConn, last); err != nil {
+			return data, http.StatusBadRequest, err
 		}
+		src = watermark
+	} else if src, err = copydata.NewRowReader(req.OriginEP, ctx, originConn, originFile); err != nil {
+		return data, http.StatusBadRequest, err
+	}
+	if originColumns != nil {
+		src = copydata.WithTableColumns(src, originColumns)
+	}
+	if len(req.DestEP.TypeOverrides) > 0 {
+		src = copydata.WithTypeOverrides(src, req.DestEP.TypeOverrides)
+	}
+	if lim.maxCopyRows > 0 {
+		src = copydata.WithRowLimit(src, lim.maxCopyRows)
+	}
 
+	// Prepare destination database transaction
+	var destTx *sql.Tx
+	if req.DestEP.Type == "table" {
+		// Start transaction
+		if destTx, err = destConn.BeginTx(ctx, nil); err != nil {
+			return data, http.StatusInternalServerError, fmt.Errorf("failed to begin transaction: %v", err)
+		}
 		defer destTx.Rollback() // Safe to call even if already committed
-	}
 
-	// Prepare destination file for streaming.
-	var destWriter io.Writer
-	if req.DestEP.Type == "file" {
-		destWriter = w // use http.ResponseWriter as destWriter to stream file to client
-		ext := req.DestEP.Format
-		if len(ext) > 4 {
-			ext = req.DestEP.Format[:4]
+		// Add missing columns to an existing table, widen types if asked
+		if req.DestEP.IsNewTable != "1" && req.DestEP.Evolve == "1" {
+			command, args, err := s.CommandsConfig.Data.Command("table-columns", req.DestEP.DBVendor, []string{req.DestEP.Table})
+			if err != nil {
+				return data, http.StatusInternalServerError, err
+			}
+			existing, err := copydata.ReadTableColumns(ctx, destTx, req.DestEP.DBVendor, command, args)
+			if err != nil {
+				return data, http.StatusInternalServerError, fmt.Errorf("failed to read destination table columns: %v", err)
+			}
+			data.DDL, err = copydata.EvolveTable(ctx, destTx, req.DestEP.DBVendor, req.DestEP.Table, existing, src.Fields(), src.Types(), req.DestEP.Widen == "1")
+			if err != nil {
+				return data, http.StatusInternalServerError, fmt.Errorf("failed to evolve destination table: %v", err)
+			}
 		}
-		w.Header().Set("Content-Disposition", "attachment; filename=export_"+time.Now().Format("20060102-150405")+"."+ext)
-		w.Header().Set("Content-Type", "application/octet-stream")
 	}
 
 	// Create dest row writer
-	dst, err := copydata.NewRowWriter(req.DestEP, r.Context(), destTx, destWriter, src.Fields())
+	dst, err := copydata.NewRowWriter(req.DestEP, ctx, destTx, destFile, src.Fields())
 	if err != nil {
-		resp.Error = err.Error()
-		response.WriteJSON(w, http.StatusBadRequest, &resp)
-		return
+		return data, http.StatusBadRequest, err
+	}
+	if req.DestEP.Type == "table" && req.DestEP.Upsert == "1" {
+		keys, err := s.upsertKeys(ctx, destTx, req.DestEP, src)
+		if err == nil {
+			dst, err = copydata.WithUpsert(dst, keys)
+		}
+		if err != nil {
+			return data, http.StatusBadRequest, err
+		}
 	}
 
 	// Copy data
-	resp.Data.Reads, resp.Data.Writes, err = copydata.CopyData(src, dst)
+	if beforeWrite != nil {
+		beforeWrite()
+	}
+	data.Reads, data.Writes, err = copydata.CopyData(src, dst)
 
 	// Handle transaction commit/rollback for database destination
 	if req.DestEP.Type == "table" {
@@ -198,24 +269,106 @@ func (s *Services) CopyHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// End file response
-	if req.DestEP.Type == "file" {
+	// Save the new high-water mark once rows are copied
+	if err == nil && watermark != nil {
+		data.Watermark = watermark.Last()
+		if saveErr := s.Store.SetCopyWatermark(watermarkUsername, watermarkName, watermark.Last()); saveErr != nil {
+			err = fmt.Errorf("failed to save copy high-water mark: %w", saveErr)
+		}
+	}
+
+	if err != nil {
+		return data, http.StatusInternalServerError, err
+	}
+	return data, http.StatusOK, nil
+}
+
+// parseFormEndpoint extracts an endpoint from multipart form fields named prefix[field].
+func parseFormEndpoint(r *http.Request, prefix string) copydata.EndPoint {
+	EPType := r.FormValue(prefix + "[type]")
+	switch EPType {
+	case "table":
+		return copydata.EndPoint{
+			Type:       EPType,
+			DSName:     r.FormValue(prefix + "[dsName]"),
+			Schema:     r.FormValue(prefix + "[schema]"),
+			Table:      r.FormValue(prefix + "[table]"),
+			IsNewTable: r.FormValue(prefix + "[isNewTable]"),
+			Evolve:     r.FormValue(prefix + "[evolve]"),
+			Widen:      r.FormValue(prefix + "[widen]"),
+			Upsert:     r.FormValue(prefix + "[upsert]"),
+			Keys:       r.FormValue(prefix + "[keys]"),
+			Watermark:  r.FormValue(prefix + "[watermark]"),
+		}
+	case "query":
+		return copydata.EndPoint{
+			Type:      EPType,
+			DSName:    r.FormValue(prefix + "[dsName]"),
+			Schema:    r.FormValue(prefix + "[schema]"),
+			Query:     r.FormValue(prefix + "[query]"),
+			Watermark: r.FormValue(prefix + "[watermark]"),
+		}
+	case "file":
+		return copydata.EndPoint{
+			Type:   EPType,
+			Format: r.FormValue(prefix + "[format]"),
+		}
+	}
+	return copydata.EndPoint{}
+}
+
+// upsertKeys returns the upsert key columns of a table destination:
+// the keys option, or the primary key of the origin for a new table, or the primary key of the existing table.
+func (s *Services) upsertKeys(ctx context.Context, tx *sql.Tx, ep copydata.EndPoint, src copydata.RowReader) ([]string, error) {
+	var keys []string
+	if ep.Keys != "" {
+		for _, key := range strings.Split(ep.Keys, ",") {
+			keys = append(keys, strings.TrimSpace(key))
+		}
+		return keys, nil
+	}
+
+	if ep.IsNewTable == "1" {
+		for i, t := range src.Types() {
+			if t.PrimaryKey {
+				keys = append(keys, src.Fields()[i])
+			}
+		}
+	} else {
+		command, args, err := s.CommandsConfig.Data.Command("table-columns", ep.DBVendor, []string{ep.Table})
 		if err != nil {
-			if resp.Data.Writes == 0 {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-			} else {
-				// error message is appended to end of file
-				w.Write([]byte(err.Error()))
+			return nil, err
+		}
+		columns, err := copydata.ReadTableColumns(ctx, tx, ep.DBVendor, command, args)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read destination table columns: %v", err)
+		}
+		for _, col := range columns {
+			if col.PrimaryKey {
+				keys = append(keys, col.Name)
 			}
 		}
-		return
 	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no primary key found for upsert into %s, set the key columns", ep.Table)
+	}
+	return keys, nil
+}
 
-	// send response
-	if err != nil {
-		resp.Error = err.Error()
+// HandleDeleteCopyWatermark resets the high-water mark of an incremental copy, its next run reads all rows.
+// The mark of a copy job is named with copyJobWatermarkPrefix and the job name.
+func (s *Services) HandleDeleteCopyWatermark(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+
+	resp := copyResponse{}
+
+	name := chi.URLParam(r, "name")
+
+	if err := s.Store.DeleteCopyWatermark(currentUsername, name); err != nil {
+		resp.Error = "cannot delete copy high-water mark. " + err.Error()
 		response.WriteJSON(w, http.StatusInternalServerError, &resp)
 		return
 	}
+
 	response.WriteJSON(w, http.StatusOK, &resp)
 }
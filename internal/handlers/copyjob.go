@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"db-portal/internal/contextkeys"
+	"db-portal/internal/copydata"
+	"db-portal/internal/internaldb"
+	"db-portal/internal/response"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// copyJob is a saved copy definition, with its request decoded.
+type copyJob struct {
+	Name      string               `json:"name"`
+	Owner     string               `json:"owner,omitempty"`
+	Request   copydata.CopyRequest `json:"request"`
+	CreatedAt string               `json:"createdAt,omitempty"`
+	UpdatedAt string               `json:"updatedAt,omitempty"`
+}
+
+type copyJobsResp = response.Response[[]copyJob]
+type copyJobResp = response.Response[copyJob]
+
+func newCopyJob(job internaldb.CopyJob) (copyJob, error) {
+	result := copyJob{Name: job.Name, Owner: job.Owner, CreatedAt: job.CreatedAt, UpdatedAt: job.UpdatedAt}
+	err := json.Unmarshal([]byte(job.Request), &result.Request)
+	return result, err
+}
+
+// validateCopyJob checks a copy definition can be run without a form: files can only be a destination.
+func validateCopyJob(job copyJob) error {
+	if strings.TrimSpace(job.Name) == "" {
+		return fmt.Errorf("copy job name is required")
+	}
+	switch job.Request.OriginEP.Type {
+	case "table", "query":
+	default:
+		return fmt.Errorf("copy job origin must be a table or a query")
+	}
+	switch job.Request.DestEP.Type {
+	case "table", "file":
+	default:
+		return fmt.Errorf("copy job destination must be a table or a file")
+	}
+	return nil
+}
+
+func (s *Services) HandleListCopyJobs(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := copyJobsResp{}
+
+	jobs, err := s.Store.GetAllUserCopyJobs(currentUsername)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+	for _, job := range jobs {
+		j, err := newCopyJob(job)
+		if err != nil {
+			resp.Error = fmt.Sprintf("invalid copy job %s. %v", job.Name, err)
+			response.WriteJSON(w, http.StatusInternalServerError, &resp)
+			return
+		}
+		resp.Data = append(resp.Data, j)
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+func (s *Services) HandleGetCopyJob(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := copyJobResp{}
+
+	job, err := s.Store.GetUserCopyJob(currentUsername, chi.URLParam(r, "name"))
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusNotFound, &resp)
+		return
+	}
+	if resp.Data, err = newCopyJob(job); err != nil {
+		resp.Error = "invalid copy job. " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// HandleSaveCopyJob creates a copy job (POST /copy-jobs) or updates its request (PUT /copy-jobs/{name}).
+// Body: {"name", "request": {"origin", "destination"}}
+func (s *Services) HandleSaveCopyJob(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.BasicResponse{}
+
+	var job copyJob
+	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+		resp.Error = "invalid json. " + err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	name := chi.URLParam(r, "name")
+	if name != "" {
+		job.Name = name
+	}
+	job.Name = strings.TrimSpace(job.Name)
+	if err := validateCopyJob(job); err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	// resolved at run time
+	job.Request.OriginEP.DBVendor = ""
+	job.Request.DestEP.DBVendor = ""
+	job.Request.Name = ""
+
+	request, err := json.Marshal(job.Request)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	if name == "" {
+		err = s.Store.CreateCopyJob(currentUsername, job.Name, string(request))
+	} else {
+		err = s.Store.UpdateCopyJob(currentUsername, job.Name, string(request))
+	}
+	if err != nil {
+		resp.Error = "cannot save copy job. " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+func (s *Services) HandleDeleteCopyJob(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.BasicResponse{}
+
+	if err := s.Store.DeleteCopyJob(currentUsername, chi.URLParam(r, "name")); err != nil {
+		resp.Error = "cannot delete copy job. " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+func (s *Services) HandleCreateUserCopyJob(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.BasicResponse{}
+
+	if err := s.Store.CreateUserCopyJob(currentUsername, chi.URLParam(r, "username"), chi.URLParam(r, "name")); err != nil {
+		resp.Error = "cannot share copy job. " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+func (s *Services) HandleDeleteUserCopyJob(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.BasicResponse{}
+
+	if err := s.Store.DeleteUserCopyJob(currentUsername, chi.URLParam(r, "username"), chi.URLParam(r, "name")); err != nil {
+		resp.Error = "cannot unshare copy job. " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// HandleRunCopyJob runs a saved copy job with the data sources allowed to the current user.
+// The high-water mark of an incremental job belongs to the job, whoever runs it.
+func (s *Services) HandleRunCopyJob(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := copyResponse{}
+
+	// reload config files if needed
+	s.CommandsConfig.Reload()
+	s.ReloadTypesConfig()
+
+	saved, err := s.Store.GetUserCopyJob(currentUsername, chi.URLParam(r, "name"))
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusNotFound, &resp)
+		return
+	}
+	job, err := newCopyJob(saved)
+	if err != nil {
+		resp.Error = "invalid copy job. " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+	req := job.Request
+	req.Name = job.Name
+
+	// Prepare destination file for streaming, see CopyHandler
+	started := false
+	beforeWrite := func() {
+		started = true
+		if req.DestEP.Type == "file" {
+			ext := req.DestEP.Format
+			if len(ext) > 4 {
+				ext = req.DestEP.Format[:4]
+			}
+			w.Header().Set("Content-Disposition", "attachment; filename="+job.Name+"_"+time.Now().Format("20060102-150405")+"."+ext)
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+	}
+	var status int
+	resp.Data, status, err = s.runCopy(r.Context(), currentUsername, job.Owner, copyJobWatermarkPrefix+job.Name, req, nil, w, beforeWrite)
+	if req.DestEP.Type == "file" && started {
+		if err != nil {
+			// error message is appended to end of file
+			w.Write([]byte(err.Error()))
+		}
+		return
+	}
+
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, status, &resp)
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
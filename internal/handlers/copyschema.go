@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"db-portal/internal/contextkeys"
+	"db-portal/internal/copydata"
+	"db-portal/internal/internaldb"
+	"db-portal/internal/response"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type copySchemaData struct {
+	Tables []copydata.TableCopyResult `json:"tables"`
+}
+
+type copySchemaResponse = response.Response[copySchemaData]
+
+// CopySchemaHandler creates the origin tables in the destination schema and copies their rows.
+// Request body: {"origin": {"dsName", "schema"}, "destination": {"dsName", "schema"}, "tables": ["*"]}
+func (s *Services) CopySchemaHandler(w http.ResponseWriter, r *http.Request) {
+	resp := copySchemaResponse{}
+
+	// reload config files if needed
+	s.CommandsConfig.Reload()
+	s.ReloadTypesConfig()
+
+	var req copydata.SchemaCopyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		resp.Error = "invalid request body"
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	if req.OriginEP.DSName == "" || req.DestEP.DSName == "" {
+		resp.Error = "origin and destination data sources are required"
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	lim, err := s.limits(currentUsername, req.OriginEP.DSName, req.DestEP.DSName)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+	ctx, cancel := withTimeout(r.Context(), lim.copyTimeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	originConn, status, err := s.endpointConn(r.Context(), currentUsername, "origin", &req.OriginEP, internaldb.PermissionReadOnly)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, status, &resp)
+		return
+	}
+	defer originConn.Close()
+	destConn, status, err := s.endpointConn(r.Context(), currentUsername, "destination", &req.DestEP, internaldb.PermissionDDL)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, status, &resp)
+		return
+	}
+	defer destConn.Close()
+
+	resp.Data.Tables, err = copydata.CopySchema(r.Context(), s.CommandsConfig.Data.Command,
+		originConn, req.OriginEP.DBVendor, destConn, req.DestEP.DBVendor, req.Tables, lim.maxCopyRows)
+	var writes int
+	for _, table := range resp.Data.Tables {
+		writes += table.Writes
+	}
+	s.audit(r.Context(), internaldb.AuditEvent{Username: currentUsername, Action: internaldb.AuditCopy, Rows: int64(writes), Error: errorString(err),
+		Detail: auditDetail(map[string]any{"origin": req.OriginEP, "destination": req.DestEP, "tables": resp.Data.Tables})})
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// endpointConn opens a connection to the data source of a DB endpoint, allowed to the user with the permission level,
+// and sets its schema. Its statements are limited to the user copy timeout on the data source. The query of a query endpoint must be allowed too. ep.DBVendor is set.
+// On error, the HTTP status to reply with is returned.
+func (s *Services) endpointConn(ctx context.Context, username string, name string, ep *copydata.EndPoint, permission string) (*sql.Conn, int, error) {
+	ds, err := s.Store.RequireUserDataSource(username, username, ep.DSName)
+	if err != nil {
+		return nil, http.StatusNotFound, fmt.Errorf("%s data source %v not found or not allowed", name, ep.DSName)
+	}
+	if err = requirePermission(ds, permission); err == nil && ep.Type == "query" {
+		err = requireStmtPermission(ds, ep.Query)
+	}
+	if err != nil {
+		return nil, http.StatusForbidden, fmt.Errorf("%s: %v", name, err)
+	}
+	lim, err := s.limits(username, ds.Name)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	conn, err := openConn(ctx, ds, lim.copyTimeout)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to connect to %s: %v", name, err)
+	}
+	ep.DBVendor = ds.Vendor
+
+	// set schema
+	if ep.Schema != "" {
+		setSchema, args, err := s.CommandsConfig.Data.Command("set-schema", ep.DBVendor, []string{ep.Schema})
+		if err == nil {
+			_, err = conn.ExecContext(ctx, setSchema, args...)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+	return conn, http.StatusOK, nil
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"db-portal/internal/contextkeys"
+	"db-portal/internal/dbutil"
+	"db-portal/internal/response"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// cursorCount is the number of rows of a cursor, when it can be counted quickly.
+type cursorCount struct {
+	Count   int64 `json:"count"`
+	Known   bool  `json:"known"`
+	Fetched int64 `json:"fetched"`
+}
+
+// cursorCountTimeout limits the count query, a count that takes longer is not cheap.
+const cursorCountTimeout = 5 * time.Second
+
+// pageSize returns the size form value, the max result set length by default.
+func pageSize(r *http.Request, maxResultsetLength int64) int64 {
+	if size, err := strconv.ParseInt(r.FormValue("size"), 10, 64); err == nil && size > 0 {
+		return size
+	}
+	if maxResultsetLength > 0 {
+		return maxResultsetLength
+	}
+	return 500
+}
+
+// HandleFetchCursor returns the next page of an open cursor. The cursor is closed after its last page.
+func (s *Services) HandleFetchCursor(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.Response[dbutil.DBResult]{}
+
+	c, err := s.Cursors.Get(currentUsername, chi.URLParam(r, "id"))
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusNotFound, &resp)
+		return
+	}
+	lim, err := s.limits(currentUsername, c.DSName)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+	resp.Data, err = s.Cursors.Fetch(c, pageSize(r, lim.maxResultsetLength))
+	resp.Data.StmtCmd = dbutil.StmtInfo(c.Query, "").Cmd
+	if err != nil && resp.Data.DBerror == "" {
+		// closed meanwhile
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusNotFound, &resp)
+		return
+	}
+
+	// a DB error is in resp.Data.DBerror, http.StatusOK is fine here
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// HandleCountCursor counts the rows of the query of a cursor on another connection.
+// The count is unknown when the query fails or takes longer than cursorCountTimeout.
+func (s *Services) HandleCountCursor(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.Response[cursorCount]{}
+
+	c, err := s.Cursors.Get(currentUsername, chi.URLParam(r, "id"))
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusNotFound, &resp)
+		return
+	}
+	resp.Data.Fetched = c.Fetched()
+
+	ds, err := s.Store.RequireUserDataSource(currentUsername, currentUsername, c.DSName)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusNotFound, &resp)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), cursorCountTimeout)
+	defer cancel()
+	conn, err := dbutil.GetConn(ctx, ds.Vendor, ds.Location, false)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+	defer conn.Close()
+
+	if c.Schema != "" {
+		setSchema, args, err := s.CommandsConfig.Data.Command("set-schema", ds.Vendor, []string{c.Schema})
+		if err == nil {
+			_, err = conn.ExecContext(ctx, setSchema, args...)
+		}
+		if err != nil {
+			resp.Error = err.Error()
+			response.WriteJSON(w, http.StatusInternalServerError, &resp)
+			return
+		}
+	}
+	err = conn.QueryRowContext(ctx, "select count(*) from ("+c.Query+") q", c.Args...).Scan(&resp.Data.Count)
+	resp.Data.Known = err == nil
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+func (s *Services) HandleCloseCursor(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.BasicResponse{}
+
+	if err := s.Cursors.Close(currentUsername, chi.URLParam(r, "id")); err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusNotFound, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
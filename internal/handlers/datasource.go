@@ -66,6 +66,8 @@ func (s *Services) HandleCreateDataSource(w http.ResponseWriter, r *http.Request
 	req.Name = strings.TrimSpace(req.Name)
 
 	err := s.Store.CreateDataSource(currentUsername, req.Name, req.Vendor, req.Location)
+	s.audit(r.Context(), internaldb.AuditEvent{Action: internaldb.AuditDSCreate, DSName: req.Name,
+		Detail: auditDetail(map[string]any{"vendor": req.Vendor}), Error: errorString(err)})
 	if err != nil {
 		resp.Error = "cannot create new data source. " + err.Error()
 		response.WriteJSON(w, http.StatusInternalServerError, &resp)
@@ -83,7 +85,15 @@ func (s *Services) HandleCreateUserDataSource(w http.ResponseWriter, r *http.Req
 	username := chi.URLParam(r, "username")
 	dsName := chi.URLParam(r, "dsName")
 
-	err := s.Store.CreateUserDataSource(currentUsername, username, dsName)
+	// permission level, full access by default
+	permission := r.FormValue("permission")
+	if permission == "" {
+		permission = internaldb.PermissionAdmin
+	}
+
+	err := s.Store.CreateUserDataSource(currentUsername, username, dsName, permission)
+	s.audit(r.Context(), internaldb.AuditEvent{Action: internaldb.AuditUserDSGrant, DSName: dsName, Target: username,
+		Detail: auditDetail(map[string]any{"permission": permission}), Error: errorString(err)})
 	if err != nil {
 		resp.Error = "cannot add data source to user. " + err.Error()
 		response.WriteJSON(w, http.StatusInternalServerError, &resp)
@@ -102,6 +112,8 @@ func (s *Services) HandleDeleteUserDataSource(w http.ResponseWriter, r *http.Req
 	dsName := chi.URLParam(r, "dsName")
 
 	err := s.Store.DeleteUserDataSource(currentUsername, username, dsName)
+	s.audit(r.Context(), internaldb.AuditEvent{Action: internaldb.AuditUserDSRevoke, DSName: dsName, Target: username,
+		Error: errorString(err)})
 	if err != nil {
 		resp.Error = "cannot delete user data source." + err.Error()
 		response.WriteJSON(w, http.StatusInternalServerError, &resp)
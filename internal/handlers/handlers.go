@@ -2,7 +2,13 @@ package handlers
 
 import (
 	"db-portal/internal/config"
+	"db-portal/internal/cursor"
+	"db-portal/internal/dbutil"
 	"db-portal/internal/internaldb"
+	"db-portal/internal/pipeline"
+	"db-portal/internal/running"
+	"db-portal/internal/scheduler"
+	"db-portal/internal/session"
 	"time"
 )
 
@@ -10,5 +16,20 @@ type Services struct {
 	Store           *internaldb.Store
 	CommandsConfig  *config.Config[config.CommandsConfig]
 	ServerConfig    *config.Config[config.Server]
+	TypesConfig     *config.Config[config.TypesConfig]
+	Scheduler       *scheduler.Scheduler
+	Pipelines       *pipeline.Runner
+	Cursors         *cursor.Manager
+	Sessions        *session.Manager
+	Queries         *running.Manager
 	clockResolution time.Duration
 }
+
+// ReloadTypesConfig reloads types.yaml if needed and applies its type mappings.
+func (s *Services) ReloadTypesConfig() {
+	if s.TypesConfig == nil {
+		return
+	}
+	s.TypesConfig.Reload()
+	dbutil.SetUserTypes(s.TypesConfig.Data.Aliases, s.TypesConfig.Data.VendorTypes)
+}
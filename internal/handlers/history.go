@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"db-portal/internal/contextkeys"
+	"db-portal/internal/dbutil"
+	"db-portal/internal/internaldb"
+	"db-portal/internal/response"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxQueryHistoryLimit caps the number of history entries returned at once.
+const maxQueryHistoryLimit = 1000
+
+// recordQuery saves a SQL editor query execution in the query history and the audit log, with the totals of its results.
+// A failure is logged only, the query response is not changed.
+func (s *Services) recordQuery(ctx context.Context, entry internaldb.QueryHistoryEntry, start time.Time, results []dbutil.DBResult, respError string) {
+	entry.StartedAt = start.UTC().Format(time.RFC3339)
+	entry.Duration = int64(time.Since(start))
+	entry.Error = respError
+
+	var cmds []string
+	for _, result := range results {
+		entry.RowsReturned += result.RowsReturned
+		entry.RowsAffected += result.RowsAffected
+		if entry.Error == "" {
+			entry.Error = result.DBerror
+		}
+		if result.StmtCmd != "" && (len(cmds) == 0 || cmds[len(cmds)-1] != result.StmtCmd) {
+			cmds = append(cmds, result.StmtCmd)
+		}
+	}
+	if entry.StmtCmd == "" {
+		entry.StmtCmd = strings.Join(cmds, ",")
+	}
+
+	if _, err := s.Store.CreateQueryHistoryEntry(entry); err != nil {
+		log.Printf("cannot record query history of user %s: %v", entry.Username, err)
+	}
+	s.audit(ctx, internaldb.AuditEvent{Username: entry.Username, Action: internaldb.AuditQuery, DSName: entry.DSName,
+		Target: entry.Query, Rows: entry.RowsReturned + entry.RowsAffected, Error: entry.Error,
+		Detail: auditDetail(map[string]any{"schema": entry.Schema, "params": entry.Params, "explain": entry.Explain, "stmtCmd": entry.StmtCmd})})
+}
+
+// StartQueryHistoryPurge deletes the history entries older than query-history-days every hour, until ctx is done.
+// The history is kept forever when query-history-days is 0.
+func (s *Services) StartQueryHistoryPurge(ctx context.Context) {
+	purge := func() {
+		days := s.ServerConfig.Data.QueryHistoryDays
+		if days <= 0 {
+			return
+		}
+		if _, err := s.Store.PurgeQueryHistory(time.Now().AddDate(0, 0, -days)); err != nil {
+			log.Printf("cannot purge query history: %v", err)
+		}
+	}
+	go func() {
+		purge()
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purge()
+			}
+		}
+	}()
+}
+
+// parseHistoryTime converts a from or to form value, a RFC 3339 time or a date, to the stored UTC format.
+func parseHistoryTime(name, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		if t, err = time.Parse(time.DateOnly, value); err != nil {
+			return "", fmt.Errorf("invalid %s %q, expected a date or a RFC 3339 time", name, value)
+		}
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
+
+// HandleListQueryHistory returns the query history of the user, most recent first.
+// Query parameters: q (text in the query), dsName, from and to (dates or RFC 3339 times, to excluded),
+// limit (100 by default) and offset. An admin reads the history of another user with username.
+func (s *Services) HandleListQueryHistory(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.Response[[]internaldb.QueryHistoryEntry]{}
+
+	f := internaldb.QueryHistoryFilter{
+		Username: r.FormValue("username"),
+		Text:     r.FormValue("q"),
+		DSName:   r.FormValue("dsName"),
+		Limit:    100,
+	}
+	var err error
+	if f.From, err = parseHistoryTime("from", r.FormValue("from")); err == nil {
+		f.To, err = parseHistoryTime("to", r.FormValue("to"))
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	if limit, err := strconv.Atoi(r.FormValue("limit")); err == nil && limit > 0 {
+		f.Limit = min(limit, maxQueryHistoryLimit)
+	}
+	if offset, err := strconv.Atoi(r.FormValue("offset")); err == nil && offset > 0 {
+		f.Offset = offset
+	}
+
+	if resp.Data, err = s.Store.GetQueryHistory(currentUsername, f); err != nil {
+		resp.Error = "cannot get query history. " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// queryHistoryEntry returns the {id} history entry allowed to the request user.
+func (s *Services) queryHistoryEntry(r *http.Request) (internaldb.QueryHistoryEntry, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return internaldb.QueryHistoryEntry{}, fmt.Errorf("invalid query history id %q", chi.URLParam(r, "id"))
+	}
+	return s.Store.GetQueryHistoryEntry(contextkeys.UsernameFromContext(r.Context()), id)
+}
+
+func (s *Services) HandleGetQueryHistoryEntry(w http.ResponseWriter, r *http.Request) {
+	resp := response.Response[internaldb.QueryHistoryEntry]{}
+
+	var err error
+	if resp.Data, err = s.queryHistoryEntry(r); err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusNotFound, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// HandleRunQueryHistoryEntry runs the query of a history entry again, with its parameters, as the request user.
+// The request form takes the other QueryHandler fields (queryId, onError, cursor, format...).
+func (s *Services) HandleRunQueryHistoryEntry(w http.ResponseWriter, r *http.Request) {
+	resp := queryResp{}
+
+	entry, err := s.queryHistoryEntry(r)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusNotFound, &resp)
+		return
+	}
+
+	// an explained entry runs again as an estimated plan, which does not execute the statement
+	explain := ""
+	if entry.Explain {
+		explain = "1"
+	}
+	s.runQuery(w, r, entry.DSName, entry.Schema, map[string]string{"query": entry.Query, "params": entry.Params, "explain": explain})
+}
+
+// runQuery runs a query with QueryHandler on the dsName data source and schema.
+// The request form values are kept, except for the values given.
+func (s *Services) runQuery(w http.ResponseWriter, r *http.Request, dsName, schema string, values map[string]string) {
+	r.ParseMultipartForm(10 << 20) // or a url encoded form
+	for name, value := range values {
+		r.Form.Set(name, value)
+	}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("dsName", dsName)
+	if schema != "" {
+		rctx.URLParams.Add("schema", schema)
+	}
+	s.QueryHandler(w, r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx)))
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"db-portal/internal/contextkeys"
+	"db-portal/internal/internaldb"
+	"db-portal/internal/response"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// limits are the limits of a user on data sources, see internaldb.Limits. A 0 limit is no limit.
+type limits struct {
+	queryTimeout       time.Duration
+	copyTimeout        time.Duration
+	maxResultsetLength int64
+	maxCopyRows        int64
+}
+
+// timeoutGrace delays the context deadline after the statement timeout, so that a native timeout is reported by the database.
+const timeoutGrace = time.Second
+
+// limits returns the limits of username on the dsNames data sources, an empty name is skipped.
+// The most restrictive limit set on the user or a data source applies, else the server.yaml default.
+func (s *Services) limits(username string, dsNames ...string) (limits, error) {
+	userLimits, err := s.Store.GetUserLimits(username, username)
+	if err != nil {
+		return limits{}, err
+	}
+	all := []internaldb.Limits{userLimits}
+	for _, dsName := range dsNames {
+		if dsName == "" {
+			continue
+		}
+		dsLimits, err := s.Store.GetDataSourceLimits(username, dsName)
+		if err != nil {
+			return limits{}, err
+		}
+		all = append(all, dsLimits)
+	}
+
+	var defaults internaldb.Limits
+	if s.ServerConfig != nil {
+		server := s.ServerConfig.Data
+		if server.QueryTimeout == 0 {
+			server.QueryTimeout = server.Timeout
+		}
+		defaults = internaldb.Limits{QueryTimeout: &server.QueryTimeout, CopyTimeout: &server.CopyTimeout,
+			MaxResultsetLength: &server.MaxResultsetLength, MaxCopyRows: &server.MaxCopyRows}
+	}
+	return limits{
+		queryTimeout:       time.Duration(limit(all, defaults.QueryTimeout, func(l internaldb.Limits) *int { return l.QueryTimeout })) * time.Second,
+		copyTimeout:        time.Duration(limit(all, defaults.CopyTimeout, func(l internaldb.Limits) *int { return l.CopyTimeout })) * time.Second,
+		maxResultsetLength: int64(limit(all, defaults.MaxResultsetLength, func(l internaldb.Limits) *int { return l.MaxResultsetLength })),
+		maxCopyRows:        int64(limit(all, defaults.MaxCopyRows, func(l internaldb.Limits) *int { return l.MaxCopyRows })),
+	}, nil
+}
+
+// limit returns the lowest limit set in all, 0 only if all set limits are 0. It returns the default when none is set.
+func limit(all []internaldb.Limits, byDefault *int, get func(internaldb.Limits) *int) int {
+	result, set := 0, false
+	for _, l := range all {
+		v := get(l)
+		if v == nil {
+			continue
+		}
+		if !set || *v > 0 && (result == 0 || *v < result) {
+			result = *v
+		}
+		set = true
+	}
+	if !set && byDefault != nil {
+		return *byDefault
+	}
+	return result
+}
+
+// withTimeout returns ctx with a deadline after timeout and timeoutGrace, ctx has no deadline with a 0 timeout.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout+timeoutGrace)
+}
+
+// parseFormLimits reads the limits form values, an empty value is not set.
+func parseFormLimits(r *http.Request) (internaldb.Limits, error) {
+	var l internaldb.Limits
+	for name, limit := range map[string]**int{
+		"queryTimeout":       &l.QueryTimeout,
+		"copyTimeout":        &l.CopyTimeout,
+		"maxResultsetLength": &l.MaxResultsetLength,
+		"maxCopyRows":        &l.MaxCopyRows,
+	} {
+		if value := r.FormValue(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return l, fmt.Errorf("invalid %s %q", name, value)
+			}
+			*limit = &n
+		}
+	}
+	return l, nil
+}
+
+func (s *Services) HandleGetDataSourceLimits(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.Response[internaldb.Limits]{}
+
+	var err error
+	if resp.Data, err = s.Store.GetDataSourceLimits(currentUsername, chi.URLParam(r, "dsName")); err != nil {
+		resp.Error = "cannot get data source limits. " + err.Error()
+		response.WriteJSON(w, http.StatusNotFound, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// HandleSetDataSourceLimits replaces the limits of a data source, a limit missing from the form is not set.
+func (s *Services) HandleSetDataSourceLimits(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.Response[internaldb.Limits]{}
+
+	l, err := parseFormLimits(r)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	if err := s.Store.SetDataSourceLimits(currentUsername, chi.URLParam(r, "dsName"), l); err != nil {
+		resp.Error = "cannot set data source limits. " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	resp.Data = l
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+func (s *Services) HandleGetUserLimits(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.Response[internaldb.Limits]{}
+
+	var err error
+	if resp.Data, err = s.Store.GetUserLimits(currentUsername, chi.URLParam(r, "username")); err != nil {
+		resp.Error = "cannot get user limits. " + err.Error()
+		response.WriteJSON(w, http.StatusNotFound, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// HandleSetUserLimits replaces the limits of a user, a limit missing from the form is not set.
+func (s *Services) HandleSetUserLimits(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.Response[internaldb.Limits]{}
+
+	l, err := parseFormLimits(r)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	if err := s.Store.SetUserLimits(currentUsername, chi.URLParam(r, "username"), l); err != nil {
+		resp.Error = "cannot set user limits. " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	resp.Data = l
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
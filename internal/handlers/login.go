@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"db-portal/internal/internaldb"
 	"db-portal/internal/response"
 	"db-portal/internal/security"
 
@@ -39,7 +40,10 @@ func (s *Services) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		response.WriteJSON(w, http.StatusInternalServerError, &resp)
 		return
 	}
+	event := internaldb.AuditEvent{Username: req.Username, IP: security.ClientIP(r), Action: internaldb.AuditLogin}
 	if !ok {
+		event.Action, event.Error = internaldb.AuditLoginFailed, "invalid username or password"
+		s.audit(r.Context(), event)
 		resp.Error = "Invalid username or password."
 		response.WriteJSON(w, http.StatusUnauthorized, &resp)
 		return
@@ -60,6 +64,7 @@ func (s *Services) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.audit(r.Context(), event)
 	resp.Token = tokenString
 	response.WriteJSON(w, http.StatusOK, &resp)
 }
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"db-portal/internal/dbutil"
+	"db-portal/internal/internaldb"
+	"fmt"
+	"time"
+)
+
+// stmtPermissions are the permission levels needed by statement kinds.
+// Transaction and session statements need read-write: they could make a read-only connection writable.
+var stmtPermissions = map[string]string{
+	dbutil.StmtKindSelect:      internaldb.PermissionReadOnly,
+	dbutil.StmtKindTransaction: internaldb.PermissionReadWrite,
+	dbutil.StmtKindSession:     internaldb.PermissionReadWrite,
+	dbutil.StmtKindDML:         internaldb.PermissionReadWrite,
+	dbutil.StmtKindCall:        internaldb.PermissionReadWrite,
+	dbutil.StmtKindOther:       internaldb.PermissionReadWrite,
+	dbutil.StmtKindDDL:         internaldb.PermissionDDL,
+	dbutil.StmtKindAdmin:       internaldb.PermissionAdmin,
+}
+
+// requirePermission returns an error when the permission level of a user data source is lower than needed.
+func requirePermission(ds internaldb.DataSource, needed string) error {
+	if !internaldb.PermissionAllows(ds.Permission, needed) {
+		return fmt.Errorf("%s permission needed on data source %s, granted permission is %s", needed, ds.Name, ds.Permission)
+	}
+	return nil
+}
+
+// requireStmtPermission returns an error when the statements of a script are not allowed by the permission level
+// of a user data source.
+func requireStmtPermission(ds internaldb.DataSource, script string) error {
+	for _, stmt := range dbutil.SplitStatements(script, ds.Vendor) {
+		info := dbutil.StmtInfo(stmt, ds.Vendor)
+		if needed := stmtPermissions[info.Kind]; !internaldb.PermissionAllows(ds.Permission, needed) {
+			return fmt.Errorf("%s statement (%s) not allowed: %s permission needed on data source %s, granted permission is %s",
+				info.Cmd, info.Kind, needed, ds.Name, ds.Permission)
+		}
+	}
+	return nil
+}
+
+// openConn returns a new connection to a user data source.
+// The connection of a read-only data source is read-only when the vendor supports it,
+// and its statements are limited to statementTimeout when the vendor supports it (0 is no timeout).
+func openConn(ctx context.Context, ds internaldb.DataSource, statementTimeout time.Duration) (*sql.Conn, error) {
+	location := ds.Location
+	if ds.Permission == internaldb.PermissionReadOnly {
+		location = dbutil.ReadOnlyLocation(ds.Vendor, location)
+	}
+	conn, err := dbutil.GetConn(ctx, ds.Vendor, location, false)
+	if err != nil {
+		return nil, err
+	}
+	if ds.Permission == internaldb.PermissionReadOnly {
+		_, err = dbutil.SetReadOnly(ctx, conn, ds.Vendor)
+	}
+	if err == nil {
+		_, err = dbutil.SetStatementTimeout(ctx, conn, ds.Vendor, statementTimeout)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
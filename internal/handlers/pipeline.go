@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"db-portal/internal/contextkeys"
+	"db-portal/internal/copydata"
+	"db-portal/internal/internaldb"
+	"db-portal/internal/pipeline"
+	"db-portal/internal/response"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// pipelineItem is a saved pipeline, with its definition decoded and its status.
+type pipelineItem struct {
+	Name       string              `json:"name"`
+	Owner      string              `json:"owner,omitempty"`
+	Definition pipeline.Definition `json:"definition"`
+	CreatedAt  string              `json:"createdAt,omitempty"`
+	UpdatedAt  string              `json:"updatedAt,omitempty"`
+	Running    bool                `json:"running"`
+}
+
+type pipelinesResp = response.Response[[]pipelineItem]
+type pipelineResp = response.Response[pipelineItem]
+type pipelineRunsResp = response.Response[[]internaldb.PipelineRun]
+type pipelineRunResp = response.Response[internaldb.PipelineRun]
+
+func (s *Services) newPipelineItem(p internaldb.Pipeline) (pipelineItem, error) {
+	item := pipelineItem{Name: p.Name, Owner: p.Owner, CreatedAt: p.CreatedAt, UpdatedAt: p.UpdatedAt}
+	if s.Pipelines != nil {
+		item.Running = s.Pipelines.Running(p.Name)
+	}
+	err := json.Unmarshal([]byte(p.Definition), &item.Definition)
+	return item, err
+}
+
+// RunPipelineStep executes a pipeline step as a user, see pipeline.StepFunc.
+func (s *Services) RunPipelineStep(ctx context.Context, username string, step pipeline.Step) (int64, error) {
+	// reload config files if needed
+	s.CommandsConfig.Reload()
+	s.ReloadTypesConfig()
+
+	switch step.Type {
+	case "sql":
+		return s.runScript(ctx, username, step.DSName, step.Script)
+	case "copy":
+		return s.runCopyJob(ctx, username, step.CopyJob)
+	case "compare":
+		result, err := s.runCompare(ctx, username, *step.Compare)
+		return int64(result.MissingLeft + result.MissingRight + result.Differing), err
+	case "wait":
+		return 0, s.waitCondition(ctx, username, step)
+	}
+	return 0, fmt.Errorf("unknown step type %q", step.Type)
+}
+
+// runCompare compares two table or query endpoints, without diff file.
+func (s *Services) runCompare(ctx context.Context, username string, req copydata.CompareRequest) (result copydata.CompareResult, err error) {
+	defer func() { s.auditCompare(ctx, username, req, result, errorString(err)) }()
+	lim, err := s.limits(username, req.Left.DSName, req.Right.DSName)
+	if err != nil {
+		return result, err
+	}
+	ctx, cancel := withTimeout(ctx, lim.copyTimeout)
+	defer cancel()
+	readers := make([]copydata.RowReader, 2)
+	for i, side := range []string{"left", "right"} {
+		ep := &req.Left
+		if side == "right" {
+			ep = &req.Right
+		}
+		conn, _, err := s.endpointConn(ctx, username, side, ep, internaldb.PermissionReadOnly)
+		if err != nil {
+			return result, err
+		}
+		defer conn.Close()
+		if readers[i], err = copydata.NewSortedRowReader(*ep, ctx, conn, nil, req.Keys); err != nil {
+			return result, fmt.Errorf("%s: %v", side, err)
+		}
+	}
+	return copydata.Compare(readers[0], readers[1], req.Keys, nil)
+}
+
+// waitCondition runs the query of a wait step until the first column of its first row is true (not null, 0, false nor empty).
+// The wait is audited as a query once it ends, with its number of runs.
+func (s *Services) waitCondition(ctx context.Context, username string, step pipeline.Step) (err error) {
+	runs := 0
+	defer func() {
+		s.audit(ctx, internaldb.AuditEvent{Username: username, Action: internaldb.AuditQuery, DSName: step.DSName, Target: step.Query,
+			Error: errorString(err), Detail: auditDetail(map[string]any{"wait": step.Name, "runs": runs})})
+	}()
+	interval, timeout := time.Duration(step.Interval)*time.Second, time.Duration(step.Timeout)*time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	if timeout <= 0 {
+		timeout = time.Hour
+	}
+
+	ds, err := s.Store.RequireUserDataSource(username, username, step.DSName)
+	if err != nil {
+		return err
+	}
+	if err := requireStmtPermission(ds, step.Query); err != nil {
+		return err
+	}
+	lim, err := s.limits(username, ds.Name)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		value, err := waitQuery(ctx, ds, step.Query, lim.queryTimeout)
+		runs++
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if err == nil && truthy(value) {
+			return nil
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("condition not met after %v", timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// waitQuery runs the query of a wait step once, within the query timeout, and returns the first column of its first row.
+func waitQuery(ctx context.Context, ds internaldb.DataSource, query string, timeout time.Duration) (value any, err error) {
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := openConn(ctx, ds, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", ds.Name, err)
+	}
+	defer conn.Close()
+	err = conn.QueryRowContext(ctx, query).Scan(&value)
+	return value, err
+}
+
+// truthy reports whether a value read from a database is true: not null, 0, false nor empty.
+func truthy(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case []byte:
+		return truthy(string(v))
+	case string:
+		v = strings.TrimSpace(v)
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f != 0
+		}
+		return v != "" && !strings.EqualFold(v, "false")
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	}
+	return fmt.Sprint(value) != "0"
+}
+
+func (s *Services) HandleListPipelines(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := pipelinesResp{}
+
+	pipelines, err := s.Store.GetAllUserPipelines(currentUsername)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+	for _, p := range pipelines {
+		item, err := s.newPipelineItem(p)
+		if err != nil {
+			resp.Error = fmt.Sprintf("invalid pipeline %s. %v", p.Name, err)
+			response.WriteJSON(w, http.StatusInternalServerError, &resp)
+			return
+		}
+		resp.Data = append(resp.Data, item)
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+func (s *Services) HandleGetPipeline(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := pipelineResp{}
+
+	p, err := s.Store.GetUserPipeline(currentUsername, chi.URLParam(r, "name"))
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusNotFound, &resp)
+		return
+	}
+	if resp.Data, err = s.newPipelineItem(p); err != nil {
+		resp.Error = "invalid pipeline. " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// HandleSavePipeline creates a pipeline (POST /pipelines) or updates its definition (PUT /pipelines/{name}).
+func (s *Services) HandleSavePipeline(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.BasicResponse{}
+
+	var item pipelineItem
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		resp.Error = "invalid json. " + err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	name := chi.URLParam(r, "name")
+	if name != "" {
+		item.Name = name
+	}
+	item.Name = strings.TrimSpace(item.Name)
+	if item.Name == "" {
+		resp.Error = "pipeline name is required"
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	if err := item.Definition.Validate(); err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	definition, err := json.Marshal(item.Definition)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	if name == "" {
+		err = s.Store.CreatePipeline(currentUsername, item.Name, string(definition))
+	} else {
+		err = s.Store.UpdatePipeline(currentUsername, item.Name, string(definition))
+	}
+	if err != nil {
+		resp.Error = "cannot save pipeline. " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+func (s *Services) HandleDeletePipeline(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.BasicResponse{}
+
+	name := chi.URLParam(r, "name")
+	if s.Pipelines != nil && s.Pipelines.Running(name) {
+		resp.Error = "cannot delete pipeline. " + pipeline.ErrRunning.Error()
+		response.WriteJSON(w, http.StatusConflict, &resp)
+		return
+	}
+	if err := s.Store.DeletePipeline(currentUsername, name); err != nil {
+		resp.Error = "cannot delete pipeline. " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// HandleRunPipeline starts a run of a pipeline in the background and returns the run id.
+// Steps run as the pipeline owner. The run is followed with HandleGetPipelineRun.
+func (s *Services) HandleRunPipeline(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.Response[int64]{}
+
+	p, err := s.Store.GetUserPipeline(currentUsername, chi.URLParam(r, "name"))
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusNotFound, &resp)
+		return
+	}
+	if s.Pipelines == nil {
+		resp.Error = "pipeline runner is not started"
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+	if resp.Data, err = s.Pipelines.Run(p); err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, pipelineErrorStatus(err), &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusAccepted, &resp)
+}
+
+// HandleResumePipelineRun runs again the failed and skipped steps of a failed run, in the background.
+func (s *Services) HandleResumePipelineRun(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.BasicResponse{}
+
+	p, run, ok := s.pipelineRun(w, r, currentUsername)
+	if !ok {
+		return
+	}
+	if s.Pipelines == nil {
+		resp.Error = "pipeline runner is not started"
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+	if err := s.Pipelines.Resume(p, run); err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, pipelineErrorStatus(err), &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusAccepted, &resp)
+}
+
+func (s *Services) HandleListPipelineRuns(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := pipelineRunsResp{}
+
+	var err error
+	resp.Data, err = s.Store.GetPipelineRuns(currentUsername, chi.URLParam(r, "name"), 100)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+func (s *Services) HandleGetPipelineRun(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := pipelineRunResp{}
+
+	_, run, ok := s.pipelineRun(w, r, currentUsername)
+	if !ok {
+		return
+	}
+	resp.Data = run
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// pipelineRun reads the pipeline and the run of the request url, or writes the error response.
+func (s *Services) pipelineRun(w http.ResponseWriter, r *http.Request, currentUsername string) (internaldb.Pipeline, internaldb.PipelineRun, bool) {
+	resp := response.BasicResponse{}
+
+	name := chi.URLParam(r, "name")
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		resp.Error = "invalid run id"
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return internaldb.Pipeline{}, internaldb.PipelineRun{}, false
+	}
+	p, err := s.Store.GetUserPipeline(currentUsername, name)
+	if err == nil {
+		var run internaldb.PipelineRun
+		if run, err = s.Store.GetPipelineRun(currentUsername, name, id); err == nil {
+			return p, run, true
+		}
+	}
+	resp.Error = err.Error()
+	response.WriteJSON(w, http.StatusNotFound, &resp)
+	return internaldb.Pipeline{}, internaldb.PipelineRun{}, false
+}
+
+func pipelineErrorStatus(err error) int {
+	if errors.Is(err, pipeline.ErrRunning) {
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"db-portal/internal/contextkeys"
+	"db-portal/internal/copydata"
+	"db-portal/internal/internaldb"
+	"db-portal/internal/profile"
+	"db-portal/internal/response"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+type profileResponse = response.Response[*profile.Profile]
+
+// maxProfileCount is the maximum number of top values and histogram buckets of a column profile.
+const maxProfileCount = 100
+
+// HandleProfile returns the profile of the columns of a table or query, computed by the database:
+// null count, distinct count, min and max, average length, most frequent values and histogram.
+// Form fields: type (table or query), dsName, schema, table or query,
+// top (number of most frequent values, 10 by default), buckets (histogram buckets, 10 by default)
+// and exact (1 for exact distinct counts where the vendor estimates them).
+// The profile runs within the copy timeout, read-only permission is enough. It is audited, denied profiles included.
+func (s *Services) HandleProfile(w http.ResponseWriter, r *http.Request) {
+	resp := profileResponse{}
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+
+	// reload config files if needed
+	s.CommandsConfig.Reload()
+
+	ep := copydata.EndPoint{
+		Type:   r.FormValue("type"),
+		DSName: r.FormValue("dsName"),
+		Schema: r.FormValue("schema"),
+		Table:  r.FormValue("table"),
+		Query:  r.FormValue("query"),
+	}
+	var err error
+	switch {
+	case ep.Type == "table" && ep.Table == "":
+		err = fmt.Errorf("table is required")
+	case ep.Type == "query" && ep.Query == "":
+		err = fmt.Errorf("query is required")
+	case ep.Type != "table" && ep.Type != "query":
+		err = fmt.Errorf("invalid type %q: table or query expected", ep.Type)
+	}
+	opts := profile.Options{Exact: r.FormValue("exact") == "1"}
+	if err == nil {
+		opts.Top, err = profileCount(r, "top")
+	}
+	if err == nil {
+		opts.Buckets, err = profileCount(r, "buckets")
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+
+	defer func() {
+		target, rows := ep.Table, int64(0)
+		if ep.Type == "query" {
+			target = ep.Query
+		}
+		if resp.Data != nil {
+			rows = resp.Data.Rows
+		}
+		s.audit(r.Context(), internaldb.AuditEvent{Username: currentUsername, Action: internaldb.AuditProfile, DSName: ep.DSName,
+			Target: target, Rows: rows, Error: resp.Error,
+			Detail: auditDetail(map[string]any{"type": ep.Type, "schema": ep.Schema, "top": opts.Top, "buckets": opts.Buckets, "exact": opts.Exact})})
+	}()
+
+	lim, err := s.limits(currentUsername, ep.DSName)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+	ctx, cancel := withTimeout(r.Context(), lim.copyTimeout)
+	defer cancel()
+
+	conn, status, err := s.endpointConn(ctx, currentUsername, ep.Type, &ep, internaldb.PermissionReadOnly)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, status, &resp)
+		return
+	}
+	defer conn.Close()
+
+	if ep.Type == "table" {
+		resp.Data, err = profile.Table(ctx, conn, ep.DBVendor, ep.Table, opts)
+	} else {
+		resp.Data, err = profile.Query(ctx, conn, ep.DBVendor, ep.Query, opts)
+	}
+	if err != nil {
+		resp.Error = "cannot profile " + ep.Type + ". " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// profileCount returns the count form value of a profile option, 10 by default.
+func profileCount(r *http.Request, name string) (int, error) {
+	value := r.FormValue(name)
+	if value == "" {
+		return 10, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 || n > maxProfileCount {
+		return 0, fmt.Errorf("invalid %s %q: a number from 0 to %d expected", name, value, maxProfileCount)
+	}
+	return n, nil
+}
@@ -2,16 +2,25 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
 	"db-portal/internal/contextkeys"
+	"db-portal/internal/copydata"
 	"db-portal/internal/dbutil"
+	"db-portal/internal/explain"
+	"db-portal/internal/internaldb"
 	"db-portal/internal/response"
+	"db-portal/internal/session"
+	"db-portal/internal/types"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
-type queryResp = response.Response[dbutil.DBResult]
+type queryResp = response.Response[[]dbutil.DBResult]
 
 func (s *Services) QueryHandler(w http.ResponseWriter, r *http.Request) {
 
@@ -32,17 +41,50 @@ func (s *Services) QueryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// get conn
-	conn, err := dbutil.GetConn(r.Context(), ds.Vendor, ds.Location, false)
+	// the query timeout and result set length limit of the user on the data source apply
+	lim, err := s.limits(currentUsername, dsName)
 	if err != nil {
 		resp.Error = err.Error()
 		response.WriteJSON(w, http.StatusInternalServerError, &resp)
 		return
 	}
-	defer conn.Close()
+	ctx, cancel := withTimeout(r.Context(), lim.queryTimeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	// a session query runs on the session connection, in its open transaction if any
+	var sess *session.Session
+	if id := r.FormValue("session"); id != "" {
+		if sess, err = s.session(r, id); err != nil {
+			resp.Error = err.Error()
+			response.WriteJSON(w, sessionErrorStatus(err), &resp)
+			return
+		}
+		if sess.DSName != dsName || sess.Schema != schema {
+			resp.Error = "the session is not on this data source and schema"
+			response.WriteJSON(w, http.StatusBadRequest, &resp)
+			return
+		}
+	}
+
+	// get conn
+	var conn *sql.Conn
+	if sess == nil {
+		if conn, err = openConn(r.Context(), ds, lim.queryTimeout); err != nil {
+			resp.Error = err.Error()
+			response.WriteJSON(w, http.StatusInternalServerError, &resp)
+			return
+		}
+	}
+	keepConn := false // a cursor keeps the connection open
+	defer func() {
+		if conn != nil && !keepConn {
+			conn.Close()
+		}
+	}()
 
-	// set schema
-	if schema != "" {
+	// set schema, a session schema is set when the session is opened
+	if schema != "" && sess == nil {
 		setSchema, args, err := s.CommandsConfig.Data.Command("set-schema", ds.Vendor, []string{schema})
 		if err != nil {
 			resp.Error = err.Error()
@@ -59,21 +101,55 @@ func (s *Services) QueryHandler(w http.ResponseWriter, r *http.Request) {
 	query := r.FormValue("query")
 
 	// Build explain query
-	if r.FormValue("explain") == "1" {
-		command, _, err := s.CommandsConfig.Data.Command("explain", ds.Vendor, []string{})
+	mode, err := explainMode(r)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	if mode != "" {
+		command, _, err := s.CommandsConfig.Data.Command(mode, ds.Vendor, []string{})
 		if err != nil {
 			resp.Error = err.Error()
 			response.WriteJSON(w, http.StatusInternalServerError, &resp)
 			return
 		}
 		if command == "" {
-			resp.Data.DBerror = fmt.Sprintf("explain command is not supported for the %v database", ds.Vendor)
+			msg := "explain command is not supported for the %v database"
+			if mode == explainActual {
+				msg = "actual plans are not supported for the %v database"
+			}
+			resp.Data = []dbutil.DBResult{{DBerror: fmt.Sprintf(msg, ds.Vendor)}}
 			response.WriteJSON(w, http.StatusOK, &resp)
 			return
 		}
+		if mode == explainActual {
+			// the statement is executed in a transaction that is rolled back
+			if ds.Vendor == types.DBVendorClickHouse {
+				resp.Data = []dbutil.DBResult{{DBerror: "actual plans are not supported for the clickhouse database: its statements cannot be rolled back"}}
+				response.WriteJSON(w, http.StatusOK, &resp)
+				return
+			}
+			if sess != nil {
+				resp.Data = []dbutil.DBResult{{DBerror: "actual plans are not supported in a session"}}
+				response.WriteJSON(w, http.StatusOK, &resp)
+				return
+			}
+			if err := requireRollbackSafe(query, ds.Vendor); err != nil {
+				resp.Data = []dbutil.DBResult{{DBerror: err.Error()}}
+				response.WriteJSON(w, http.StatusOK, &resp)
+				return
+			}
+		}
 
 		if ds.Vendor == "mssql" {
-			// explain command (mssql SET SHOWPLAN_ALL ON) is executed before the query
+			if sess != nil {
+				// SHOWPLAN_XML would stay on for the next session queries
+				resp.Data = []dbutil.DBResult{{DBerror: "explain is not supported in a mssql session"}}
+				response.WriteJSON(w, http.StatusOK, &resp)
+				return
+			}
+			// explain command (mssql SET SHOWPLAN_XML ON or SET STATISTICS XML ON) is executed before the query
 			if _, err = conn.ExecContext(r.Context(), command, []any{}...); err != nil {
 				resp.Error = err.Error()
 				response.WriteJSON(w, http.StatusInternalServerError, &resp)
@@ -84,25 +160,344 @@ func (s *Services) QueryHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// infer statement type (query or not query) and command (select, insert, update, delete, etc.)
-	stmtInfos := dbutil.StmtInfo(query, ds.Vendor)
+	// record the execution in the query history and the audit log, denied statements included
+	start := time.Now()
+	entry := internaldb.QueryHistoryEntry{Username: currentUsername, DSName: dsName, Schema: schema,
+		Query: r.FormValue("query"), Params: r.FormValue("params"), Explain: mode != ""}
+	defer func() { s.recordQuery(r.Context(), entry, start, resp.Data, resp.Error) }()
 
-	// execute query
-	ctx := r.Context()
-	if stmtInfos.Type == "query" {
-		resp.Data, err = dbutil.QueryWithResult(ctx, conn, query, []any{}, int64(s.ServerConfig.Data.MaxResultsetLength))
-	} else {
-		resp.Data, err = dbutil.ExecWithResult(ctx, conn, query, []any{})
+	// statements must be allowed by the user permission level on the data source
+	if err := requireStmtPermission(ds, query); err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusForbidden, &resp)
+		return
+	}
+	if mode == explainActual && (ds.Vendor == types.DBVendorMySQL || ds.Vendor == types.DBVendorMariaDB) {
+		if err := requireTransactionalTables(r.Context(), conn, ds.Vendor, r.FormValue("query")); err != nil {
+			resp.Data = []dbutil.DBResult{{DBerror: err.Error()}}
+			response.WriteJSON(w, http.StatusOK, &resp)
+			return
+		}
 	}
-	resp.Data.StmtType = stmtInfos.Type
-	resp.Data.StmtCmd = stmtInfos.Cmd
 
+	// bind :name and @name parameters, params is a json object of values by name
+	params, err := dbutil.ParseParams(r.FormValue("params"))
 	if err != nil {
-		// just set error. http.StatusOK is fine here
-		if ctx.Err() == context.Canceled {
-			resp.Error = "request canceled by client"
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+
+	// track the running query, the client cancels it by its id with HandleCancelQuery
+	ctx, rq, err := s.Queries.Register(r.Context(), currentUsername, r.FormValue("queryId"), dsName, schema, query)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, runningErrorStatus(err), &resp)
+		return
+	}
+	defer s.Queries.Done(rq)
+	ctx = dbutil.WithQueryID(ctx, ds.Vendor, rq.ID)
+	r = r.WithContext(ctx)
+	w.Header().Set("X-Query-Id", rq.ID)
+
+	// stream all rows in a file format, without row limit
+	if format := streamFormat(r); format != "" {
+		if sess != nil {
+			resp.Error = "a session query cannot be streamed"
+			response.WriteJSON(w, http.StatusBadRequest, &resp)
+			return
+		}
+		if mode == explainActual {
+			resp.Error = "an actual plan cannot be streamed"
+			response.WriteJSON(w, http.StatusBadRequest, &resp)
+			return
+		}
+		query, args, err := dbutil.BindNamedParams(query, ds.Vendor, params)
+		if err != nil {
+			resp.Error = err.Error()
+			response.WriteJSON(w, http.StatusBadRequest, &resp)
+			return
+		}
+		stmtInfos := dbutil.StmtInfo(query, ds.Vendor)
+		if stmtInfos.Type != "query" {
+			resp.Error = "only queries returning rows can be streamed as " + format
+			response.WriteJSON(w, http.StatusBadRequest, &resp)
+			return
+		}
+		s.setQueryKill(ctx, rq, conn, ds)
+		rows, err := s.streamQuery(w, r, conn, ds.Vendor, query, args, format)
+		entry.StmtCmd, entry.RowsReturned = stmtInfos.Cmd, int64(rows)
+		if err != nil {
+			resp.Error = err.Error() // for the query history, the response is already written
+		}
+		return
+	}
+
+	// open a cursor and fetch the first page, the next pages are fetched with HandleFetchCursor
+	if stmtInfos := dbutil.StmtInfo(query, ds.Vendor); r.FormValue("cursor") == "1" && mode == "" && stmtInfos.Type == "query" && s.Cursors != nil && sess == nil {
+		query, args, err := dbutil.BindNamedParams(query, ds.Vendor, params)
+		if err != nil {
+			resp.Error = err.Error()
+			response.WriteJSON(w, http.StatusBadRequest, &resp)
+			return
+		}
+		s.setQueryKill(ctx, rq, conn, ds)
+		c, dResult, err := s.Cursors.Open(currentUsername, conn, dsName, schema, query, args)
+		if err == nil {
+			keepConn = true
+			dResult, err = s.Cursors.Fetch(c, pageSize(r, lim.maxResultsetLength))
+		}
+		dResult.StmtType = stmtInfos.Type
+		dResult.StmtCmd = stmtInfos.Cmd
+		resp.Data = []dbutil.DBResult{dResult}
+		response.WriteJSON(w, http.StatusOK, &resp)
+		return
+	}
+
+	// A script is split into statements, except for MSSQL where a batch runs as a whole
+	// (its variables are scoped to the batch) and returns its result sets. An explain query is not split.
+	stmts := []string{query}
+	if mode == "" && ds.Vendor != types.DBVendorMSSQL {
+		if split := dbutil.SplitStatements(query, ds.Vendor); len(split) > 0 {
+			stmts = split
+		}
+	}
+	stmtArgs := make([][]any, len(stmts))
+	for i := range stmts {
+		if stmts[i], stmtArgs[i], err = dbutil.BindNamedParams(stmts[i], ds.Vendor, params); err != nil {
+			resp.Error = err.Error()
+			response.WriteJSON(w, http.StatusBadRequest, &resp)
+			return
+		}
+	}
+
+	// execute statements, one result by statement or result set.
+	// Execution stops at the first error, unless onError is "continue".
+	resp.Data = []dbutil.DBResult{}
+	run := func(q dbutil.Querier) error {
+		s.setQueryKill(ctx, rq, q, ds)
+		for i, stmt := range stmts {
+			// infer statement type (query or not query) and command (select, insert, update, delete, etc.)
+			stmtInfos := dbutil.StmtInfo(stmt, ds.Vendor)
+
+			var results []dbutil.DBResult
+			if stmtInfos.Type == "query" {
+				results, _ = dbutil.QueryWithResults(ctx, q, stmt, stmtArgs[i], lim.maxResultsetLength)
+			} else {
+				dResult, _ := dbutil.ExecWithResult(ctx, q, stmt, stmtArgs[i])
+				results = []dbutil.DBResult{dResult}
+			}
+			failed := false
+			for j := range results {
+				results[j].StmtType = stmtInfos.Type
+				results[j].StmtCmd = stmtInfos.Cmd
+				if len(stmts) > 1 {
+					results[j].Statement = stmt
+				}
+				failed = failed || results[j].DBerror != ""
+			}
+			resp.Data = append(resp.Data, results...)
+
+			// just set error. http.StatusOK is fine here
+			if s.Queries.Canceled(rq) {
+				resp.Error = "query canceled"
+				break
+			}
+			if ctx.Err() == context.Canceled {
+				resp.Error = "request canceled by client"
+				break
+			}
+			if ctx.Err() == context.DeadlineExceeded {
+				resp.Error = fmt.Sprintf("query timeout of %v exceeded", lim.queryTimeout)
+				break
+			}
+			if failed && r.FormValue("onError") != "continue" {
+				break
+			}
+		}
+		return nil
+	}
+	if sess != nil {
+		err = s.Sessions.Do(sess, run)
+	} else if mode == explainActual {
+		err = runRolledBack(r.Context(), conn, run)
+	} else {
+		err = run(conn)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, sessionErrorStatus(err), &resp)
+		return
+	}
+
+	// parse the plan rows of an explain query into a plan tree, unknown plan formats keep their rows only
+	if mode != "" {
+		for i := range resp.Data {
+			if resp.Data[i].DBerror == "" && !resp.Data[i].Truncated {
+				resp.Data[i].Plan, _ = explain.Parse(ds.Vendor, resp.Data[i].Cols, resp.Data[i].Rows)
+			}
 		}
 	}
 
 	response.WriteJSON(w, http.StatusOK, &resp)
 }
+
+// Explain modes, they are the names of their commands in commands.yaml.
+const (
+	explainEstimated = "explain"        // the plan of the statement, which is not executed
+	explainActual    = "explain-actual" // the plan with actual rows and time, the statement is executed
+)
+
+// explainMode returns the explain mode of the explain form value: "1" or "estimated" for an estimated plan,
+// "actual" for an actual plan. It is empty for a query that is not explained.
+func explainMode(r *http.Request) (string, error) {
+	switch r.FormValue("explain") {
+	case "", "0":
+		return "", nil
+	case "1", "estimated":
+		return explainEstimated, nil
+	case "actual":
+		return explainActual, nil
+	}
+	return "", fmt.Errorf("invalid explain mode %q: estimated or actual expected", r.FormValue("explain"))
+}
+
+// requireRollbackSafe returns an error unless the query of an actual plan is a single statement that cannot end
+// the transaction it is rolled back with: no transaction or session statement (COMMIT, SET IMPLICIT_TRANSACTIONS...),
+// nor a procedure or code block call, which can commit.
+func requireRollbackSafe(query, dbVendor string) error {
+	stmts := dbutil.SplitStatements(query, dbVendor)
+	if len(stmts) != 1 {
+		return fmt.Errorf("an actual plan explains a single statement, %d found", len(stmts))
+	}
+	info := dbutil.StmtInfo(stmts[0], dbVendor)
+	for _, kind := range append([]string{info.Kind}, info.Nested...) {
+		switch kind {
+		case dbutil.StmtKindTransaction, dbutil.StmtKindSession, dbutil.StmtKindCall:
+			return fmt.Errorf("actual plan not allowed: a %s command could end the transaction the statement is rolled back with", kind)
+		}
+	}
+	return nil
+}
+
+// transactionalEngines are the MySQL and MariaDB storage engines whose changes are rolled back. MyISAM, Aria,
+// Memory and the other engines keep the changes of a rolled back transaction.
+var transactionalEngines = map[string]bool{"innodb": true, "ndbcluster": true, "ndb": true, "rocksdb": true, "tokudb": true}
+
+// requireTransactionalTables returns an error unless the tables of a MySQL or MariaDB statement that modifies data
+// all have a transactional storage engine, so that the statement of its actual plan can be rolled back.
+func requireTransactionalTables(ctx context.Context, conn *sql.Conn, dbVendor, query string) error {
+	info := dbutil.StmtInfo(query, dbVendor)
+	if info.ReadOnly {
+		return nil
+	}
+	for _, table := range info.Tables {
+		schema, name, found := strings.Cut(table, ".")
+		if !found {
+			schema, name = "", table
+		}
+		var engine sql.NullString
+		err := conn.QueryRowContext(ctx, "SELECT ENGINE FROM information_schema.TABLES WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ?",
+			schema, name).Scan(&engine)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return fmt.Errorf("actual plan not allowed: table %s not found, its changes may not be rolled back", table)
+		case err != nil:
+			return fmt.Errorf("cannot read the storage engine of table %s. %v", table, err)
+		case !transactionalEngines[strings.ToLower(engine.String)]:
+			if !engine.Valid {
+				engine.String = "none, a view"
+			}
+			return fmt.Errorf("actual plan not allowed: table %s is not transactional (engine %s), its changes would not be rolled back", table, engine.String)
+		}
+	}
+	return nil
+}
+
+// runRolledBack runs the statements of an actual plan in a transaction that is always rolled back,
+// so that an explained insert, update or delete does not change data.
+func runRolledBack(ctx context.Context, conn *sql.Conn, run func(dbutil.Querier) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin the transaction of the actual plan. %v", err)
+	}
+	defer tx.Rollback()
+	return run(tx)
+}
+
+// streamFormats are the file formats of streamed query results, by media type.
+var streamFormats = map[string]string{
+	"application/x-ndjson":      "ndjson",
+	"application/jsonl":         "ndjson",
+	"text/csv":                  "csv",
+	"text/tab-separated-values": "tsv",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": "xlsx",
+	"application/vnd.apache.parquet":                                    "parquet",
+	"application/x-parquet":                                             "parquet",
+}
+
+// streamContentTypes are the response content types by file format.
+var streamContentTypes = map[string]string{
+	"ndjson":  "application/x-ndjson",
+	"csv":     "text/csv",
+	"tsv":     "text/tab-separated-values",
+	"xlsx":    "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"parquet": "application/vnd.apache.parquet",
+}
+
+// streamFormat returns the file format requested by the format form value, or else by the Accept header.
+// It is empty for the default json response.
+func streamFormat(r *http.Request) string {
+	if format := r.FormValue("format"); format != "" && format != "json" {
+		return format
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(accept, ";")
+		if format, ok := streamFormats[strings.TrimSpace(strings.ToLower(mediaType))]; ok {
+			return format
+		}
+	}
+	return ""
+}
+
+// streamQuery writes all the rows of a query in a file format. Memory use does not depend on the number of rows,
+// except for xlsx which is built in memory.
+// Errors before the first row are returned as json, later errors are appended to the file.
+// The number of rows written and the error are returned once the response is written.
+func (s *Services) streamQuery(w http.ResponseWriter, r *http.Request, conn *sql.Conn, dbVendor, query string, args []any, format string) (int, error) {
+	resp := response.BasicResponse{}
+
+	ext, contentType := format, streamContentTypes[format]
+	if format == "ndjson" {
+		ext = "jsonl"
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	writer, err := copydata.NewRowWriter(copydata.EndPoint{Type: "file", Format: format}, r.Context(), nil, w, nil)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return 0, err
+	}
+	reader, err := copydata.NewDBRowReader(r.Context(), conn, dbVendor, query, args...)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return 0, err
+	}
+
+	w.Header().Set("Content-Disposition", "attachment; filename=query_"+time.Now().Format("20060102-150405")+"."+ext)
+	w.Header().Set("Content-Type", contentType)
+	_, writes, err := copydata.CopyData(reader, writer)
+	if err != nil {
+		if writes == 0 {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			// error message is appended to end of file
+			w.Write([]byte(err.Error()))
+		}
+	}
+	return writes, err
+}
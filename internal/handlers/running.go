@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"db-portal/internal/contextkeys"
+	"db-portal/internal/dbutil"
+	"db-portal/internal/internaldb"
+	"db-portal/internal/response"
+	"db-portal/internal/running"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// runningErrorStatus returns the http status of a running query error.
+func runningErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, running.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, running.ErrDuplicate):
+		return http.StatusConflict
+	case errors.Is(err, running.ErrInvalidID):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// setQueryKill finds the server id of the statements run on q, so that canceling rq kills them on the database server.
+// Without it, rq is canceled by its context only.
+func (s *Services) setQueryKill(ctx context.Context, rq *running.Query, q dbutil.Querier, ds internaldb.DataSource) {
+	backendID, err := dbutil.BackendID(ctx, q, ds.Vendor, rq.ID)
+	if err != nil || backendID == "" {
+		return
+	}
+	s.Queries.SetKill(rq, func(ctx context.Context) error {
+		conn, err := dbutil.GetConn(ctx, ds.Vendor, ds.Location, false)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return dbutil.KillStatement(ctx, conn, ds.Vendor, backendID)
+	})
+}
+
+// HandleListQueries returns the running queries of the user.
+func (s *Services) HandleListQueries(w http.ResponseWriter, r *http.Request) {
+	resp := response.Response[[]running.Info]{}
+	resp.Data = s.Queries.List(contextkeys.UsernameFromContext(r.Context()))
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// HandleCancelQuery cancels a running query of the user: its statement is killed on the database server,
+// and its request returns the results of the statements already run.
+func (s *Services) HandleCancelQuery(w http.ResponseWriter, r *http.Request) {
+	resp := response.BasicResponse{}
+
+	if err := s.Queries.Cancel(contextkeys.UsernameFromContext(r.Context()), chi.URLParam(r, "id")); err != nil {
+		status := runningErrorStatus(err)
+		resp.Error = err.Error()
+		if status == http.StatusInternalServerError {
+			resp.Error = "query canceled, but its statement could not be killed on the database server. " + err.Error()
+		}
+		response.WriteJSON(w, status, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"db-portal/internal/contextkeys"
+	"db-portal/internal/dbutil"
+	"db-portal/internal/internaldb"
+	"db-portal/internal/response"
+	"db-portal/internal/types"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// savedQueryParam is a declared parameter of a saved query.
+// A parameter without default value is required to run the query.
+type savedQueryParam struct {
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"` // see dbutil.Param
+	Default     any    `json:"default,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// savedQuery is a saved query, with its declared parameters decoded.
+type savedQuery struct {
+	ID           int64             `json:"id"`
+	Name         string            `json:"name"`
+	Folder       string            `json:"folder"`
+	Owner        string            `json:"owner,omitempty"`
+	DSName       string            `json:"dsName"`
+	Vendor       string            `json:"vendor"`
+	Query        string            `json:"query"`
+	Params       []savedQueryParam `json:"params"`
+	SharedWithDS bool              `json:"sharedWithDS"`
+	CreatedAt    string            `json:"createdAt,omitempty"`
+	UpdatedAt    string            `json:"updatedAt,omitempty"`
+}
+
+type savedQueriesResp = response.Response[[]savedQuery]
+type savedQueryResp = response.Response[savedQuery]
+
+var savedQueryVendors = map[string]bool{
+	types.DBVendorClickHouse: true, types.DBVendorMySQL: true, types.DBVendorMariaDB: true,
+	types.DBVendorMSSQL: true, types.DBVendorPostgres: true, types.DBVendorSQLite: true,
+}
+
+func newSavedQuery(q internaldb.SavedQuery) (savedQuery, error) {
+	result := savedQuery{ID: q.ID, Name: q.Name, Folder: q.Folder, Owner: q.Owner, DSName: q.DSName, Vendor: q.Vendor,
+		Query: q.Query, Params: []savedQueryParam{}, SharedWithDS: q.SharedWithDS, CreatedAt: q.CreatedAt, UpdatedAt: q.UpdatedAt}
+	if q.Params == "" {
+		return result, nil
+	}
+	dec := json.NewDecoder(strings.NewReader(q.Params))
+	dec.UseNumber()
+	err := dec.Decode(&result.Params)
+	return result, err
+}
+
+// validateSavedQuery checks a saved query before it is stored.
+func validateSavedQuery(q savedQuery) error {
+	if q.Name == "" {
+		return fmt.Errorf("saved query name is required")
+	}
+	if strings.TrimSpace(q.Query) == "" {
+		return fmt.Errorf("saved query is empty")
+	}
+	if q.DSName != "" && q.Vendor != "" {
+		return fmt.Errorf("a saved query applies to a data source or to a vendor, not both")
+	}
+	if q.Vendor != "" && !savedQueryVendors[q.Vendor] {
+		return fmt.Errorf("unknown vendor %q", q.Vendor)
+	}
+	if q.SharedWithDS && q.DSName == "" {
+		return fmt.Errorf("a saved query shared with the users of its data source needs a data source")
+	}
+	names := map[string]bool{}
+	for _, p := range q.Params {
+		if p.Name == "" {
+			return fmt.Errorf("parameter name is required")
+		}
+		if names[p.Name] {
+			return fmt.Errorf("parameter %s is declared twice", p.Name)
+		}
+		names[p.Name] = true
+		if !dbutil.ValidParamType(p.Type) {
+			return fmt.Errorf("unknown type %q of parameter %s", p.Type, p.Name)
+		}
+	}
+	return nil
+}
+
+// savedQueryID returns the {id} URL parameter.
+func savedQueryID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid saved query id %q", chi.URLParam(r, "id"))
+	}
+	return id, nil
+}
+
+// HandleListSavedQueries returns the saved queries owned by or shared with the user.
+// Query parameters: folder, and dsName for the queries that apply to a data source.
+func (s *Services) HandleListSavedQueries(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := savedQueriesResp{Data: []savedQuery{}}
+
+	queries, err := s.Store.GetAllUserSavedQueries(currentUsername, internaldb.SavedQueryFilter{
+		Folder: r.FormValue("folder"),
+		DSName: r.FormValue("dsName"),
+	})
+	if err != nil {
+		resp.Error = "cannot get saved queries. " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+	for _, query := range queries {
+		q, err := newSavedQuery(query)
+		if err != nil {
+			resp.Error = fmt.Sprintf("invalid saved query %d. %v", query.ID, err)
+			response.WriteJSON(w, http.StatusInternalServerError, &resp)
+			return
+		}
+		resp.Data = append(resp.Data, q)
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// savedQuery returns the {id} saved query allowed to the request user.
+func (s *Services) savedQuery(r *http.Request) (savedQuery, int, error) {
+	id, err := savedQueryID(r)
+	if err != nil {
+		return savedQuery{}, http.StatusBadRequest, err
+	}
+	return s.savedQueryByID(contextkeys.UsernameFromContext(r.Context()), id)
+}
+
+func (s *Services) HandleGetSavedQuery(w http.ResponseWriter, r *http.Request) {
+	resp := savedQueryResp{}
+
+	var status int
+	var err error
+	if resp.Data, status, err = s.savedQuery(r); err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, status, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// HandleSaveSavedQuery creates a saved query (POST /saved-queries) or replaces it (PUT /saved-queries/{id}).
+// Body: {"name", "folder", "dsName" or "vendor", "query", "params": [{"name", "type", "default", "description"}], "sharedWithDS"}
+func (s *Services) HandleSaveSavedQuery(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := savedQueryResp{}
+
+	var q savedQuery
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&q); err != nil {
+		resp.Error = "invalid json. " + err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	q.ID = 0
+	if chi.URLParam(r, "id") != "" {
+		var err error
+		if q.ID, err = savedQueryID(r); err != nil {
+			resp.Error = err.Error()
+			response.WriteJSON(w, http.StatusBadRequest, &resp)
+			return
+		}
+	}
+	q.Name = strings.TrimSpace(q.Name)
+	q.Folder = strings.Trim(strings.TrimSpace(q.Folder), "/")
+	for i := range q.Params {
+		q.Params[i].Name = strings.TrimLeft(q.Params[i].Name, ":@")
+	}
+	if err := validateSavedQuery(q); err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+
+	params := ""
+	if len(q.Params) > 0 {
+		b, err := json.Marshal(q.Params)
+		if err != nil {
+			resp.Error = err.Error()
+			response.WriteJSON(w, http.StatusBadRequest, &resp)
+			return
+		}
+		params = string(b)
+	}
+	saved := internaldb.SavedQuery{ID: q.ID, Name: q.Name, Folder: q.Folder, DSName: q.DSName, Vendor: q.Vendor,
+		Query: q.Query, Params: params, SharedWithDS: q.SharedWithDS}
+	var err error
+	if q.ID == 0 {
+		saved.ID, err = s.Store.CreateSavedQuery(currentUsername, saved)
+	} else {
+		err = s.Store.UpdateSavedQuery(currentUsername, saved)
+	}
+	if err != nil {
+		resp.Error = "cannot save query. " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	var status int
+	if resp.Data, status, err = s.savedQueryByID(currentUsername, saved.ID); err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, status, &resp)
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// savedQueryByID returns a saved query allowed to username.
+func (s *Services) savedQueryByID(username string, id int64) (savedQuery, int, error) {
+	saved, err := s.Store.GetUserSavedQuery(username, id)
+	if err != nil {
+		return savedQuery{}, http.StatusNotFound, err
+	}
+	q, err := newSavedQuery(saved)
+	if err != nil {
+		return savedQuery{}, http.StatusInternalServerError, fmt.Errorf("invalid saved query. %v", err)
+	}
+	return q, http.StatusOK, nil
+}
+
+func (s *Services) HandleDeleteSavedQuery(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.BasicResponse{}
+
+	id, err := savedQueryID(r)
+	if err == nil {
+		err = s.Store.DeleteSavedQuery(currentUsername, id)
+	}
+	if err != nil {
+		resp.Error = "cannot delete saved query. " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+func (s *Services) HandleCreateUserSavedQuery(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.BasicResponse{}
+
+	id, err := savedQueryID(r)
+	if err == nil {
+		err = s.Store.CreateUserSavedQuery(currentUsername, chi.URLParam(r, "username"), id)
+	}
+	if err != nil {
+		resp.Error = "cannot share saved query. " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+func (s *Services) HandleDeleteUserSavedQuery(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.BasicResponse{}
+
+	id, err := savedQueryID(r)
+	if err == nil {
+		err = s.Store.DeleteUserSavedQuery(currentUsername, chi.URLParam(r, "username"), id)
+	}
+	if err != nil {
+		resp.Error = "cannot unshare saved query. " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// bindSavedQueryParams returns the json params of a saved query run: the values given in the params json object,
+// typed as declared, and the default values of the declared parameters not given.
+func bindSavedQueryParams(q savedQuery, data string) (string, error) {
+	params, err := dbutil.ParseParams(data)
+	if err != nil {
+		return "", err
+	}
+	for _, declared := range q.Params {
+		p, ok := params[declared.Name]
+		if !ok {
+			if declared.Default == nil {
+				return "", fmt.Errorf("missing value for parameter %s", declared.Name)
+			}
+			p.Value = declared.Default
+		}
+		if p.Type == "" {
+			p.Type = declared.Type
+		}
+		if _, err := p.BindValue(); err != nil {
+			return "", fmt.Errorf("invalid value for parameter %s. %v", declared.Name, err)
+		}
+		params[declared.Name] = p
+	}
+	if len(params) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(params)
+	return string(b), err
+}
+
+// HandleRunSavedQuery runs a saved query as the request user, with QueryHandler.
+// Form: dsName (required when the saved query is not tied to a data source), schema, params (json object of values by name)
+// and the other QueryHandler fields (queryId, onError, cursor, format...).
+func (s *Services) HandleRunSavedQuery(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := queryResp{}
+
+	q, status, err := s.savedQuery(r)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, status, &resp)
+		return
+	}
+
+	dsName := r.FormValue("dsName")
+	switch {
+	case q.DSName != "" && dsName != "" && dsName != q.DSName:
+		err = fmt.Errorf("saved query %q applies to data source %q only", q.Name, q.DSName)
+	case q.DSName != "":
+		dsName = q.DSName
+	case dsName == "":
+		err = fmt.Errorf("dsName is required")
+	case q.Vendor != "":
+		var ds internaldb.DataSource
+		if ds, err = s.Store.RequireUserDataSource(currentUsername, currentUsername, dsName); err != nil {
+			resp.Error = err.Error()
+			response.WriteJSON(w, http.StatusNotFound, &resp)
+			return
+		}
+		if ds.Vendor != q.Vendor {
+			err = fmt.Errorf("saved query %q applies to %s data sources only", q.Name, q.Vendor)
+		}
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+
+	params, err := bindSavedQueryParams(q, r.FormValue("params"))
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	s.runQuery(w, r, dsName, r.FormValue("schema"), map[string]string{"query": q.Query, "params": params})
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"db-portal/internal/contextkeys"
+	"db-portal/internal/dbutil"
+	"db-portal/internal/internaldb"
+	"db-portal/internal/response"
+	"db-portal/internal/scheduler"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// schedule is a schedule with its next run time and status.
+type schedule struct {
+	internaldb.Schedule
+	NextRun string `json:"nextRun,omitempty"`
+	Running bool   `json:"running"`
+}
+
+type schedulesResp = response.Response[[]schedule]
+type scheduleRunsResp = response.Response[[]internaldb.ScheduleRun]
+
+// RunSchedule runs a schedule once as its designated user, see scheduler.RunFunc.
+func (s *Services) RunSchedule(ctx context.Context, sch internaldb.Schedule) (rows int64, err error) {
+	// reload config files if needed
+	s.CommandsConfig.Reload()
+	s.ReloadTypesConfig()
+
+	switch sch.Kind {
+	case "copy-job":
+		return s.runCopyJob(ctx, sch.RunAs, sch.CopyJob)
+	case "sql":
+		return s.runScript(ctx, sch.RunAs, sch.DSName, sch.Script)
+	}
+	return 0, fmt.Errorf("unknown schedule kind %q", sch.Kind)
+}
+
+// runCopyJob runs a saved copy job without a form, its destination must be a table, and returns the rows written.
+func (s *Services) runCopyJob(ctx context.Context, username, name string) (int64, error) {
+	saved, err := s.Store.GetUserCopyJob(username, name)
+	if err != nil {
+		return 0, err
+	}
+	job, err := newCopyJob(saved)
+	if err != nil {
+		return 0, fmt.Errorf("invalid copy job. %v", err)
+	}
+	if job.Request.DestEP.Type != "table" {
+		return 0, fmt.Errorf("copy job %s must have a table destination", name)
+	}
+	req := job.Request
+	req.Name = job.Name
+	data, _, err := s.runCopy(ctx, username, job.Owner, copyJobWatermarkPrefix+job.Name, req, nil, nil, nil)
+	return int64(data.Writes), err
+}
+
+// runScript runs the statements of a SQL script on a data source and returns the rows affected.
+// The run is audited, denied scripts included.
+func (s *Services) runScript(ctx context.Context, username, dsName, script string) (rows int64, err error) {
+	defer func() {
+		s.audit(ctx, internaldb.AuditEvent{Username: username, Action: internaldb.AuditScript, DSName: dsName, Target: script,
+			Rows: rows, Error: errorString(err)})
+	}()
+
+	ds, err := s.Store.RequireUserDataSource(username, username, dsName)
+	if err != nil {
+		return 0, err
+	}
+	if err := requireStmtPermission(ds, script); err != nil {
+		return 0, err
+	}
+	lim, err := s.limits(username, ds.Name)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := withTimeout(ctx, lim.queryTimeout)
+	defer cancel()
+	conn, err := openConn(ctx, ds, lim.queryTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to %s: %v", dsName, err)
+	}
+	defer conn.Close()
+	for i, stmt := range dbutil.SplitStatements(script, ds.Vendor) {
+		result, err := conn.ExecContext(ctx, stmt)
+		if err != nil {
+			return rows, fmt.Errorf("statement %d: %w", i+1, err)
+		}
+		if n, err := result.RowsAffected(); err == nil && n > 0 {
+			rows += n
+		}
+	}
+	return rows, nil
+}
+
+func (s *Services) HandleListSchedules(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := schedulesResp{}
+
+	schedules, err := s.Store.GetAllUserSchedules(currentUsername)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+	for _, sch := range schedules {
+		item := schedule{Schedule: sch}
+		if cron, err := scheduler.ParseCron(sch.Cron); err == nil && sch.Enabled == 1 {
+			if next := cron.Next(time.Now()); !next.IsZero() {
+				item.NextRun = next.Format(time.RFC3339)
+			}
+		}
+		if s.Scheduler != nil {
+			item.Running = s.Scheduler.Running(sch.Name)
+		}
+		resp.Data = append(resp.Data, item)
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// HandleSaveSchedule creates a schedule (POST /schedules) or updates it (PUT /schedules/{name}).
+func (s *Services) HandleSaveSchedule(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.BasicResponse{}
+
+	sch := internaldb.Schedule{Enabled: 1, RetryDelay: 60}
+	if err := json.NewDecoder(r.Body).Decode(&sch); err != nil {
+		resp.Error = "invalid json. " + err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	name := chi.URLParam(r, "name")
+	if name != "" {
+		sch.Name = name
+	}
+	sch.Name = strings.TrimSpace(sch.Name)
+	if sch.Name == "" {
+		resp.Error = "schedule name is required"
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	if _, err := scheduler.ParseCron(sch.Cron); err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	switch {
+	case sch.Kind == "copy-job" && sch.CopyJob != "":
+	case sch.Kind == "sql" && sch.DSName != "" && strings.TrimSpace(sch.Script) != "":
+	default:
+		resp.Error = `schedule kind must be "copy-job" with a copyJob, or "sql" with a dsName and a script`
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+	if sch.MaxRetries < 0 || sch.RetryDelay < 0 {
+		resp.Error = "maxRetries and retryDelay must be positive"
+		response.WriteJSON(w, http.StatusBadRequest, &resp)
+		return
+	}
+
+	var err error
+	if name == "" {
+		err = s.Store.CreateSchedule(currentUsername, sch)
+	} else {
+		err = s.Store.UpdateSchedule(currentUsername, sch)
+	}
+	if err != nil {
+		resp.Error = "cannot save schedule. " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+func (s *Services) HandleDeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.BasicResponse{}
+
+	if err := s.Store.DeleteSchedule(currentUsername, chi.URLParam(r, "name")); err != nil {
+		resp.Error = "cannot delete schedule. " + err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// HandleRunSchedule triggers a schedule run in the background. Runs are listed by HandleListScheduleRuns.
+func (s *Services) HandleRunSchedule(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.BasicResponse{}
+
+	sch, err := s.Store.GetUserSchedule(currentUsername, chi.URLParam(r, "name"))
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusNotFound, &resp)
+		return
+	}
+	if s.Scheduler == nil {
+		resp.Error = "scheduler is not started"
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+	if err := s.Scheduler.Trigger(sch, "manual"); err != nil {
+		resp.Error = err.Error()
+		status := http.StatusInternalServerError
+		if errors.Is(err, scheduler.ErrRunning) {
+			status = http.StatusConflict
+		}
+		response.WriteJSON(w, status, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusAccepted, &resp)
+}
+
+func (s *Services) HandleListScheduleRuns(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := scheduleRunsResp{}
+
+	var err error
+	resp.Data, err = s.Store.GetScheduleRuns(currentUsername, chi.URLParam(r, "name"), 100)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
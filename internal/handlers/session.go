@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"db-portal/internal/contextkeys"
+	"db-portal/internal/response"
+	"db-portal/internal/session"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// sessionErrorStatus returns the http status of a session error.
+func sessionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, session.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, session.ErrTooMany):
+		return http.StatusTooManyRequests
+	case errors.Is(err, session.ErrInTransaction), errors.Is(err, session.ErrNoTransaction):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func (s *Services) HandleListSessions(w http.ResponseWriter, r *http.Request) {
+	resp := response.Response[[]session.Info]{}
+	resp.Data = s.Sessions.List(contextkeys.UsernameFromContext(r.Context()), contextkeys.TokenFromContext(r.Context()))
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// HandleOpenSession opens a session on the dsName data source, and schema if given.
+// The session connection is held until the session is closed or idle for too long.
+func (s *Services) HandleOpenSession(w http.ResponseWriter, r *http.Request) {
+	currentUsername := contextkeys.UsernameFromContext(r.Context())
+	resp := response.Response[session.Info]{}
+
+	dsName, schema := r.FormValue("dsName"), r.FormValue("schema")
+	ds, err := s.Store.RequireUserDataSource(currentUsername, currentUsername, dsName)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusNotFound, &resp)
+		return
+	}
+
+	// the query timeout applies to each session statement
+	lim, err := s.limits(currentUsername, dsName)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+	conn, err := openConn(r.Context(), ds, lim.queryTimeout)
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, http.StatusInternalServerError, &resp)
+		return
+	}
+	if schema != "" {
+		s.CommandsConfig.Reload()
+		setSchema, args, err := s.CommandsConfig.Data.Command("set-schema", ds.Vendor, []string{schema})
+		if err == nil {
+			_, err = conn.ExecContext(r.Context(), setSchema, args...)
+		}
+		if err != nil {
+			conn.Close()
+			resp.Error = err.Error()
+			response.WriteJSON(w, http.StatusInternalServerError, &resp)
+			return
+		}
+	}
+
+	sess, err := s.Sessions.Open(currentUsername, contextkeys.TokenFromContext(r.Context()), conn, dsName, schema, ds.Vendor)
+	if err != nil {
+		conn.Close()
+		resp.Error = err.Error()
+		response.WriteJSON(w, sessionErrorStatus(err), &resp)
+		return
+	}
+
+	resp.Data = s.Sessions.Info(sess)
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// session returns the {id} session of the request user token.
+func (s *Services) session(r *http.Request, id string) (*session.Session, error) {
+	return s.Sessions.Get(contextkeys.UsernameFromContext(r.Context()), contextkeys.TokenFromContext(r.Context()), id)
+}
+
+func (s *Services) HandleGetSession(w http.ResponseWriter, r *http.Request) {
+	resp := response.Response[session.Info]{}
+
+	sess, err := s.session(r, chi.URLParam(r, "id"))
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, sessionErrorStatus(err), &resp)
+		return
+	}
+
+	resp.Data = s.Sessions.Info(sess)
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+// HandleCloseSession closes a session, its open transaction is rolled back.
+func (s *Services) HandleCloseSession(w http.ResponseWriter, r *http.Request) {
+	resp := response.BasicResponse{}
+
+	err := s.Sessions.Close(contextkeys.UsernameFromContext(r.Context()), contextkeys.TokenFromContext(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		resp.Error = err.Error()
+		response.WriteJSON(w, sessionErrorStatus(err), &resp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
+
+func (s *Services) HandleBeginSession(w http.ResponseWriter, r *http.Request) {
+	s.sessionTransaction(w, r, s.Sessions.Begin)
+}
+
+func (s *Services) HandleCommitSession(w http.ResponseWriter, r *http.Request) {
+	s.sessionTransaction(w, r, s.Sessions.Commit)
+}
+
+func (s *Services) HandleRollbackSession(w http.ResponseWriter, r *http.Request) {
+	s.sessionTransaction(w, r, s.Sessions.Rollback)
+}
+
+// sessionTransaction begins, commits or rolls back the transaction of a session, and returns the session state.
+func (s *Services) sessionTransaction(w http.ResponseWriter, r *http.Request, f func(*session.Session) error) {
+	resp := response.Response[session.Info]{}
+
+	sess, err := s.session(r, chi.URLParam(r, "id"))
+	if err == nil {
+		err = f(sess)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		if sess != nil {
+			resp.Data = s.Sessions.Info(sess)
+		}
+		response.WriteJSON(w, sessionErrorStatus(err), &resp)
+		return
+	}
+
+	resp.Data = s.Sessions.Info(sess)
+	response.WriteJSON(w, http.StatusOK, &resp)
+}
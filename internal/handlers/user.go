@@ -51,6 +51,8 @@ func (s *Services) HandleCreateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = s.Store.CreateUser(currentUsername, req.Username, isAdminInt, req.Password)
+	s.audit(r.Context(), internaldb.AuditEvent{Action: internaldb.AuditUserCreate, Target: req.Username,
+		Detail: auditDetail(map[string]any{"isadmin": isAdminInt}), Error: errorString(err)})
 	if err != nil {
 		resp.Error = "Cannot add user. " + err.Error()
 		response.WriteJSON(w, http.StatusInternalServerError, &resp)
@@ -0,0 +1,118 @@
+package internaldb
+
+import "fmt"
+
+// Audited actions.
+const (
+	AuditLogin        = "login"
+	AuditLoginFailed  = "login-failed"
+	AuditUserCreate   = "user-create"
+	AuditDSCreate     = "ds-create"
+	AuditUserDSGrant  = "user-ds-grant"
+	AuditUserDSRevoke = "user-ds-revoke"
+	AuditQuery        = "query"
+	AuditScript       = "script"
+	AuditCopy         = "copy"
+	AuditCompare      = "compare"
+	AuditProfile      = "profile"
+)
+
+// AuditEvent is an entry of the audit log. Username is the user who acted, or tried to log in.
+// Target is the object of the action: the user created or granted, the query or script, the copy name, the profiled table or query.
+// Detail is a json object of the action parameters, Rows the rows returned, affected or copied.
+type AuditEvent struct {
+	ID       int64  `json:"id"`
+	At       string `json:"at"`
+	Username string `json:"username"`
+	IP       string `json:"ip"`
+	Action   string `json:"action"`
+	DSName   string `json:"dsName"`
+	Target   string `json:"target"`
+	Detail   string `json:"detail"`
+	Rows     int64  `json:"rows"`
+	Error    string `json:"error"`
+}
+
+// AuditFilter selects audit events, an empty field selects all. A 0 limit is no limit.
+type AuditFilter struct {
+	Username string
+	Action   string
+	DSName   string
+	From     string // RFC 3339 UTC time or date, included
+	To       string // RFC 3339 UTC time or date, excluded
+	Limit    int
+	Offset   int
+}
+
+// Append an event to the audit log. No access control.
+func (s *Store) CreateAuditEvent(e AuditEvent) error {
+	_, err := s.DB.Exec(`
+	INSERT INTO audit_log (at, username, ip, action, ds_name, target, detail, rows, error)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.At, e.Username, e.IP, e.Action, e.DSName, e.Target, e.Detail, e.Rows, e.Error)
+	return err
+}
+
+// Fetch the audit events selected by f, most recent first. Only an admin can.
+func (s *Store) GetAuditLog(currentUsername string, f AuditFilter) ([]AuditEvent, error) {
+	result := []AuditEvent{}
+	err := s.EachAuditEvent(currentUsername, f, true, func(e AuditEvent) error {
+		result = append(result, e)
+		return nil
+	})
+	return result, err
+}
+
+// Call fn for each audit event selected by f, oldest first unless desc. Only an admin can.
+func (s *Store) EachAuditEvent(currentUsername string, f AuditFilter, desc bool, fn func(AuditEvent) error) error {
+	isAdmin, err := s.CheckIsAdmin(currentUsername)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return fmt.Errorf("audit log not allowed for user %q", currentUsername)
+	}
+
+	query := `
+	SELECT id, at, username, ip, action, ds_name, target, detail, rows, error
+	FROM audit_log
+	WHERE 1 = 1`
+	var args []any
+	for _, c := range []struct{ cond, value string }{
+		{` AND username = ?`, f.Username},
+		{` AND action = ?`, f.Action},
+		{` AND ds_name = ?`, f.DSName},
+		{` AND at >= ?`, f.From},
+		{` AND at < ?`, f.To},
+	} {
+		if c.value != "" {
+			query += c.cond
+			args = append(args, c.value)
+		}
+	}
+	if desc {
+		query += ` ORDER BY id DESC`
+	} else {
+		query += ` ORDER BY id`
+	}
+	if f.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, f.Limit, f.Offset)
+	}
+
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e AuditEvent
+		if err := rows.Scan(&e.ID, &e.At, &e.Username, &e.IP, &e.Action, &e.DSName, &e.Target, &e.Detail, &e.Rows, &e.Error); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
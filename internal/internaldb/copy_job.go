@@ -0,0 +1,148 @@
+package internaldb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CopyJob is a saved copy definition. Request is a json copy request.
+type CopyJob struct {
+	Name      string `json:"name"`
+	Owner     string `json:"owner"`
+	Request   string `json:"request"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+const copyJobBaseQuery = `
+    WITH currentuser AS (
+        SELECT id, name, isadmin
+        FROM user
+        WHERE name = ?
+    )
+    SELECT copy_job.name, owner.name, copy_job.request, copy_job.created_at, copy_job.updated_at
+    FROM copy_job
+    INNER JOIN user owner ON owner.id = copy_job.owner_id
+    INNER JOIN currentuser ON currentuser.isadmin = 1
+        OR currentuser.id = copy_job.owner_id
+        OR EXISTS (
+            SELECT 1 FROM user_copy_job
+            WHERE user_copy_job.copy_job_id = copy_job.id AND user_copy_job.user_id = currentuser.id
+        )
+`
+
+// Fetch copy jobs owned by or shared with the current user.
+func (s *Store) GetAllUserCopyJobs(currentUsername string) ([]CopyJob, error) {
+	rows, err := s.DB.Query(copyJobBaseQuery+` ORDER BY 1`, currentUsername)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []CopyJob
+	for rows.Next() {
+		var job CopyJob
+		if err := rows.Scan(&job.Name, &job.Owner, &job.Request, &job.CreatedAt, &job.UpdatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Get a copy job by its name, if owned by or shared with the current user.
+func (s *Store) GetUserCopyJob(currentUsername, name string) (CopyJob, error) {
+	var job CopyJob
+	err := s.DB.QueryRow(copyJobBaseQuery+` WHERE copy_job.name = ?`, currentUsername, name).
+		Scan(&job.Name, &job.Owner, &job.Request, &job.CreatedAt, &job.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return job, fmt.Errorf("copy job %q not found or not allowed for user %q", name, currentUsername)
+	}
+	return job, err
+}
+
+// Create a copy job owned by the current user.
+func (s *Store) CreateCopyJob(currentUsername, name, request string) error {
+	query := `
+	INSERT INTO copy_job (name, owner_id, request, created_at, updated_at)
+	SELECT ?, user.id, ?, ?, ?
+	FROM user
+	WHERE user.name = ?
+	`
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := s.DB.Exec(query, name, request, now, now, currentUsername)
+	return err
+}
+
+// Update the request of a copy job. Only its owner or an admin can.
+func (s *Store) UpdateCopyJob(currentUsername, name, request string) error {
+	query := `
+	WITH currentuser AS (
+        SELECT id, isadmin 
+        FROM user 
+        WHERE name = ?
+    )
+	UPDATE copy_job SET request = ?, updated_at = ?
+	WHERE name = ?
+	AND (owner_id = (SELECT id FROM currentuser) OR (SELECT isadmin FROM currentuser) = 1)
+	`
+	result, err := s.DB.Exec(query, currentUsername, request, time.Now().UTC().Format(time.RFC3339), name)
+	return requireRowsAffected(result, err, fmt.Sprintf("copy job %q", name))
+}
+
+// Delete a copy job and its shares. Only its owner or an admin can.
+func (s *Store) DeleteCopyJob(currentUsername, name string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	allowed := `
+	    SELECT copy_job.id FROM copy_job
+	    INNER JOIN user ON user.name = ?
+	    WHERE copy_job.name = ? AND (copy_job.owner_id = user.id OR user.isadmin = 1)
+	`
+	if _, err = tx.Exec(`DELETE FROM user_copy_job WHERE copy_job_id IN (`+allowed+`)`, currentUsername, name); err != nil {
+		return err
+	}
+	result, err := tx.Exec(`DELETE FROM copy_job WHERE id IN (`+allowed+`)`, currentUsername, name)
+	if err = requireRowsAffected(result, err, fmt.Sprintf("copy job %q", name)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Share a copy job with a user. Only its owner or an admin can.
+func (s *Store) CreateUserCopyJob(currentUsername, username, name string) error {
+	query := `
+	INSERT INTO user_copy_job (user_id, copy_job_id)
+	SELECT user.id, copy_job.id
+	FROM user
+	INNER JOIN copy_job ON copy_job.name = ?
+	INNER JOIN user currentuser ON currentuser.name = ?
+	WHERE user.name = ? AND (copy_job.owner_id = currentuser.id OR currentuser.isadmin = 1)
+	`
+	result, err := s.DB.Exec(query, name, currentUsername, username)
+	return requireRowsAffected(result, err, fmt.Sprintf("copy job %q", name))
+}
+
+// Stop sharing a copy job with a user. Only its owner or an admin can.
+func (s *Store) DeleteUserCopyJob(currentUsername, username, name string) error {
+	query := `
+	DELETE FROM user_copy_job
+	WHERE user_id = (SELECT id FROM user WHERE name = ?)
+	AND copy_job_id IN (
+	    SELECT copy_job.id FROM copy_job
+	    INNER JOIN user currentuser ON currentuser.name = ?
+	    WHERE copy_job.name = ? AND (copy_job.owner_id = currentuser.id OR currentuser.isadmin = 1)
+	)
+	`
+	_, err := s.DB.Exec(query, username, currentUsername, name)
+	return err
+}
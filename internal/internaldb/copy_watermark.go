@@ -0,0 +1,46 @@
+package internaldb
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Get the last high-water mark of a user incremental copy. An empty string is returned if there is none.
+func (s *Store) GetCopyWatermark(username, name string) (string, error) {
+	query := `
+	SELECT copy_watermark.value
+	FROM copy_watermark
+	INNER JOIN user ON user.id = copy_watermark.user_id
+	WHERE user.name = ? AND copy_watermark.name = ?
+	`
+	var value string
+	err := s.DB.QueryRow(query, username, name).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return value, err
+}
+
+// Save the high-water mark of a user incremental copy.
+func (s *Store) SetCopyWatermark(username, name, value string) error {
+	query := `
+	INSERT INTO copy_watermark (user_id, name, value, updated_at)
+	SELECT user.id, ?, ?, ?
+	FROM user
+	WHERE user.name = ?
+	ON CONFLICT (user_id, name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+	`
+	_, err := s.DB.Exec(query, name, value, time.Now().UTC().Format(time.RFC3339), username)
+	return err
+}
+
+// Delete the high-water mark of a user incremental copy, the next copy will read all rows.
+func (s *Store) DeleteCopyWatermark(username, name string) error {
+	query := `
+	DELETE FROM copy_watermark
+	WHERE user_id = (SELECT id FROM user WHERE name = ?) AND name = ?
+	`
+	_, err := s.DB.Exec(query, username, name)
+	return err
+}
@@ -3,12 +3,14 @@ package internaldb
 import (
 	"database/sql"
 	"db-portal/internal/dbutil"
+	"fmt"
 )
 
 type DataSource struct {
-	Name     string `json:"name"`
-	Vendor   string `json:"vendor"`
-	Location string `json:"location"`
+	Name       string `json:"name"`
+	Vendor     string `json:"vendor"`
+	Location   string `json:"location"`
+	Permission string `json:"permission,omitempty"` // permission level of a user data source
 }
 
 func (s *Store) CreateDataSource(currentUsername, name, vendor, location string) error {
@@ -25,8 +27,8 @@ func (s *Store) CreateDataSource(currentUsername, name, vendor, location string)
 	WHERE isadmin = 1
 	`
 
-	_, err := s.DB.Exec(query, currentUsername, name, location, vendor)
-	return err
+	result, err := s.DB.Exec(query, currentUsername, name, location, vendor)
+	return requireRowsAffected(result, err, fmt.Sprintf("vendor %q or current user %q", vendor, currentUsername))
 }
 
 func (s *Store) TestDataSource(vendor, location string) (bool, error) {
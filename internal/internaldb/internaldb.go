@@ -4,13 +4,23 @@ The current user, unless he is admin (user.isadmin = 1), cannot retrieve or modi
 - data sources (ds.*) not registred to himself
 - users (user.*) but himself
 - ds.location, unless vendor.name = 'sqlite3'
-- user data source (user_ds.*)
+- user data source (user_ds.*), including its permission level
+- limits of data sources and users (ds.query_timeout, user.query_timeout, ...), but his own user limits
+- copy jobs (copy_job.*) not owned by or shared with himself
+- copy jobs he does not own, for modifications and sharing (user_copy_job.*)
+- schedules (schedule.*, schedule_run.*) not run as himself, and cannot modify any schedule
+- pipelines (pipeline.*, pipeline_run.*, pipeline_step_run.*) not owned by himself
+- query history (query_history.*) of other users
+- saved queries (saved_query.*) not owned by or shared with himself, or with all the users of one of his data sources
+- saved queries he does not own, for modifications and sharing (user_saved_query.*)
+- audit log (audit_log.*), nobody can modify or delete its entries
 */
 package internaldb
 
 import (
 	"database/sql"
 	"db-portal/internal/meta"
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -35,6 +45,11 @@ func NewStore(configPath string) (*Store, error) {
 		return nil, err
 	}
 
+	// create tables added after the initial release, see install/initdb.md
+	if err = migrate(db); err != nil {
+		return nil, err
+	}
+
 	// internal DB always exists as data source
 	// update data source location of internaldb (ds.id=1) to its current path
 	_, err = db.Exec("UPDATE ds SET location = ? WHERE id = 1", dbPath)
@@ -47,3 +62,202 @@ func NewStore(configPath string) (*Store, error) {
 		DB:     db,
 	}, nil
 }
+
+// Tables added after the initial release.
+// They are created at startup when missing, so that existing DB files keep working.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS copy_watermark (
+		id integer primary key autoincrement,
+		user_id int not null,
+		name text not null,
+		value text not null,
+		updated_at text not null,
+		unique (user_id, name),
+		foreign key(user_id) references user(id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS copy_job (
+		id integer primary key autoincrement,
+		name text not null,
+		owner_id int not null,
+		request text not null,
+		created_at text not null,
+		updated_at text not null,
+		unique (name),
+		foreign key(owner_id) references user(id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS user_copy_job (
+		id integer primary key autoincrement,
+		user_id int not null,
+		copy_job_id int not null,
+		unique (user_id, copy_job_id),
+		foreign key(user_id) references user(id),
+		foreign key(copy_job_id) references copy_job(id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS schedule (
+		id integer primary key autoincrement,
+		name text not null,
+		cron text not null,
+		kind text not null,
+		copy_job text not null default '',
+		ds_name text not null default '',
+		script text not null default '',
+		run_as_id int not null,
+		enabled int not null default 1,
+		max_retries int not null default 0,
+		retry_delay int not null default 60,
+		unique (name),
+		check (kind IN ('copy-job', 'sql')),
+		foreign key(run_as_id) references user(id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS schedule_run (
+		id integer primary key autoincrement,
+		schedule_id int not null,
+		trigger text not null,
+		attempt int not null,
+		started_at text not null,
+		ended_at text,
+		rows int not null default 0,
+		error text not null default '',
+		foreign key(schedule_id) references schedule(id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS pipeline (
+		id integer primary key autoincrement,
+		name text not null,
+		owner_id int not null,
+		definition text not null,
+		created_at text not null,
+		updated_at text not null,
+		unique (name),
+		foreign key(owner_id) references user(id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS pipeline_run (
+		id integer primary key autoincrement,
+		pipeline_id int not null,
+		status text not null,
+		started_at text not null,
+		ended_at text,
+		check (status IN ('running', 'succeeded', 'failed')),
+		foreign key(pipeline_id) references pipeline(id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS pipeline_step_run (
+		id integer primary key autoincrement,
+		pipeline_run_id int not null,
+		step text not null,
+		status text not null,
+		started_at text not null,
+		ended_at text,
+		rows int not null default 0,
+		error text not null default '',
+		check (status IN ('running', 'succeeded', 'failed', 'skipped')),
+		foreign key(pipeline_run_id) references pipeline_run(id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS query_history (
+		id integer primary key autoincrement,
+		user_id int not null,
+		ds_name text not null,
+		schema text not null default '',
+		query text not null,
+		params text not null default '',
+		explain int not null default 0,
+		stmt_cmd text not null default '',
+		started_at text not null,
+		duration int not null default 0,
+		rows_returned int not null default 0,
+		rows_affected int not null default 0,
+		error text not null default '',
+		foreign key(user_id) references user(id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS query_history_started_at ON query_history (started_at)`,
+	`CREATE TABLE IF NOT EXISTS saved_query (
+		id integer primary key autoincrement,
+		name text not null,
+		folder text not null default '',
+		owner_id int not null,
+		ds_name text not null default '',
+		vendor text not null default '',
+		query text not null,
+		params text not null default '',
+		shared_with_ds int not null default 0,
+		created_at text not null,
+		updated_at text not null,
+		unique (owner_id, folder, name),
+		check (shared_with_ds = 0 OR ds_name != ''),
+		foreign key(owner_id) references user(id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS user_saved_query (
+		id integer primary key autoincrement,
+		user_id int not null,
+		saved_query_id int not null,
+		unique (user_id, saved_query_id),
+		foreign key(user_id) references user(id),
+		foreign key(saved_query_id) references saved_query(id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		id integer primary key autoincrement,
+		at text not null,
+		username text not null,
+		ip text not null default '',
+		action text not null,
+		ds_name text not null default '',
+		target text not null default '',
+		detail text not null default '',
+		rows int not null default 0,
+		error text not null default ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS audit_log_at ON audit_log (at)`,
+	`CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END`,
+	`CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END`,
+}
+
+// Columns added to tables after the initial release.
+// They are added at startup when missing.
+var columnMigrations = []struct{ table, column, definition string }{
+	{"user_ds", "permission", `text not null default 'admin' check (permission IN ('read-only', 'read-write', 'ddl', 'admin'))`},
+	{"ds", "query_timeout", `int check (query_timeout >= 0)`},
+	{"ds", "copy_timeout", `int check (copy_timeout >= 0)`},
+	{"ds", "max_resultset_length", `int check (max_resultset_length >= 0)`},
+	{"ds", "max_copy_rows", `int check (max_copy_rows >= 0)`},
+	{"user", "query_timeout", `int check (query_timeout >= 0)`},
+	{"user", "copy_timeout", `int check (copy_timeout >= 0)`},
+	{"user", "max_resultset_length", `int check (max_resultset_length >= 0)`},
+	{"user", "max_copy_rows", `int check (max_copy_rows >= 0)`},
+}
+
+func migrate(db *sql.DB) error {
+	for _, query := range migrations {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	for _, m := range columnMigrations {
+		var exists int
+		err := db.QueryRow("SELECT count(*) FROM pragma_table_info(?) WHERE name = ?", m.table, m.column).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// requireRowsAffected returns an error when a statement changed nothing,
+// the object was not found or the current user is not allowed.
+func requireRowsAffected(result sql.Result, err error, object string) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%s not found or not allowed", object)
+	}
+	return nil
+}
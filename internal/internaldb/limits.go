@@ -0,0 +1,105 @@
+package internaldb
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Limits of a data source or a user. Timeouts are in seconds. A nil limit is not set, 0 is no limit.
+// The most restrictive limit set on the user or the data source applies, server defaults apply when none is set.
+type Limits struct {
+	QueryTimeout       *int `json:"queryTimeout"`
+	CopyTimeout        *int `json:"copyTimeout"`
+	MaxResultsetLength *int `json:"maxResultsetLength"`
+	MaxCopyRows        *int `json:"maxCopyRows"`
+}
+
+func (l Limits) validate() error {
+	for _, limit := range []*int{l.QueryTimeout, l.CopyTimeout, l.MaxResultsetLength, l.MaxCopyRows} {
+		if limit != nil && *limit < 0 {
+			return fmt.Errorf("a limit cannot be negative")
+		}
+	}
+	return nil
+}
+
+// GetDataSourceLimits returns the limits of a data source, any user of the data source can read them.
+func (s *Store) GetDataSourceLimits(currentUsername, dsName string) (Limits, error) {
+	query := `
+	WITH currentuser AS (
+        SELECT id, name, isadmin
+        FROM user
+        WHERE name = ?
+    )
+	SELECT ds.query_timeout, ds.copy_timeout, ds.max_resultset_length, ds.max_copy_rows
+	FROM ds
+	INNER JOIN currentuser ON currentuser.isadmin = 1
+		OR EXISTS (SELECT 1 FROM user_ds WHERE user_ds.ds_id = ds.id AND user_ds.user_id = currentuser.id)
+	WHERE ds.name = ?
+	`
+	var l Limits
+	err := s.DB.QueryRow(query, currentUsername, dsName).Scan(&l.QueryTimeout, &l.CopyTimeout, &l.MaxResultsetLength, &l.MaxCopyRows)
+	if err == sql.ErrNoRows {
+		return l, fmt.Errorf("data source %q not found or not allowed", dsName)
+	}
+	return l, err
+}
+
+// SetDataSourceLimits replaces the limits of a data source.
+func (s *Store) SetDataSourceLimits(currentUsername, dsName string, l Limits) error {
+	if err := l.validate(); err != nil {
+		return err
+	}
+	query := `
+	WITH currentuser AS (
+        SELECT name, isadmin
+        FROM user
+        WHERE name = ?
+    )
+	UPDATE ds
+	SET query_timeout = ?, copy_timeout = ?, max_resultset_length = ?, max_copy_rows = ?
+	WHERE name = ? AND (SELECT isadmin FROM currentuser) = 1
+	`
+	result, err := s.DB.Exec(query, currentUsername, l.QueryTimeout, l.CopyTimeout, l.MaxResultsetLength, l.MaxCopyRows, dsName)
+	return requireRowsAffected(result, err, "data source "+dsName)
+}
+
+// GetUserLimits returns the limits of a user, a user can read his own limits.
+func (s *Store) GetUserLimits(currentUsername, username string) (Limits, error) {
+	query := `
+	WITH currentuser AS (
+        SELECT name, isadmin
+        FROM user
+        WHERE name = ?
+    )
+	SELECT user.query_timeout, user.copy_timeout, user.max_resultset_length, user.max_copy_rows
+	FROM user
+	INNER JOIN currentuser ON user.name = currentuser.name OR currentuser.isadmin = 1
+	WHERE user.name = ?
+	`
+	var l Limits
+	err := s.DB.QueryRow(query, currentUsername, username).Scan(&l.QueryTimeout, &l.CopyTimeout, &l.MaxResultsetLength, &l.MaxCopyRows)
+	if err == sql.ErrNoRows {
+		return l, fmt.Errorf("user %q not found or not allowed", username)
+	}
+	return l, err
+}
+
+// SetUserLimits replaces the limits of a user.
+func (s *Store) SetUserLimits(currentUsername, username string, l Limits) error {
+	if err := l.validate(); err != nil {
+		return err
+	}
+	query := `
+	WITH currentuser AS (
+        SELECT name, isadmin
+        FROM user
+        WHERE name = ?
+    )
+	UPDATE user
+	SET query_timeout = ?, copy_timeout = ?, max_resultset_length = ?, max_copy_rows = ?
+	WHERE name = ? AND (SELECT isadmin FROM currentuser) = 1
+	`
+	result, err := s.DB.Exec(query, currentUsername, l.QueryTimeout, l.CopyTimeout, l.MaxResultsetLength, l.MaxCopyRows, username)
+	return requireRowsAffected(result, err, "user "+username)
+}
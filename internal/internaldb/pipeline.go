@@ -0,0 +1,291 @@
+package internaldb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Pipeline is a saved pipeline. Definition is a json pipeline definition.
+type Pipeline struct {
+	Name       string `json:"name"`
+	Owner      string `json:"owner"`
+	Definition string `json:"definition"`
+	CreatedAt  string `json:"createdAt"`
+	UpdatedAt  string `json:"updatedAt"`
+}
+
+// PipelineRun is a run of a pipeline, with its steps when fetched by GetPipelineRun.
+type PipelineRun struct {
+	ID        int64             `json:"id"`
+	Pipeline  string            `json:"pipeline"`
+	Status    string            `json:"status"` // "running", "succeeded" or "failed"
+	StartedAt string            `json:"startedAt"`
+	EndedAt   string            `json:"endedAt"`
+	Steps     []PipelineStepRun `json:"steps,omitempty"`
+}
+
+// PipelineStepRun is an execution of a pipeline step. A resumed run has several executions of its failed steps.
+type PipelineStepRun struct {
+	ID        int64  `json:"id"`
+	Step      string `json:"step"`
+	Status    string `json:"status"` // "running", "succeeded", "failed" or "skipped"
+	StartedAt string `json:"startedAt"`
+	EndedAt   string `json:"endedAt"`
+	Rows      int64  `json:"rows"`
+	Error     string `json:"error"`
+}
+
+const pipelineBaseQuery = `
+    WITH currentuser AS (
+        SELECT id, name, isadmin
+        FROM user
+        WHERE name = ?
+    )
+    SELECT pipeline.name, owner.name, pipeline.definition, pipeline.created_at, pipeline.updated_at
+    FROM pipeline
+    INNER JOIN user owner ON owner.id = pipeline.owner_id
+    INNER JOIN currentuser ON currentuser.isadmin = 1 OR currentuser.id = pipeline.owner_id
+`
+
+// Fetch pipelines owned by the current user.
+func (s *Store) GetAllUserPipelines(currentUsername string) ([]Pipeline, error) {
+	rows, err := s.DB.Query(pipelineBaseQuery+` ORDER BY 1`, currentUsername)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []Pipeline
+	for rows.Next() {
+		var p Pipeline
+		if err := rows.Scan(&p.Name, &p.Owner, &p.Definition, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Get a pipeline by its name, if owned by the current user.
+func (s *Store) GetUserPipeline(currentUsername, name string) (Pipeline, error) {
+	var p Pipeline
+	err := s.DB.QueryRow(pipelineBaseQuery+` WHERE pipeline.name = ?`, currentUsername, name).
+		Scan(&p.Name, &p.Owner, &p.Definition, &p.CreatedAt, &p.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, fmt.Errorf("pipeline %q not found or not allowed for user %q", name, currentUsername)
+	}
+	return p, err
+}
+
+// Create a pipeline owned by the current user.
+func (s *Store) CreatePipeline(currentUsername, name, definition string) error {
+	query := `
+	INSERT INTO pipeline (name, owner_id, definition, created_at, updated_at)
+	SELECT ?, user.id, ?, ?, ?
+	FROM user
+	WHERE user.name = ?
+	`
+	now := time.Now().UTC().Format(time.RFC3339)
+	result, err := s.DB.Exec(query, name, definition, now, now, currentUsername)
+	return requireRowsAffected(result, err, fmt.Sprintf("user %q", currentUsername))
+}
+
+// Update a pipeline definition. Only its owner or an admin can.
+func (s *Store) UpdatePipeline(currentUsername, name, definition string) error {
+	query := `
+	WITH currentuser AS (
+        SELECT id, isadmin
+        FROM user
+        WHERE name = ?
+    )
+	UPDATE pipeline SET definition = ?, updated_at = ?
+	WHERE name = ?
+	AND EXISTS (SELECT 1 FROM currentuser WHERE currentuser.isadmin = 1 OR currentuser.id = pipeline.owner_id)
+	`
+	result, err := s.DB.Exec(query, currentUsername, definition, time.Now().UTC().Format(time.RFC3339), name)
+	return requireRowsAffected(result, err, fmt.Sprintf("pipeline %q", name))
+}
+
+// Delete a pipeline and its run history. Only its owner or an admin can.
+func (s *Store) DeletePipeline(currentUsername, name string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	allowed := `
+	    SELECT pipeline.id FROM pipeline
+	    INNER JOIN user ON user.name = ? AND (user.isadmin = 1 OR user.id = pipeline.owner_id)
+	    WHERE pipeline.name = ?
+	`
+	if _, err = tx.Exec(`
+	DELETE FROM pipeline_step_run WHERE pipeline_run_id IN (
+	    SELECT id FROM pipeline_run WHERE pipeline_id IN (`+allowed+`)
+	)`, currentUsername, name); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`DELETE FROM pipeline_run WHERE pipeline_id IN (`+allowed+`)`, currentUsername, name); err != nil {
+		return err
+	}
+	result, err := tx.Exec(`DELETE FROM pipeline WHERE id IN (`+allowed+`)`, currentUsername, name)
+	if err = requireRowsAffected(result, err, fmt.Sprintf("pipeline %q", name)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Record the start of a pipeline run. No access control.
+func (s *Store) CreatePipelineRun(name string) (int64, error) {
+	result, err := s.DB.Exec(`
+	INSERT INTO pipeline_run (pipeline_id, status, started_at)
+	SELECT id, 'running', ? FROM pipeline WHERE name = ?
+	`, time.Now().UTC().Format(time.RFC3339), name)
+	if err = requireRowsAffected(result, err, fmt.Sprintf("pipeline %q", name)); err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// Set the status of a pipeline run, "running" when it is resumed. No access control.
+func (s *Store) SetPipelineRunStatus(id int64, status string) error {
+	var endedAt any
+	if status != "running" {
+		endedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	result, err := s.DB.Exec(`UPDATE pipeline_run SET status = ?, ended_at = ? WHERE id = ?`, status, endedAt, id)
+	return requireRowsAffected(result, err, fmt.Sprintf("pipeline run %d", id))
+}
+
+// Mark the runs and steps left running, by a server stop, as failed. No access control.
+func (s *Store) FailRunningPipelineRuns() error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := s.DB.Exec(`UPDATE pipeline_step_run SET status = 'failed', ended_at = ?, error = 'interrupted'
+	WHERE status = 'running'`, now); err != nil {
+		return err
+	}
+	_, err := s.DB.Exec(`UPDATE pipeline_run SET status = 'failed', ended_at = ? WHERE status = 'running'`, now)
+	return err
+}
+
+// Record the start of a step execution, or a skipped step. No access control.
+func (s *Store) CreatePipelineStepRun(runID int64, step, status string) (int64, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	var endedAt any
+	if status != "running" {
+		endedAt = now
+	}
+	result, err := s.DB.Exec(`
+	INSERT INTO pipeline_step_run (pipeline_run_id, step, status, started_at, ended_at)
+	VALUES (?, ?, ?, ?, ?)
+	`, runID, step, status, now, endedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// Record the end of a step execution. No access control.
+func (s *Store) EndPipelineStepRun(id int64, rows int64, stepErr error) error {
+	status, errText := "succeeded", ""
+	if stepErr != nil {
+		status, errText = "failed", stepErr.Error()
+	}
+	_, err := s.DB.Exec(`UPDATE pipeline_step_run SET status = ?, ended_at = ?, rows = ?, error = ? WHERE id = ?`,
+		status, time.Now().UTC().Format(time.RFC3339), rows, errText, id)
+	return err
+}
+
+// Fetch the names of the steps that succeeded in a run, which a resumed run skips. No access control.
+func (s *Store) GetSucceededPipelineSteps(runID int64) ([]string, error) {
+	rows, err := s.DB.Query(`SELECT DISTINCT step FROM pipeline_step_run WHERE pipeline_run_id = ? AND status = 'succeeded'`, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []string
+	for rows.Next() {
+		var step string
+		if err := rows.Scan(&step); err != nil {
+			return nil, err
+		}
+		result = append(result, step)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+const pipelineRunQuery = `
+	SELECT pipeline_run.id, pipeline.name, pipeline_run.status, pipeline_run.started_at, COALESCE(pipeline_run.ended_at, '')
+	FROM pipeline_run
+	INNER JOIN pipeline ON pipeline.id = pipeline_run.pipeline_id
+	WHERE pipeline.name = ?
+`
+
+// Fetch the last runs of a pipeline, most recent first, without their steps.
+func (s *Store) GetPipelineRuns(currentUsername, name string, limit int) ([]PipelineRun, error) {
+	if _, err := s.GetUserPipeline(currentUsername, name); err != nil {
+		return nil, err
+	}
+	rows, err := s.DB.Query(pipelineRunQuery+` ORDER BY pipeline_run.id DESC LIMIT ?`, name, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []PipelineRun
+	for rows.Next() {
+		var run PipelineRun
+		if err := rows.Scan(&run.ID, &run.Pipeline, &run.Status, &run.StartedAt, &run.EndedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Get a run of a pipeline with its step executions, in execution order.
+func (s *Store) GetPipelineRun(currentUsername, name string, id int64) (PipelineRun, error) {
+	var run PipelineRun
+	if _, err := s.GetUserPipeline(currentUsername, name); err != nil {
+		return run, err
+	}
+	err := s.DB.QueryRow(pipelineRunQuery+` AND pipeline_run.id = ?`, name, id).
+		Scan(&run.ID, &run.Pipeline, &run.Status, &run.StartedAt, &run.EndedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return run, fmt.Errorf("run %d of pipeline %q not found", id, name)
+	}
+	if err != nil {
+		return run, err
+	}
+
+	rows, err := s.DB.Query(`
+	SELECT id, step, status, started_at, COALESCE(ended_at, ''), rows, error
+	FROM pipeline_step_run
+	WHERE pipeline_run_id = ?
+	ORDER BY id`, id)
+	if err != nil {
+		return run, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var step PipelineStepRun
+		if err := rows.Scan(&step.ID, &step.Step, &step.Status, &step.StartedAt, &step.EndedAt, &step.Rows, &step.Error); err != nil {
+			return run, err
+		}
+		run.Steps = append(run.Steps, step)
+	}
+	return run, rows.Err()
+}
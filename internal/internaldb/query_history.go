@@ -0,0 +1,136 @@
+package internaldb
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// QueryHistoryEntry is an execution of a SQL editor query.
+type QueryHistoryEntry struct {
+	ID           int64  `json:"id"`
+	Username     string `json:"username"`
+	DSName       string `json:"dsName"`
+	Schema       string `json:"schema"`
+	Query        string `json:"query"`
+	Params       string `json:"params,omitempty"` // json object of the parameter values
+	Explain      bool   `json:"explain"`
+	StmtCmd      string `json:"stmtCmd"` // commands of the statements, comma separated
+	StartedAt    string `json:"startedAt"`
+	Duration     int64  `json:"duration"` // nanoseconds
+	RowsReturned int64  `json:"rowsReturned"`
+	RowsAffected int64  `json:"rowsAffected"`
+	Error        string `json:"error"`
+}
+
+// QueryHistoryFilter selects history entries, an empty field selects all.
+type QueryHistoryFilter struct {
+	Username string // user of the entries, only an admin can read the history of another user
+	Text     string // contained in the query, case insensitive
+	DSName   string
+	From     string // RFC 3339 UTC time or date, included
+	To       string // RFC 3339 UTC time or date, excluded
+	Limit    int
+	Offset   int
+}
+
+const queryHistoryBaseQuery = `
+    WITH currentuser AS (
+        SELECT name, isadmin
+        FROM user
+        WHERE name = ?
+    )
+    SELECT query_history.id, user.name, query_history.ds_name, query_history.schema, query_history.query,
+        query_history.params, query_history.explain, query_history.stmt_cmd, query_history.started_at,
+        query_history.duration, query_history.rows_returned, query_history.rows_affected, query_history.error
+    FROM query_history
+    INNER JOIN user ON user.id = query_history.user_id
+    INNER JOIN currentuser ON user.name = currentuser.name OR currentuser.isadmin = 1
+    WHERE `
+
+func scanQueryHistory(rows *sql.Rows) ([]QueryHistoryEntry, error) {
+	defer rows.Close()
+	result := []QueryHistoryEntry{}
+	for rows.Next() {
+		var e QueryHistoryEntry
+		if err := rows.Scan(&e.ID, &e.Username, &e.DSName, &e.Schema, &e.Query, &e.Params, &e.Explain, &e.StmtCmd,
+			&e.StartedAt, &e.Duration, &e.RowsReturned, &e.RowsAffected, &e.Error); err != nil {
+			return nil, err
+		}
+		result = append(result, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Record a query execution of e.Username. No access control.
+func (s *Store) CreateQueryHistoryEntry(e QueryHistoryEntry) (int64, error) {
+	result, err := s.DB.Exec(`
+	INSERT INTO query_history (user_id, ds_name, schema, query, params, explain, stmt_cmd, started_at, duration, rows_returned, rows_affected, error)
+	SELECT id, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? FROM user WHERE name = ?
+	`, e.DSName, e.Schema, e.Query, e.Params, e.Explain, e.StmtCmd, e.StartedAt, e.Duration, e.RowsReturned, e.RowsAffected, e.Error, e.Username)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// Fetch the history entries selected by f, most recent first. The history of the current user by default.
+func (s *Store) GetQueryHistory(currentUsername string, f QueryHistoryFilter) ([]QueryHistoryEntry, error) {
+	if f.Username == "" {
+		f.Username = currentUsername
+	}
+	query := queryHistoryBaseQuery + ` user.name = ?`
+	args := []any{currentUsername, f.Username}
+	if f.Text != "" {
+		query += ` AND instr(lower(query_history.query), lower(?)) > 0`
+		args = append(args, f.Text)
+	}
+	if f.DSName != "" {
+		query += ` AND query_history.ds_name = ?`
+		args = append(args, f.DSName)
+	}
+	if f.From != "" {
+		query += ` AND query_history.started_at >= ?`
+		args = append(args, f.From)
+	}
+	if f.To != "" {
+		query += ` AND query_history.started_at < ?`
+		args = append(args, f.To)
+	}
+	query += ` ORDER BY query_history.id DESC LIMIT ? OFFSET ?`
+	args = append(args, f.Limit, f.Offset)
+
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanQueryHistory(rows)
+}
+
+// Fetch a history entry by its id.
+func (s *Store) GetQueryHistoryEntry(currentUsername string, id int64) (QueryHistoryEntry, error) {
+	rows, err := s.DB.Query(queryHistoryBaseQuery+` query_history.id = ?`, currentUsername, id)
+	if err != nil {
+		return QueryHistoryEntry{}, err
+	}
+	entries, err := scanQueryHistory(rows)
+	if err != nil {
+		return QueryHistoryEntry{}, err
+	}
+	if len(entries) == 0 {
+		return QueryHistoryEntry{}, fmt.Errorf("query history entry %d not found or not allowed", id)
+	}
+	return entries[0], nil
+}
+
+// Delete the history entries started before a time, for the retention policy. No access control.
+func (s *Store) PurgeQueryHistory(before time.Time) (int64, error) {
+	result, err := s.DB.Exec(`DELETE FROM query_history WHERE started_at < ?`, before.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,223 @@
+package internaldb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SavedQuery is a named SQL editor query, in a folder of its owner.
+// It applies to a data source (DSName), to the data sources of a vendor (Vendor) or to any data source when both are empty.
+// Params is a json array of the declared parameters. A query shared with its data source (SharedWithDS)
+// can be read and run by all the users of the data source.
+type SavedQuery struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Folder       string `json:"folder"`
+	Owner        string `json:"owner"`
+	DSName       string `json:"dsName"`
+	Vendor       string `json:"vendor"`
+	Query        string `json:"query"`
+	Params       string `json:"params"`
+	SharedWithDS bool   `json:"sharedWithDS"`
+	CreatedAt    string `json:"createdAt"`
+	UpdatedAt    string `json:"updatedAt"`
+}
+
+// SavedQueryFilter selects saved queries, an empty field selects all.
+type SavedQueryFilter struct {
+	Folder string
+	DSName string // queries of the data source, of its vendor or of any data source
+}
+
+const savedQueryBaseQuery = `
+    WITH currentuser AS (
+        SELECT id, name, isadmin
+        FROM user
+        WHERE name = ?
+    )
+    SELECT saved_query.id, saved_query.name, saved_query.folder, owner.name, saved_query.ds_name, saved_query.vendor,
+        saved_query.query, saved_query.params, saved_query.shared_with_ds, saved_query.created_at, saved_query.updated_at
+    FROM saved_query
+    INNER JOIN user owner ON owner.id = saved_query.owner_id
+    INNER JOIN currentuser ON currentuser.isadmin = 1
+        OR currentuser.id = saved_query.owner_id
+        OR EXISTS (
+            SELECT 1 FROM user_saved_query
+            WHERE user_saved_query.saved_query_id = saved_query.id AND user_saved_query.user_id = currentuser.id
+        )
+        OR saved_query.shared_with_ds = 1 AND EXISTS (
+            SELECT 1 FROM user_ds
+            INNER JOIN ds ON ds.id = user_ds.ds_id
+            WHERE ds.name = saved_query.ds_name AND user_ds.user_id = currentuser.id
+        )
+    WHERE `
+
+func scanSavedQueries(rows *sql.Rows) ([]SavedQuery, error) {
+	defer rows.Close()
+	result := []SavedQuery{}
+	for rows.Next() {
+		var q SavedQuery
+		if err := rows.Scan(&q.ID, &q.Name, &q.Folder, &q.Owner, &q.DSName, &q.Vendor,
+			&q.Query, &q.Params, &q.SharedWithDS, &q.CreatedAt, &q.UpdatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Fetch the saved queries owned by or shared with the current user, by folder and name.
+func (s *Store) GetAllUserSavedQueries(currentUsername string, f SavedQueryFilter) ([]SavedQuery, error) {
+	query := savedQueryBaseQuery + ` 1 = 1`
+	args := []any{currentUsername}
+	if f.Folder != "" {
+		query += ` AND saved_query.folder = ?`
+		args = append(args, f.Folder)
+	}
+	if f.DSName != "" {
+		query += ` AND (saved_query.ds_name = ? OR saved_query.ds_name = '' AND saved_query.vendor IN ('', (
+			SELECT vendor.name FROM ds INNER JOIN vendor ON vendor.id = ds.vendor_id WHERE ds.name = ?
+		)))`
+		args = append(args, f.DSName, f.DSName)
+	}
+	query += ` ORDER BY saved_query.folder, saved_query.name, owner.name`
+
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanSavedQueries(rows)
+}
+
+// Get a saved query by its id, if owned by or shared with the current user.
+func (s *Store) GetUserSavedQuery(currentUsername string, id int64) (SavedQuery, error) {
+	rows, err := s.DB.Query(savedQueryBaseQuery+` saved_query.id = ?`, currentUsername, id)
+	if err != nil {
+		return SavedQuery{}, err
+	}
+	queries, err := scanSavedQueries(rows)
+	if err != nil {
+		return SavedQuery{}, err
+	}
+	if len(queries) == 0 {
+		return SavedQuery{}, fmt.Errorf("saved query %d not found or not allowed for user %q", id, currentUsername)
+	}
+	return queries[0], nil
+}
+
+// Create a saved query owned by the current user and return its id.
+// A data source the current user cannot use is refused.
+func (s *Store) CreateSavedQuery(currentUsername string, q SavedQuery) (int64, error) {
+	if err := s.requireSavedQueryDataSource(currentUsername, q.DSName); err != nil {
+		return 0, err
+	}
+	query := `
+	INSERT INTO saved_query (name, folder, owner_id, ds_name, vendor, query, params, shared_with_ds, created_at, updated_at)
+	SELECT ?, ?, user.id, ?, ?, ?, ?, ?, ?, ?
+	FROM user
+	WHERE user.name = ?
+	`
+	now := time.Now().UTC().Format(time.RFC3339)
+	result, err := s.DB.Exec(query, q.Name, q.Folder, q.DSName, q.Vendor, q.Query, q.Params, q.SharedWithDS, now, now, currentUsername)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// Update a saved query, its owner is unchanged. Only its owner or an admin can.
+func (s *Store) UpdateSavedQuery(currentUsername string, q SavedQuery) error {
+	if err := s.requireSavedQueryDataSource(currentUsername, q.DSName); err != nil {
+		return err
+	}
+	query := `
+	WITH currentuser AS (
+        SELECT id, isadmin
+        FROM user
+        WHERE name = ?
+    )
+	UPDATE saved_query
+	SET name = ?, folder = ?, ds_name = ?, vendor = ?, query = ?, params = ?, shared_with_ds = ?, updated_at = ?
+	WHERE id = ?
+	AND (owner_id = (SELECT id FROM currentuser) OR (SELECT isadmin FROM currentuser) = 1)
+	`
+	result, err := s.DB.Exec(query, currentUsername, q.Name, q.Folder, q.DSName, q.Vendor, q.Query, q.Params, q.SharedWithDS,
+		time.Now().UTC().Format(time.RFC3339), q.ID)
+	return requireRowsAffected(result, err, fmt.Sprintf("saved query %d", q.ID))
+}
+
+// requireSavedQueryDataSource checks the current user can use a data source, an empty name is any data source.
+func (s *Store) requireSavedQueryDataSource(currentUsername, dsName string) error {
+	if dsName == "" {
+		return nil
+	}
+	var exists int
+	err := s.DB.QueryRow(`
+	SELECT 1 FROM ds
+	INNER JOIN user ON user.name = ?
+	WHERE ds.name = ? AND (user.isadmin = 1 OR EXISTS (
+	    SELECT 1 FROM user_ds WHERE user_ds.ds_id = ds.id AND user_ds.user_id = user.id
+	))
+	`, currentUsername, dsName).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("data source %q not found or not allowed for user %q", dsName, currentUsername)
+	}
+	return err
+}
+
+// Delete a saved query and its shares. Only its owner or an admin can.
+func (s *Store) DeleteSavedQuery(currentUsername string, id int64) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	allowed := `
+	    SELECT saved_query.id FROM saved_query
+	    INNER JOIN user ON user.name = ?
+	    WHERE saved_query.id = ? AND (saved_query.owner_id = user.id OR user.isadmin = 1)
+	`
+	if _, err = tx.Exec(`DELETE FROM user_saved_query WHERE saved_query_id IN (`+allowed+`)`, currentUsername, id); err != nil {
+		return err
+	}
+	result, err := tx.Exec(`DELETE FROM saved_query WHERE id IN (`+allowed+`)`, currentUsername, id)
+	if err = requireRowsAffected(result, err, fmt.Sprintf("saved query %d", id)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Share a saved query with a user. Only its owner or an admin can.
+func (s *Store) CreateUserSavedQuery(currentUsername, username string, id int64) error {
+	query := `
+	INSERT INTO user_saved_query (user_id, saved_query_id)
+	SELECT user.id, saved_query.id
+	FROM user
+	INNER JOIN saved_query ON saved_query.id = ?
+	INNER JOIN user currentuser ON currentuser.name = ?
+	WHERE user.name = ? AND (saved_query.owner_id = currentuser.id OR currentuser.isadmin = 1)
+	`
+	result, err := s.DB.Exec(query, id, currentUsername, username)
+	return requireRowsAffected(result, err, fmt.Sprintf("saved query %d", id))
+}
+
+// Stop sharing a saved query with a user. Only its owner or an admin can.
+func (s *Store) DeleteUserSavedQuery(currentUsername, username string, id int64) error {
+	query := `
+	DELETE FROM user_saved_query
+	WHERE user_id = (SELECT id FROM user WHERE name = ?)
+	AND saved_query_id IN (
+	    SELECT saved_query.id FROM saved_query
+	    INNER JOIN user currentuser ON currentuser.name = ?
+	    WHERE saved_query.id = ? AND (saved_query.owner_id = currentuser.id OR currentuser.isadmin = 1)
+	)
+	`
+	_, err := s.DB.Exec(query, username, currentUsername, id)
+	return err
+}
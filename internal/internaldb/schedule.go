@@ -0,0 +1,217 @@
+package internaldb
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Schedule runs a copy job or a SQL script as a designated user, according to a cron expression.
+type Schedule struct {
+	Name       string `json:"name"`
+	Cron       string `json:"cron"`
+	Kind       string `json:"kind"`              // "copy-job" or "sql"
+	CopyJob    string `json:"copyJob,omitempty"` // copy job name (for "copy-job")
+	DSName     string `json:"dsName,omitempty"`  // data source name (for "sql")
+	Script     string `json:"script,omitempty"`  // SQL script (for "sql")
+	RunAs      string `json:"runAs"`
+	Enabled    int    `json:"enabled"`
+	MaxRetries int    `json:"maxRetries"`
+	RetryDelay int    `json:"retryDelay"` // seconds, doubled at each retry
+}
+
+// ScheduleRun is an attempt of a schedule run.
+type ScheduleRun struct {
+	ID        int64  `json:"id"`
+	Schedule  string `json:"schedule"`
+	Trigger   string `json:"trigger"` // "cron" or "manual"
+	Attempt   int    `json:"attempt"`
+	StartedAt string `json:"startedAt"`
+	EndedAt   string `json:"endedAt"`
+	Rows      int64  `json:"rows"`
+	Error     string `json:"error"`
+}
+
+const scheduleBaseQuery = `
+    WITH currentuser AS (
+        SELECT id, name, isadmin
+        FROM user
+        WHERE name = ?
+    )
+    SELECT schedule.name, schedule.cron, schedule.kind, schedule.copy_job, schedule.ds_name, schedule.script,
+        runas.name, schedule.enabled, schedule.max_retries, schedule.retry_delay
+    FROM schedule
+    INNER JOIN user runas ON runas.id = schedule.run_as_id
+    INNER JOIN currentuser ON currentuser.isadmin = 1 OR currentuser.id = schedule.run_as_id
+`
+
+func scanSchedules(rows *sql.Rows) ([]Schedule, error) {
+	defer rows.Close()
+	var result []Schedule
+	for rows.Next() {
+		var sch Schedule
+		if err := rows.Scan(&sch.Name, &sch.Cron, &sch.Kind, &sch.CopyJob, &sch.DSName, &sch.Script,
+			&sch.RunAs, &sch.Enabled, &sch.MaxRetries, &sch.RetryDelay); err != nil {
+			return nil, err
+		}
+		result = append(result, sch)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Fetch schedules. Admins see all schedules, other users the schedules run as themselves.
+func (s *Store) GetAllUserSchedules(currentUsername string) ([]Schedule, error) {
+	rows, err := s.DB.Query(scheduleBaseQuery+` ORDER BY 1`, currentUsername)
+	if err != nil {
+		return nil, err
+	}
+	return scanSchedules(rows)
+}
+
+// Get a schedule by its name.
+func (s *Store) GetUserSchedule(currentUsername, name string) (Schedule, error) {
+	rows, err := s.DB.Query(scheduleBaseQuery+` WHERE schedule.name = ?`, currentUsername, name)
+	if err != nil {
+		return Schedule{}, err
+	}
+	result, err := scanSchedules(rows)
+	if err != nil {
+		return Schedule{}, err
+	}
+	if len(result) == 0 {
+		return Schedule{}, fmt.Errorf("schedule %q not found or not allowed for user %q", name, currentUsername)
+	}
+	return result[0], nil
+}
+
+// Fetch enabled schedules, for the scheduler. No access control.
+func (s *Store) GetEnabledSchedules() ([]Schedule, error) {
+	rows, err := s.DB.Query(`
+	SELECT schedule.name, schedule.cron, schedule.kind, schedule.copy_job, schedule.ds_name, schedule.script,
+		runas.name, schedule.enabled, schedule.max_retries, schedule.retry_delay
+	FROM schedule
+	INNER JOIN user runas ON runas.id = schedule.run_as_id
+	WHERE schedule.enabled = 1
+	ORDER BY 1`)
+	if err != nil {
+		return nil, err
+	}
+	return scanSchedules(rows)
+}
+
+// Create a schedule. Only admins can.
+func (s *Store) CreateSchedule(currentUsername string, sch Schedule) error {
+	query := `
+	WITH currentuser AS (
+        SELECT name, isadmin
+        FROM user
+        WHERE name = ?
+    )
+	INSERT INTO schedule (name, cron, kind, copy_job, ds_name, script, run_as_id, enabled, max_retries, retry_delay)
+	SELECT ?, ?, ?, ?, ?, ?, runas.id, ?, ?, ?
+	FROM user runas
+	INNER JOIN currentuser ON currentuser.isadmin = 1
+	WHERE runas.name = ?
+	`
+	result, err := s.DB.Exec(query, currentUsername, sch.Name, sch.Cron, sch.Kind, sch.CopyJob, sch.DSName, sch.Script,
+		sch.Enabled, sch.MaxRetries, sch.RetryDelay, sch.RunAs)
+	return requireRowsAffected(result, err, fmt.Sprintf("schedule %q or run as user %q", sch.Name, sch.RunAs))
+}
+
+// Update a schedule. Only admins can.
+func (s *Store) UpdateSchedule(currentUsername string, sch Schedule) error {
+	query := `
+	WITH currentuser AS (
+        SELECT name, isadmin
+        FROM user
+        WHERE name = ?
+    )
+	UPDATE schedule SET cron = ?, kind = ?, copy_job = ?, ds_name = ?, script = ?,
+		run_as_id = (SELECT id FROM user WHERE name = ?), enabled = ?, max_retries = ?, retry_delay = ?
+	WHERE name = ? AND (SELECT isadmin FROM currentuser) = 1
+	`
+	result, err := s.DB.Exec(query, currentUsername, sch.Cron, sch.Kind, sch.CopyJob, sch.DSName, sch.Script,
+		sch.RunAs, sch.Enabled, sch.MaxRetries, sch.RetryDelay, sch.Name)
+	return requireRowsAffected(result, err, fmt.Sprintf("schedule %q or run as user %q", sch.Name, sch.RunAs))
+}
+
+// Delete a schedule and its run history. Only admins can.
+func (s *Store) DeleteSchedule(currentUsername, name string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	allowed := `
+	    SELECT schedule.id FROM schedule
+	    INNER JOIN user ON user.name = ? AND user.isadmin = 1
+	    WHERE schedule.name = ?
+	`
+	if _, err = tx.Exec(`DELETE FROM schedule_run WHERE schedule_id IN (`+allowed+`)`, currentUsername, name); err != nil {
+		return err
+	}
+	result, err := tx.Exec(`DELETE FROM schedule WHERE id IN (`+allowed+`)`, currentUsername, name)
+	if err = requireRowsAffected(result, err, fmt.Sprintf("schedule %q", name)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Record the start of a schedule run attempt. No access control.
+func (s *Store) CreateScheduleRun(name, trigger string, attempt int) (int64, error) {
+	result, err := s.DB.Exec(`
+	INSERT INTO schedule_run (schedule_id, trigger, attempt, started_at)
+	SELECT id, ?, ?, ? FROM schedule WHERE name = ?
+	`, trigger, attempt, time.Now().UTC().Format(time.RFC3339), name)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// Record the end of a schedule run attempt. No access control.
+func (s *Store) EndScheduleRun(id int64, rows int64, runErr error) error {
+	errText := ""
+	if runErr != nil {
+		errText = runErr.Error()
+	}
+	_, err := s.DB.Exec(`UPDATE schedule_run SET ended_at = ?, rows = ?, error = ? WHERE id = ?`,
+		time.Now().UTC().Format(time.RFC3339), rows, errText, id)
+	return err
+}
+
+// Fetch the last runs of a schedule, most recent first.
+func (s *Store) GetScheduleRuns(currentUsername, name string, limit int) ([]ScheduleRun, error) {
+	if _, err := s.GetUserSchedule(currentUsername, name); err != nil {
+		return nil, err
+	}
+	rows, err := s.DB.Query(`
+	SELECT schedule_run.id, schedule.name, schedule_run.trigger, schedule_run.attempt,
+		schedule_run.started_at, COALESCE(schedule_run.ended_at, ''), schedule_run.rows, schedule_run.error
+	FROM schedule_run
+	INNER JOIN schedule ON schedule.id = schedule_run.schedule_id
+	WHERE schedule.name = ?
+	ORDER BY schedule_run.id DESC
+	LIMIT ?`, name, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []ScheduleRun
+	for rows.Next() {
+		var run ScheduleRun
+		if err := rows.Scan(&run.ID, &run.Schedule, &run.Trigger, &run.Attempt, &run.StartedAt, &run.EndedAt, &run.Rows, &run.Error); err != nil {
+			return nil, err
+		}
+		result = append(result, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
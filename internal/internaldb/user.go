@@ -80,8 +80,8 @@ func (s *Store) CreateUser(currentUsername, username string, isAdmin int, passwo
 		return err
 	}
 
-	_, err = s.DB.Exec(query, currentUsername, username, isAdmin, string(pwdHash))
-	return err
+	result, err := s.DB.Exec(query, currentUsername, username, isAdmin, string(pwdHash))
+	return requireRowsAffected(result, err, "current user "+currentUsername)
 }
 
 // checks if the provided username and password match the stored credentials.
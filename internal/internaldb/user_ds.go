@@ -2,6 +2,26 @@ package internaldb
 
 import "fmt"
 
+// Permission levels of a user data source, from the lowest. Each level allows the statements of the lower ones.
+const (
+	PermissionReadOnly  = "read-only"  // queries
+	PermissionReadWrite = "read-write" // data modifications and procedure calls
+	PermissionDDL       = "ddl"        // schema changes
+	PermissionAdmin     = "admin"      // grants and server administration
+)
+
+var permissionRanks = map[string]int{PermissionReadOnly: 1, PermissionReadWrite: 2, PermissionDDL: 3, PermissionAdmin: 4}
+
+// ValidPermission reports whether permission is a permission level.
+func ValidPermission(permission string) bool {
+	return permissionRanks[permission] > 0
+}
+
+// PermissionAllows reports whether the permission level includes the needed level.
+func PermissionAllows(permission, needed string) bool {
+	return ValidPermission(needed) && permissionRanks[permission] >= permissionRanks[needed]
+}
+
 const dsBaseQuery = `
     WITH currentuser AS (
         SELECT name, isadmin
@@ -15,7 +35,8 @@ const dsBaseQuery = `
             WHEN currentuser.isadmin = 1 OR vendor.name = 'sqlite3'
                 THEN ds.location
 			ELSE ''
-        END AS location
+        END AS location,
+        user_ds.permission
     FROM  user 
     INNER JOIN user_ds ON user_ds.user_id = user.id
     INNER JOIN ds ON ds.id = user_ds.ds_id
@@ -39,7 +60,7 @@ func (s *Store) RequireUserDataSource(currentUsername, username, dsName string)
 func (s *Store) GetUserDataSource(currentUsername, username, dsName string) (DataSource, error) {
 	query := dsBaseQuery + ` user.name = ? AND ds.name = ?`
 	var result DataSource
-	err := s.DB.QueryRow(query, currentUsername, username, dsName).Scan(&result.Name, &result.Vendor, &result.Location)
+	err := s.DB.QueryRow(query, currentUsername, username, dsName).Scan(&result.Name, &result.Vendor, &result.Location, &result.Permission)
 	return result, err
 }
 
@@ -56,7 +77,7 @@ func (s *Store) GetAllUserDataSources(currentUsername, username string) ([]DataS
 	var result []DataSource
 	for rows.Next() {
 		var ds DataSource
-		if err := rows.Scan(&ds.Name, &ds.Vendor, &ds.Location); err != nil {
+		if err := rows.Scan(&ds.Name, &ds.Vendor, &ds.Location, &ds.Permission); err != nil {
 			return nil, err
 		}
 		result = append(result, ds)
@@ -109,23 +130,28 @@ func (s *Store) GetAllUserAvailableDataSources(currentUsername, username string)
 	return result, nil
 }
 
-func (s *Store) CreateUserDataSource(currentUsername, username, dsName string) error {
+// CreateUserDataSource grants a data source to a user with a permission level, or changes the level of a granted one.
+func (s *Store) CreateUserDataSource(currentUsername, username, dsName, permission string) error {
+	if !ValidPermission(permission) {
+		return fmt.Errorf("invalid permission %q", permission)
+	}
 	query := `
 	WITH currentuser AS (
         SELECT name, isadmin 
         FROM user 
         WHERE name = ?
     )
-	INSERT INTO user_ds (user_id, ds_id)
-	SELECT user.id, ds.id
+	INSERT INTO user_ds (user_id, ds_id, permission)
+	SELECT user.id, ds.id, ?
 	FROM user
 	INNER JOIN ds ON ds.name = ?
 	INNER JOIN currentuser ON currentuser.isadmin = 1
 	WHERE user.name = ?
+	ON CONFLICT (user_id, ds_id) DO UPDATE SET permission = excluded.permission
 	`
 
-	_, err := s.DB.Exec(query, currentUsername, dsName, username)
-	return err
+	result, err := s.DB.Exec(query, currentUsername, permission, dsName, username)
+	return requireRowsAffected(result, err, fmt.Sprintf("data source %q of user %q", dsName, username))
 }
 
 func (s *Store) DeleteUserDataSource(currentUsername, username, dsName string) error {
@@ -140,6 +166,6 @@ func (s *Store) DeleteUserDataSource(currentUsername, username, dsName string) e
 	AND ds_id = (SELECT id FROM ds WHERE name = ?)
 	AND user_id = (SELECT id FROM user WHERE name = ?)
 	`
-	_, err := s.DB.Exec(query, currentUsername, dsName, username)
-	return err
+	result, err := s.DB.Exec(query, currentUsername, dsName, username)
+	return requireRowsAffected(result, err, fmt.Sprintf("data source %q of user %q", dsName, username))
 }
@@ -0,0 +1,112 @@
+// Package pipeline runs multi-step pipelines: a DAG of steps (SQL script, copy job, compare, wait for a condition),
+// recording each step status in the internal DB so that a failed run can be resumed.
+package pipeline
+
+import (
+	"db-portal/internal/copydata"
+	"fmt"
+	"strings"
+)
+
+// Definition is the json definition of a pipeline.
+type Definition struct {
+	Steps []Step `json:"steps"`
+}
+
+// Step is a pipeline step. A step starts once the steps it depends on have succeeded.
+// When DependsOn is nil, the step depends on the previous one: steps run in order.
+// An empty DependsOn ([]) makes a step independent.
+type Step struct {
+	Name      string    `json:"name"`
+	Type      string    `json:"type"` // "sql", "copy", "compare" or "wait"
+	DependsOn []string  `json:"dependsOn,omitempty"`
+	Condition Condition `json:"condition,omitempty"`
+
+	DSName string `json:"dsName,omitempty"` // data source (for "sql" and "wait")
+	Script string `json:"script,omitempty"` // SQL script (for "sql")
+
+	CopyJob string `json:"copyJob,omitempty"` // saved copy job name (for "copy")
+
+	Compare *copydata.CompareRequest `json:"compare,omitempty"` // table or query endpoints (for "compare")
+
+	Query    string `json:"query,omitempty"`    // wait until the first column of its first row is true, not 0 nor empty (for "wait")
+	Interval int    `json:"interval,omitempty"` // seconds between queries, 30 by default (for "wait")
+	Timeout  int    `json:"timeout,omitempty"`  // seconds before the step fails, 3600 by default (for "wait")
+}
+
+// Condition is the success condition of a step, on its rows:
+// rows affected for "sql", rows written for "copy", differences (missing or differing rows) for "compare".
+// Ex: {"maxRows": 0} for a compare step makes it fail if the endpoints differ.
+type Condition struct {
+	MinRows *int64 `json:"minRows,omitempty"`
+	MaxRows *int64 `json:"maxRows,omitempty"`
+}
+
+// Check returns an error if rows do not meet the condition.
+func (c Condition) Check(rows int64) error {
+	if c.MinRows != nil && rows < *c.MinRows {
+		return fmt.Errorf("condition failed: %d rows, minimum is %d", rows, *c.MinRows)
+	}
+	if c.MaxRows != nil && rows > *c.MaxRows {
+		return fmt.Errorf("condition failed: %d rows, maximum is %d", rows, *c.MaxRows)
+	}
+	return nil
+}
+
+// dependencies returns the steps a step depends on.
+func (d Definition) dependencies(i int) []string {
+	if d.Steps[i].DependsOn == nil && i > 0 {
+		return []string{d.Steps[i-1].Name}
+	}
+	return d.Steps[i].DependsOn
+}
+
+// Validate checks step names, types, parameters and dependencies.
+// Steps can only depend on previous steps, so that the steps order is a valid run order.
+func (d Definition) Validate() error {
+	if len(d.Steps) == 0 {
+		return fmt.Errorf("a pipeline needs steps")
+	}
+	seen := map[string]bool{}
+	for i, step := range d.Steps {
+		if strings.TrimSpace(step.Name) == "" {
+			return fmt.Errorf("step %d: name is required", i+1)
+		}
+		if seen[step.Name] {
+			return fmt.Errorf("step %s: duplicate name", step.Name)
+		}
+		for _, dep := range d.dependencies(i) {
+			if !seen[dep] {
+				return fmt.Errorf("step %s: depends on %s which is not a previous step", step.Name, dep)
+			}
+		}
+		seen[step.Name] = true
+
+		switch step.Type {
+		case "sql":
+			if step.DSName == "" || strings.TrimSpace(step.Script) == "" {
+				return fmt.Errorf("step %s: sql step needs a dsName and a script", step.Name)
+			}
+		case "copy":
+			if step.CopyJob == "" {
+				return fmt.Errorf("step %s: copy step needs a copyJob", step.Name)
+			}
+		case "compare":
+			if step.Compare == nil || len(step.Compare.Keys) == 0 {
+				return fmt.Errorf("step %s: compare step needs left and right endpoints and keys", step.Name)
+			}
+			for _, ep := range []copydata.EndPoint{step.Compare.Left, step.Compare.Right} {
+				if ep.Type != "table" && ep.Type != "query" {
+					return fmt.Errorf("step %s: compare endpoints must be tables or queries", step.Name)
+				}
+			}
+		case "wait":
+			if step.DSName == "" || strings.TrimSpace(step.Query) == "" {
+				return fmt.Errorf("step %s: wait step needs a dsName and a query", step.Name)
+			}
+		default:
+			return fmt.Errorf("step %s: unknown type %q", step.Name, step.Type)
+		}
+	}
+	return nil
+}
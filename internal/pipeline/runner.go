@@ -0,0 +1,164 @@
+package pipeline
+
+import (
+	"context"
+	"db-portal/internal/internaldb"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// StepFunc executes a step as a user and returns its rows, see Condition.
+type StepFunc func(ctx context.Context, runAs string, step Step) (rows int64, err error)
+
+// ErrRunning is returned when a pipeline is run or resumed while a run of it is not finished.
+var ErrRunning = errors.New("pipeline is already running")
+
+// Runner runs pipelines in the background, as their owner, one run at a time per pipeline.
+// Steps run in the definition order. A step whose dependencies did not all succeed is skipped,
+// independent steps still run. A resumed run only executes the steps that did not succeed.
+type Runner struct {
+	store   *internaldb.Store
+	exec    StepFunc
+	mu      sync.Mutex
+	running map[string]bool
+	ctx     context.Context
+}
+
+func NewRunner(store *internaldb.Store, exec StepFunc) *Runner {
+	return &Runner{
+		store:   store,
+		exec:    exec,
+		running: map[string]bool{},
+		ctx:     context.Background(),
+	}
+}
+
+// Start sets the context of the runs and marks the runs interrupted by a previous server stop as failed.
+func (r *Runner) Start(ctx context.Context) error {
+	r.ctx = ctx
+	return r.store.FailRunningPipelineRuns()
+}
+
+// Run starts a new run of a pipeline and returns its id.
+func (r *Runner) Run(p internaldb.Pipeline) (int64, error) {
+	def, err := parse(p)
+	if err != nil {
+		return 0, err
+	}
+	if err := r.lock(p.Name); err != nil {
+		return 0, err
+	}
+	runID, err := r.store.CreatePipelineRun(p.Name)
+	if err != nil {
+		r.unlock(p.Name)
+		return 0, err
+	}
+	go r.execute(p, def, runID, nil)
+	return runID, nil
+}
+
+// Resume runs again the steps of a run that did not succeed, with the current pipeline definition.
+func (r *Runner) Resume(p internaldb.Pipeline, run internaldb.PipelineRun) error {
+	if run.Status != "failed" {
+		return fmt.Errorf("only a failed run can be resumed, run %d is %s", run.ID, run.Status)
+	}
+	def, err := parse(p)
+	if err != nil {
+		return err
+	}
+	if err := r.lock(p.Name); err != nil {
+		return err
+	}
+	succeeded, err := r.store.GetSucceededPipelineSteps(run.ID)
+	if err == nil {
+		err = r.store.SetPipelineRunStatus(run.ID, "running")
+	}
+	if err != nil {
+		r.unlock(p.Name)
+		return err
+	}
+	go r.execute(p, def, run.ID, succeeded)
+	return nil
+}
+
+// Running reports whether a pipeline is running.
+func (r *Runner) Running(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.running[name]
+}
+
+func (r *Runner) lock(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running[name] {
+		return ErrRunning
+	}
+	r.running[name] = true
+	return nil
+}
+
+func (r *Runner) unlock(name string) {
+	r.mu.Lock()
+	delete(r.running, name)
+	r.mu.Unlock()
+}
+
+func parse(p internaldb.Pipeline) (def Definition, err error) {
+	if err = json.Unmarshal([]byte(p.Definition), &def); err != nil {
+		return def, fmt.Errorf("invalid pipeline definition. %v", err)
+	}
+	return def, def.Validate()
+}
+
+// execute runs the steps of a run, except the ones that already succeeded, and records their status.
+func (r *Runner) execute(p internaldb.Pipeline, def Definition, runID int64, succeeded []string) {
+	defer r.unlock(p.Name)
+
+	done := map[string]bool{}
+	for _, name := range succeeded {
+		done[name] = true
+	}
+	status := "succeeded"
+	for i, step := range def.Steps {
+		if done[step.Name] {
+			continue
+		}
+		ready := r.ctx.Err() == nil
+		for _, dep := range def.dependencies(i) {
+			ready = ready && done[dep]
+		}
+		if !ready {
+			status = "failed"
+			if _, err := r.store.CreatePipelineStepRun(runID, step.Name, "skipped"); err != nil {
+				log.Printf("pipeline %s: cannot record step %s: %v", p.Name, step.Name, err)
+			}
+			continue
+		}
+
+		id, err := r.store.CreatePipelineStepRun(runID, step.Name, "running")
+		if err != nil {
+			log.Printf("pipeline %s: cannot record step %s: %v", p.Name, step.Name, err)
+		}
+		rows, stepErr := r.exec(r.ctx, p.Owner, step)
+		if stepErr == nil {
+			stepErr = step.Condition.Check(rows)
+		}
+		if stepErr == nil {
+			done[step.Name] = true
+		} else {
+			status = "failed"
+		}
+		if err == nil {
+			if err = r.store.EndPipelineStepRun(id, rows, stepErr); err != nil {
+				log.Printf("pipeline %s: cannot record step %s end: %v", p.Name, step.Name, err)
+			}
+		}
+	}
+	if err := r.store.SetPipelineRunStatus(runID, status); err != nil {
+		log.Printf("pipeline %s: cannot record run end: %v", p.Name, err)
+	}
+}
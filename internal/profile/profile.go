@@ -0,0 +1,329 @@
+// Package profile computes column profiles of a table or query: null and distinct counts, min and max,
+// average length, most frequent values and a histogram. The statistics are computed by the database
+// with vendor-specific SQL, rows are not read by the server.
+package profile
+
+import (
+	"context"
+	"db-portal/internal/dbutil"
+	"db-portal/internal/types"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Profile is the profile of the columns of a table or query.
+type Profile struct {
+	Rows    int64    `json:"rows"`
+	Columns []Column `json:"columns"`
+}
+
+// Column is the profile of a column. Statistics that do not apply to the column type are omitted.
+type Column struct {
+	Name           string   `json:"name"`
+	DatabaseType   string   `json:"databaseType"`
+	Type           string   `json:"type"` // canonical type, see dbutil.CanonicalType
+	Nulls          int64    `json:"nulls"`
+	Distinct       *int64   `json:"distinct,omitempty"`       // distinct non null values
+	DistinctApprox bool     `json:"distinctApprox,omitempty"` // distinct is an estimate of the vendor
+	Min            any      `json:"min,omitempty"`
+	Max            any      `json:"max,omitempty"`
+	AvgLength      *float64 `json:"avgLength,omitempty"` // average character length of the non null values
+	Top            []Value  `json:"top,omitempty"`       // most frequent non null values, most frequent first
+	Histogram      []Bucket `json:"histogram,omitempty"` // equal width buckets of the non null values
+}
+
+// Value is a value of a column and its number of rows.
+type Value struct {
+	Value any   `json:"value"`
+	Count int64 `json:"count"`
+}
+
+// Bucket is a histogram bucket: the rows with a value from Low, included, to High, excluded but for the last bucket.
+// Bounds are numbers, or RFC 3339 times for a date or time column.
+type Bucket struct {
+	Low   any   `json:"low"`
+	High  any   `json:"high"`
+	Count int64 `json:"count"`
+}
+
+// Options are the profile options.
+type Options struct {
+	Top     int  // number of most frequent values, 0 for none
+	Buckets int  // number of histogram buckets, 0 for none
+	Exact   bool // exact distinct counts, even when the vendor can estimate them
+}
+
+// Table returns the profile of a table of the current schema.
+func Table(ctx context.Context, conn dbutil.Querier, dbVendor, table string, opts Options) (*Profile, error) {
+	return run(ctx, conn, dbVendor, dbutil.QuoteIdentifier(dbVendor, table)+" src", opts)
+}
+
+// Query returns the profile of the result set of a query, a single statement, see dbutil.Subquery.
+func Query(ctx context.Context, conn dbutil.Querier, dbVendor, query string, opts Options) (*Profile, error) {
+	query, err := dbutil.Subquery(query, dbVendor)
+	if err != nil {
+		return nil, err
+	}
+	return run(ctx, conn, dbVendor, "("+query+"\n) src", opts)
+}
+
+// run profiles the columns of from, a table or a subquery aliased src:
+// one query for the counts, min, max and lengths of all the columns, then one query by column
+// for its most frequent values and one for its histogram.
+func run(ctx context.Context, conn dbutil.Querier, dbVendor, from string, opts Options) (*Profile, error) {
+	cols, err := columns(ctx, conn, dbVendor, from)
+	if err != nil {
+		return nil, err
+	}
+
+	agg := newAggregate(dbVendor, cols, opts)
+	values, err := queryRow(ctx, conn, "SELECT "+strings.Join(agg.exprs, ", ")+" FROM "+from)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compute column statistics. %v", err)
+	}
+	p := &Profile{Rows: toInt(values[0]), Columns: make([]Column, len(cols))}
+	for i, c := range cols {
+		p.Columns[i] = agg.column(i, p.Rows, values)
+		p.Columns[i].Name, p.Columns[i].DatabaseType, p.Columns[i].Type = c.name, c.databaseType, c.canonical
+	}
+
+	for i, c := range cols {
+		pc := &p.Columns[i]
+		if opts.Top > 0 && c.stats.top && pc.Nulls < p.Rows {
+			if pc.Top, err = top(ctx, conn, dbVendor, from, c, opts.Top); err != nil {
+				return nil, fmt.Errorf("cannot compute the top values of column %s. %v", c.name, err)
+			}
+		}
+		low, high := agg.bounds(i, values)
+		if opts.Buckets > 0 && low != nil && high != nil {
+			if pc.Histogram, err = histogram(ctx, conn, dbVendor, from, c, *low, *high, p.Rows-pc.Nulls, opts.Buckets); err != nil {
+				return nil, fmt.Errorf("cannot compute the histogram of column %s. %v", c.name, err)
+			}
+		}
+	}
+	return p, nil
+}
+
+// column is a column of the profiled table or query.
+type column struct {
+	name         string
+	quoted       string
+	databaseType string
+	canonical    string
+	stats        stats
+}
+
+// columns returns the columns of from, from an empty result set.
+func columns(ctx context.Context, conn dbutil.Querier, dbVendor, from string) ([]column, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT * FROM "+from+" WHERE 1 = 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	cols := make([]column, len(columnTypes))
+	for i, ct := range columnTypes {
+		t := dbutil.NewColumnType(dbVendor, ct)
+		cols[i] = column{
+			name:         ct.Name(),
+			quoted:       dbutil.QuoteIdentifier(dbVendor, ct.Name()),
+			databaseType: ct.DatabaseTypeName(),
+			canonical:    t.Canonical,
+			stats:        statsOf(t.Canonical),
+		}
+	}
+	return cols, rows.Err()
+}
+
+// aggregate is the query of the statistics of all the columns, with the index of each statistic in its row (-1 if not computed).
+type aggregate struct {
+	exprs                             []string
+	count, distinct, min, max, length []int
+	low, high                         []int // numeric min and max, for the histogram
+	approx                            bool
+}
+
+func newAggregate(dbVendor string, cols []column, opts Options) *aggregate {
+	a := &aggregate{exprs: []string{"COUNT(*)"}}
+	add := func(index *[]int, ok bool, expr string) {
+		if !ok {
+			*index = append(*index, -1)
+			return
+		}
+		*index = append(*index, len(a.exprs))
+		a.exprs = append(a.exprs, expr)
+	}
+	var distinct func(string) string
+	distinct, a.approx = distinctExpr(dbVendor, opts.Exact)
+	for _, c := range cols {
+		value := valueExpr(dbVendor, c)
+		add(&a.count, true, "COUNT("+c.quoted+")")
+		add(&a.distinct, c.stats.distinct, distinct(value))
+		add(&a.min, c.stats.minMax, "MIN("+value+")")
+		add(&a.max, c.stats.minMax, "MAX("+value+")")
+		add(&a.length, c.stats.length, "AVG("+lengthExpr(dbVendor, c.quoted)+")")
+		num := numberExpr(dbVendor, c)
+		add(&a.low, opts.Buckets > 0 && num != "", "MIN("+num+")")
+		add(&a.high, opts.Buckets > 0 && num != "", "MAX("+num+")")
+	}
+	return a
+}
+
+// column returns the statistics of the column i in the row of the aggregate query.
+func (a *aggregate) column(i int, rows int64, values []any) Column {
+	c := Column{Nulls: rows - toInt(values[a.count[i]])}
+	if index := a.distinct[i]; index >= 0 {
+		distinct := toInt(values[index])
+		c.Distinct, c.DistinctApprox = &distinct, a.approx
+	}
+	if index := a.min[i]; index >= 0 {
+		c.Min, c.Max = values[index], values[a.max[i]]
+	}
+	if index := a.length[i]; index >= 0 {
+		c.AvgLength = toFloat(values[index])
+	}
+	return c
+}
+
+// bounds returns the numeric min and max of the column i, nil when not computed or null.
+func (a *aggregate) bounds(i int, values []any) (low, high *float64) {
+	if a.low[i] < 0 {
+		return nil, nil
+	}
+	return toFloat(values[a.low[i]]), toFloat(values[a.high[i]])
+}
+
+// top returns the most frequent non null values of a column, ties ordered by value.
+func top(ctx context.Context, conn dbutil.Querier, dbVendor, from string, c column, n int) ([]Value, error) {
+	value := valueExpr(dbVendor, c)
+	query := "SELECT " + value + " AS v, COUNT(*) AS cnt FROM " + from + " WHERE " + c.quoted + " IS NOT NULL GROUP BY " + value + " ORDER BY cnt DESC, v"
+	if dbVendor == types.DBVendorMSSQL {
+		query = "SELECT TOP (" + strconv.Itoa(n) + ") " + strings.TrimPrefix(query, "SELECT ")
+	} else {
+		query += " LIMIT " + strconv.Itoa(n)
+	}
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	values := []Value{}
+	for rows.Next() {
+		row, err := dbutil.ScanRow(rows, 2)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, Value{Value: row[0], Count: toInt(row[1])})
+	}
+	return values, rows.Err()
+}
+
+// histogram returns the equal width buckets of the non null values of a column, from low to high.
+// A column with a single value has a single bucket.
+func histogram(ctx context.Context, conn dbutil.Querier, dbVendor, from string, c column, low, high float64, count int64, n int) ([]Bucket, error) {
+	bound := func(f float64) any {
+		if c.stats.temporal {
+			sec := int64(f)
+			return time.Unix(sec, int64((f-float64(sec))*1e9)).UTC().Format(time.RFC3339Nano)
+		}
+		return f
+	}
+	if high <= low {
+		return []Bucket{{Low: bound(low), High: bound(high), Count: count}}, nil
+	}
+
+	literal := func(f float64) string { return strconv.FormatFloat(f, 'e', -1, 64) }
+	query := "SELECT b, COUNT(*) AS cnt FROM (" +
+		"SELECT CASE WHEN v >= " + literal(high) + " THEN " + strconv.Itoa(n-1) +
+		" ELSE FLOOR((v - " + literal(low) + ") * " + strconv.Itoa(n) + " / " + literal(high-low) + ") END AS b" +
+		" FROM (SELECT " + numberExpr(dbVendor, c) + " AS v FROM " + from + " WHERE " + c.quoted + " IS NOT NULL) x" +
+		") h GROUP BY b"
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	buckets := make([]Bucket, n)
+	width := (high - low) / float64(n)
+	for i := range buckets {
+		buckets[i] = Bucket{Low: bound(low + float64(i)*width), High: bound(low + float64(i+1)*width)}
+	}
+	buckets[n-1].High = bound(high)
+	for rows.Next() {
+		row, err := dbutil.ScanRow(rows, 2)
+		if err != nil {
+			return nil, err
+		}
+		if b := toFloat(row[0]); b != nil && *b >= 0 && int(*b) < n {
+			buckets[int(*b)].Count += toInt(row[1])
+		}
+	}
+	return buckets, rows.Err()
+}
+
+// queryRow returns the values of the single row of a query.
+func queryRow(ctx context.Context, conn dbutil.Querier, query string) ([]any, error) {
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("no row returned")
+	}
+	return dbutil.ScanRow(rows, len(cols))
+}
+
+// toFloat returns a numeric value as a float, nil for a null or not numeric value.
+// Drivers return numbers as integers, floats or decimal strings.
+func toFloat(v any) *float64 {
+	var f float64
+	switch n := v.(type) {
+	case int64:
+		f = float64(n)
+	case uint64:
+		f = float64(n)
+	case int32:
+		f = float64(n)
+	case uint32:
+		f = float64(n)
+	case float64:
+		f = n
+	case float32:
+		f = float64(n)
+	case string:
+		var err error
+		if f, err = strconv.ParseFloat(strings.TrimSpace(n), 64); err != nil {
+			return nil
+		}
+	case fmt.Stringer:
+		// decimal types of the drivers
+		var err error
+		if f, err = strconv.ParseFloat(n.String(), 64); err != nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return &f
+}
+
+// toInt returns a count as an integer, 0 for a null or not numeric value.
+func toInt(v any) int64 {
+	if f := toFloat(v); f != nil {
+		return int64(*f)
+	}
+	return 0
+}
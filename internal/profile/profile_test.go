@@ -0,0 +1,120 @@
+package profile
+
+import (
+	"context"
+	"database/sql"
+	"db-portal/internal/types"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestNumberExpr(t *testing.T) {
+	num := column{quoted: `"n"`, stats: statsOf("decimal")}
+	date := column{quoted: `"d"`, stats: statsOf("datetime")}
+	text := column{quoted: `"s"`, stats: statsOf("varchar")}
+	tests := []struct {
+		vendor string
+		c      column
+		want   string
+	}{
+		{types.DBVendorPostgres, num, `CAST("n" AS double precision)`},
+		{types.DBVendorMySQL, num, `("n" * 1e0)`},
+		{types.DBVendorMSSQL, num, `CAST("n" AS float)`},
+		{types.DBVendorClickHouse, num, `toFloat64("n")`},
+		{types.DBVendorSQLite, num, `CAST("n" AS REAL)`},
+		{types.DBVendorPostgres, date, `CAST(EXTRACT(EPOCH FROM "d") AS double precision)`},
+		{types.DBVendorMariaDB, date, `TIMESTAMPDIFF(SECOND, '1970-01-01', "d")`},
+		{types.DBVendorMSSQL, date, `CAST(DATEDIFF_BIG(second, '1970-01-01', "d") AS float)`},
+		{types.DBVendorSQLite, date, `unixepoch("d")`},
+		{types.DBVendorPostgres, text, ""},
+	}
+	for _, tt := range tests {
+		if got := numberExpr(tt.vendor, tt.c); got != tt.want {
+			t.Errorf("numberExpr(%s, %s) = %q, want %q", tt.vendor, tt.c.quoted, got, tt.want)
+		}
+	}
+}
+
+func TestToFloat(t *testing.T) {
+	f := func(f float64) *float64 { return &f }
+	tests := []struct {
+		value any
+		want  *float64
+	}{
+		{int64(-3), f(-3)},
+		{uint64(3), f(3)},
+		{int32(7), f(7)},
+		{float32(0.5), f(0.5)},
+		{1.25, f(1.25)},
+		{" 12.5 ", f(12.5)},
+		{"1e3", f(1000)},
+		{big.NewFloat(2.5), f(2.5)}, // fmt.Stringer, as the decimal types of the drivers
+		{"abc", nil},
+		{nil, nil},
+		{[]byte("1"), nil},
+	}
+	for _, tt := range tests {
+		if got := toFloat(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("toFloat(%#v) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+// openTestDB returns an in-memory SQLite connection with a table t of the numbers 0 to 10.
+func openTestDB(t *testing.T) *sql.Conn {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	_, err = conn.ExecContext(context.Background(),
+		"CREATE TABLE t (v REAL); INSERT INTO t VALUES (0), (1), (2), (3), (4), (5), (6), (7), (8), (9), (10), (NULL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestHistogram(t *testing.T) {
+	conn := openTestDB(t)
+	c := column{name: "v", quoted: `"v"`, canonical: "float", stats: statsOf("float")}
+	tests := []struct {
+		low, high float64
+		n         int
+		want      []Bucket
+	}{
+		{0, 10, 5, []Bucket{{0.0, 2.0, 2}, {2.0, 4.0, 2}, {4.0, 6.0, 2}, {6.0, 8.0, 2}, {8.0, 10.0, 3}}},
+		{0, 10, 1, []Bucket{{0.0, 10.0, 11}}},
+		{5, 5, 3, []Bucket{{5.0, 5.0, 11}}}, // a single value has a single bucket
+	}
+	for _, tt := range tests {
+		got, err := histogram(context.Background(), conn, types.DBVendorSQLite, `"t" src`, c, tt.low, tt.high, 11, tt.n)
+		if err != nil {
+			t.Fatalf("histogram(%v, %v, %d): %v", tt.low, tt.high, tt.n, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("histogram(%v, %v, %d) = %v, want %v", tt.low, tt.high, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	conn := openTestDB(t)
+	p, err := Query(context.Background(), conn, types.DBVendorSQLite, "SELECT v FROM t WHERE v < 5 -- ends with a comment;\n;", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Rows != 5 || len(p.Columns) != 1 || p.Columns[0].Max != 4.0 {
+		t.Errorf("Query() = %+v, want 5 rows and a max of 4", p)
+	}
+	if _, err = Query(context.Background(), conn, types.DBVendorSQLite, "SELECT 1; SELECT 2", Options{}); err == nil {
+		t.Error("Query() of two statements should fail")
+	}
+}
@@ -0,0 +1,112 @@
+package profile
+
+import "db-portal/internal/types"
+
+// stats are the statistics computed for a column, by canonical type.
+type stats struct {
+	distinct bool // distinct count
+	minMax   bool // min and max values
+	length   bool // average length
+	top      bool // most frequent values
+	numeric  bool // histogram of the values
+	temporal bool // histogram of the epoch seconds of the values
+}
+
+// statsOf returns the statistics of a canonical type. Only the null count is computed
+// for the types the vendors cannot compare (json, array, geometry...).
+func statsOf(canonical string) stats {
+	switch canonical {
+	case "int", "bigint", "smallint", "decimal", "float":
+		return stats{distinct: true, minMax: true, top: true, numeric: true}
+	case "date", "datetime", "timestamptz":
+		return stats{distinct: true, minMax: true, top: true, temporal: true}
+	case "time":
+		return stats{distinct: true, minMax: true, top: true}
+	case "char", "varchar", "text":
+		return stats{distinct: true, minMax: true, length: true, top: true}
+	case "boolean", "uuid":
+		return stats{distinct: true, top: true}
+	case "binary", "interval":
+		return stats{distinct: true}
+	}
+	return stats{}
+}
+
+// valueExpr returns the expression of the values of a column to count, compare and group.
+// Text is the fallback canonical type of unknown vendor types (enum, xml, ntext...): they are cast to a string type.
+func valueExpr(dbVendor string, c column) string {
+	if c.canonical != "text" {
+		return c.quoted
+	}
+	switch dbVendor {
+	case types.DBVendorPostgres:
+		return "CAST(" + c.quoted + " AS text)"
+	case types.DBVendorMSSQL:
+		return "CAST(" + c.quoted + " AS nvarchar(max))"
+	}
+	return c.quoted
+}
+
+// distinctExpr returns the distinct count expression of the vendor, and whether it is approximate.
+// ClickHouse and MSSQL (2019 and later) estimate distinct counts unless exact.
+func distinctExpr(dbVendor string, exact bool) (func(string) string, bool) {
+	switch {
+	case dbVendor == types.DBVendorClickHouse && exact:
+		return func(v string) string { return "uniqExact(" + v + ")" }, false
+	case dbVendor == types.DBVendorClickHouse:
+		return func(v string) string { return "uniq(" + v + ")" }, true
+	case dbVendor == types.DBVendorMSSQL && !exact:
+		return func(v string) string { return "APPROX_COUNT_DISTINCT(" + v + ")" }, true
+	}
+	return func(v string) string { return "COUNT(DISTINCT " + v + ")" }, false
+}
+
+// lengthExpr returns the character length expression of a string column.
+func lengthExpr(dbVendor, quoted string) string {
+	switch dbVendor {
+	case types.DBVendorPostgres:
+		return "length(CAST(" + quoted + " AS text))"
+	case types.DBVendorMySQL, types.DBVendorMariaDB:
+		return "CHAR_LENGTH(" + quoted + ")"
+	case types.DBVendorMSSQL:
+		return "CAST(LEN(CAST(" + quoted + " AS nvarchar(max))) AS float)"
+	case types.DBVendorClickHouse:
+		return "lengthUTF8(toString(" + quoted + "))"
+	}
+	return "length(" + quoted + ")"
+}
+
+// numberExpr returns the float expression of the values of a numeric column, or the epoch seconds of a date or time column.
+// It is empty for a column without histogram.
+func numberExpr(dbVendor string, c column) string {
+	q := c.quoted
+	switch {
+	case c.stats.numeric:
+		switch dbVendor {
+		case types.DBVendorPostgres:
+			return "CAST(" + q + " AS double precision)"
+		case types.DBVendorMySQL, types.DBVendorMariaDB:
+			return "(" + q + " * 1e0)"
+		case types.DBVendorMSSQL:
+			return "CAST(" + q + " AS float)"
+		case types.DBVendorClickHouse:
+			return "toFloat64(" + q + ")"
+		case types.DBVendorSQLite:
+			return "CAST(" + q + " AS REAL)"
+		}
+	case c.stats.temporal:
+		switch dbVendor {
+		case types.DBVendorPostgres:
+			return "CAST(EXTRACT(EPOCH FROM " + q + ") AS double precision)"
+		case types.DBVendorMySQL, types.DBVendorMariaDB:
+			return "TIMESTAMPDIFF(SECOND, '1970-01-01', " + q + ")"
+		case types.DBVendorMSSQL:
+			return "CAST(DATEDIFF_BIG(second, '1970-01-01', " + q + ") AS float)"
+		case types.DBVendorClickHouse:
+			return "toFloat64(toUnixTimestamp(toDateTime(" + q + ")))"
+		case types.DBVendorSQLite:
+			return "unixepoch(" + q + ")"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,175 @@
+// Package running tracks the queries being executed for each user, so that a user can list and cancel them.
+// Canceling a query cancels its context and kills its statement on the database server when the vendor allows it:
+// dropping the HTTP request alone may leave the statement running.
+package running
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for an unknown or finished query, or a query of another user.
+	ErrNotFound = errors.New("query not found or finished")
+	// ErrDuplicate is returned when the user already runs a query with the same id.
+	ErrDuplicate = errors.New("a query with this id is already running")
+	// ErrInvalidID is returned for an id that is not 1 to 64 letters, digits, - or _.
+	ErrInvalidID = errors.New("invalid query id")
+)
+
+// killTimeout limits the statement kill, run on another connection.
+const killTimeout = 10 * time.Second
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Query is a running query.
+type Query struct {
+	ID     string
+	DSName string
+	Schema string
+	SQL    string
+	Start  time.Time
+
+	username string
+	cancel   context.CancelFunc
+
+	// guarded by mu, held while the statement is killed so that the query does not end meanwhile
+	mu       sync.Mutex
+	kill     func(ctx context.Context) error // nil until the server statement is known, or when the vendor has no kill
+	canceled bool
+	done     bool
+}
+
+// Info is the visible state of a running query.
+type Info struct {
+	ID       string    `json:"id"`
+	DSName   string    `json:"dsName"`
+	Schema   string    `json:"schema,omitempty"`
+	SQL      string    `json:"sql"`
+	Start    time.Time `json:"start"`
+	Canceled bool      `json:"canceled"`
+}
+
+// Manager holds the running queries of all users.
+type Manager struct {
+	mu      sync.Mutex
+	queries map[string]map[string]*Query // by username and id
+}
+
+func NewManager() *Manager {
+	return &Manager{queries: map[string]map[string]*Query{}}
+}
+
+// Register tracks a query of username until Done. id is chosen by the client to cancel the query before
+// its response, a random id is used when it is empty. The returned context is canceled with the query.
+func (m *Manager) Register(ctx context.Context, username, id, dsName, schema, sql string) (context.Context, *Query, error) {
+	if id == "" {
+		b := make([]byte, 16)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+	} else if !validID.MatchString(id) {
+		return ctx, nil, ErrInvalidID
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	q := &Query{
+		ID:       id,
+		DSName:   dsName,
+		Schema:   schema,
+		SQL:      sql,
+		Start:    time.Now(),
+		username: username,
+		cancel:   cancel,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.queries[username][id] != nil {
+		cancel()
+		return ctx, nil, ErrDuplicate
+	}
+	if m.queries[username] == nil {
+		m.queries[username] = map[string]*Query{}
+	}
+	m.queries[username][id] = q
+	return ctx, q, nil
+}
+
+// SetKill sets the function killing the statement of a query on the database server.
+func (m *Manager) SetKill(q *Query, kill func(ctx context.Context) error) {
+	q.mu.Lock()
+	q.kill = kill
+	q.mu.Unlock()
+}
+
+// Done ends the tracking of a query. It waits for a kill in progress, the query connection must not be
+// released before: the server would kill the statement of its next user.
+func (m *Manager) Done(q *Query) {
+	m.mu.Lock()
+	delete(m.queries[q.username], q.ID)
+	if len(m.queries[q.username]) == 0 {
+		delete(m.queries, q.username)
+	}
+	m.mu.Unlock()
+
+	q.mu.Lock()
+	q.done = true
+	q.mu.Unlock()
+	q.cancel()
+}
+
+// Canceled reports whether a query was canceled with Cancel.
+func (m *Manager) Canceled(q *Query) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.canceled
+}
+
+// List returns the running queries of a user, the oldest first.
+func (m *Manager) List(username string) []Info {
+	m.mu.Lock()
+	queries := make([]*Query, 0, len(m.queries[username]))
+	for _, q := range m.queries[username] {
+		queries = append(queries, q)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(queries, func(i, j int) bool { return queries[i].Start.Before(queries[j].Start) })
+	infos := make([]Info, len(queries))
+	for i, q := range queries {
+		infos[i] = Info{ID: q.ID, DSName: q.DSName, Schema: q.Schema, SQL: q.SQL, Start: q.Start, Canceled: m.Canceled(q)}
+	}
+	return infos
+}
+
+// Cancel kills the statement of a query of a user on the database server, then cancels its context.
+// A kill error is returned, the context is canceled anyway.
+func (m *Manager) Cancel(username, id string) error {
+	m.mu.Lock()
+	q := m.queries[username][id]
+	m.mu.Unlock()
+	if q == nil {
+		return ErrNotFound
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.done {
+		return ErrNotFound
+	}
+	q.canceled = true
+	var err error
+	if q.kill != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), killTimeout)
+		err = q.kill(ctx)
+		cancel()
+	}
+	q.cancel()
+	return err
+}
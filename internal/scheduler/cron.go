@@ -0,0 +1,127 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed 5 fields cron expression: minute hour day-of-month month day-of-week.
+// Fields accept *, numbers, ranges (1-5), lists (1,15) and steps (*/10, 0-30/5).
+// Day of week is 0-6, Sunday is 0 (7 is accepted too).
+// Macros: @hourly, @daily, @weekly, @monthly, @yearly.
+type Cron struct {
+	minute, hour, dom, month, dow uint64 // bit sets
+	domAny, dowAny                bool
+}
+
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// ParseCron parses a cron expression.
+func ParseCron(expr string) (c Cron, err error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return c, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1 // 7 is Sunday
+	}
+	c.domAny, c.dowAny = fields[2] == "*", fields[4] == "*"
+	return
+}
+
+func parseCronField(field string, first, last int) (bits uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i != -1 {
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid cron step %q", part)
+			}
+			part = part[:i]
+		}
+		lo, hi := first, last
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid cron range %q", part)
+			}
+			if hi, err = strconv.Atoi(bounds[1]); err != nil {
+				return 0, fmt.Errorf("invalid cron range %q", part)
+			}
+		default:
+			if lo, err = strconv.Atoi(part); err != nil {
+				return 0, fmt.Errorf("invalid cron value %q", part)
+			}
+			hi = lo
+			if step > 1 {
+				hi = last // ex: 5/15
+			}
+		}
+		if lo < first || hi > last || lo > hi {
+			return 0, fmt.Errorf("cron value %q out of range %d-%d", part, first, last)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// Match reports whether t, truncated to the minute, matches the expression.
+// As in standard cron, when both day of month and day of week are restricted, either can match.
+func (c Cron) Match(t time.Time) bool {
+	if c.minute&(1<<t.Minute()) == 0 || c.hour&(1<<t.Hour()) == 0 || c.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	dom, dow := c.dom&(1<<t.Day()) != 0, c.dow&(1<<int(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// Next returns the first time after t matching the expression, zero if none within 5 years.
+func (c Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for end := t.AddDate(5, 0, 0); t.Before(end); t = t.Add(time.Minute) {
+		if c.Match(t) {
+			return t
+		}
+	}
+	return time.Time{}
+}
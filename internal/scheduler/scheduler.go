@@ -0,0 +1,132 @@
+// Package scheduler runs the schedules stored in the internal DB, according to their cron expression.
+package scheduler
+
+import (
+	"context"
+	"db-portal/internal/internaldb"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// RunFunc runs a schedule once and returns the number of rows copied or affected.
+type RunFunc func(ctx context.Context, sch internaldb.Schedule) (rows int64, err error)
+
+// ErrRunning is returned when a schedule is triggered while its previous run is not finished.
+var ErrRunning = errors.New("schedule is already running")
+
+// Scheduler checks the enabled schedules every minute and runs the matching ones.
+// A schedule never runs twice at the same time, failed runs are retried with a doubling delay.
+type Scheduler struct {
+	store   *internaldb.Store
+	run     RunFunc
+	mu      sync.Mutex
+	running map[string]bool
+	ctx     context.Context
+}
+
+func New(store *internaldb.Store, run RunFunc) *Scheduler {
+	return &Scheduler{
+		store:   store,
+		run:     run,
+		running: map[string]bool{},
+		ctx:     context.Background(),
+	}
+}
+
+// Start checks the schedules at the beginning of every minute, until ctx is done.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.ctx = ctx
+	go func() {
+		for {
+			now := time.Now()
+			next := now.Truncate(time.Minute).Add(time.Minute)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(next.Sub(now)):
+			}
+			s.tick(next)
+		}
+	}()
+}
+
+// tick runs the schedules matching t.
+func (s *Scheduler) tick(t time.Time) {
+	schedules, err := s.store.GetEnabledSchedules()
+	if err != nil {
+		log.Printf("scheduler: cannot read schedules: %v", err)
+		return
+	}
+	for _, sch := range schedules {
+		cron, err := ParseCron(sch.Cron)
+		if err != nil {
+			log.Printf("scheduler: schedule %s: %v", sch.Name, err)
+			continue
+		}
+		if !cron.Match(t) {
+			continue
+		}
+		if err := s.Trigger(sch, "cron"); errors.Is(err, ErrRunning) {
+			// overlap prevention, the skipped run is recorded in the history
+			if id, err := s.store.CreateScheduleRun(sch.Name, "cron", 0); err == nil {
+				s.store.EndScheduleRun(id, 0, fmt.Errorf("skipped: %w", ErrRunning))
+			}
+		}
+	}
+}
+
+// Trigger starts a run of the schedule in the background, unless it is already running.
+func (s *Scheduler) Trigger(sch internaldb.Schedule, trigger string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[sch.Name] {
+		return ErrRunning
+	}
+	s.running[sch.Name] = true
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			delete(s.running, sch.Name)
+			s.mu.Unlock()
+		}()
+		s.execute(sch, trigger)
+	}()
+	return nil
+}
+
+// Running reports whether a schedule is running.
+func (s *Scheduler) Running(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running[name]
+}
+
+// execute runs a schedule, with retries, and records each attempt.
+func (s *Scheduler) execute(sch internaldb.Schedule, trigger string) {
+	for attempt := 1; ; attempt++ {
+		id, err := s.store.CreateScheduleRun(sch.Name, trigger, attempt)
+		if err != nil {
+			log.Printf("scheduler: schedule %s: cannot record run: %v", sch.Name, err)
+		}
+		rows, runErr := s.run(s.ctx, sch)
+		if err == nil {
+			if err = s.store.EndScheduleRun(id, rows, runErr); err != nil {
+				log.Printf("scheduler: schedule %s: cannot record run end: %v", sch.Name, err)
+			}
+		}
+		if runErr == nil || attempt > sch.MaxRetries {
+			return
+		}
+
+		delay := time.Duration(sch.RetryDelay) * time.Second << (attempt - 1)
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
@@ -3,6 +3,7 @@ package security
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"net"
 	"net/http"
 	"os"
 	"strings"
@@ -58,10 +59,21 @@ func JWTMiddleware(next http.Handler) http.Handler {
 		}
 
 		ctx := contextkeys.SetUsername(r.Context(), username)
+		ctx = contextkeys.SetToken(ctx, tokenString)
+		ctx = contextkeys.SetClientIP(ctx, ClientIP(r))
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// ClientIP returns the IP address of the request client, proxy headers are not trusted.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func LoadJWTSecretKey(path string) ([]byte, error) {
 	key, err := os.ReadFile(path)
 	if err != nil || len(key) == 0 {
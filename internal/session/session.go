@@ -0,0 +1,324 @@
+// Package session keeps interactive SQL editor sessions: a connection held by the server between requests,
+// so that a transaction spans several queries. A session is bound to the user token.
+// An idle session is closed and its transaction rolled back.
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"db-portal/internal/dbutil"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for an unknown, closed or expired session, or a session of another token.
+	ErrNotFound = errors.New("session not found or expired")
+	// ErrTooMany is returned when the user already has the maximum number of sessions.
+	ErrTooMany = errors.New("too many open sessions, close one first")
+	// ErrInTransaction is returned by Begin when a transaction is already open.
+	ErrInTransaction = errors.New("a transaction is already open")
+	// ErrNoTransaction is returned by Commit and Rollback when no transaction is open.
+	ErrNoTransaction = errors.New("no open transaction")
+)
+
+// Session is a connection held between requests, with an optional open transaction.
+type Session struct {
+	ID     string
+	DSName string
+	Schema string
+	Vendor string
+
+	username string
+	token    string // token hash
+	conn     *sql.Conn
+	tx       *sql.Tx
+	mu       sync.Mutex // serializes statements, guards conn and tx
+
+	// guarded by the manager mutex
+	txStart  time.Time
+	lastUsed time.Time
+	busy     int
+	closed   bool
+}
+
+// Info is the visible state of a session.
+type Info struct {
+	ID               string     `json:"id"`
+	DSName           string     `json:"dsName"`
+	Schema           string     `json:"schema,omitempty"`
+	InTransaction    bool       `json:"inTransaction"`
+	TransactionStart *time.Time `json:"transactionStart,omitempty"`
+	LastUsed         time.Time  `json:"lastUsed"`
+	ExpiresAt        time.Time  `json:"expiresAt"` // unless used again
+}
+
+// Manager holds the open sessions of all users.
+type Manager struct {
+	idleTimeout time.Duration
+	maxPerUser  int
+	mu          sync.Mutex
+	sessions    map[string]*Session
+}
+
+// NewManager returns a session manager. Defaults are 5 minutes and 2 sessions per user.
+func NewManager(idleTimeout time.Duration, maxPerUser int) *Manager {
+	if idleTimeout <= 0 {
+		idleTimeout = 5 * time.Minute
+	}
+	if maxPerUser <= 0 {
+		maxPerUser = 2
+	}
+	return &Manager{
+		idleTimeout: idleTimeout,
+		maxPerUser:  maxPerUser,
+		sessions:    map[string]*Session{},
+	}
+}
+
+// Start closes the idle sessions every 10 seconds, until ctx is done.
+func (m *Manager) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.closeIdle(time.Now().Add(-m.idleTimeout))
+			}
+		}
+	}()
+}
+
+// closeIdle closes the sessions unused since before, a session running a statement is not idle.
+func (m *Manager) closeIdle(before time.Time) {
+	var idle []*Session
+	m.mu.Lock()
+	for id, s := range m.sessions {
+		if s.busy == 0 && s.lastUsed.Before(before) {
+			s.closed = true
+			idle = append(idle, s)
+			delete(m.sessions, id)
+		}
+	}
+	m.mu.Unlock()
+	for _, s := range idle {
+		s.close()
+	}
+}
+
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Open returns a new session on conn. The session owns conn, which is closed with the session.
+func (m *Manager) Open(username, token string, conn *sql.Conn, dsName, schema, vendor string) (*Session, error) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	s := &Session{
+		ID:       hex.EncodeToString(id),
+		DSName:   dsName,
+		Schema:   schema,
+		Vendor:   vendor,
+		username: username,
+		token:    tokenHash(token),
+		conn:     conn,
+		lastUsed: time.Now(),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for _, other := range m.sessions {
+		if other.username == username {
+			count++
+		}
+	}
+	if count >= m.maxPerUser {
+		return nil, ErrTooMany
+	}
+	m.sessions[s.ID] = s
+	return s, nil
+}
+
+// Get returns a session of the user token.
+func (m *Manager) Get(username, token, id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok || s.username != username || s.token != tokenHash(token) {
+		return nil, ErrNotFound
+	}
+	s.lastUsed = time.Now()
+	return s, nil
+}
+
+// List returns the sessions of the user token.
+func (m *Manager) List(username, token string) []Info {
+	hash := tokenHash(token)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	infos := []Info{}
+	for _, s := range m.sessions {
+		if s.username == username && s.token == hash {
+			infos = append(infos, m.info(s))
+		}
+	}
+	return infos
+}
+
+// Info returns the state of a session.
+func (m *Manager) Info(s *Session) Info {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.info(s)
+}
+
+func (m *Manager) info(s *Session) Info {
+	info := Info{
+		ID:            s.ID,
+		DSName:        s.DSName,
+		Schema:        s.Schema,
+		InTransaction: !s.txStart.IsZero(),
+		LastUsed:      s.lastUsed,
+		ExpiresAt:     s.lastUsed.Add(m.idleTimeout),
+	}
+	if info.InTransaction {
+		txStart := s.txStart
+		info.TransactionStart = &txStart
+	}
+	return info
+}
+
+// Close closes a session of the user token. An open transaction is rolled back.
+func (m *Manager) Close(username, token, id string) error {
+	m.mu.Lock()
+	s, ok := m.sessions[id]
+	if !ok || s.username != username || s.token != tokenHash(token) {
+		m.mu.Unlock()
+		return ErrNotFound
+	}
+	s.closed = true
+	delete(m.sessions, id)
+	m.mu.Unlock()
+
+	s.close()
+	return nil
+}
+
+// Do runs f with the session querier: the open transaction, or else the connection.
+// Statements of a session run one at a time, and a session is not idle while f runs.
+func (m *Manager) Do(s *Session, f func(q dbutil.Querier) error) error {
+	if !m.acquire(s) {
+		return ErrNotFound
+	}
+	defer m.release(s)
+
+	if s.tx != nil {
+		return f(s.tx)
+	}
+	return f(s.conn)
+}
+
+// acquire locks a session for a statement, it fails if the session was closed meanwhile.
+func (m *Manager) acquire(s *Session) bool {
+	m.mu.Lock()
+	if s.closed {
+		m.mu.Unlock()
+		return false
+	}
+	s.busy++
+	m.mu.Unlock()
+
+	s.mu.Lock()
+	if s.conn == nil {
+		s.mu.Unlock()
+		m.mu.Lock()
+		s.busy--
+		m.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+// release unlocks a session after a statement, the session idle time starts now.
+func (m *Manager) release(s *Session) {
+	s.mu.Unlock()
+	m.mu.Lock()
+	s.busy--
+	s.lastUsed = time.Now()
+	m.mu.Unlock()
+}
+
+// Begin starts a transaction. It is rolled back if the session is closed or expires.
+func (m *Manager) Begin(s *Session) error {
+	if !m.acquire(s) {
+		return ErrNotFound
+	}
+	defer m.release(s)
+
+	if s.tx != nil {
+		return ErrInTransaction
+	}
+	// the transaction outlives the request
+	tx, err := s.conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	s.tx = tx
+	m.setTxStart(s, time.Now())
+	return nil
+}
+
+// Commit commits the open transaction.
+func (m *Manager) Commit(s *Session) error {
+	return m.end(s, (*sql.Tx).Commit)
+}
+
+// Rollback rolls back the open transaction.
+func (m *Manager) Rollback(s *Session) error {
+	return m.end(s, (*sql.Tx).Rollback)
+}
+
+func (m *Manager) end(s *Session, f func(*sql.Tx) error) error {
+	if !m.acquire(s) {
+		return ErrNotFound
+	}
+	defer m.release(s)
+
+	if s.tx == nil {
+		return ErrNoTransaction
+	}
+	// the transaction is over even if commit fails
+	err := f(s.tx)
+	s.tx = nil
+	m.setTxStart(s, time.Time{})
+	return err
+}
+
+func (m *Manager) setTxStart(s *Session, t time.Time) {
+	m.mu.Lock()
+	s.txStart = t
+	m.mu.Unlock()
+}
+
+// close rolls back the open transaction and closes the connection. It waits for a running statement.
+func (s *Session) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tx != nil {
+		s.tx.Rollback()
+		s.tx = nil
+	}
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
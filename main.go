@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -8,10 +9,15 @@ import (
 	"path/filepath"
 
 	"db-portal/internal/config"
+	"db-portal/internal/cursor"
 	"db-portal/internal/handlers"
 	"db-portal/internal/internaldb"
 	"db-portal/internal/meta"
+	"db-portal/internal/pipeline"
+	"db-portal/internal/running"
+	"db-portal/internal/scheduler"
 	"db-portal/internal/security"
+	"db-portal/internal/session"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -71,6 +77,14 @@ func main() {
 		log.Fatalf("error loading %s file: %s", commandsConfig.Filename, err)
 	}
 
+	// Load optional type mappings config file
+	path = filepath.Join(configPath, "types.yaml")
+	typesConfig := config.New[config.TypesConfig](path)
+	typesConfig.Optional = true
+	if err := typesConfig.Load(); err != nil {
+		log.Fatalf("error loading %s file: %s", typesConfig.Filename, err)
+	}
+
 	// JWTSecretKey is read from file, it is generated if file not exists
 	path = filepath.Join(configPath, meta.JWTKeyFileName)
 	key, err := security.LoadJWTSecretKey(path)
@@ -94,6 +108,31 @@ func main() {
 		Store:          store,
 		CommandsConfig: &commandsConfig,
 		ServerConfig:   &serverConfig,
+		TypesConfig:    &typesConfig,
+	}
+
+	// Start the scheduler of copy jobs and SQL scripts
+	svcs.Scheduler = scheduler.New(store, svcs.RunSchedule)
+	svcs.Scheduler.Start(context.Background())
+
+	// Start closing idle SQL editor cursors
+	svcs.Cursors = cursor.NewManager(time.Duration(serverConfig.Data.CursorIdleTimeout)*time.Second, serverConfig.Data.MaxCursorsPerUser)
+	svcs.Cursors.Start(context.Background())
+
+	// Start closing idle SQL editor sessions, rolling back their transaction
+	svcs.Sessions = session.NewManager(time.Duration(serverConfig.Data.SessionIdleTimeout)*time.Second, serverConfig.Data.MaxSessionsPerUser)
+	svcs.Sessions.Start(context.Background())
+
+	// Track running queries, so that users cancel them
+	svcs.Queries = running.NewManager()
+
+	// Start deleting query history entries older than query-history-days
+	svcs.StartQueryHistoryPurge(context.Background())
+
+	// Start the pipeline runner
+	svcs.Pipelines = pipeline.NewRunner(store, svcs.RunPipelineStep)
+	if err := svcs.Pipelines.Start(context.Background()); err != nil {
+		log.Printf("cannot mark interrupted pipeline runs as failed: %v", err)
 	}
 
 	r := chi.NewRouter()
@@ -102,12 +141,6 @@ func main() {
 	r.Use(middleware.Logger)
 	r.Use(middleware.Compress(5, "text/html", "text/css", "application/json", "text/javascript"))
 
-	if serverConfig.Data.Timeout > 0 {
-		duration := time.Duration(serverConfig.Data.Timeout) * time.Second
-		r.Use(middleware.Timeout(duration))
-		fmt.Printf("request timeout is set to: %v\n", duration)
-	}
-
 	// Public routes
 	r.Get("/", svcs.IndexHandler)
 	r.Handle("/web/*", svcs.StaticFileHandler())
@@ -125,9 +158,16 @@ func main() {
 		api.Get("/users/{username}/data-sources/{dsName}/test", svcs.HandleUserDataSourceTest)
 		api.Post("/users/{username}/data-sources/{dsName}", svcs.HandleCreateUserDataSource)
 		api.Delete("/users/{username}/data-sources/{dsName}", svcs.HandleDeleteUserDataSource)
+		api.Get("/users/{username}/limits", svcs.HandleGetUserLimits)
+		api.Put("/users/{username}/limits", svcs.HandleSetUserLimits)
 
 		api.Post("/data-sources/test", svcs.HandleDataSourceTest) // do not use GET, use POST to receive DSN location
 		api.Post("/data-sources", svcs.HandleCreateDataSource)
+		api.Get("/data-sources/{dsName}/limits", svcs.HandleGetDataSourceLimits)
+		api.Put("/data-sources/{dsName}/limits", svcs.HandleSetDataSourceLimits)
+
+		api.Get("/audit-log", svcs.HandleListAuditLog)
+		api.Get("/audit-log/export", svcs.HandleExportAuditLog)
 
 		api.Get("/vendors", svcs.HandleListVendors)
 
@@ -138,8 +178,60 @@ func main() {
 
 		api.Post("/query/{dsName}", svcs.QueryHandler)
 		api.Post("/query/{dsName}/{schema}", svcs.QueryHandler)
+		api.Get("/cursors/{id}", svcs.HandleFetchCursor)
+		api.Get("/cursors/{id}/count", svcs.HandleCountCursor)
+		api.Delete("/cursors/{id}", svcs.HandleCloseCursor)
+		api.Get("/query-history", svcs.HandleListQueryHistory)
+		api.Get("/query-history/{id}", svcs.HandleGetQueryHistoryEntry)
+		api.Post("/query-history/{id}/run", svcs.HandleRunQueryHistoryEntry)
+		api.Get("/saved-queries", svcs.HandleListSavedQueries)
+		api.Post("/saved-queries", svcs.HandleSaveSavedQuery)
+		api.Get("/saved-queries/{id}", svcs.HandleGetSavedQuery)
+		api.Put("/saved-queries/{id}", svcs.HandleSaveSavedQuery)
+		api.Delete("/saved-queries/{id}", svcs.HandleDeleteSavedQuery)
+		api.Post("/saved-queries/{id}/run", svcs.HandleRunSavedQuery)
+		api.Post("/users/{username}/saved-queries/{id}", svcs.HandleCreateUserSavedQuery)
+		api.Delete("/users/{username}/saved-queries/{id}", svcs.HandleDeleteUserSavedQuery)
+		api.Get("/queries", svcs.HandleListQueries)
+		api.Delete("/queries/{id}", svcs.HandleCancelQuery)
+		api.Get("/sessions", svcs.HandleListSessions)
+		api.Post("/sessions", svcs.HandleOpenSession)
+		api.Get("/sessions/{id}", svcs.HandleGetSession)
+		api.Delete("/sessions/{id}", svcs.HandleCloseSession)
+		api.Post("/sessions/{id}/begin", svcs.HandleBeginSession)
+		api.Post("/sessions/{id}/commit", svcs.HandleCommitSession)
+		api.Post("/sessions/{id}/rollback", svcs.HandleRollbackSession)
 
 		api.Post("/copy", svcs.CopyHandler)
+		api.Post("/copy-schema", svcs.CopySchemaHandler)
+		api.Post("/compare", svcs.CompareHandler)
+		api.Post("/profile", svcs.HandleProfile)
+		api.Delete("/copy-watermarks/{name}", svcs.HandleDeleteCopyWatermark)
+
+		api.Get("/copy-jobs", svcs.HandleListCopyJobs)
+		api.Post("/copy-jobs", svcs.HandleSaveCopyJob)
+		api.Get("/copy-jobs/{name}", svcs.HandleGetCopyJob)
+		api.Put("/copy-jobs/{name}", svcs.HandleSaveCopyJob)
+		api.Delete("/copy-jobs/{name}", svcs.HandleDeleteCopyJob)
+		api.Post("/copy-jobs/{name}/run", svcs.HandleRunCopyJob)
+		api.Post("/users/{username}/copy-jobs/{name}", svcs.HandleCreateUserCopyJob)
+		api.Delete("/users/{username}/copy-jobs/{name}", svcs.HandleDeleteUserCopyJob)
+
+		api.Get("/schedules", svcs.HandleListSchedules)
+		api.Post("/schedules", svcs.HandleSaveSchedule)
+		api.Put("/schedules/{name}", svcs.HandleSaveSchedule)
+		api.Delete("/schedules/{name}", svcs.HandleDeleteSchedule)
+		api.Post("/schedules/{name}/run", svcs.HandleRunSchedule)
+		api.Get("/schedules/{name}/runs", svcs.HandleListScheduleRuns)
+		api.Get("/pipelines", svcs.HandleListPipelines)
+		api.Post("/pipelines", svcs.HandleSavePipeline)
+		api.Get("/pipelines/{name}", svcs.HandleGetPipeline)
+		api.Put("/pipelines/{name}", svcs.HandleSavePipeline)
+		api.Delete("/pipelines/{name}", svcs.HandleDeletePipeline)
+		api.Post("/pipelines/{name}/run", svcs.HandleRunPipeline)
+		api.Get("/pipelines/{name}/runs", svcs.HandleListPipelineRuns)
+		api.Get("/pipelines/{name}/runs/{id}", svcs.HandleGetPipelineRun)
+		api.Post("/pipelines/{name}/runs/{id}/resume", svcs.HandleResumePipelineRun)
 	})
 
 	// Create HTTP server
@@ -128,6 +128,19 @@ function DataEndpointForm() {
                                 }),
                             )
                         ]),
+                        endPointType == "destination" && this.tableMode == "existent" && m("tr", [
+                            m("th", "Schema changes"),
+                            m("td", [
+                                m("label", { title: "Columns found in the source but not in the table will be added." }, [
+                                    m("input[type=checkbox]", { name: `${endPointType}[evolve]`, value: "1" }),
+                                    " add missing columns"
+                                ]),
+                                m("label", { title: "Varchar and decimal columns narrower than the source will be widened." }, [
+                                    m("input[type=checkbox]", { name: `${endPointType}[widen]`, value: "1" }),
+                                    " widen types"
+                                ])
+                            ])
+                        ]),
                         endPointType == "destination" && m("tr", [
                             m("th.pointer", {
                                 style: {opacity: this.tableMode == "new" ? 1 : .4},
@@ -160,8 +173,39 @@ function DataEndpointForm() {
                                 ]
                             )
                         ]),
+                        endPointType == "destination" && m("tr", [
+                            m("th", "Upsert"),
+                            m("td", [
+                                m("label", { title: "Rows matching an existing key are updated instead of inserted." }, [
+                                    m("input[type=checkbox]", { name: `${endPointType}[upsert]`, value: "1" }),
+                                    " update existing rows "
+                                ]),
+                                m("input[type=text]", {
+                                    name: `${endPointType}[keys]`,
+                                    autocomplete: "off",
+                                    placeholder: "key columns, primary key by default"
+                                })
+                            ])
+                        ]),
                     ] : null,
 
+                endPointType == "origin" && (this.type === "table" || this.type === "query") ?
+                    m("tr", [
+                        m("th", "Incremental"),
+                        m("td", { title: "Only rows beyond the last copy high-water mark are read. The mark is saved by copy name." }, [
+                            m("input[type=text]", {
+                                name: `${endPointType}[watermark]`,
+                                autocomplete: "off",
+                                placeholder: "watermark column (timestamp or increasing id)"
+                            }),
+                            m("input[type=text]", {
+                                name: "name",
+                                autocomplete: "off",
+                                placeholder: "copy name"
+                            })
+                        ])
+                    ]) : null,
+
                 this.type === "query" ?
                     [
                         m("tr", [
@@ -1,17 +1,23 @@
 const QryForm = {
     query: "",
-    respData: null,
+    respData: null, // selected result
+    results: [],    // one result by statement or result set
+    resultIndex: 0,
     exportType: "",
     resizeObserver: null,
     editor: null,
     editorTheme: "",
     xhr: null,
+    queryId: null,  // id of the running query, to cancel it on the server
     executing: false,
     error: false,
     selectedFileName: "",
+    session: null,  // open transaction: the server holds the connection between queries
     reset: () => {
+        QryForm.closeSession()
         QryForm.query = ""
         QryForm.respData = null
+        QryForm.results = []
         QryForm.currentPage = 0
 
         QryExplainForm.reset()
@@ -20,6 +26,7 @@ const QryForm = {
     // execute query and explain query forms
     submitQuery: () => {
         QryForm.respData = null
+        QryForm.results = []
         QryForm.currentPage = 0
         QryForm.error = null
         QryForm.query = QryForm.editor.getCode().trim()
@@ -39,6 +46,11 @@ const QryForm = {
         }
         const formData = new FormData()
         formData.set("query", QryForm.query)
+        if (QryForm.session) {
+            formData.set("session", QryForm.session.id)
+        }
+        QryForm.queryId = newQueryId()
+        formData.set("queryId", QryForm.queryId)
 
         //const abortController = new AbortController()
         QryForm.xhr =  new AbortController()
@@ -59,15 +71,105 @@ const QryForm = {
         }).then((response) => {
             QryForm.executing = false
             QryForm.xhr = null
+            QryForm.queryId = null
             QryResultSection.currentPage = 0
-            QryForm.respData = response.data
-            QryForm.respData.duration = Math.ceil(QryForm.respData.duration / 1e+6) // nanoseconds to milliseconds
+            QryForm.results = response.data
+            QryForm.results.forEach((result) => {
+                result.duration = Math.ceil(result.duration / 1e+6) // nanoseconds to milliseconds
+            })
+            // show the last result, or the first error
+            QryForm.selectResult(QryForm.results.findIndex((result) => result.DBerror !== ""))
         }).catch((e) => {
             QryForm.executing = false
             QryForm.xhr = null
+            QryForm.queryId = null
             QryForm.error = e.response.error;
+            if (e.code === 404) {
+                QryForm.session = null // expired, its transaction was rolled back
+            }
+        })
+    },
+    // cancel the running query on the server, its statement is killed on the database server, then drop the request
+    abortQuery: () => {
+        if (QryForm.queryId) {
+            m.request({
+                method: "DELETE",
+                url: "/api/queries/:id",
+                params: { id: QryForm.queryId },
+                headers: App.getAuthHeaders(),
+            }).catch(() => { }) // already finished
+            QryForm.queryId = null
+        }
+        QryForm.xhr.abort()
+        QryForm.xhr = null
+        QryForm.executing = false
+    },
+    // open a session and begin a transaction, the next queries run in it until commit or rollback
+    beginTransaction: () => {
+        QryForm.error = null
+        const formData = new FormData()
+        formData.set("dsName", QueryPage.dsName)
+        formData.set("schema", QueryPage.schema)
+        m.request({
+            method: "POST",
+            url: "/api/sessions",
+            headers: App.getAuthHeaders(),
+            body: formData
+        }).then((response) => {
+            return m.request({
+                method: "POST",
+                url: "/api/sessions/:id/begin",
+                params: { id: response.data.id },
+                headers: App.getAuthHeaders()
+            }).catch((e) => {
+                QryForm.session = response.data
+                QryForm.closeSession()
+                throw e
+            })
+        }).then((response) => {
+            QryForm.session = response.data
+        }).catch((e) => {
+            QryForm.error = e.response.error
+        })
+    },
+    // commit or rollback the transaction, then close the session
+    endTransaction: (action) => {
+        QryForm.error = null
+        m.request({
+            method: "POST",
+            url: "/api/sessions/:id/" + action,
+            params: { id: QryForm.session.id },
+            headers: App.getAuthHeaders()
+        }).then(() => {
+            QryForm.closeSession()
+        }).catch((e) => {
+            QryForm.error = e.response.error
+            if (e.code === 404) {
+                QryForm.session = null
+            }
         })
     },
+    // close the session, an open transaction is rolled back
+    closeSession: () => {
+        if (!QryForm.session) {
+            return
+        }
+        m.request({
+            method: "DELETE",
+            url: "/api/sessions/:id",
+            params: { id: QryForm.session.id },
+            headers: App.getAuthHeaders()
+        }).catch(() => { })
+        QryForm.session = null
+    },
+    selectResult: (index) => {
+        if (index < 0 || index >= QryForm.results.length) {
+            index = QryForm.results.length - 1
+        }
+        QryResultSection.currentPage = 0
+        QryForm.resultIndex = index
+        QryForm.respData = QryForm.results[index] || null
+    },
     // download results form: see view
     view: () => {
         return [
@@ -114,12 +216,21 @@ const QryForm = {
                     m("fieldset",
                         m("legend", "query execution"),
                         m("button[type=button]", {
+                            title: "Estimated plan, the query is not executed.",
                             disabled: QryForm.executing,
                             onclick: () => {
-                                QryExplainForm.submit()
+                                QryExplainForm.submit("estimated")
                                 QueryPage.tabState.set("explain")
                             }
                         }, "explain"),
+                        m("button[type=button].ml-10", {
+                            title: "Actual plan, the query is executed in a transaction that is rolled back.",
+                            disabled: QryForm.executing,
+                            onclick: () => {
+                                QryExplainForm.submit("actual")
+                                QueryPage.tabState.set("explain")
+                            }
+                        }, "explain analyze"),
                         m("button[type=button].ml-10", {
                             disabled: QryForm.executing,
                             onclick: () => {
@@ -131,13 +242,29 @@ const QryForm = {
                         m("button[type=button]", {
                             title: "Abort execution.",
                             disabled: !QryForm.executing,
-                            onclick: () => {
-                                QryForm.xhr.abort()
-                                QryForm.xhr = null
-                                QryForm.executing = false
-                            }
+                            onclick: () => QryForm.abortQuery()
                         }, "■"),
                     ),
+                    m("fieldset",
+                        m("legend", "transaction"),
+                        !QryForm.session ? m("button[type=button]", {
+                            title: "Run the next queries in a transaction, until commit or rollback.",
+                            disabled: QryForm.executing || !QueryPage.dsName,
+                            onclick: () => QryForm.beginTransaction()
+                        }, "begin") : [
+                            m("button[type=button]", {
+                                disabled: QryForm.executing,
+                                onclick: () => QryForm.endTransaction("commit")
+                            }, "commit"),
+                            m("button[type=button].ml-10", {
+                                disabled: QryForm.executing,
+                                onclick: () => QryForm.endTransaction("rollback")
+                            }, "rollback"),
+                            m("span.ml-10.text-warning", {
+                                title: "An idle transaction is rolled back after a timeout."
+                            }, "transaction open")
+                        ]
+                    ),
                     m("fieldset", { style: "float: right" },
                         m("legend", m.trust("&#8644 copy data")),
                         m("button[type=button]", {
@@ -6,7 +6,8 @@ const QryExplainForm = {
         QryExplainForm.query = null;
         QryExplainForm.respData = null;
     },
-    submit: () => {
+    // mode is "estimated", or "actual" to execute the query in a transaction that is rolled back
+    submit: (mode) => {
         QryExplainForm.executing = true;
         QryExplainForm.error = null
         QryExplainForm.respData = null;
@@ -29,7 +30,7 @@ const QryExplainForm = {
         formData.set("schema", QueryPage.schema);
         formData.set("query", QryExplainForm.query);
         formData.set("statementType", "query");
-        formData.set("explain", "1");
+        formData.set("explain", mode);
 
         m.request({
             method: "POST",
@@ -39,14 +40,42 @@ const QryExplainForm = {
             body: formData,
         }).then(function (response) {
             QryExplainForm.executing = false;
-            QryExplainForm.respData = response.data;
+            // the plan follows the query result with a mssql actual plan
+            QryExplainForm.respData = response.data.find((d) => d.plan) || response.data[0];
         }).catch((e) => {
             QryExplainForm.executing = false
             QryExplainForm.error = e.response.error;
         });
     },
+    // plan tree rows, a node is indented by its depth
+    planRows: (node, depth, rows) => {
+        rows.push({ node, depth });
+        (node.children || []).forEach((c) => QryExplainForm.planRows(c, depth + 1, rows));
+        return rows;
+    },
+    // number of a plan node, blank when the vendor does not report it
+    planNumber: (v) => v === undefined || v === null ? "" : Number(v.toFixed(3)).toLocaleString(),
+    // plan tree with one row by node, the most expensive nodes are highlighted
+    planView: (plan) => {
+        return m("table.comptext", [
+            m("thead", m("tr",
+                ["operator", "relation", "estimated rows", "actual rows", "cost", "time (ms)", "detail"].map((v) => m("th", v)),
+            )),
+            m("tbody", QryExplainForm.planRows(plan, 0, []).map(({ node, depth }) =>
+                m("tr", { class: node.expensive ? "expensive" : "", title: node.expensive ? "most expensive node" : "" },
+                    m("td", { style: "padding-left: " + (5 + depth * 15) + "px;" }, node.operator),
+                    m("td", node.relation || ""),
+                    m("td.tar", QryExplainForm.planNumber(node.estimatedRows)),
+                    m("td.tar", QryExplainForm.planNumber(node.actualRows)),
+                    m("td.tar", QryExplainForm.planNumber(node.cost)),
+                    m("td.tar", QryExplainForm.planNumber(node.time)),
+                    m("td", node.detail || ""),
+                ),
+            )),
+        ]);
+    },
     view: () => {
-        if (QryExplainForm.respData) {
+        if (QryExplainForm.respData && !QryExplainForm.respData.plan) {
             /* table col widths */
             var tableDim = new TableDim();
             tableDim.setRows(QryExplainForm.respData.rows.slice(0, 10).concat([QryExplainForm.respData.cols])) // first 10 rows + colnames
@@ -65,6 +94,9 @@ const QryExplainForm = {
         if (QryExplainForm.respData && QryExplainForm.respData.DBerror)
             return m("div.error", QryExplainForm.respData.DBerror);
 
+        if (QryExplainForm.respData && QryExplainForm.respData.plan)
+            return QryExplainForm.planView(QryExplainForm.respData.plan);
+
         if (QryExplainForm.respData) {
             return [
                 m("table.comptext", { style: "width: " + tableDim.getTotalWidth() + "px;" }, [
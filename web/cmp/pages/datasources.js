@@ -4,6 +4,7 @@ function DatasourcesPage() {
         notRegisteredDSs: [],
         users: [],
         vendors: [],
+        permissions: ["read-only", "read-write", "ddl", "admin"], // from lowest to full access
 
         usernameInput: "",
         vendorInput: "",
@@ -66,13 +67,14 @@ function DatasourcesPage() {
                 throw e;
             });
         },
-        postUserDatasources: function (username, dsname) {
+        // grant a data source, or change its permission level
+        postUserDatasources: function (username, dsname, permission) {
             this.postUserDatasourcesError = "";
             return m.request({
                 method: "POST",
                 url: "/api/users/:username/data-sources/:dsname",
                 headers: App.getAuthHeaders(),
-                params: { username, dsname }
+                params: { username, dsname, permission }
             }).then((response) => {
                 this.getUsersDatasources(this.usernameInput);
                 this.getUsersAvailableDatasources(this.usernameInput);
@@ -148,7 +150,8 @@ function DatasourcesPage() {
                         e.preventDefault();
                         const username = e.target.elements["username"].value;
                         const dsname = e.target.elements["dsname"].value;
-                        this.postUserDatasources(username, dsname)
+                        const permission = e.target.elements["permission"].value;
+                        this.postUserDatasources(username, dsname, permission)
                             .then(() => {
                                 e.target.reset();
                             });
@@ -176,13 +179,14 @@ function DatasourcesPage() {
                                     m("th", "vendor"),
                                     m("th", "name"),
                                     m("th", "location"),
+                                    m("th", "permission"),
                                     m("th", "action"),
                                 ])
                             ),
                             m("tbody",
                                 this.registeredDSs.length === 0
                                     ? m("tr",
-                                        m("td[colspan=4]", "No data sources found.")
+                                        m("td[colspan=5]", "No data sources found.")
                                     )
                                     : this.registeredDSs.map(row =>
                                         m("tr", [
@@ -190,6 +194,16 @@ function DatasourcesPage() {
                                             m(Cell, { val: row.name, type: "string" }),
                                             m(Cell, { val: row.location, type: "string" }),
 
+                                            // change permission level
+                                            m("td",
+                                                m("select", {
+                                                    disabled: !App.getIsAdmin(),
+                                                    onchange: (e) => {
+                                                        this.postUserDatasources(this.usernameInput, row.name, e.target.value);
+                                                    }
+                                                }, this.permissions.map(p => m("option", { value: p, selected: p === row.permission }, p)))
+                                            ),
+
                                             // remove data source
                                             m("td.tar",
                                                 m("button[type=button]", {
@@ -218,6 +232,10 @@ function DatasourcesPage() {
                                     options: toSelectOptions(this.notRegisteredDSs, "", "name", "name", "vendor")
                                 }),
                             ),
+                            m("label.ml-10",
+                                m("span", "permission: "),
+                                m("select[name=permission]", this.permissions.map(p => m("option", { value: p }, p)))
+                            ),
                             m("button[type=submit]", "submit"),
                             m("div", this.postUserDatasourcesError)
                         ),
@@ -25,6 +25,8 @@ const QueryPage = {
                                     QueryPage.SchemaInput.reset();
                                     DSInfoSection.reset();
                                     QryForm.reset();
+                                    QryHistorySection.reset();
+                                    QrySavedSection.reset();
                                     DataDictForm.reset();
                                 }
                             })
@@ -76,7 +78,7 @@ const QueryPage = {
                                 m("div.area-query-splitter.splitter.splitter-horizontal"),
                                 m("div",
                                     m("section.area-query-output-menu",
-                                        m("div.grid", { style: "grid-template-columns: auto auto 1fr;" },
+                                        m("div.grid", { style: "grid-template-columns: auto auto auto auto 1fr;" },
                                             m("div.grid-col.tab.tab-b", {
                                                 class: QueryPage.tabState.selectedClass("result"),
                                                 onclick: () => QueryPage.tabState.set("result")
@@ -85,12 +87,28 @@ const QueryPage = {
                                                 class: QueryPage.tabState.selectedClass("explain"),
                                                 onclick: () => QueryPage.tabState.set("explain")
                                             }, "explain"),
+                                            m("div.grid-col.tab.tab-b.ml-20", {
+                                                class: QueryPage.tabState.selectedClass("history"),
+                                                onclick: () => {
+                                                    QueryPage.tabState.set("history");
+                                                    QryHistorySection.get();
+                                                }
+                                            }, "history"),
+                                            m("div.grid-col.tab.tab-b.ml-20", {
+                                                class: QueryPage.tabState.selectedClass("saved"),
+                                                onclick: () => {
+                                                    QueryPage.tabState.set("saved");
+                                                    QrySavedSection.get();
+                                                }
+                                            }, "saved"),
                                             m("div.grid-col.align-items-end.ml-50", m(QryInfosSection)),
                                         ),
                                     ),
                                     m("section.area-query-output",
                                         m("div", { class: QueryPage.tabState.displayClass("result") }, m(QryResultSection)),
                                         m("div", { class: QueryPage.tabState.displayClass("explain") }, m(QryExplainForm)),
+                                        m("div", { class: QueryPage.tabState.displayClass("history") }, m(QryHistorySection)),
+                                        m("div", { class: QueryPage.tabState.displayClass("saved") }, m(QrySavedSection)),
                                     )
                                 )
                             )
@@ -0,0 +1,50 @@
+// query history of the selected data source, a click loads the query in the editor
+const QryHistorySection = {
+    entries: [],
+    search: "",
+    error: "",
+    get: () => {
+        QryHistorySection.error = "";
+        m.request({
+            method: "GET",
+            url: "/api/query-history",
+            params: { dsName: QueryPage.dsName, q: QryHistorySection.search, limit: 100 },
+            headers: App.getAuthHeaders(),
+        }).then((response) => {
+            QryHistorySection.entries = response.data || [];
+        }).catch((e) => {
+            QryHistorySection.error = e.response.error;
+        });
+    },
+    reset: () => {
+        QryHistorySection.entries = [];
+        QryHistorySection.search = "";
+        QryHistorySection.error = "";
+    },
+    view: () => {
+        return [
+            m("div.mt-5.mb-5",
+                m("input[type=search]", {
+                    placeholder: "text in the query",
+                    value: QryHistorySection.search,
+                    oninput: (e) => QryHistorySection.search = e.target.value,
+                    onkeyup: (e) => e.key === "Enter" && QryHistorySection.get(),
+                }),
+                m("button[type=button].ml-10", { onclick: () => QryHistorySection.get() }, "search"),
+            ),
+            QryHistorySection.error ? m("div.error", "error: " + QryHistorySection.error) : null,
+            m("table.comptext",
+                QryHistorySection.entries.map((entry) => m("tr.pointer", {
+                    title: "Load the query in the editor.",
+                    onclick: () => QryForm.editor.setCode(entry.query),
+                },
+                    m("td.no-wrap", new Date(entry.startedAt).toLocaleString()),
+                    m("td", entry.stmtCmd),
+                    m("td.tar.no-wrap", Math.ceil(entry.duration / 1e+6) + " ms"),
+                    m("td.tar.no-wrap", entry.rowsReturned || entry.rowsAffected),
+                    m("td.no-wrap", { class: entry.error ? "error" : "" }, entry.error ? entry.error : entry.query),
+                )),
+            ),
+        ];
+    }
+};
@@ -34,11 +34,23 @@ const QryResultSection = {
         if (QryForm.error)
             return m("div.error", "error: " + QryForm.error);
 
+        // result selection, when a script returns several results
+        const resultSelect = QryForm.results.length < 2 ? null : m("div.mb-5",
+            m("select", {
+                onchange: (e) => QryForm.selectResult(Number(e.target.value))
+            }, QryForm.results.map((result, idx) => m("option", {
+                value: idx,
+                selected: idx === QryForm.resultIndex
+            }, "result " + (idx + 1) + " of " + QryForm.results.length + (result.DBerror ? " (error)" : "") +
+                (result.statement ? ": " + result.statement.slice(0, 60) : ""))))
+        );
+
         if (QryForm.respData && QryForm.respData.DBerror)
-            return m("div.error", QryForm.respData.DBerror);
+            return [resultSelect, m("div.error", QryForm.respData.DBerror)];
 
         if (QryForm.respData) {
             return [
+                resultSelect,
                 m("div", { style: "height: " + (totalPages ? "260px" : "auto") },
                     m("table.comptext", { style: "width: " + tableDim.getTotalWidth() + "px;" }, [
                         m("thead", [
@@ -0,0 +1,109 @@
+// saved queries that apply to the selected data source, a click loads the query in the editor
+const QrySavedSection = {
+    queries: [],
+    id: 0, // loaded query, saved again with an update
+    name: "",
+    folder: "",
+    error: "",
+    get: () => {
+        QrySavedSection.error = "";
+        m.request({
+            method: "GET",
+            url: "/api/saved-queries",
+            params: { dsName: QueryPage.dsName },
+            headers: App.getAuthHeaders(),
+        }).then((response) => {
+            QrySavedSection.queries = response.data || [];
+        }).catch((e) => {
+            QrySavedSection.error = e.response.error;
+        });
+    },
+    load: (q) => {
+        QrySavedSection.id = q.id;
+        QrySavedSection.name = q.name;
+        QrySavedSection.folder = q.folder;
+        QryForm.editor.setCode(q.query);
+    },
+    save: () => {
+        QrySavedSection.error = "";
+        m.request({
+            method: QrySavedSection.id ? "PUT" : "POST",
+            url: QrySavedSection.id ? "/api/saved-queries/:id" : "/api/saved-queries",
+            params: QrySavedSection.id ? { id: QrySavedSection.id } : {},
+            headers: App.getAuthHeaders(),
+            body: {
+                name: QrySavedSection.name,
+                folder: QrySavedSection.folder,
+                dsName: QueryPage.dsName,
+                query: QryForm.editor.getCode(),
+            },
+        }).then((response) => {
+            QrySavedSection.id = response.data.id;
+            QrySavedSection.get();
+        }).catch((e) => {
+            QrySavedSection.error = e.response.error;
+        });
+    },
+    delete: (q) => {
+        if (!confirm(`Delete the saved query ${q.name}?`)) return;
+        m.request({
+            method: "DELETE",
+            url: "/api/saved-queries/:id",
+            params: { id: q.id },
+            headers: App.getAuthHeaders(),
+        }).then(() => {
+            if (QrySavedSection.id === q.id) QrySavedSection.id = 0;
+            QrySavedSection.get();
+        }).catch((e) => {
+            QrySavedSection.error = e.response.error;
+        });
+    },
+    reset: () => {
+        QrySavedSection.queries = [];
+        QrySavedSection.id = 0;
+        QrySavedSection.name = "";
+        QrySavedSection.folder = "";
+        QrySavedSection.error = "";
+    },
+    view: () => {
+        return [
+            m("div.mt-5.mb-5",
+                m("input[type=text]", {
+                    placeholder: "folder",
+                    value: QrySavedSection.folder,
+                    oninput: (e) => QrySavedSection.folder = e.target.value,
+                }),
+                m("input[type=text].ml-10", {
+                    placeholder: "name",
+                    value: QrySavedSection.name,
+                    oninput: (e) => QrySavedSection.name = e.target.value,
+                }),
+                m("button[type=button].ml-10", {
+                    title: "Save the editor query.",
+                    onclick: () => QrySavedSection.save(),
+                }, QrySavedSection.id ? "update" : "save"),
+                QrySavedSection.id ? m("button[type=button].ml-10", {
+                    title: "Save the editor query as a new query.",
+                    onclick: () => { QrySavedSection.id = 0; QrySavedSection.save(); },
+                }, "save as new") : null,
+            ),
+            QrySavedSection.error ? m("div.error", "error: " + QrySavedSection.error) : null,
+            m("table.comptext",
+                QrySavedSection.queries.map((q) => m("tr.pointer", {
+                    title: "Load the query in the editor.",
+                    class: q.id === QrySavedSection.id ? "selected" : "",
+                    onclick: () => QrySavedSection.load(q),
+                },
+                    m("td.no-wrap", q.folder),
+                    m("td.no-wrap", q.name),
+                    m("td.no-wrap", q.owner),
+                    m("td.no-wrap", q.query),
+                    m("td.pointer", {
+                        title: "Delete the saved query.",
+                        onclick: (e) => { e.stopPropagation(); QrySavedSection.delete(q); },
+                    }, m.trust("&times;")),
+                )),
+            ),
+        ];
+    }
+};
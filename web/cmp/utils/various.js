@@ -315,4 +315,10 @@ function toSelectOptions(rows, emptyName, valueCol, labelCol, groupCol) {
         group: u[groupCol]
     })));
     return options;
-}
\ No newline at end of file
+}
+
+// Returns a random query id, sent with a query to cancel it while it runs
+function newQueryId() {
+    const bytes = crypto.getRandomValues(new Uint8Array(16));
+    return Array.from(bytes, (b) => b.toString(16).padStart(2, "0")).join("");
+}
@@ -13,6 +13,8 @@ import "./cmp/inputs/logout.js";
 import "./cmp/sections/dsInfo.js";
 import "./cmp/sections/qryInfos.js";
 import "./cmp/sections/qryResult.js";
+import "./cmp/sections/qryHistory.js";
+import "./cmp/sections/qrySaved.js";
 import "./cmp/sections/dictColumns.js";
 import "./cmp/sections/dictCode.js";
 import "./cmp/forms/qryExplain.js";
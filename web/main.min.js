@@ -28,6 +28,7 @@ function WaitingAnimation(vnode){const animationState={baseText:vnode.attrs.text
 function parseJwt(token){const base64Url=token.split('.')[1];const base64=base64Url.replace(/-/g,'+').replace(/_/g,'/');const jsonPayload=decodeURIComponent(atob(base64).split('').map(function(c){return'%'+('00'+c.charCodeAt(0).toString(16)).slice(-2);}).join(''));return JSON.parse(jsonPayload);}
 function toSelectOptions(rows,emptyName,valueCol,labelCol,groupCol){const options=[];if(emptyName!==false){options.push({value:"",label:emptyName,});}
 options.push(...(rows||[]).map(u=>({value:u[valueCol],label:u[labelCol],group:u[groupCol]})));return options;}
+function newQueryId(){const bytes=crypto.getRandomValues(new Uint8Array(16));return Array.from(bytes,(b)=>b.toString(16).padStart(2,"0")).join("");}
 const OptGroup={view:({attrs:{rows,groupColname,contentColname,valueColname}})=>{if(!Array.isArray(rows)||!groupColname||!contentColname||!valueColname)return null;const groups=rows.reduce((acc,row)=>{const group=row[groupColname]||"";if(!acc[group])acc[group]=[];acc[group].push(row);return acc;},{});return Object.entries(groups).map(([group,items])=>group?m("optgroup",{label:group},items.map(item=>m("option",{value:item[valueColname]},item[contentColname]))):items.map(item=>m("option",{value:item[valueColname]},item[contentColname])));}};function DataSourceInput(){return{dsNames:[],error:"",connecting:false,getDataSources:function(){m.request({method:"GET",url:"/api/users/:username/data-sources",params:{username:App.getUsername()},headers:App.getAuthHeaders(),}).then((response)=>{this.dsNames=response.data;App.noServerResponse=false}).catch((e)=>{App.noServerResponse=true})},testDataSource:function(dsName,onSuccess){this.connecting=true
 this.error=""
 m.request({method:"GET",url:"/api/users/:username/data-sources/:dsName/test",params:{username:App.getUsername(),dsName:dsName},headers:App.getAuthHeaders(),}).then((response)=>{this.connecting=false;if(onSuccess)onSuccess(dsName,response)}).catch((e)=>{this.connecting=false;this.error=e.response.error})},oninit:function(){this.getDataSources()},view:function(vnode){if(!this.dsNames.length)
@@ -62,24 +63,26 @@ return m.request({method:"GET",url,headers:App.getAuthHeaders(),params,}).then((
 return;let i=0;DSInfoSection.hostname=!r.data.rows[0][i]?null:{"key":r.data.cols[i],"value":r.data.rows[0][i]};i++;DSInfoSection.port=!r.data.rows[0][i]?null:{"key":r.data.cols[i],"value":r.data.rows[0][i]};i++;DSInfoSection.database=!r.data.rows[0][i]?null:{"key":r.data.cols[i],"value":r.data.rows[0][i]};i++;DSInfoSection.schema=!r.data.rows[0][i]?null:{"key":r.data.cols[i],"value":r.data.rows[0][i]};i++;DSInfoSection.user=!r.data.rows[0][i]?null:{"key":r.data.cols[i],"value":r.data.rows[0][i]};i++;DSInfoSection.version=!r.data.rows[0][i]?null:{"key":r.data.cols[i],"value":r.data.rows[0][i]};i++;})},view:()=>{return[!DSInfoSection.response?null:[DSInfoSection.error?m("div.text-warning",DSInfoSection.error):[!DSInfoSection.database?null:m("div.font-sm.mr-20",m("span",DSInfoSection.database.key+": "),m("span.info",{title:DSInfoSection.database.value},DSInfoSection.database.value.split(/[/\\]/).pop())),!DSInfoSection.schema?null:m("div.font-sm.mr-20",m("span",DSInfoSection.schema.key+": "),m("span.info",DSInfoSection.schema.value)),!DSInfoSection.user?null:m("div.font-sm.mr-20",m("span",DSInfoSection.user.key+": "),m("span.info",DSInfoSection.user.value)),!DSInfoSection.hostname?null:m("div.font-sm.mr-20",m("span",DSInfoSection.hostname.key+": "),m("span.info",DSInfoSection.hostname.value+(DSInfoSection.port.value?":"+DSInfoSection.port.value:""))),!DSInfoSection.version?null:m("div.font-sm.mr-20.no-overflow",{style:"max-width: 220px;"},m("span",DSInfoSection.version.key+": "),m("span.info",{title:DSInfoSection.version.value},DSInfoSection.version.value))]]];}};const QryInfosSection={rowsAffected:"",duration:"",truncated:false,clockResolution:null,oninit:()=>{return m.request({method:"GET",url:"/api/clock-resolution",headers:App.getAuthHeaders(),}).then(function(result){QryInfosSection.clockResolution=Math.ceil(result.data/1e+6)+" ms";})},reset:()=>{QryInfosSection.rowsAffected="";QryInfosSection.duration="";QryInfosSection.truncated=false;},view:()=>{QryInfosSection.rowsAffected=!QryForm.respData||QryForm.respData.DBerror!==""||QryForm.respData.stmtType==="query"?"-":QryForm.respData.rowsAffected;QryInfosSection.rowsReturned=!QryForm.respData||QryForm.respData.DBerror!==""||QryForm.respData.stmtType==="non-query"?"-":QryForm.respData.rowsReturned;QryInfosSection.duration=!QryForm.respData?"-":(QryForm.respData.duration==0?"<"+QryInfosSection.clockResolution:QryForm.respData.duration)+" ms";QryInfosSection.truncated=!QryForm.respData?false:QryForm.respData.truncated;return[!QryInfosSection.duration?null:[m("div.tab-addon.font-sm.mr-20",{style:"min-width: 130px; "},"rows returned: ",m('span.info',{class:QryInfosSection.truncated?"text-warning":"",title:QryInfosSection.truncated?"The result is truncated. Use export to get the full result.":"",},QryInfosSection.rowsReturned)),m("div.tab-addon.font-sm.mr-20",{style:"min-width: 130px; "},"rows affected: ",m("span.info",QryInfosSection.rowsAffected)),m("div.tab-addon.font-sm.mr-20","duration: ",m("span.info",QryInfosSection.duration)),]];}};const QryResultSection={currentPage:0,pageSize:15,initPagination:()=>{const totalRows=QryForm.respData&&QryForm.respData.rows?QryForm.respData.rows.length:0;const totalPages=Math.ceil(totalRows/QryResultSection.pageSize);const startIndex=QryResultSection.currentPage*QryResultSection.pageSize;const endIndex=startIndex+QryResultSection.pageSize;const setPage=function(page){if(page>=0&&page<totalPages){QryResultSection.currentPage=page;}};return{totalRows,totalPages,startIndex,endIndex,setPage};},view:()=>{if(QryForm.respData){var{totalPages,startIndex,endIndex,setPage}=QryResultSection.initPagination();var tableDim=new TableDim();tableDim.setRows(QryForm.respData.rows.slice(0,10).concat([QryForm.respData.cols])).setCharWidth(6.5).setAvailableWidth(document.body.clientWidth+ -30).setTdPadding(10+2).calc();}
 if(QryForm.executing)
 return m(WaitingAnimation,{text:"waiting for results"});if(QryForm.error)
-return m("div.error","error: "+QryForm.error);if(QryForm.respData&&QryForm.respData.DBerror)
-return m("div.error",QryForm.respData.DBerror);if(QryForm.respData){return[m("div",{style:"height: "+(totalPages?"260px":"auto")},m("table.comptext",{style:"width: "+tableDim.getTotalWidth()+"px;"},[m("thead",[m("tr",[QryForm.respData.cols.map(function(v,idx){return m("th",{title:v,style:"width: "+tableDim.getColWidth(idx)+"px;"},v);})])]),m("tbody",[QryForm.respData.rows.slice(startIndex,endIndex).map(function(row){return m("tr",row.map(function(v,i){return m(Cell,{val:v,type:QryForm.respData.databaseTypes[i]});}));})])])),!totalPages?null:m("div.mt-5.tac",m("button",{onclick:function(){setPage(QryResultSection.currentPage-1);},disabled:QryResultSection.currentPage===0},"Previous"),m("span.ml-10","Page "+(QryResultSection.currentPage+1)+" of "+Math.max(totalPages,1)),m("button.ml-10",{onclick:function(){setPage(QryResultSection.currentPage+1);},disabled:QryResultSection.currentPage===totalPages-1},"Next"))]}}}
-const DictColumnsSection={tableDim:null,resizeObserver:null,rowsSample:null,view:(vnode)=>{const resp=vnode.attrs.resp;const selected=vnode.attrs.selected;if(resp?.rows?.length){DictColumnsSection.rowsSample=resp.rows.slice(0,10).concat([resp.cols]);let availableWidth=document.querySelector('#dataDictDef').clientWidth-7;DictColumnsSection.tableDim=new TableDim().setRows(DictColumnsSection.rowsSample).setCharWidth(6.5).setAvailableWidth(availableWidth).setTdPadding(10).calc();}
+return m("div.error","error: "+QryForm.error);const resultSelect=QryForm.results.length<2?null:m("div.mb-5",m("select",{onchange:(e)=>QryForm.selectResult(Number(e.target.value))},QryForm.results.map((result,idx)=>m("option",{value:idx,selected:idx===QryForm.resultIndex},"result "+(idx+1)+" of "+QryForm.results.length+(result.DBerror?" (error)":"")+
+(result.statement?": "+result.statement.slice(0,60):"")))));if(QryForm.respData&&QryForm.respData.DBerror)
+return[resultSelect,m("div.error",QryForm.respData.DBerror)];if(QryForm.respData){return[resultSelect,m("div",{style:"height: "+(totalPages?"260px":"auto")},m("table.comptext",{style:"width: "+tableDim.getTotalWidth()+"px;"},[m("thead",[m("tr",[QryForm.respData.cols.map(function(v,idx){return m("th",{title:v,style:"width: "+tableDim.getColWidth(idx)+"px;"},v);})])]),m("tbody",[QryForm.respData.rows.slice(startIndex,endIndex).map(function(row){return m("tr",row.map(function(v,i){return m(Cell,{val:v,type:QryForm.respData.databaseTypes[i]});}));})])])),!totalPages?null:m("div.mt-5.tac",m("button",{onclick:function(){setPage(QryResultSection.currentPage-1);},disabled:QryResultSection.currentPage===0},"Previous"),m("span.ml-10","Page "+(QryResultSection.currentPage+1)+" of "+Math.max(totalPages,1)),m("button.ml-10",{onclick:function(){setPage(QryResultSection.currentPage+1);},disabled:QryResultSection.currentPage===totalPages-1},"Next"))]}}}
+const QryHistorySection={entries:[],search:"",error:"",get:()=>{QryHistorySection.error="";m.request({method:"GET",url:"/api/query-history",params:{dsName:QueryPage.dsName,q:QryHistorySection.search,limit:100},headers:App.getAuthHeaders(),}).then((response)=>{QryHistorySection.entries=response.data||[];}).catch((e)=>{QryHistorySection.error=e.response.error;});},reset:()=>{QryHistorySection.entries=[];QryHistorySection.search="";QryHistorySection.error="";},view:()=>{return[m("div.mt-5.mb-5",m("input[type=search]",{placeholder:"text in the query",value:QryHistorySection.search,oninput:(e)=>QryHistorySection.search=e.target.value,onkeyup:(e)=>e.key==="Enter"&&QryHistorySection.get(),}),m("button[type=button].ml-10",{onclick:()=>QryHistorySection.get()},"search"),),QryHistorySection.error?m("div.error","error: "+QryHistorySection.error):null,m("table.comptext",QryHistorySection.entries.map((entry)=>m("tr.pointer",{title:"Load the query in the editor.",onclick:()=>QryForm.editor.setCode(entry.query),},m("td.no-wrap",new Date(entry.startedAt).toLocaleString()),m("td",entry.stmtCmd),m("td.tar.no-wrap",Math.ceil(entry.duration/1e+6)+" ms"),m("td.tar.no-wrap",entry.rowsReturned||entry.rowsAffected),m("td.no-wrap",{class:entry.error?"error":""},entry.error?entry.error:entry.query),)),),];}};const QrySavedSection={queries:[],id:0,name:"",folder:"",error:"",get:()=>{QrySavedSection.error="";m.request({method:"GET",url:"/api/saved-queries",params:{dsName:QueryPage.dsName},headers:App.getAuthHeaders(),}).then((response)=>{QrySavedSection.queries=response.data||[];}).catch((e)=>{QrySavedSection.error=e.response.error;});},load:(q)=>{QrySavedSection.id=q.id;QrySavedSection.name=q.name;QrySavedSection.folder=q.folder;QryForm.editor.setCode(q.query);},save:()=>{QrySavedSection.error="";m.request({method:QrySavedSection.id?"PUT":"POST",url:QrySavedSection.id?"/api/saved-queries/:id":"/api/saved-queries",params:QrySavedSection.id?{id:QrySavedSection.id}:{},headers:App.getAuthHeaders(),body:{name:QrySavedSection.name,folder:QrySavedSection.folder,dsName:QueryPage.dsName,query:QryForm.editor.getCode(),},}).then((response)=>{QrySavedSection.id=response.data.id;QrySavedSection.get();}).catch((e)=>{QrySavedSection.error=e.response.error;});},delete:(q)=>{if(!confirm(`Delete the saved query ${q.name}?`))return;m.request({method:"DELETE",url:"/api/saved-queries/:id",params:{id:q.id},headers:App.getAuthHeaders(),}).then(()=>{if(QrySavedSection.id===q.id)QrySavedSection.id=0;QrySavedSection.get();}).catch((e)=>{QrySavedSection.error=e.response.error;});},reset:()=>{QrySavedSection.queries=[];QrySavedSection.id=0;QrySavedSection.name="";QrySavedSection.folder="";QrySavedSection.error="";},view:()=>{return[m("div.mt-5.mb-5",m("input[type=text]",{placeholder:"folder",value:QrySavedSection.folder,oninput:(e)=>QrySavedSection.folder=e.target.value,}),m("input[type=text].ml-10",{placeholder:"name",value:QrySavedSection.name,oninput:(e)=>QrySavedSection.name=e.target.value,}),m("button[type=button].ml-10",{title:"Save the editor query.",onclick:()=>QrySavedSection.save(),},QrySavedSection.id?"update":"save"),QrySavedSection.id?m("button[type=button].ml-10",{title:"Save the editor query as a new query.",onclick:()=>{QrySavedSection.id=0;QrySavedSection.save();},},"save as new"):null,),QrySavedSection.error?m("div.error","error: "+QrySavedSection.error):null,m("table.comptext",QrySavedSection.queries.map((q)=>m("tr.pointer",{title:"Load the query in the editor.",class:q.id===QrySavedSection.id?"selected":"",onclick:()=>QrySavedSection.load(q),},m("td.no-wrap",q.folder),m("td.no-wrap",q.name),m("td.no-wrap",q.owner),m("td.no-wrap",q.query),m("td.pointer",{title:"Delete the saved query.",onclick:(e)=>{e.stopPropagation();QrySavedSection.delete(q);},},m.trust("&times;")),)),),];}};const DictColumnsSection={tableDim:null,resizeObserver:null,rowsSample:null,view:(vnode)=>{const resp=vnode.attrs.resp;const selected=vnode.attrs.selected;if(resp?.rows?.length){DictColumnsSection.rowsSample=resp.rows.slice(0,10).concat([resp.cols]);let availableWidth=document.querySelector('#dataDictDef').clientWidth-7;DictColumnsSection.tableDim=new TableDim().setRows(DictColumnsSection.rowsSample).setCharWidth(6.5).setAvailableWidth(availableWidth).setTdPadding(10).calc();}
 return[!resp?null:[resp.DBerror?m("div.text-warning",resp.DBerror):m("table",{style:{width:(DictColumnsSection.tableDim.getTotalWidth())+"px"},oninit:()=>{DictColumnsSection.resizeObserver=new ResizeObserver(entries=>{window.requestAnimationFrame(()=>{DictColumnsSection.tableDim.setAvailableWidth(entries[0].contentRect.width).calc();m.redraw();});});},oncreate:()=>{DictColumnsSection.resizeObserver.observe(document.querySelector('#dataDictDef'));},onremove:()=>{DictColumnsSection.resizeObserver.disconnect();}},[m("caption",selected),m("thead",[m("tr",[resp.cols.map(function(v,idx){return m("th",{style:"width: "+DictColumnsSection.tableDim.getColWidth(idx)+"px;"},v);})])]),m("tbody",[resp.rows.map(function(row){return m("tr",row.map(function(v,i){return m(Cell,{val:v,type:resp.databaseTypes[i]});}));})])])]]}}
 const DictCodeSection={view:(vnode)=>{const resp=vnode.attrs.resp;const selected=vnode.attrs.selected;let code="";if(resp?.rows?.length){if(resp.cols.length>1&&resp.rows.length==1){for(var i=0;i<resp.cols.length;i++){if(resp.cols[i].toLowerCase().startsWith("create")){code=resp.rows[0][i];break;}}}
 else if(resp.cols.length===1&&resp.rows.length>1){for(var i=0;i<resp.rows.length;i++){code+=resp.rows[i][0];}}
 if(code==="")code=resp.rows[0][0];}
 return[resp?.DBerror?m("div.text-warning.mt-10",resp.DBerror):code===""?null:m("table",[m("caption",selected),m("tbody",[m("tr",m("td",m("code",{id:"viewDef",oncreate:function(vnode){resp.editorTheme=App.theme;resp.editor=new SqlEditor(vnode.dom.id,isLightTheme(App.theme)?'light':'dark');resp.editor.setReadOnly(true);resp.editor.setCode(code);},onbeforeupdate:function(){if(resp.editorTheme!==App.theme){if(isLightTheme(App.theme))resp.editor.setLightTheme();else resp.editor.setDarkTheme();resp.editorTheme=App.theme;}
 return false;},},null)))])])]}}
-const QryExplainForm={query:"",respData:null,error:false,reset:()=>{QryExplainForm.query=null;QryExplainForm.respData=null;},submit:()=>{QryExplainForm.executing=true;QryExplainForm.error=null
+const QryExplainForm={query:"",respData:null,error:false,reset:()=>{QryExplainForm.query=null;QryExplainForm.respData=null;},submit:(mode)=>{QryExplainForm.executing=true;QryExplainForm.error=null
 QryExplainForm.respData=null;QryExplainForm.query=QryForm.editor.getCode().trim();if(!QryExplainForm.query.length){return;}
 let url,params;params={dsname:QueryPage.dsName};if(QueryPage.schema!==""){url="/api/query/:dsname/:schema";params.schema=QueryPage.schema;}else{url="/api/query/:dsname";}
-const formData=new FormData();formData.set("dsName",QueryPage.dsName);formData.set("schema",QueryPage.schema);formData.set("query",QryExplainForm.query);formData.set("statementType","query");formData.set("explain","1");m.request({method:"POST",url,params,headers:App.getAuthHeaders(),body:formData,}).then(function(response){QryExplainForm.executing=false;QryExplainForm.respData=response.data;}).catch((e)=>{QryExplainForm.executing=false
-QryExplainForm.error=e.response.error;});},view:()=>{if(QryExplainForm.respData){var tableDim=new TableDim();tableDim.setRows(QryExplainForm.respData.rows.slice(0,10).concat([QryExplainForm.respData.cols])).setCharWidth(6.5).setAvailableWidth(document.body.clientWidth+ -30).setTdPadding(10+2).calc();}
+const formData=new FormData();formData.set("dsName",QueryPage.dsName);formData.set("schema",QueryPage.schema);formData.set("query",QryExplainForm.query);formData.set("statementType","query");formData.set("explain",mode);m.request({method:"POST",url,params,headers:App.getAuthHeaders(),body:formData,}).then(function(response){QryExplainForm.executing=false;QryExplainForm.respData=response.data.find((d)=>d.plan)||response.data[0];}).catch((e)=>{QryExplainForm.executing=false
+QryExplainForm.error=e.response.error;});},planRows:(node,depth,rows)=>{rows.push({node,depth});(node.children||[]).forEach((c)=>QryExplainForm.planRows(c,depth+1,rows));return rows;},planNumber:(v)=>v===undefined||v===null?"":Number(v.toFixed(3)).toLocaleString(),planView:(plan)=>{return m("table.comptext",[m("thead",m("tr",["operator","relation","estimated rows","actual rows","cost","time (ms)","detail"].map((v)=>m("th",v)),)),m("tbody",QryExplainForm.planRows(plan,0,[]).map(({node,depth})=>m("tr",{class:node.expensive?"expensive":"",title:node.expensive?"most expensive node":""},m("td",{style:"padding-left: "+(5+depth*15)+"px;"},node.operator),m("td",node.relation||""),m("td.tar",QryExplainForm.planNumber(node.estimatedRows)),m("td.tar",QryExplainForm.planNumber(node.actualRows)),m("td.tar",QryExplainForm.planNumber(node.cost)),m("td.tar",QryExplainForm.planNumber(node.time)),m("td",node.detail||""),),)),]);},view:()=>{if(QryExplainForm.respData&&!QryExplainForm.respData.plan){var tableDim=new TableDim();tableDim.setRows(QryExplainForm.respData.rows.slice(0,10).concat([QryExplainForm.respData.cols])).setCharWidth(6.5).setAvailableWidth(document.body.clientWidth+ -30).setTdPadding(10+2).calc();}
 if(QryExplainForm.executing)
 return m(WaitingAnimation,{text:"waiting for results"});if(QryExplainForm.error)
 return m("div.error","error: "+QryExplainForm.error);if(QryExplainForm.respData&&QryExplainForm.respData.DBerror)
-return m("div.error",QryExplainForm.respData.DBerror);if(QryExplainForm.respData){return[m("table.comptext",{style:"width: "+tableDim.getTotalWidth()+"px;"},[m("thead",[m("tr",[QryExplainForm.respData.cols.map(function(v,idx){return m("th",{title:v,style:"width: "+tableDim.getColWidth(idx)+"px;"},v);})])]),m("tbody",[QryExplainForm.respData.rows.map(function(row){return m("tr",row.map(function(v,i){return m(Cell,{val:v,type:QryExplainForm.respData.databaseTypes[i]})}));})])])]}}}
+return m("div.error",QryExplainForm.respData.DBerror);if(QryExplainForm.respData&&QryExplainForm.respData.plan)
+return QryExplainForm.planView(QryExplainForm.respData.plan);if(QryExplainForm.respData){return[m("table.comptext",{style:"width: "+tableDim.getTotalWidth()+"px;"},[m("thead",[m("tr",[QryExplainForm.respData.cols.map(function(v,idx){return m("th",{title:v,style:"width: "+tableDim.getColWidth(idx)+"px;"},v);})])]),m("tbody",[QryExplainForm.respData.rows.map(function(row){return m("tr",row.map(function(v,i){return m(Cell,{val:v,type:QryExplainForm.respData.databaseTypes[i]})}));})])])]}}}
 function DataEndpointForm(){return{type:"",dsName:"",schema:"",table:"",tableMode:"existent",query:"",format:"",fileObject:null,FileInput:FileInput(),SchemaInput:SchemaInput(),TableInput:TableInput(),view:function(vnode){const{endPointType="origin"}=vnode.attrs||{}
 if(App.dataTransferAction){App.dataTransferAction=false
 this.type="query"
@@ -94,12 +97,15 @@ this.type=sel;}}))]),this.type==="file"?m("tr",[m("th","Format"),m("td",m(FileFo
 this.FileInput.reset()}
 this.format=sel;}}))]):null,this.type==="file"&&endPointType==="origin"&&this.format?m("tr",[m("th","File"),m("td",m(this.FileInput,{filename:this.fileObject?this.fileObject.name:"",namePrefix:endPointType,format:this.format,onChange:(file)=>{this.fileObject=file;}}))]):null,this.type==="table"||this.type==="query"?[m("tr",[m("th","Data source"),m("td",m(DataSourceInput,{value:this.dsName,namePrefix:endPointType,onChange:(sel)=>{this.schema=this.table=""
 this.dsName=sel;this.SchemaInput.getSchemas(this.dsName,this.schema)
-this.TableInput.getTables(this.dsName,this.schema)}}))]),m("tr",[m("th","Schema"),m("td",m(this.SchemaInput,{value:this.schema,namePrefix:endPointType,dsName:this.dsName,onChange:(sel)=>{this.table="";this.schema=sel;this.TableInput.getTables(this.dsName,this.schema)}}))]),]:null,this.type==="table"?[m("tr",[m("th.pointer",{style:{opacity:this.tableMode=="existent"?1:.4},onclick:(e)=>{this.tableMode="existent"}},"Table"),m("td",this.tableMode=="existent"&&m(this.TableInput,{value:this.table,namePrefix:endPointType,dsName:this.dsName,schema:this.schema,onChange:(sel)=>{this.table=sel}}),)]),endPointType=="destination"&&m("tr",[m("th.pointer",{style:{opacity:this.tableMode=="new"?1:.4},title:"A new table will be created with column names and types matching the source (copy from).",onclick:(e)=>{this.tableMode="new"}},"New table"),m("td",this.tableMode=="new"&&this.dsName!=""&&[m('input',{oncreate:(vnode)=>{vnode.dom.focus();},type:"text",autocomplete:"off",placeholder:"A new table will be created",name:`${endPointType}[table]`,value:this.table,onchange:(e)=>{this.table=e.target.value;}}),m('pre.info.','Only DB table, DB query, or JSON tabular file as source are supported.\nOther cases are not yet implemented.'),m('input',{type:"hidden",name:`${endPointType}[isNewTable]`,value:"1"})])]),]:null,this.type==="query"?[m("tr",[m("th","SQL Query"),m("td",{style:"padding-right: 0"},m('textarea',{value:this.query,name:endPointType+"[query]",onchange:(e)=>{this.query=e.target.value}}))])]:null,]);}};}
-const QryForm={query:"",respData:null,exportType:"",resizeObserver:null,editor:null,editorTheme:"",xhr:null,executing:false,error:false,selectedFileName:"",reset:()=>{QryForm.query=""
+this.TableInput.getTables(this.dsName,this.schema)}}))]),m("tr",[m("th","Schema"),m("td",m(this.SchemaInput,{value:this.schema,namePrefix:endPointType,dsName:this.dsName,onChange:(sel)=>{this.table="";this.schema=sel;this.TableInput.getTables(this.dsName,this.schema)}}))]),]:null,this.type==="table"?[m("tr",[m("th.pointer",{style:{opacity:this.tableMode=="existent"?1:.4},onclick:(e)=>{this.tableMode="existent"}},"Table"),m("td",this.tableMode=="existent"&&m(this.TableInput,{value:this.table,namePrefix:endPointType,dsName:this.dsName,schema:this.schema,onChange:(sel)=>{this.table=sel}}),)]),endPointType=="destination"&&this.tableMode=="existent"&&m("tr",[m("th","Schema changes"),m("td",[m("label",{title:"Columns found in the source but not in the table will be added."},[m("input[type=checkbox]",{name:`${endPointType}[evolve]`,value:"1"})," add missing columns"]),m("label",{title:"Varchar and decimal columns narrower than the source will be widened."},[m("input[type=checkbox]",{name:`${endPointType}[widen]`,value:"1"})," widen types"])])]),endPointType=="destination"&&m("tr",[m("th.pointer",{style:{opacity:this.tableMode=="new"?1:.4},title:"A new table will be created with column names and types matching the source (copy from).",onclick:(e)=>{this.tableMode="new"}},"New table"),m("td",this.tableMode=="new"&&this.dsName!=""&&[m('input',{oncreate:(vnode)=>{vnode.dom.focus();},type:"text",autocomplete:"off",placeholder:"A new table will be created",name:`${endPointType}[table]`,value:this.table,onchange:(e)=>{this.table=e.target.value;}}),m('pre.info.','Only DB table, DB query, or JSON tabular file as source are supported.\nOther cases are not yet implemented.'),m('input',{type:"hidden",name:`${endPointType}[isNewTable]`,value:"1"})])]),endPointType=="destination"&&m("tr",[m("th","Upsert"),m("td",[m("label",{title:"Rows matching an existing key are updated instead of inserted."},[m("input[type=checkbox]",{name:`${endPointType}[upsert]`,value:"1"})," update existing rows "]),m("input[type=text]",{name:`${endPointType}[keys]`,autocomplete:"off",placeholder:"key columns, primary key by default"})])]),]:null,endPointType=="origin"&&(this.type==="table"||this.type==="query")?m("tr",[m("th","Incremental"),m("td",{title:"Only rows beyond the last copy high-water mark are read. The mark is saved by copy name."},[m("input[type=text]",{name:`${endPointType}[watermark]`,autocomplete:"off",placeholder:"watermark column (timestamp or increasing id)"}),m("input[type=text]",{name:"name",autocomplete:"off",placeholder:"copy name"})])]):null,this.type==="query"?[m("tr",[m("th","SQL Query"),m("td",{style:"padding-right: 0"},m('textarea',{value:this.query,name:endPointType+"[query]",onchange:(e)=>{this.query=e.target.value}}))])]:null,]);}};}
+const QryForm={query:"",respData:null,results:[],resultIndex:0,exportType:"",resizeObserver:null,editor:null,editorTheme:"",xhr:null,queryId:null,executing:false,error:false,selectedFileName:"",session:null,reset:()=>{QryForm.closeSession()
+QryForm.query=""
 QryForm.respData=null
+QryForm.results=[]
 QryForm.currentPage=0
 QryExplainForm.reset()
 QryInfosSection.reset()},submitQuery:()=>{QryForm.respData=null
+QryForm.results=[]
 QryForm.currentPage=0
 QryForm.error=null
 QryForm.query=QryForm.editor.getCode().trim()
@@ -112,14 +118,37 @@ if(QueryPage.schema!==""){url="/api/query/:dsname/:schema"
 params.schema=QueryPage.schema}else{url="/api/query/:dsname"}
 const formData=new FormData()
 formData.set("query",QryForm.query)
+if(QryForm.session){formData.set("session",QryForm.session.id)}
+QryForm.queryId=newQueryId()
+formData.set("queryId",QryForm.queryId)
 QryForm.xhr=new AbortController()
 m.request({method:"POST",url,params,headers:App.getAuthHeaders(),body:formData,background:true,config:(xhr)=>{QryForm.xhr.signal.addEventListener('abort',()=>{xhr.abort()})}}).then((response)=>{QryForm.executing=false
 QryForm.xhr=null
+QryForm.queryId=null
 QryResultSection.currentPage=0
-QryForm.respData=response.data
-QryForm.respData.duration=Math.ceil(QryForm.respData.duration/1e+6)}).catch((e)=>{QryForm.executing=false
+QryForm.results=response.data
+QryForm.results.forEach((result)=>{result.duration=Math.ceil(result.duration/1e+6)})
+QryForm.selectResult(QryForm.results.findIndex((result)=>result.DBerror!==""))}).catch((e)=>{QryForm.executing=false
 QryForm.xhr=null
-QryForm.error=e.response.error;})},view:()=>{return[QueryPage.dsName.length&&[m("code[id=query-code]",{onclick:()=>{QryForm.editor.setFocusInitial()},oninit:(vnode)=>{var qryFormMenuHeight=58
+QryForm.queryId=null
+QryForm.error=e.response.error;if(e.code===404){QryForm.session=null}})},abortQuery:()=>{if(QryForm.queryId){m.request({method:"DELETE",url:"/api/queries/:id",params:{id:QryForm.queryId},headers:App.getAuthHeaders(),}).catch(()=>{})
+QryForm.queryId=null}
+QryForm.xhr.abort()
+QryForm.xhr=null
+QryForm.executing=false},beginTransaction:()=>{QryForm.error=null
+const formData=new FormData()
+formData.set("dsName",QueryPage.dsName)
+formData.set("schema",QueryPage.schema)
+m.request({method:"POST",url:"/api/sessions",headers:App.getAuthHeaders(),body:formData}).then((response)=>{return m.request({method:"POST",url:"/api/sessions/:id/begin",params:{id:response.data.id},headers:App.getAuthHeaders()}).catch((e)=>{QryForm.session=response.data
+QryForm.closeSession()
+throw e})}).then((response)=>{QryForm.session=response.data}).catch((e)=>{QryForm.error=e.response.error})},endTransaction:(action)=>{QryForm.error=null
+m.request({method:"POST",url:"/api/sessions/:id/"+action,params:{id:QryForm.session.id},headers:App.getAuthHeaders()}).then(()=>{QryForm.closeSession()}).catch((e)=>{QryForm.error=e.response.error
+if(e.code===404){QryForm.session=null}})},closeSession:()=>{if(!QryForm.session){return}
+m.request({method:"DELETE",url:"/api/sessions/:id",params:{id:QryForm.session.id},headers:App.getAuthHeaders()}).catch(()=>{})
+QryForm.session=null},selectResult:(index)=>{if(index<0||index>=QryForm.results.length){index=QryForm.results.length-1}
+QryResultSection.currentPage=0
+QryForm.resultIndex=index
+QryForm.respData=QryForm.results[index]||null},view:()=>{return[QueryPage.dsName.length&&[m("code[id=query-code]",{onclick:()=>{QryForm.editor.setFocusInitial()},oninit:(vnode)=>{var qryFormMenuHeight=58
 var datadictMgBtm=2
 QryForm.resizeObserver=new ResizeObserver(entries=>{vnode.dom.style.height=entries[0].contentRect.height-qryFormMenuHeight+'px'
 document.querySelector('section.area-q-datadict > :first-child').style.height=entries[0].contentRect.height-datadictMgBtm+'px'})},oncreate:(vnode)=>{const lastQuery=localStorage.getItem(["lastQuery",QueryPage.dsName].join("::"))||''
@@ -130,12 +159,11 @@ QryForm.editor.setFocusInitial()
 QryForm.resizeObserver.observe(document.querySelector('.area-query-editor'))},onbeforeupdate:()=>{if(QryForm.editorTheme!==App.theme){if(isLightTheme(App.theme))QryForm.editor.setLightTheme()
 else QryForm.editor.setDarkTheme()
 QryForm.editorTheme=App.theme}
-return false},onremove:()=>{QryForm.resizeObserver.disconnect()}}),m("div[id=qryFormMenu]",{style:"padding: 0 6px"},m("fieldset",m("legend","query execution"),m("button[type=button]",{disabled:QryForm.executing,onclick:()=>{QryExplainForm.submit()
-QueryPage.tabState.set("explain")}},"explain"),m("button[type=button].ml-10",{disabled:QryForm.executing,onclick:()=>{QryExplainForm.reset()
+return false},onremove:()=>{QryForm.resizeObserver.disconnect()}}),m("div[id=qryFormMenu]",{style:"padding: 0 6px"},m("fieldset",m("legend","query execution"),m("button[type=button]",{title:"Estimated plan, the query is not executed.",disabled:QryForm.executing,onclick:()=>{QryExplainForm.submit("estimated")
+QueryPage.tabState.set("explain")}},"explain"),m("button[type=button].ml-10",{title:"Actual plan, the query is executed in a transaction that is rolled back.",disabled:QryForm.executing,onclick:()=>{QryExplainForm.submit("actual")
+QueryPage.tabState.set("explain")}},"explain analyze"),m("button[type=button].ml-10",{disabled:QryForm.executing,onclick:()=>{QryExplainForm.reset()
 QryForm.submitQuery()
-QueryPage.tabState.set("result")}},"run query"),m("button[type=button]",{title:"Abort execution.",disabled:!QryForm.executing,onclick:()=>{QryForm.xhr.abort()
-QryForm.xhr=null
-QryForm.executing=false}},"■"),),m("fieldset",{style:"float: right"},m("legend",m.trust("&#8644 copy data")),m("button[type=button]",{title:"Navigate to the copy data panel with current settings.",disabled:QryForm.executing,onclick:()=>{App.dataTransferAction=true
+QueryPage.tabState.set("result")}},"run query"),m("button[type=button]",{title:"Abort execution.",disabled:!QryForm.executing,onclick:()=>QryForm.abortQuery()},"■"),),m("fieldset",m("legend","transaction"),!QryForm.session?m("button[type=button]",{title:"Run the next queries in a transaction, until commit or rollback.",disabled:QryForm.executing||!QueryPage.dsName,onclick:()=>QryForm.beginTransaction()},"begin"):[m("button[type=button]",{disabled:QryForm.executing,onclick:()=>QryForm.endTransaction("commit")},"commit"),m("button[type=button].ml-10",{disabled:QryForm.executing,onclick:()=>QryForm.endTransaction("rollback")},"rollback"),m("span.ml-10.text-warning",{title:"An idle transaction is rolled back after a timeout."},"transaction open")]),m("fieldset",{style:"float: right"},m("legend",m.trust("&#8644 copy data")),m("button[type=button]",{title:"Navigate to the copy data panel with current settings.",disabled:QryForm.executing,onclick:()=>{App.dataTransferAction=true
 App.pageState.set("copy")}},"set as source"),),),]]}}
 const DataDictForm={tables:new DictInput(),views:new DictInput(),procedures:new DictInput(),activity:new DictInput(),tabStates:{objects:new UIState(),tables:new UIState({def:"columns"}),views:new UIState({def:"columns"})},reset:()=>{DataDictForm.tables=new DictInput();DataDictForm.views=new DictInput();DataDictForm.procedures=new DictInput();DataDictForm.activity=new DictInput();DataDictForm.tabStates={objects:new UIState(),tables:new UIState({def:"columns"}),views:new UIState({def:"columns"})};},getCommandOptions(command,args){let url,params;params={dsName:QueryPage.dsName,command:command};if(QueryPage.schema!=="")
 params.schema=QueryPage.schema;url=QueryPage.schema?"/api/command/:dsName/:schema/:command":"/api/command/:dsName/:command"
@@ -149,10 +177,10 @@ m.request({method:"POST",url:"/api/auth/login",body:{username,password},}).then(
 usernmame=e.target.elements["username"].value
 password=e.target.elements["password"].value
 this.login(usernmame,password)}},[m("fieldset",{style:"background-color: var(--primary-bg);"},m("legend","login"),m("div",[m("label",{for:"username"},"username"),m("input[type=text]",{id:"username",required:1,oncreate:vnode=>vnode.dom.focus()})]),m("div",[m("label",{for:"password"},"password"),m("input[type=password]",{id:"password",required:1,autocomplete:"off",})]),m("button[type=submit].mt-15","login"),m("div.error",this.error),),])]);}};}
-const QueryPage={dsName:"",schema:"",tabState:new UIState({def:"result"}),SchemaInput:SchemaInput(),view:()=>{return[m("section.area-main-menu",m("div.grid",{style:"grid-template-columns: auto 1fr;"},m("div.grid-col",m("div",m(DataSourceInput,{value:QueryPage.dsName,onConnect:(dsName)=>{QueryPage.dsName=dsName;DSInfoSection.get();QueryPage.SchemaInput.getSchemas(QueryPage.dsName,QueryPage.schema);DataDictForm.getTables();DataDictForm.getViews();DataDictForm.getProcedures();},onChange:()=>{QueryPage.dsName="";QueryPage.schema="";QueryPage.SchemaInput.reset();DSInfoSection.reset();QryForm.reset();DataDictForm.reset();}})),m("div.ml-10",m(QueryPage.SchemaInput,{dsName:QueryPage.dsName,value:QueryPage.schema,onChange:(newSchema)=>{QueryPage.schema=newSchema;QryForm.reset();QryExplainForm.reset();DataDictForm.reset();DSInfoSection.get();DataDictForm.getTables();DataDictForm.getViews();DataDictForm.getProcedures();}})),m("div.grid-col.align-items-end.ml-10",m(DSInfoSection)),),),m("section.area-main-content",!QueryPage.dsName?null:[m("div.grid-query",{oncreate:function(vnode){var h0=document.querySelector('.grid-query').offsetHeight,h1=195,h2=335,h1=Math.max(h0-h2,h1);const LayoutGrid=GridResize('.grid-query','.area-query-splitter','.area-query-editor',`${h1}px 3px auto auto`,195,false);LayoutGrid.init();}},m("section.area-query-editor",m("div.grid-q-editor-datadict",{oncreate:function(vnode){const LayoutGrid=GridResize('.grid-q-editor-datadict','.area-q-splitter','.area-q-editor',`1fr 3px 1fr`,540,true);LayoutGrid.init();}},m("section.area-q-editor",m(QryForm)),m("div.area-q-splitter.splitter.splitter-vertical"),m("section.area-q-datadict",m(DataDictForm)),)),m("div.area-query-splitter.splitter.splitter-horizontal"),m("div",m("section.area-query-output-menu",m("div.grid",{style:"grid-template-columns: auto auto 1fr;"},m("div.grid-col.tab.tab-b",{class:QueryPage.tabState.selectedClass("result"),onclick:()=>QueryPage.tabState.set("result")},"result"),m("div.grid-col.tab.tab-b.ml-20",{class:QueryPage.tabState.selectedClass("explain"),onclick:()=>QueryPage.tabState.set("explain")},"explain"),m("div.grid-col.align-items-end.ml-50",m(QryInfosSection)),),),m("section.area-query-output",m("div",{class:QueryPage.tabState.displayClass("result")},m(QryResultSection)),m("div",{class:QueryPage.tabState.displayClass("explain")},m(QryExplainForm)),)))]))]}};function CopyDataPage(){return{origin:DataEndpointForm(),destination:DataEndpointForm(),getDestinationType:()=>{const sel=document.querySelector('select[name="destination[type]"]');return sel&&sel.value;},view:function(){const self=this;return m("form",{method:"POST",action:"/api/copy",target:"exportpage",enctype:"multipart/form-data",onsubmit:function(e){const popup=window.open('','exportpage','width=800,height=600');const message=self.getDestinationType()==="file"?"Preparing file. The download will start soon, please be patient...":"Copying data. A json report will be displayed when finished, please be patient..."
+const QueryPage={dsName:"",schema:"",tabState:new UIState({def:"result"}),SchemaInput:SchemaInput(),view:()=>{return[m("section.area-main-menu",m("div.grid",{style:"grid-template-columns: auto 1fr;"},m("div.grid-col",m("div",m(DataSourceInput,{value:QueryPage.dsName,onConnect:(dsName)=>{QueryPage.dsName=dsName;DSInfoSection.get();QueryPage.SchemaInput.getSchemas(QueryPage.dsName,QueryPage.schema);DataDictForm.getTables();DataDictForm.getViews();DataDictForm.getProcedures();},onChange:()=>{QueryPage.dsName="";QueryPage.schema="";QueryPage.SchemaInput.reset();DSInfoSection.reset();QryForm.reset();QryHistorySection.reset();QrySavedSection.reset();DataDictForm.reset();}})),m("div.ml-10",m(QueryPage.SchemaInput,{dsName:QueryPage.dsName,value:QueryPage.schema,onChange:(newSchema)=>{QueryPage.schema=newSchema;QryForm.reset();QryExplainForm.reset();DataDictForm.reset();DSInfoSection.get();DataDictForm.getTables();DataDictForm.getViews();DataDictForm.getProcedures();}})),m("div.grid-col.align-items-end.ml-10",m(DSInfoSection)),),),m("section.area-main-content",!QueryPage.dsName?null:[m("div.grid-query",{oncreate:function(vnode){var h0=document.querySelector('.grid-query').offsetHeight,h1=195,h2=335,h1=Math.max(h0-h2,h1);const LayoutGrid=GridResize('.grid-query','.area-query-splitter','.area-query-editor',`${h1}px 3px auto auto`,195,false);LayoutGrid.init();}},m("section.area-query-editor",m("div.grid-q-editor-datadict",{oncreate:function(vnode){const LayoutGrid=GridResize('.grid-q-editor-datadict','.area-q-splitter','.area-q-editor',`1fr 3px 1fr`,540,true);LayoutGrid.init();}},m("section.area-q-editor",m(QryForm)),m("div.area-q-splitter.splitter.splitter-vertical"),m("section.area-q-datadict",m(DataDictForm)),)),m("div.area-query-splitter.splitter.splitter-horizontal"),m("div",m("section.area-query-output-menu",m("div.grid",{style:"grid-template-columns: auto auto auto auto 1fr;"},m("div.grid-col.tab.tab-b",{class:QueryPage.tabState.selectedClass("result"),onclick:()=>QueryPage.tabState.set("result")},"result"),m("div.grid-col.tab.tab-b.ml-20",{class:QueryPage.tabState.selectedClass("explain"),onclick:()=>QueryPage.tabState.set("explain")},"explain"),m("div.grid-col.tab.tab-b.ml-20",{class:QueryPage.tabState.selectedClass("history"),onclick:()=>{QueryPage.tabState.set("history");QryHistorySection.get();}},"history"),m("div.grid-col.tab.tab-b.ml-20",{class:QueryPage.tabState.selectedClass("saved"),onclick:()=>{QueryPage.tabState.set("saved");QrySavedSection.get();}},"saved"),m("div.grid-col.align-items-end.ml-50",m(QryInfosSection)),),),m("section.area-query-output",m("div",{class:QueryPage.tabState.displayClass("result")},m(QryResultSection)),m("div",{class:QueryPage.tabState.displayClass("explain")},m(QryExplainForm)),m("div",{class:QueryPage.tabState.displayClass("history")},m(QryHistorySection)),m("div",{class:QueryPage.tabState.displayClass("saved")},m(QrySavedSection)),)))]))]}};function CopyDataPage(){return{origin:DataEndpointForm(),destination:DataEndpointForm(),getDestinationType:()=>{const sel=document.querySelector('select[name="destination[type]"]');return sel&&sel.value;},view:function(){const self=this;return m("form",{method:"POST",action:"/api/copy",target:"exportpage",enctype:"multipart/form-data",onsubmit:function(e){const popup=window.open('','exportpage','width=800,height=600');const message=self.getDestinationType()==="file"?"Preparing file. The download will start soon, please be patient...":"Copying data. A json report will be displayed when finished, please be patient..."
 if(popup){popup.document.write(`<html><head><style>body { color: #222; background: #fff; }@media (prefers-color-scheme: dark) {body { color: #eee; background: #222; }}</style></head><body><div>${message}</div><button onclick="window.close()">Close</button></body></html>`);popup.document.close();}
 e.target.setAttribute('target','exportpage');return true;}},[m("input[type=hidden][name=jwt]",{value:localStorage.getItem(JWT_KEY)}),m("fieldset.mb-20.w-600.h-130",{style:"display: block"},m("legend","Source (copy from)"),m(this.origin,{endPointType:"origin"})),m("fieldset.mb-20.w-600.h-130",{style:"display: block"},m("legend","Destination (copy to)"),m(this.destination,{endPointType:"destination"})),m("div.mb-20",m("button[type=submit]",{title:"copy data from origin to destination",disabled:this.executing},this.getDestinationType()==="file"?"download":"copy data")),this.getDestinationType()==="table"&&[m("strong","ℹ️ Transaction Safety"),m("pre",{style:"margin: 5px 0 0 0; font-size: 14px;"},"This copy operation uses a database transaction.\n If any error occurs during the process, "+"all changes will be automatically rolled back, leaving your destination table unchanged.\n "+"The copy will either complete successfully with all data, or fail completely with no partial data.")]]);}};}
-function DatasourcesPage(){return{registeredDSs:[],notRegisteredDSs:[],users:[],vendors:[],usernameInput:"",vendorInput:"",locationInput:"",postUserDatasourcesError:"",postUsersError:"",addDSError:"",testDataSourceResult:"",getUsersDatasources:function(username){m.request({method:"GET",url:"/api/users/:username/data-sources",params:{username},headers:App.getAuthHeaders(),}).then((response)=>{this.registeredDSs=response.data||[];});},getUsersAvailableDatasources:function(username){m.request({method:"GET",url:"/api/users/:username/available-data-sources",params:{username},headers:App.getAuthHeaders(),}).then((response)=>{this.notRegisteredDSs=response.data||[];});},getUsers:function(){m.request({method:"GET",url:"/api/users",headers:App.getAuthHeaders(),}).then((response)=>{this.users=response.data||[];});},getVendors:function(){m.request({method:"GET",url:"/api/vendors",headers:App.getAuthHeaders(),}).then((response)=>{this.vendors=response.data||[];});},postDatasources:function(name,vendor,location){this.addDSError="";return m.request({method:"POST",url:"/api/data-sources",headers:App.getAuthHeaders(),body:{name,vendor,location}}).then(()=>{this.getUsersAvailableDatasources(this.usernameInput);}).catch((e)=>{this.addDSError=e.response.error;throw e;});},postUserDatasources:function(username,dsname){this.postUserDatasourcesError="";return m.request({method:"POST",url:"/api/users/:username/data-sources/:dsname",headers:App.getAuthHeaders(),params:{username,dsname}}).then((response)=>{this.getUsersDatasources(this.usernameInput);this.getUsersAvailableDatasources(this.usernameInput);}).catch((e)=>{this.postUserDatasourcesError=e.response.error;throw e;});},deleteUserDatasources:function(username,dsname){this.postUserDatasourcesError="";return m.request({method:"DELETE",url:"/api/users/:username/data-sources/:dsname",headers:App.getAuthHeaders(),params:{username,dsname}}).then(()=>{this.getUsersDatasources(this.usernameInput);this.getUsersAvailableDatasources(this.usernameInput);}).catch((e)=>{this.postUserDatasourcesError=e.response.error;throw e;});},postUsers:function(username,isadmin,password){this.postUsersError="";return m.request({method:"POST",url:"/api/users",headers:App.getAuthHeaders(),body:{username,isadmin,password}}).then(()=>{this.getUsers();}).catch((e)=>{this.postUsersError=e.response.error;throw e;});},testDataSource:function(vendor,location){return m.request({method:"POST",url:"/api/data-sources/test",headers:App.getAuthHeaders(),body:{vendor,location}}).then((resp)=>{this.testDataSourceResult=resp.error?resp.error:"connection test succeeded.";}).catch((e)=>{this.testDataSourceResult=e.response.error;throw e;});},oninit:function(){this.usernameInput=App.getUsername();this.postUserDatasourcesError="";this.postUsersError="";this.addDSError="";this.testDataSourceResult="";this.getUsers();this.getVendors();this.getUsersDatasources(this.usernameInput);this.getUsersAvailableDatasources(this.usernameInput);},view:function(){return[m("form.mt-20",{autocomplete:"off",onchange:()=>{this.postUsersError="";},onsubmit:(e)=>{e.preventDefault();const username=e.target.elements["username"].value;const dsname=e.target.elements["dsname"].value;this.postUserDatasources(username,dsname).then(()=>{e.target.reset();});}},m("fieldset",m("legend","allowed data sources"),m("label",m("span","user: "),m(SelectInput,{name:"username",required:1,options:toSelectOptions(this.users,false,"name","name"),value:this.usernameInput,onchange:(e)=>{this.usernameInput=e.target.value;this.getUsersDatasources(this.usernameInput);this.getUsersAvailableDatasources(this.usernameInput);}})),m("table.mt-10",{style:"min-width: 500px"},m("thead",m("tr",[m("th","vendor"),m("th","name"),m("th","location"),m("th","action"),])),m("tbody",this.registeredDSs.length===0?m("tr",m("td[colspan=4]","No data sources found.")):this.registeredDSs.map(row=>m("tr",[m(Cell,{val:row.vendor,type:"string"}),m(Cell,{val:row.name,type:"string"}),m(Cell,{val:row.location,type:"string"}),m("td.tar",m("button[type=button]",{title:"remove",onclick:(e)=>{this.deleteUserDatasources(this.usernameInput,row.name);}},m.trust("&#10006;")))])))),m("div.mt-20",m("label",m("span",["allow ",m("b.fake-input",this.usernameInput)," to access: "]),m(SelectInput,{name:"dsname",required:1,options:toSelectOptions(this.notRegisteredDSs,"","name","name","vendor")}),),m("button[type=submit]","submit"),m("div",this.postUserDatasourcesError)),),),App.getIsAdmin()&&m("form.mt-30",{autocomplete:"off",onchange:()=>{this.addDSError="";this.testDataSourceResult="";},onsubmit:(e)=>{e.preventDefault();const name=e.target.elements["name"].value;const vendor=e.target.elements["vendor"].value;const location=e.target.elements["location"].value;this.postDatasources(name,vendor,location).then(()=>{e.target.reset();})}},m("fieldset",m("legend","add a new data source"),m("table",{style:"min-width: 500px"},m("tr",m("td",{title:"the label of the data source",},"name:"),m("td",m("input",{name:"name",required:1,pattern:"^[a-zA-Z0-9_\\-]{1,30}$",}))),m("tr",m("td","DB vendor:"),m("td",m(SelectInput,{name:"vendor",required:1,options:toSelectOptions(this.vendors,"","name","name"),value:this.vendorInput,onchange:(e)=>{this.vendorInput=e.target.value;}}))),m("tr",m("td",{title:"the driver-specific data source name, usually consisting of at least a database name and connection information",},"location:"),m("td",m("input",{name:"location",required:1,value:this.locationInput,oninput:(e)=>{this.locationInput=e.target.value;}}))),m("tr",m("td"),m("td",m("button[type=submit].mr-20","add"),m("button[type=button].mr-10",{disabled:!this.vendorInput||!this.locationInput,onclick:()=>{this.testDataSource(this.vendorInput,this.locationInput)}},"test"),))),m("pre",this.testDataSourceResult),m("span.error",this.addDSError))),App.getIsAdmin()&&m("form.mt-30",{autocomplete:"off",onchange:()=>{this.postUsersError="";},onsubmit:(e)=>{e.preventDefault();const username=e.target.elements["name"].value;const isadmin=e.target.elements["isadmin"].value;const password=e.target.elements["password"].value;this.postUsers(username,isadmin,password).then(()=>{e.target.reset();});}},m("fieldset",m("legend","add a new user"),m("table",m("tr",m("td","name:"),m("td",m("input",{name:"name",required:1,pattern:"^[a-zA-Z0-9_\\-]{1,20}$",}))),m("tr",m("td","admin:"),m("td",m(SelectInput,{name:"isadmin",required:1,options:[{label:"",value:""},{label:"no",value:"0"},{label:"yes",value:"1"}]}))),m("tr",m("td","password:"),m("td",m("input[type=password]",{name:"password",autocomplete:"off",required:1,}))),m("tr",m("td"),m("td",m("button[type=submit]","add")))),m("span.error",this.postUsersError),)),]}}}
+function DatasourcesPage(){return{registeredDSs:[],notRegisteredDSs:[],users:[],vendors:[],permissions:["read-only","read-write","ddl","admin"],usernameInput:"",vendorInput:"",locationInput:"",postUserDatasourcesError:"",postUsersError:"",addDSError:"",testDataSourceResult:"",getUsersDatasources:function(username){m.request({method:"GET",url:"/api/users/:username/data-sources",params:{username},headers:App.getAuthHeaders(),}).then((response)=>{this.registeredDSs=response.data||[];});},getUsersAvailableDatasources:function(username){m.request({method:"GET",url:"/api/users/:username/available-data-sources",params:{username},headers:App.getAuthHeaders(),}).then((response)=>{this.notRegisteredDSs=response.data||[];});},getUsers:function(){m.request({method:"GET",url:"/api/users",headers:App.getAuthHeaders(),}).then((response)=>{this.users=response.data||[];});},getVendors:function(){m.request({method:"GET",url:"/api/vendors",headers:App.getAuthHeaders(),}).then((response)=>{this.vendors=response.data||[];});},postDatasources:function(name,vendor,location){this.addDSError="";return m.request({method:"POST",url:"/api/data-sources",headers:App.getAuthHeaders(),body:{name,vendor,location}}).then(()=>{this.getUsersAvailableDatasources(this.usernameInput);}).catch((e)=>{this.addDSError=e.response.error;throw e;});},postUserDatasources:function(username,dsname,permission){this.postUserDatasourcesError="";return m.request({method:"POST",url:"/api/users/:username/data-sources/:dsname",headers:App.getAuthHeaders(),params:{username,dsname,permission}}).then((response)=>{this.getUsersDatasources(this.usernameInput);this.getUsersAvailableDatasources(this.usernameInput);}).catch((e)=>{this.postUserDatasourcesError=e.response.error;throw e;});},deleteUserDatasources:function(username,dsname){this.postUserDatasourcesError="";return m.request({method:"DELETE",url:"/api/users/:username/data-sources/:dsname",headers:App.getAuthHeaders(),params:{username,dsname}}).then(()=>{this.getUsersDatasources(this.usernameInput);this.getUsersAvailableDatasources(this.usernameInput);}).catch((e)=>{this.postUserDatasourcesError=e.response.error;throw e;});},postUsers:function(username,isadmin,password){this.postUsersError="";return m.request({method:"POST",url:"/api/users",headers:App.getAuthHeaders(),body:{username,isadmin,password}}).then(()=>{this.getUsers();}).catch((e)=>{this.postUsersError=e.response.error;throw e;});},testDataSource:function(vendor,location){return m.request({method:"POST",url:"/api/data-sources/test",headers:App.getAuthHeaders(),body:{vendor,location}}).then((resp)=>{this.testDataSourceResult=resp.error?resp.error:"connection test succeeded.";}).catch((e)=>{this.testDataSourceResult=e.response.error;throw e;});},oninit:function(){this.usernameInput=App.getUsername();this.postUserDatasourcesError="";this.postUsersError="";this.addDSError="";this.testDataSourceResult="";this.getUsers();this.getVendors();this.getUsersDatasources(this.usernameInput);this.getUsersAvailableDatasources(this.usernameInput);},view:function(){return[m("form.mt-20",{autocomplete:"off",onchange:()=>{this.postUsersError="";},onsubmit:(e)=>{e.preventDefault();const username=e.target.elements["username"].value;const dsname=e.target.elements["dsname"].value;const permission=e.target.elements["permission"].value;this.postUserDatasources(username,dsname,permission).then(()=>{e.target.reset();});}},m("fieldset",m("legend","allowed data sources"),m("label",m("span","user: "),m(SelectInput,{name:"username",required:1,options:toSelectOptions(this.users,false,"name","name"),value:this.usernameInput,onchange:(e)=>{this.usernameInput=e.target.value;this.getUsersDatasources(this.usernameInput);this.getUsersAvailableDatasources(this.usernameInput);}})),m("table.mt-10",{style:"min-width: 500px"},m("thead",m("tr",[m("th","vendor"),m("th","name"),m("th","location"),m("th","permission"),m("th","action"),])),m("tbody",this.registeredDSs.length===0?m("tr",m("td[colspan=5]","No data sources found.")):this.registeredDSs.map(row=>m("tr",[m(Cell,{val:row.vendor,type:"string"}),m(Cell,{val:row.name,type:"string"}),m(Cell,{val:row.location,type:"string"}),m("td",m("select",{disabled:!App.getIsAdmin(),onchange:(e)=>{this.postUserDatasources(this.usernameInput,row.name,e.target.value);}},this.permissions.map(p=>m("option",{value:p,selected:p===row.permission},p)))),m("td.tar",m("button[type=button]",{title:"remove",onclick:(e)=>{this.deleteUserDatasources(this.usernameInput,row.name);}},m.trust("&#10006;")))])))),m("div.mt-20",m("label",m("span",["allow ",m("b.fake-input",this.usernameInput)," to access: "]),m(SelectInput,{name:"dsname",required:1,options:toSelectOptions(this.notRegisteredDSs,"","name","name","vendor")}),),m("label.ml-10",m("span","permission: "),m("select[name=permission]",this.permissions.map(p=>m("option",{value:p},p)))),m("button[type=submit]","submit"),m("div",this.postUserDatasourcesError)),),),App.getIsAdmin()&&m("form.mt-30",{autocomplete:"off",onchange:()=>{this.addDSError="";this.testDataSourceResult="";},onsubmit:(e)=>{e.preventDefault();const name=e.target.elements["name"].value;const vendor=e.target.elements["vendor"].value;const location=e.target.elements["location"].value;this.postDatasources(name,vendor,location).then(()=>{e.target.reset();})}},m("fieldset",m("legend","add a new data source"),m("table",{style:"min-width: 500px"},m("tr",m("td",{title:"the label of the data source",},"name:"),m("td",m("input",{name:"name",required:1,pattern:"^[a-zA-Z0-9_\\-]{1,30}$",}))),m("tr",m("td","DB vendor:"),m("td",m(SelectInput,{name:"vendor",required:1,options:toSelectOptions(this.vendors,"","name","name"),value:this.vendorInput,onchange:(e)=>{this.vendorInput=e.target.value;}}))),m("tr",m("td",{title:"the driver-specific data source name, usually consisting of at least a database name and connection information",},"location:"),m("td",m("input",{name:"location",required:1,value:this.locationInput,oninput:(e)=>{this.locationInput=e.target.value;}}))),m("tr",m("td"),m("td",m("button[type=submit].mr-20","add"),m("button[type=button].mr-10",{disabled:!this.vendorInput||!this.locationInput,onclick:()=>{this.testDataSource(this.vendorInput,this.locationInput)}},"test"),))),m("pre",this.testDataSourceResult),m("span.error",this.addDSError))),App.getIsAdmin()&&m("form.mt-30",{autocomplete:"off",onchange:()=>{this.postUsersError="";},onsubmit:(e)=>{e.preventDefault();const username=e.target.elements["name"].value;const isadmin=e.target.elements["isadmin"].value;const password=e.target.elements["password"].value;this.postUsers(username,isadmin,password).then(()=>{e.target.reset();});}},m("fieldset",m("legend","add a new user"),m("table",m("tr",m("td","name:"),m("td",m("input",{name:"name",required:1,pattern:"^[a-zA-Z0-9_\\-]{1,20}$",}))),m("tr",m("td","admin:"),m("td",m(SelectInput,{name:"isadmin",required:1,options:[{label:"",value:""},{label:"no",value:"0"},{label:"yes",value:"1"}]}))),m("tr",m("td","password:"),m("td",m("input[type=password]",{name:"password",autocomplete:"off",required:1,}))),m("tr",m("td"),m("td",m("button[type=submit]","add")))),m("span.error",this.postUsersError),)),]}}}
 const JWT_KEY="jwt";const App={theme:"",dataTransferAction:false,claims:{},noServerResponse:false,isLogged:()=>{const jwt=localStorage.getItem(JWT_KEY);if(jwt===null)
 return false
 App.claims=parseJwt(jwt);if(App.claims.exp&&Date.now()/1000>App.claims.exp){localStorage.removeItem(JWT_KEY);return false}